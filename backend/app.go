@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"livechat-system/backend/attachment"
+	"livechat-system/backend/blob"
+	"livechat-system/backend/config"
+	"livechat-system/backend/logging"
+	"livechat-system/backend/metrics"
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/ratelimit"
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+	websocket "livechat-system/backend/websocket"
+)
+
+// app holds what the HTTP handlers share. The handlers are its methods, so a test can build
+// one around any store.
+type app struct {
+	cfg          config.Config
+	store        storage.Store
+	forumService *service.ForumService
+	wsServer     *websocket.WebSocketServer
+	limiter      *httpRateLimiter
+	secretKey    string // Signing key for JWT tokens
+}
+
+// newApp builds the forum service and the WebSocket hub on store and blobs, as configured by cfg.
+// It neither joins the cluster nor starts anything.
+func newApp(cfg config.Config, store storage.Store, blobs blob.Store) *app {
+	secretKey := cfg.Auth.SecretKey
+	if secretKey == "" {
+		slog.Warn("No secret key configured, generating one: tokens will not survive a restart")
+		secretKey = generateSecretKey()
+	}
+
+	forumService := service.NewForumService(store)
+	forumService.MaxCommentDepth = cfg.Forum.MaxCommentDepth
+	forumService.Blobs = blobs
+	forumService.UploadLimits = attachment.Limits{
+		MaxSize:       cfg.Attachments.MaxSize,
+		MaxDimension:  cfg.Attachments.MaxDimension,
+		ThumbnailSize: cfg.Attachments.ThumbnailSize,
+	}
+	forumService.MaxAttachments = cfg.Attachments.MaxPerItem
+
+	wsServer := websocket.NewWebSocketServer(forumService, secretKey)
+	wsServer.EditWindow = cfg.Chat.EditWindow.Duration
+	wsServer.EventLogSize = cfg.Chat.EventLogSize
+	wsServer.SessionTTL = cfg.Chat.SessionTTL.Duration
+	wsServer.CheckOrigin = func(r *http.Request) bool {
+		// Non-browser clients send no Origin header
+		origin := r.Header.Get("Origin")
+		return origin == "" || cfg.Server.AllowsOrigin(origin)
+	}
+	if cfg.RateLimit.Enabled {
+		wsServer.RateLimits = ratelimit.NewGroup(ratePolicies(cfg.RateLimit.WebSocket))
+		wsServer.Offenders = ratelimit.NewOffenders(cfg.RateLimit.OffenderThreshold, cfg.RateLimit.OffenderWindow.Duration)
+	}
+
+	return &app{
+		cfg:          cfg,
+		store:        store,
+		forumService: forumService,
+		wsServer:     wsServer,
+		limiter:      newHTTPRateLimiter(cfg.RateLimit),
+		secretKey:    secretKey,
+	}
+}
+
+// routes returns a mux serving the API. main adds the admin and health endpoints to it.
+func (a *app) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	limiter := a.limiter
+
+	// Authenticated routes are limited per user, the others per client IP
+	mux.HandleFunc("/users", limiter.limit("/users", a.Users))
+	mux.HandleFunc("/login", limiter.limit("/login", a.Login))
+	mux.HandleFunc("/register", limiter.limit("/register", a.Register))
+	mux.HandleFunc("/newpost", a.jwtMiddleware(limiter.limit("/newpost", a.NewPost)))
+	mux.HandleFunc("/posts", a.jwtMiddleware(limiter.limit("/posts", a.Posts)))
+	mux.HandleFunc("/post", a.jwtMiddleware(limiter.limit("/post", a.postHandler)))
+	mux.HandleFunc("/comments", a.jwtMiddleware(limiter.limit("/comments", a.commentsHandler)))
+	mux.HandleFunc("/post/revisions", a.jwtMiddleware(limiter.limit("/post/revisions", a.postRevisionsHandler)))
+	mux.HandleFunc("/poll", a.jwtMiddleware(limiter.limit("/poll", a.pollHandler)))
+	mux.HandleFunc("/ws", limiter.limit("/ws", a.wsServer.HandleConnections))
+	// Fallbacks for clients behind proxies that block WebSocket upgrades
+	mux.HandleFunc("/events", limiter.limit("/events", a.wsServer.HandleEvents))
+	mux.HandleFunc("/events/send", limiter.limit("/events/send", a.wsServer.HandleSend))
+	mux.HandleFunc("/events/poll", limiter.limit("/events/poll", a.wsServer.HandlePoll))
+	mux.HandleFunc("/chat-history", a.jwtMiddleware(limiter.limit("/chat-history", a.chatHistoryHandler)))
+	mux.HandleFunc("/blocks", a.jwtMiddleware(limiter.limit("/blocks", a.userRelationsHandler(realtimeforum.RelationBlock))))
+	mux.HandleFunc("/mutes", a.jwtMiddleware(limiter.limit("/mutes", a.userRelationsHandler(realtimeforum.RelationMute))))
+	mux.HandleFunc("/bookmarks", a.jwtMiddleware(limiter.limit("/bookmarks", a.bookmarksHandler)))
+	mux.HandleFunc("/watches", a.jwtMiddleware(limiter.limit("/watches", a.watchesHandler)))
+	mux.HandleFunc("/notifications", a.jwtMiddleware(limiter.limit("/notifications", a.notificationsHandler)))
+	mux.HandleFunc("/notifications/read", a.jwtMiddleware(limiter.limit("/notifications/read", a.notificationsReadHandler)))
+	mux.HandleFunc("/search", a.jwtMiddleware(limiter.limit("/search", a.searchHandler)))
+	mux.HandleFunc("/attachments", a.jwtMiddleware(limiter.limit("/attachments", a.uploadAttachmentHandler)))
+	mux.HandleFunc("/attachment", a.jwtMiddleware(limiter.limit("/attachment", a.attachmentHandler)))
+	return mux
+}
+
+// handler wraps mux with CORS, the HTTP metrics and request IDs.
+func (a *app) handler(mux *http.ServeMux, httpMetrics *metrics.HTTPMetrics) http.Handler {
+	serverConfig := a.cfg.Server
+
+	// CORS configuration
+	allowedHeaders := "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization,X-CSRF-Token"
+	allowedMethods := "GET, POST, PUT, DELETE, OPTIONS"
+
+	// CORS middleware
+	corsHandler := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if origin := r.Header.Get("Origin"); origin != "" && serverConfig.AllowsOrigin(origin) {
+				if serverConfig.AllowsOrigin("*") {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+			}
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			if r.Method == "OPTIONS" {
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	return logging.RequestID(httpMetrics.Middleware(mux, corsHandler(mux)))
+}
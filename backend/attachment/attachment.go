@@ -0,0 +1,194 @@
+// Package attachment checks the files users attach to posts and chat messages, and prepares them
+// to be stored. Process accepts JPEG, PNG and GIF images, PDF documents and UTF-8 text files,
+// recognized by their content rather than their name or the type the client declares:
+//
+//	file, err := attachment.Process(data, attachment.DefaultLimits())
+//
+// Images are limited in size, so decoding them cannot take too much memory, and come with a
+// thumbnail. JPEG and PNG images are decoded and encoded again, which drops their metadata: EXIF
+// in particular can hold the location a photo was taken at. The EXIF orientation is applied
+// first, so photos keep the way up they were taken with. GIF images, which have no EXIF, are
+// kept as uploaded so animations survive.
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // Registered for image.DecodeConfig and image.Decode
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Default limits, used unless configured otherwise.
+const (
+	DefaultMaxSize       = 10 << 20 // 10 MiB
+	DefaultMaxDimension  = 4096
+	DefaultThumbnailSize = 256
+)
+
+// Content types of the files Process accepts.
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeGIF  = "image/gif"
+	TypePDF  = "application/pdf"
+	TypeText = "text/plain; charset=utf-8"
+)
+
+// jpegQuality is the quality JPEG images are encoded again with. Thumbnails are small enough to
+// use a lower one.
+const (
+	jpegQuality          = 90
+	jpegThumbnailQuality = 80
+)
+
+// Errors returned by Process for files that cannot be attached.
+var (
+	ErrEmpty           = errors.New("the file is empty")
+	ErrTooLarge        = errors.New("the file is too large")
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images, PDF documents and UTF-8 text files can be attached")
+	ErrInvalidImage    = errors.New("the image cannot be read")
+	ErrImageTooLarge   = errors.New("the image is too large")
+)
+
+// Limits bound the files Process accepts.
+type Limits struct {
+	MaxSize       int64 // Largest file, in bytes
+	MaxDimension  int   // Widest and tallest image, in pixels
+	ThumbnailSize int   // Thumbnails fit in a square this many pixels wide
+}
+
+// DefaultLimits returns the limits used unless configured otherwise.
+func DefaultLimits() Limits {
+	return Limits{MaxSize: DefaultMaxSize, MaxDimension: DefaultMaxDimension, ThumbnailSize: DefaultThumbnailSize}
+}
+
+// File is an uploaded file ready to be stored.
+type File struct {
+	ContentType   string
+	Data          []byte // The content to store, without metadata for JPEG and PNG images
+	Width, Height int    // Dimensions of images, after applying their orientation
+	Thumbnail     []byte // Thumbnail of images; nil for other files
+}
+
+// IsImage reports whether files of contentType are images, shown inline with a thumbnail.
+func IsImage(contentType string) bool {
+	return contentType == TypeJPEG || contentType == TypePNG || contentType == TypeGIF
+}
+
+// ThumbnailType returns the content type of the thumbnails of images of contentType: JPEG for
+// photos, PNG for the others, which may be transparent.
+func ThumbnailType(contentType string) string {
+	if contentType == TypeJPEG {
+		return TypeJPEG
+	}
+	return TypePNG
+}
+
+// Process checks an uploaded file against limits and returns it ready to be stored.
+func Process(data []byte, limits Limits) (File, error) {
+	if len(data) == 0 {
+		return File{}, ErrEmpty
+	}
+	if int64(len(data)) > limits.MaxSize {
+		return File{}, ErrTooLarge
+	}
+
+	contentType, err := detectType(data)
+	if err != nil {
+		return File{}, err
+	}
+	if !IsImage(contentType) {
+		return File{ContentType: contentType, Data: data}, nil
+	}
+	return processImage(data, contentType, limits)
+}
+
+// detectType recognizes the type of a file from its first bytes, the way browsers do.
+func detectType(data []byte) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "", ErrUnsupportedType
+	}
+	switch mediaType {
+	case TypeJPEG, TypePNG, TypeGIF, TypePDF:
+		return mediaType, nil
+	case "text/plain":
+		if params["charset"] == "utf-8" && utf8.Valid(data) {
+			return TypeText, nil
+		}
+	}
+	return "", ErrUnsupportedType
+}
+
+func processImage(data []byte, contentType string, limits Limits) (File, error) {
+	// The header gives the dimensions without decoding the pixels, which could take gigabytes
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return File{}, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return File{}, ErrInvalidImage
+	}
+	if config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return File{}, ErrImageTooLarge
+	}
+
+	// Only the first frame of a GIF is decoded, for its thumbnail
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return File{}, ErrInvalidImage
+	}
+
+	file := File{ContentType: contentType}
+	var encoded bytes.Buffer
+	switch contentType {
+	case TypeJPEG:
+		img = orient(img, exifOrientation(data))
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: jpegQuality})
+		file.Data = encoded.Bytes()
+	case TypePNG:
+		err = png.Encode(&encoded, img)
+		file.Data = encoded.Bytes()
+	case TypeGIF:
+		file.Data = data
+	}
+	if err != nil {
+		return File{}, err
+	}
+	bounds := img.Bounds()
+	file.Width, file.Height = bounds.Dx(), bounds.Dy()
+
+	if file.Thumbnail, err = thumbnail(img, contentType, limits.ThumbnailSize); err != nil {
+		return File{}, err
+	}
+	return file, nil
+}
+
+// thumbnail returns img scaled down to fit in a square size pixels wide, encoded as
+// ThumbnailType(contentType). Smaller images are not scaled up.
+func thumbnail(img image.Image, contentType string, size int) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+	scaled := scale(img, width, height)
+
+	var encoded bytes.Buffer
+	var err error
+	if ThumbnailType(contentType) == TypeJPEG {
+		err = jpeg.Encode(&encoded, scaled, &jpeg.Options{Quality: jpegThumbnailQuality})
+	} else {
+		err = png.Encode(&encoded, scaled)
+	}
+	return encoded.Bytes(), err
+}
@@ -0,0 +1,137 @@
+package attachment
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// exifOrientationTag is the EXIF tag saying how a photo must be turned to be seen the right way up.
+const exifOrientationTag = 0x0112
+
+// exifOrientation returns the EXIF orientation of a JPEG image, from 1 to 8, or 1 when it has none.
+func exifOrientation(data []byte) int {
+	// The segments before the image data: a marker, then a big-endian length that counts itself
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) { // Start of the image data
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation in the first directory of the TIFF structure of EXIF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orient turns img the way its EXIF orientation says, so it no longer needs one.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 { // Turned by a quarter, so width and height swap
+		dstWidth, dstHeight = height, width
+	}
+
+	// Where each pixel of the result comes from
+	source := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return width - 1 - x, y },              // Mirrored
+		3: func(x, y int) (int, int) { return width - 1 - x, height - 1 - y }, // Upside down
+		4: func(x, y int) (int, int) { return x, height - 1 - y },             // Mirrored upside down
+		5: func(x, y int) (int, int) { return y, x },                          // Mirrored along the diagonal
+		6: func(x, y int) (int, int) { return y, height - 1 - x },             // Turned a quarter clockwise
+		7: func(x, y int) (int, int) { return width - 1 - y, height - 1 - x }, // Mirrored along the other diagonal
+		8: func(x, y int) (int, int) { return width - 1 - y, x },              // Turned a quarter counterclockwise
+	}[orientation]
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			sx, sy := source(x, y)
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// scale resizes img to width by height pixels, averaging the pixels each pixel of the result
+// covers, which keeps detail when scaling down a lot.
+func scale(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	srcWidth, srcHeight := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			count := (x1 - x0) * (y1 - y0)
+			pixel := dst.Pix[dst.PixOffset(x, y):]
+			for c := 0; c < 4; c++ {
+				pixel[c] = uint8(sum[c] / count)
+			}
+		}
+	}
+	return dst
+}
+
+// toRGBA returns img as an RGBA image whose bounds start at the origin. The premultiplied alpha
+// of RGBA keeps averages of transparent pixels right.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"livechat-system/backend/attachment"
+	"livechat-system/backend/logging"
+	"livechat-system/backend/storage"
+)
+
+// multipartOverhead is what a multipart upload may add to the size of its file: the boundaries and
+// part headers.
+const multipartOverhead = 64 << 10
+
+// uploadAttachmentHandler serves POST /attachments for the authenticated user: a multipart form
+// whose "file" part is stored as a new upload. The response describes it; its attachment_id is
+// then listed in the attachment_ids of a post or the attachmentIds of a chat message.
+func (a *app) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := currentUserID(r)
+	maxSize := a.forumService.UploadLimits.MaxSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+
+	parts, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart form", http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := parts.NextPart()
+		var tooLarge *http.MaxBytesError
+		switch {
+		case err == io.EOF:
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		case errors.As(err, &tooLarge):
+			writeAttachmentError(w, r, err)
+			return
+		case err != nil:
+			http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		// One byte more than allowed is enough to know the file is too large
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if err != nil {
+			writeAttachmentError(w, r, err)
+			return
+		}
+		upload, err := a.forumService.UploadAttachment(r.Context(), userID, part.FileName(), data)
+		if err != nil {
+			writeAttachmentError(w, r, err)
+			return
+		}
+		logging.FromContext(r.Context()).Info("Attachment uploaded", "user_id", userID,
+			"attachment_id", upload.AttachmentID, "content_type", upload.ContentType, "size", upload.Size)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(upload)
+		return
+	}
+}
+
+// attachmentHandler serves GET /attachment?attachmentId=1 for the authenticated user, and with
+// &size=thumbnail the thumbnail of an image. Images are shown inline, other files downloaded.
+// The content of an attachment never changes, so it may be cached for good, by the user's
+// browser only.
+func (a *app) attachmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	attachmentID, err := strconv.ParseInt(r.URL.Query().Get("attachmentId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+	thumbnail := false
+	switch size := r.URL.Query().Get("size"); size {
+	case "":
+	case "thumbnail":
+		thumbnail = true
+	default:
+		http.Error(w, "size must be thumbnail", http.StatusBadRequest)
+		return
+	}
+
+	file, content, err := a.forumService.OpenAttachment(r.Context(), currentUserID(r), attachmentID, thumbnail)
+	if err != nil {
+		writeAttachmentError(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	contentType, key, disposition := file.ContentType, file.BlobKey, "attachment"
+	if thumbnail {
+		contentType, key = attachment.ThumbnailType(file.ContentType), file.ThumbnailKey
+	}
+	if attachment.IsImage(file.ContentType) {
+		disposition = "inline"
+	}
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Filename}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	header.Set("Cache-Control", "private, max-age=31536000, immutable")
+	header.Set("Vary", "Authorization")
+	header.Set("ETag", `"`+key+`"`)
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
+
+func writeAttachmentError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+	case errors.Is(err, attachment.ErrTooLarge), errors.As(err, &tooLarge):
+		http.Error(w, attachment.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, attachment.ErrEmpty), errors.Is(err, attachment.ErrInvalidImage), errors.Is(err, attachment.ErrImageTooLarge):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.FromContext(r.Context()).Error("Failed to serve attachment", "err", err)
+		http.Error(w, "Failed to serve attachment", http.StatusInternalServerError)
+	}
+}
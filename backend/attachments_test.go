@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// encodePNG returns a PNG image of the given size, with a gradient so it does not compress
+// to nothing.
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x * y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// upload posts data to /attachments as the file named filename and returns the status and
+// the body of the response.
+func upload(t *testing.T, srv *httptest.Server, user *testUser, filename string, data []byte) (int, []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/attachments", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+user.Token)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response bytes.Buffer
+	response.ReadFrom(resp.Body)
+	return resp.StatusCode, response.Bytes()
+}
+
+func attachmentPath(attachmentID int) string {
+	return "/attachment?attachmentId=" + strconv.Itoa(attachmentID)
+}
+
+func TestAttachments(t *testing.T) {
+	cfg := testConfig()
+	cfg.Attachments.MaxSize = 64 << 10
+	srv := newTestServer(t, cfg)
+	alice, bob := register(t, srv, "alice"), register(t, srv, "bob")
+
+	status, body := upload(t, srv, alice, "photo.png", encodePNG(t, 300, 200))
+	if status != http.StatusCreated {
+		t.Fatalf("uploading an image: %d %s", status, body)
+	}
+	var uploaded realtimeforum.Attachment
+	decode(t, body, &uploaded)
+	if uploaded.AttachmentID == 0 || uploaded.ContentType != "image/png" || uploaded.Filename != "photo.png" {
+		t.Errorf("uploaded image: got %+v, want photo.png as image/png", uploaded)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+attachmentPath(uploaded.AttachmentID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+alice.Token)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" ||
+		resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("downloading the image: got %d with headers %v", resp.StatusCode, resp.Header)
+	}
+	if status, body := do(t, srv, alice, http.MethodGet, attachmentPath(uploaded.AttachmentID)+"&size=thumbnail", nil); status != http.StatusOK {
+		t.Errorf("downloading the thumbnail: %d %s", status, body)
+	}
+
+	// An upload is only served to its uploader until it is attached
+	if status, _ := do(t, srv, bob, http.MethodGet, attachmentPath(uploaded.AttachmentID), nil); status != http.StatusNotFound {
+		t.Errorf("downloading an unattached upload of alice as bob: got %d, want %d", status, http.StatusNotFound)
+	}
+	status, body = do(t, srv, alice, http.MethodPost, "/newpost", realtimeforum.Posts{Title: "Photo", Content: "See",
+		CategoryID: 1, AttachmentIDs: []int64{int64(uploaded.AttachmentID)}})
+	if status != http.StatusOK {
+		t.Fatalf("attaching the image to a post: %d %s", status, body)
+	}
+	if status, body := do(t, srv, bob, http.MethodGet, attachmentPath(uploaded.AttachmentID), nil); status != http.StatusOK {
+		t.Errorf("downloading an attached image as bob: %d %s", status, body)
+	}
+
+	for _, tc := range []struct {
+		what     string
+		filename string
+		data     []byte
+		status   int
+	}{
+		{"an empty file", "empty.txt", nil, http.StatusBadRequest},
+		{"a file of an unsupported type", "run.exe", []byte("MZ\x90\x00\x03\x00\x00\x00"), http.StatusUnsupportedMediaType},
+		{"a file over the size limit", "large.png", encodePNG(t, 1000, 1000), http.StatusRequestEntityTooLarge},
+	} {
+		if status, body := upload(t, srv, alice, tc.filename, tc.data); status != tc.status {
+			t.Errorf("uploading %s: got %d %s, want %d", tc.what, status, body, tc.status)
+		}
+	}
+
+	if status, _ := do(t, srv, alice, http.MethodGet, attachmentPath(uploaded.AttachmentID+100), nil); status != http.StatusNotFound {
+		t.Errorf("downloading an unknown attachment: got %d, want %d", status, http.StatusNotFound)
+	}
+	if status, _ := do(t, srv, alice, http.MethodGet, attachmentPath(uploaded.AttachmentID)+"&size=huge", nil); status != http.StatusBadRequest {
+		t.Errorf("downloading an unknown size: got %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,54 @@
+// Package backplane carries messages between the nodes of a deployment, so a WebSocket hub can
+// reach users connected to another instance behind the same load balancer.
+//
+// A Backplane is plain publish/subscribe on named channels: every message published on a
+// channel reaches every subscriber of that channel, on every node, including the publisher's
+// own. Local connects the hubs of a single process; NATS connects processes through a NATS server.
+package backplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Drivers selecting the backplane of a server.
+const (
+	DriverNone = "none" // A single node, which needs no backplane
+	DriverNATS = "nats"
+)
+
+var (
+	// ErrClosed is returned when publishing or subscribing on a closed backplane.
+	ErrClosed = errors.New("backplane is closed")
+
+	// ErrUnknownDriver is returned by Open for a driver it cannot connect with.
+	ErrUnknownDriver = errors.New("unknown backplane driver")
+)
+
+// Backplane publishes messages to, and receives messages from, every node.
+type Backplane interface {
+	// Publish sends data to the subscribers of channel. It does not wait for them to receive it.
+	Publish(channel string, data []byte) error
+
+	// Subscribe calls handle with every message published on channel until unsubscribe is
+	// called or the backplane is closed. Messages from one publisher arrive in the order they
+	// were published, and handle is never called concurrently for one subscription.
+	Subscribe(channel string, handle func(data []byte)) (unsubscribe func(), err error)
+
+	// Ping checks that messages can currently be exchanged with the other nodes.
+	Ping(ctx context.Context) error
+
+	Close() error
+}
+
+// Open connects to the backplane selected by driver at url. name identifies this node to the
+// backplane server, in its logs and monitoring.
+func Open(driver, url, name string) (Backplane, error) {
+	switch driver {
+	case DriverNATS:
+		return NewNATS(url, name)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownDriver, driver)
+	}
+}
@@ -0,0 +1,40 @@
+package backplane_test
+
+import (
+	"os"
+	"testing"
+
+	"livechat-system/backend/backplane"
+	"livechat-system/backend/backplane/backplanetest"
+)
+
+// envNATSURL names a NATS server to run the suite against, such as nats://localhost:4222.
+// NATS is skipped without it.
+const envNATSURL = "LIVECHAT_TEST_NATS_URL"
+
+func TestLocal(t *testing.T) {
+	backplanetest.Run(t, func(t *testing.T) (backplane.Backplane, backplane.Backplane) {
+		local := backplane.NewLocal()
+		return local, local
+	})
+}
+
+// TestNATS plays the two nodes with two connections to the server.
+func TestNATS(t *testing.T) {
+	url := os.Getenv(envNATSURL)
+	if url == "" {
+		t.Skip(envNATSURL + " is not set")
+	}
+	backplanetest.Run(t, func(t *testing.T) (backplane.Backplane, backplane.Backplane) {
+		a, err := backplane.NewNATS(url, "backplanetest-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := backplane.NewNATS(url, "backplanetest-b")
+		if err != nil {
+			a.Close()
+			t.Fatal(err)
+		}
+		return a, b
+	})
+}
@@ -0,0 +1,218 @@
+// Package backplanetest checks that an implementation of backplane.Backplane behaves the way
+// the WebSocket hub expects. Every implementation must pass it:
+//
+//	backplanetest.Run(t, func(t *testing.T) (a, b backplane.Backplane) { ... })
+//
+// Each case gets two connected nodes from newCluster, which may be the same value for an
+// in-process backplane, and closes them when done. The tests of package backplane run the
+// suite against every implementation.
+package backplanetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"livechat-system/backend/backplane"
+)
+
+// timeout bounds how long a case waits for a message to arrive.
+const timeout = 5 * time.Second
+
+type testCase struct {
+	name string
+	run  func(a, b backplane.Backplane) error
+}
+
+var cases = []testCase{
+	{"reaches every node", testReachesEveryNode},
+	{"keeps order", testKeepsOrder},
+	{"separates channels", testSeparatesChannels},
+	{"unsubscribe", testUnsubscribe},
+	{"close", testClose},
+}
+
+// Run runs every case as a subtest, each against its own pair of nodes.
+func Run(t *testing.T, newCluster func(t *testing.T) (a, b backplane.Backplane)) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := newCluster(t)
+			defer a.Close()
+			defer b.Close()
+			if err := tc.run(a, b); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// channel returns a channel name no other run uses, since a NATS server may be shared.
+func channel(name string) string {
+	random := make([]byte, 6)
+	rand.Read(random)
+	return "backplanetest." + name + "." + hex.EncodeToString(random)
+}
+
+// inbox collects the messages a subscription receives.
+type inbox struct {
+	mu       sync.Mutex
+	messages []string
+	received chan struct{}
+}
+
+func subscribe(bp backplane.Backplane, channel string) (*inbox, func(), error) {
+	in := &inbox{received: make(chan struct{}, 1)}
+	unsubscribe, err := bp.Subscribe(channel, func(data []byte) {
+		in.mu.Lock()
+		in.messages = append(in.messages, string(data))
+		in.mu.Unlock()
+		select {
+		case in.received <- struct{}{}:
+		default:
+		}
+	})
+	return in, unsubscribe, err
+}
+
+// wait returns the first n messages, or fails after timeout.
+func (in *inbox) wait(n int) ([]string, error) {
+	deadline := time.After(timeout)
+	for {
+		in.mu.Lock()
+		if len(in.messages) >= n {
+			messages := append([]string(nil), in.messages[:n]...)
+			in.mu.Unlock()
+			return messages, nil
+		}
+		got := len(in.messages)
+		in.mu.Unlock()
+
+		select {
+		case <-in.received:
+		case <-deadline:
+			return nil, fmt.Errorf("received %d messages, want %d", got, n)
+		}
+	}
+}
+
+// quiet fails if the inbox holds more than n messages after a while.
+func (in *inbox) quiet(n int) error {
+	time.Sleep(200 * time.Millisecond)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if len(in.messages) > n {
+		return fmt.Errorf("received %v, want only %d messages", in.messages, n)
+	}
+	return nil
+}
+
+func testReachesEveryNode(a, b backplane.Backplane) error {
+	ch := channel("every")
+	inA, _, err := subscribe(a, ch)
+	if err != nil {
+		return err
+	}
+	inB, _, err := subscribe(b, ch)
+	if err != nil {
+		return err
+	}
+	if err := a.Publish(ch, []byte("hello")); err != nil {
+		return err
+	}
+	for node, in := range map[string]*inbox{"publishing node": inA, "other node": inB} {
+		messages, err := in.wait(1)
+		if err != nil {
+			return fmt.Errorf("%s: %w", node, err)
+		}
+		if messages[0] != "hello" {
+			return fmt.Errorf("%s received %q, want \"hello\"", node, messages[0])
+		}
+		if err := in.quiet(1); err != nil {
+			return fmt.Errorf("%s: %w", node, err)
+		}
+	}
+	return nil
+}
+
+func testKeepsOrder(a, b backplane.Backplane) error {
+	ch := channel("order")
+	in, _, err := subscribe(b, ch)
+	if err != nil {
+		return err
+	}
+	const count = 500
+	for i := 0; i < count; i++ {
+		if err := a.Publish(ch, []byte(strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	messages, err := in.wait(count)
+	if err != nil {
+		return err
+	}
+	for i, message := range messages {
+		if message != strconv.Itoa(i) {
+			return fmt.Errorf("message %d is %q: messages arrived out of order", i, message)
+		}
+	}
+	return nil
+}
+
+func testSeparatesChannels(a, b backplane.Backplane) error {
+	first, second := channel("first"), channel("second")
+	in, _, err := subscribe(b, first)
+	if err != nil {
+		return err
+	}
+	if err := a.Publish(second, []byte("elsewhere")); err != nil {
+		return err
+	}
+	if err := a.Publish(first, []byte("here")); err != nil {
+		return err
+	}
+	messages, err := in.wait(1)
+	if err != nil {
+		return err
+	}
+	if messages[0] != "here" {
+		return fmt.Errorf("received %q from another channel", messages[0])
+	}
+	return in.quiet(1)
+}
+
+func testUnsubscribe(a, b backplane.Backplane) error {
+	ch := channel("unsubscribe")
+	in, unsubscribe, err := subscribe(b, ch)
+	if err != nil {
+		return err
+	}
+	if err := a.Publish(ch, []byte("before")); err != nil {
+		return err
+	}
+	if _, err := in.wait(1); err != nil {
+		return err
+	}
+	unsubscribe()
+	if err := a.Publish(ch, []byte("after")); err != nil {
+		return err
+	}
+	return in.quiet(1)
+}
+
+func testClose(a, b backplane.Backplane) error {
+	if err := a.Close(); err != nil {
+		return err
+	}
+	if err := a.Publish(channel("closed"), []byte("x")); !errors.Is(err, backplane.ErrClosed) {
+		return fmt.Errorf("publishing on a closed backplane: got error %v, want ErrClosed", err)
+	}
+	if _, err := a.Subscribe(channel("closed"), func([]byte) {}); !errors.Is(err, backplane.ErrClosed) {
+		return fmt.Errorf("subscribing on a closed backplane: got error %v, want ErrClosed", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package backplane
+
+import (
+	"context"
+	"sync"
+)
+
+// Local is a Backplane within one process. A single node uses it to run without a message
+// broker; several hubs sharing one Local behave like the nodes of a deployment.
+type Local struct {
+	mu            sync.Mutex
+	closed        bool
+	subscriptions map[string]map[*localSubscription]bool // Keyed by channel
+}
+
+var _ Backplane = (*Local)(nil)
+
+// NewLocal creates an in-process backplane.
+func NewLocal() *Local {
+	return &Local{subscriptions: make(map[string]map[*localSubscription]bool)}
+}
+
+// localSubscription queues messages for its handler, which runs on a goroutine of its own
+// so a slow subscriber never blocks the publisher.
+type localSubscription struct {
+	handle func(data []byte)
+
+	mu      sync.Mutex
+	queue   [][]byte
+	pending chan struct{} // Signalled when the queue goes from empty to non-empty
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// Publish queues a copy of data for every subscriber of channel.
+func (l *Local) Publish(channel string, data []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	for sub := range l.subscriptions[channel] {
+		sub.enqueue(append([]byte(nil), data...))
+	}
+	return nil
+}
+
+// Subscribe calls handle with the messages published on channel from now on.
+func (l *Local) Subscribe(channel string, handle func(data []byte)) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &localSubscription{handle: handle, pending: make(chan struct{}, 1), stop: make(chan struct{})}
+	if l.subscriptions[channel] == nil {
+		l.subscriptions[channel] = make(map[*localSubscription]bool)
+	}
+	l.subscriptions[channel][sub] = true
+	go sub.run()
+
+	unsubscribe := func() {
+		l.mu.Lock()
+		delete(l.subscriptions[channel], sub)
+		l.mu.Unlock()
+		sub.close()
+	}
+	return unsubscribe, nil
+}
+
+// Ping only fails once the backplane is closed.
+func (l *Local) Ping(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	return ctx.Err()
+}
+
+// Close stops every subscription. Messages still queued are dropped.
+func (l *Local) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	for _, subs := range l.subscriptions {
+		for sub := range subs {
+			sub.close()
+		}
+	}
+	l.subscriptions = nil
+	return nil
+}
+
+func (s *localSubscription) enqueue(data []byte) {
+	s.mu.Lock()
+	s.queue = append(s.queue, data)
+	s.mu.Unlock()
+	select {
+	case s.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (s *localSubscription) close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *localSubscription) run() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.pending:
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			data := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			s.handle(data)
+		}
+	}
+}
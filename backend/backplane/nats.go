@@ -0,0 +1,97 @@
+package backplane
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS is a Backplane on a NATS server. Channels are NATS subjects.
+type NATS struct {
+	conn   *nats.Conn
+	closed atomic.Bool // Set by Close; the connection only closes once drained
+}
+
+var _ Backplane = (*NATS)(nil)
+
+// NewNATS connects to the NATS server at url, such as "nats://localhost:4222", identifying the
+// connection with name. When the server goes away the connection keeps trying to reconnect, and
+// messages published in the meantime are buffered.
+func NewNATS(url, name string) (*NATS, error) {
+	conn, err := nats.Connect(url,
+		nats.Name(name),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			// err is nil when the connection is closed on purpose
+			if err != nil {
+				slog.Warn("Disconnected from NATS", "err", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			slog.Info("Reconnected to NATS", "url", conn.ConnectedUrlRedacted())
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, sub *nats.Subscription, err error) {
+			// Reported when a slow subscriber drops messages, among others
+			slog.Error("NATS error", "subject", subject(sub), "err", err)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	return &NATS{conn: conn}, nil
+}
+
+func subject(sub *nats.Subscription) string {
+	if sub == nil {
+		return ""
+	}
+	return sub.Subject
+}
+
+// Publish sends data on the subject channel.
+func (n *NATS) Publish(channel string, data []byte) error {
+	if n.closed.Load() {
+		return ErrClosed
+	}
+	return n.conn.Publish(channel, data)
+}
+
+// Subscribe calls handle with the messages published on the subject channel.
+func (n *NATS) Subscribe(channel string, handle func(data []byte)) (func(), error) {
+	if n.closed.Load() {
+		return nil, ErrClosed
+	}
+	// Handlers of one subscription are called one at a time, in the order messages arrive
+	sub, err := n.conn.Subscribe(channel, func(msg *nats.Msg) { handle(msg.Data) })
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the server registered the subscription before anything is published
+	if err := n.conn.Flush(); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+	return func() { sub.Unsubscribe() }, nil
+}
+
+// Ping makes a round trip to the server.
+func (n *NATS) Ping(ctx context.Context) error {
+	if n.closed.Load() {
+		return ErrClosed
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
+// Close delivers the messages already received to their handlers, sends what is still
+// buffered and disconnects.
+func (n *NATS) Close() error {
+	if n.closed.Swap(true) {
+		return nil
+	}
+	return n.conn.Drain()
+}
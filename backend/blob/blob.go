@@ -0,0 +1,82 @@
+// Package blob keeps the files uploaded by users, such as attachments and their thumbnails, out
+// of the database. A Store holds opaque blobs under keys chosen by the caller; FS keeps them in a
+// local directory, and other stores, such as an object storage bucket, can implement the same
+// interface.
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Drivers selecting the blob store of a server.
+const (
+	DriverFS = "fs"
+)
+
+var (
+	// ErrNotFound is returned when no blob is stored under a key.
+	ErrNotFound = errors.New("blob not found")
+
+	// ErrInvalidKey is returned for a key NewKey could not have made.
+	ErrInvalidKey = errors.New("invalid blob key")
+
+	// ErrUnknownDriver is returned by Open for a driver it cannot store blobs with.
+	ErrUnknownDriver = errors.New("unknown blob store driver")
+)
+
+// Store stores blobs by key. Blobs are written once and never changed, so they can be cached
+// by key for as long as they exist.
+type Store interface {
+	// Put stores the content of r under key. A blob is either stored entirely or not at all.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Open returns the blob stored under key, or ErrNotFound. The caller closes it.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+
+	// Delete removes the blob stored under key. Deleting a blob that does not exist is a no-op.
+	Delete(ctx context.Context, key string) error
+
+	// Ping checks that blobs can currently be stored.
+	Ping(ctx context.Context) error
+}
+
+// Open returns the blob store selected by driver; location is the directory of DriverFS.
+func Open(driver, location string) (Store, error) {
+	switch driver {
+	case DriverFS:
+		return NewFS(location)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownDriver, driver)
+	}
+}
+
+// keyLength is the length of the keys made by NewKey, in hexadecimal digits.
+const keyLength = 32
+
+// NewKey returns a random key, which cannot be guessed from the keys of other blobs.
+func NewKey() (string, error) {
+	random := make([]byte, keyLength/2)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// validKey reports whether key could have been made by NewKey. Stores only accept such keys, so a
+// key can never name a path outside the store.
+func validKey(key string) bool {
+	if len(key) != keyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
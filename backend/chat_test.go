@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+func TestChatHistory(t *testing.T) {
+	srv := newTestServer(t, testConfig())
+	alice, bob, carol := register(t, srv, "alice"), register(t, srv, "bob"), register(t, srv, "carol")
+
+	send := func(from, to *testUser, text string) {
+		t.Helper()
+		msg := realtimeforum.Message{Type: "private", ReceiverID: to.ID, Message: text}
+		if status, body := do(t, srv, from, http.MethodPost, "/events/send", msg); status != http.StatusOK {
+			t.Fatalf("sending %q from %s: %d %s", text, from.Name, status, body)
+		}
+	}
+	send(alice, bob, "hello bob")
+	send(bob, alice, "hello alice")
+	send(bob, carol, "hello carol")
+
+	history := func(user *testUser, query string) (int, []realtimeforum.Chats) {
+		t.Helper()
+		status, body := do(t, srv, user, http.MethodGet, "/chat-history?"+query, nil)
+		var chats []realtimeforum.Chats
+		if status == http.StatusOK {
+			decode(t, body, &chats)
+		}
+		return status, chats
+	}
+
+	for _, tc := range []struct {
+		what  string
+		user  *testUser
+		query string
+	}{
+		{"with bob", alice, fmt.Sprintf("receiverId=%d", bob.ID)},
+		{"as the sender", alice, fmt.Sprintf("senderId=%d&receiverId=%d", alice.ID, bob.ID)},
+		{"as the receiver", alice, fmt.Sprintf("senderId=%d&receiverId=%d", bob.ID, alice.ID)},
+	} {
+		status, chats := history(tc.user, tc.query)
+		if status != http.StatusOK || len(chats) != 2 ||
+			chats[0].MessageContent != "hello bob" || chats[1].MessageContent != "hello alice" {
+			t.Errorf("history of alice %s: got %d %+v, want both messages", tc.what, status, chats)
+		}
+	}
+
+	for _, tc := range []struct {
+		what   string
+		user   *testUser
+		query  string
+		status int
+	}{
+		{"without a token", nil, fmt.Sprintf("senderId=%d&receiverId=%d", alice.ID, bob.ID), http.StatusUnauthorized},
+		{"of two other users", alice, fmt.Sprintf("senderId=%d&receiverId=%d", bob.ID, carol.ID), http.StatusForbidden},
+		{"without a receiver", alice, "", http.StatusBadRequest},
+		{"with an invalid sender", alice, fmt.Sprintf("senderId=x&receiverId=%d", bob.ID), http.StatusBadRequest},
+	} {
+		if status, chats := history(tc.user, tc.query); status != tc.status {
+			t.Errorf("history %s: got %d %+v, want %d", tc.what, status, chats, tc.status)
+		}
+	}
+
+	// The receiver alone names the other side: carol only sees the conversation between carol and bob
+	if status, chats := history(carol, fmt.Sprintf("receiverId=%d", bob.ID)); status != http.StatusOK ||
+		len(chats) != 1 || chats[0].MessageContent != "hello carol" {
+		t.Errorf("history of carol with bob: got %d %+v, want hello carol", status, chats)
+	}
+	if status, chats := history(carol, fmt.Sprintf("receiverId=%d", alice.ID)); status != http.StatusOK || len(chats) != 0 {
+		t.Errorf("history of carol with alice: got %d %+v, want none", status, chats)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+
+	"livechat-system/backend/backplane"
+	"livechat-system/backend/config"
+	websocket "livechat-system/backend/websocket"
+)
+
+// joinCluster connects the WebSocket hub to the other instances through the configured
+// backplane. It returns nil without a backplane, when the server runs as a single instance.
+func joinCluster(cfg config.ClusterConfig, wsServer *websocket.WebSocketServer) (backplane.Backplane, error) {
+	if cfg.Backplane == backplane.DriverNone {
+		return nil, nil
+	}
+	node := cfg.Node
+	if node == "" {
+		node = generateNodeID()
+	}
+	bp, err := backplane.Open(cfg.Backplane, cfg.URL, "livechat-"+node)
+	if err != nil {
+		return nil, err
+	}
+	if err := wsServer.JoinCluster(bp, cfg.Channel, node, cfg.PresenceInterval.Duration); err != nil {
+		bp.Close()
+		return nil, err
+	}
+	return bp, nil
+}
+
+// generateNodeID names an instance after its host, with a random suffix so a restarted
+// instance is not mistaken for the one it replaces.
+func generateNodeID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		slog.Warn("Could not get the host name for the node ID", "err", err)
+		host = "node"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		panic("Error generating node ID")
+	}
+	return host + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"livechat-system/backend/logging"
+	realtimeforum "livechat-system/backend/models"
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+)
+
+// Limits of the listings of /comments.
+const (
+	defaultCommentPageSize = 20
+	maxCommentPageSize     = 100
+	defaultCommentReplies  = 3
+	maxCommentReplies      = 20
+	defaultCommentDepth    = 2
+)
+
+// Formats of the listings of /comments.
+const (
+	commentFormatTree = "tree"
+	commentFormatFlat = "flat"
+)
+
+// commentsResponse is the body of a GET /comments response.
+type commentsResponse struct {
+	Comments   []realtimeforum.Comments `json:"comments"`
+	NextCursor int                      `json:"nextCursor,omitempty"`
+	Format     string                   `json:"format"`
+}
+
+// commentsHandler serves /comments for the authenticated user:
+//
+//	GET ?postId=1               lists the top-level comments of a post with their first replies
+//	    &parentId=5             lists the replies to a comment instead
+//	    &after=7                continues a listing after the comment 7 (nextCursor)
+//	    &limit=20&replies=3     comments listed at the first level, and below each comment
+//	    &depth=2                levels of replies listed below the first one
+//	    &format=tree            replies nested in each comment; flat lists them in thread order
+//	POST {"post_id": 1, "parent_comment_id": 5, "content": ">>comment:5 I agree"}
+//	                            adds a comment, replying to parent_comment_id when it is set
+//
+// Quotes of other comments and posts are rendered into content_html. The watchers of the post
+// are notified of new comments through wsServer.
+func (a *app) commentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		postID, err := strconv.ParseInt(params.Get("postId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		query := service.CommentQuery{
+			Limit:   defaultCommentPageSize,
+			Replies: defaultCommentReplies,
+			Depth:   min(defaultCommentDepth, a.forumService.MaxCommentDepth),
+		}
+		numbers := []struct {
+			name     string
+			min, max int64
+			target   func(int64)
+		}{
+			{"parentId", 1, 1<<63 - 1, func(n int64) { query.ParentID = n }},
+			{"after", 1, 1<<63 - 1, func(n int64) { query.After = n }},
+			{"limit", 1, maxCommentPageSize, func(n int64) { query.Limit = int(n) }},
+			{"replies", 1, maxCommentReplies, func(n int64) { query.Replies = int(n) }},
+			{"depth", 0, int64(a.forumService.MaxCommentDepth), func(n int64) { query.Depth = int(n) }},
+		}
+		for _, number := range numbers {
+			value := params.Get(number.name)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < number.min || n > number.max {
+				http.Error(w, "Invalid "+number.name, http.StatusBadRequest)
+				return
+			}
+			number.target(n)
+		}
+		format := params.Get("format")
+		switch format {
+		case "":
+			format = commentFormatTree
+		case commentFormatTree, commentFormatFlat:
+		default:
+			http.Error(w, "format must be tree or flat", http.StatusBadRequest)
+			return
+		}
+		query.Flat = format == commentFormatFlat
+
+		comments, next, err := a.forumService.GetCommentThread(userID, postID, query)
+		if err != nil {
+			writeCommentError(w, r, err)
+			return
+		}
+		writeJSON(w, commentsResponse{Comments: comments, NextCursor: next, Format: format})
+
+	case http.MethodPost:
+		var request struct {
+			PostID          int64  `json:"post_id"`
+			ParentCommentID int64  `json:"parent_comment_id"`
+			Content         string `json:"content"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxContentBody)).Decode(&request); err != nil || request.PostID == 0 {
+			http.Error(w, "Invalid comment", http.StatusBadRequest)
+			return
+		}
+		comment, err := a.forumService.CreateComment(userID, request.PostID, request.ParentCommentID, request.Content)
+		if err != nil {
+			writeCommentError(w, r, err)
+			return
+		}
+		logging.FromContext(r.Context()).Info("Comment created", "user_id", userID, "post_id", request.PostID,
+			"comment_id", comment.CommentID, "depth", comment.Depth)
+		notifications, err := a.forumService.NotifyNewComment(comment)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to notify watchers of comment", "comment_id", comment.CommentID, "err", err)
+		}
+		a.wsServer.SendNotifications(notifications)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(comment)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeCommentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Post or comment not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrPostDeleted):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, service.ErrInvalidComment), errors.Is(err, service.ErrInvalidParent),
+		errors.Is(err, service.ErrCommentTooDeep), errors.Is(err, service.ErrInvalidCursor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.FromContext(r.Context()).Error("Failed to serve comments", "err", err)
+		http.Error(w, "Failed to serve comments", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,98 @@
+// Package diff compares two versions of a text line by line, for the edit history of posts:
+//
+//	lines := diff.Lines(previous.Content, current.Content)
+//
+// The result lists every line of both versions once, in order: lines kept by the edit, lines
+// it removed and lines it added.
+package diff
+
+import (
+	"strings"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// maxCells bounds the size of the table of the longest common subsequence, in lines of the old
+// text times lines of the new one. Beyond it, the changed lines are listed as all removed, then
+// all added, which is still a correct, if long, diff.
+const maxCells = 1 << 20
+
+// Lines returns the changes turning old into new, as few removed and added lines as possible.
+func Lines(old, new string) []realtimeforum.DiffLine {
+	a, b := splitLines(old), splitLines(new)
+
+	// Lines shared at both ends are kept as they are, which leaves little to compare after small edits
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]realtimeforum.DiffLine, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		lines = append(lines, realtimeforum.DiffLine{Op: realtimeforum.DiffEqual, Text: line})
+	}
+	lines = append(lines, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, realtimeforum.DiffLine{Op: realtimeforum.DiffEqual, Text: line})
+	}
+	return lines
+}
+
+// middle diffs the lines between the common prefix and suffix with a longest common subsequence.
+func middle(a, b []string) []realtimeforum.DiffLine {
+	var lines []realtimeforum.DiffLine
+	if len(a)*len(b) > maxCells {
+		for _, line := range a {
+			lines = append(lines, realtimeforum.DiffLine{Op: realtimeforum.DiffDelete, Text: line})
+		}
+		for _, line := range b {
+			lines = append(lines, realtimeforum.DiffLine{Op: realtimeforum.DiffInsert, Text: line})
+		}
+		return lines
+	}
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, realtimeforum.DiffLine{Op: realtimeforum.DiffEqual, Text: a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, realtimeforum.DiffLine{Op: realtimeforum.DiffDelete, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, realtimeforum.DiffLine{Op: realtimeforum.DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+// splitLines splits text into lines, without their line breaks. An empty text has no lines.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,187 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// exifSecret is written into the EXIF data of a photo, which uploads must strip.
+const exifSecret = "GPS 48.8584 N 2.2945 E"
+
+// testAttachments checks that uploads stay private until attached, that attachments are then
+// served to whoever may see their post or message, and that images lose their metadata.
+func testAttachments(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	picture, err := encodePNG(600, 400)
+	if err != nil {
+		return err
+	}
+	uploaded, err := sc.server.Upload(alice, "holidays.png", picture)
+	if err != nil {
+		return err
+	}
+	if uploaded.ContentType != "image/png" || uploaded.Width != 600 || uploaded.Height != 400 || !uploaded.HasThumbnail {
+		return fmt.Errorf("uploaded picture: got %+v, want a 600x400 PNG with a thumbnail", uploaded)
+	}
+	photo, err := encodeJPEG(600, 400, 6) // Taken with the camera turned a quarter
+	if err != nil {
+		return err
+	}
+	uploadedPhoto, err := sc.server.Upload(alice, "camera/IMG_0001.jpg", photo)
+	if err != nil {
+		return err
+	}
+	if uploadedPhoto.Width != 400 || uploadedPhoto.Height != 600 || uploadedPhoto.Filename != "IMG_0001.jpg" {
+		return fmt.Errorf("uploaded photo: got %+v, want IMG_0001.jpg turned to 400x600", uploadedPhoto)
+	}
+
+	// Nobody else may see an upload before it is attached, or use it
+	if _, _, err := sc.server.Download(bob, int64(uploaded.AttachmentID), false); !HasStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("download of another user's upload: got error %v, want 404", err)
+	}
+	stolen := realtimeforum.Posts{Title: "mine", Content: "now", CategoryID: 1, AttachmentIDs: []int64{int64(uploaded.AttachmentID)}}
+	if _, err := sc.server.CreatePost(bob, stolen); !HasStatus(err, http.StatusBadRequest) {
+		return fmt.Errorf("post with another user's upload: got error %v, want 400", err)
+	}
+	_, err = sc.server.Upload(alice, "page.png", []byte("<html><script>alert(1)</script></html>"))
+	if !HasStatus(err, http.StatusUnsupportedMediaType) {
+		return fmt.Errorf("upload of HTML: got error %v, want 415", err)
+	}
+
+	post := realtimeforum.Posts{Title: "holidays", Content: "pictures", CategoryID: 1,
+		AttachmentIDs: []int64{int64(uploaded.AttachmentID), int64(uploadedPhoto.AttachmentID)}}
+	postID, err := sc.server.CreatePost(alice, post)
+	if err != nil {
+		return err
+	}
+	got, err := sc.server.GetPost(bob, postID)
+	if err != nil {
+		return err
+	}
+	if len(got.Attachments) != 2 || got.Attachments[0].AttachmentID != uploaded.AttachmentID {
+		return fmt.Errorf("attachments of the post: got %+v, want the picture and the photo", got.Attachments)
+	}
+
+	content, header, err := sc.server.Download(bob, int64(uploaded.AttachmentID), false)
+	if err != nil {
+		return err
+	}
+	if header.Get("Content-Type") != "image/png" || header.Get("X-Content-Type-Options") != "nosniff" ||
+		!strings.Contains(header.Get("Cache-Control"), "immutable") || !strings.HasPrefix(header.Get("Content-Disposition"), "inline") {
+		return fmt.Errorf("headers of the picture: got %v", header)
+	}
+	if config, err := png.DecodeConfig(bytes.NewReader(content)); err != nil || config.Width != 600 {
+		return fmt.Errorf("downloaded picture: got %+v, %v, want a 600 pixels wide PNG", config, err)
+	}
+	thumbnail, _, err := sc.server.Download(bob, int64(uploaded.AttachmentID), true)
+	if err != nil {
+		return err
+	}
+	if config, err := png.DecodeConfig(bytes.NewReader(thumbnail)); err != nil || config.Width != 256 || config.Height != 170 {
+		return fmt.Errorf("thumbnail of the picture: got %+v, %v, want 256x170", config, err)
+	}
+	content, _, err = sc.server.Download(bob, int64(uploadedPhoto.AttachmentID), false)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(content, []byte(exifSecret)) || bytes.Contains(content, []byte("Exif")) {
+		return fmt.Errorf("downloaded photo still has its EXIF data")
+	}
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(content)); err != nil || config.Width != 400 || config.Height != 600 {
+		return fmt.Errorf("downloaded photo: got %+v, %v, want 400x600", config, err)
+	}
+
+	// A file attached to a private message is for its sender and receiver only
+	document, err := sc.server.Upload(alice, "report.pdf", []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n%%EOF\n"))
+	if err != nil {
+		return err
+	}
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	message := realtimeforum.Message{Type: "private", ReceiverID: bob.ID, Message: "the report",
+		AttachmentIDs: []int64{int64(document.AttachmentID)}}
+	if err := aliceClient.Send(message); err != nil {
+		return err
+	}
+	received, err := bobClient.WaitFor("private message", OfType("private"))
+	if err != nil {
+		return err
+	}
+	if len(received.Attachments) != 1 || received.Attachments[0].ContentType != "application/pdf" {
+		return fmt.Errorf("attachments of the message: got %+v, want the PDF", received.Attachments)
+	}
+	if _, header, err = sc.server.Download(bob, int64(document.AttachmentID), false); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(header.Get("Content-Disposition"), "attachment") {
+		return fmt.Errorf("Content-Disposition of the PDF: got %q, want it downloaded", header.Get("Content-Disposition"))
+	}
+	if _, _, err := sc.server.Download(carol, int64(document.AttachmentID), false); !HasStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("download of someone else's message attachment: got error %v, want 404", err)
+	}
+	return nil
+}
+
+// encodePNG returns a PNG image of a gradient.
+func encodePNG(width, height int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, gradient(width, height))
+	return buf.Bytes(), err
+}
+
+// encodeJPEG returns a JPEG photo of a gradient whose EXIF data gives its orientation and the
+// place it was taken.
+func encodeJPEG(width, height, orientation int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gradient(width, height), nil); err != nil {
+		return nil, err
+	}
+
+	// A TIFF directory with the orientation alone, followed by the secret
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // Padding and no next directory
+	tiff = append(tiff, exifSecret...)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	jpg := buf.Bytes()
+	photo := append([]byte{}, jpg[:2]...) // Start of image
+	photo = append(photo, 0xFF, 0xE1)
+	photo = binary.BigEndian.AppendUint16(photo, uint16(len(segment)+2))
+	photo = append(photo, segment...)
+	return append(photo, jpg[2:]...), nil
+}
+
+func gradient(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+	return img
+}
@@ -0,0 +1,565 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultTimeout is how long a Client waits for an expected frame.
+const DefaultTimeout = 5 * time.Second
+
+// User is a registered and logged-in user.
+type User struct {
+	ID       int64
+	Username string
+	Password string
+	Token    string
+}
+
+// NewUser registers a user and logs them in. The name is made unique with a counter, so
+// scenarios sharing a server can all ask for "alice".
+func (s *Server) NewUser(name string) (User, error) {
+	user := User{Username: fmt.Sprintf("%s%d", name, s.users.Add(1)), Password: name + "-password"}
+
+	_, err := s.post("/register", realtimeforum.User{
+		Username: user.Username, Age: 30, Gender: "other", FirstName: name, LastName: "E2E",
+		Email: user.Username + "@example.com", Password: user.Password,
+	})
+	if err != nil {
+		return User{}, fmt.Errorf("registering %s: %w", user.Username, err)
+	}
+
+	body, err := s.post("/login", map[string]string{"username": user.Username, "password": user.Password})
+	if err != nil {
+		return User{}, fmt.Errorf("logging in %s: %w", user.Username, err)
+	}
+	var login struct {
+		Token  string `json:"token"`
+		UserID int64  `json:"userId"`
+	}
+	if err := json.Unmarshal(body, &login); err != nil {
+		return User{}, fmt.Errorf("logging in %s: %w", user.Username, err)
+	}
+	user.ID, user.Token = login.UserID, login.Token
+	return user, nil
+}
+
+// NewPost creates a post as user in the given category and returns its ID.
+func (s *Server) NewPost(user User, title, content string, categoryID int) (int64, error) {
+	return s.CreatePost(user, realtimeforum.Posts{Title: title, Content: content, CategoryID: categoryID})
+}
+
+// CreatePost creates a post as user, with the attachments it lists, and returns its ID.
+func (s *Server) CreatePost(user User, post realtimeforum.Posts) (int64, error) {
+	body, err := s.postAs(user, "/newpost", post)
+	if err != nil {
+		return 0, fmt.Errorf("posting as %s: %w", user.Username, err)
+	}
+	var created struct {
+		PostID int64 `json:"post_id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return 0, fmt.Errorf("posting as %s: %w", user.Username, err)
+	}
+	return created.PostID, nil
+}
+
+// EditPost replaces a post as user.
+func (s *Server) EditPost(user User, postID int64, title, content string, categoryID int) error {
+	payload, err := json.Marshal(realtimeforum.PostEdit{Title: title, Content: content, CategoryID: categoryID})
+	if err != nil {
+		return err
+	}
+	_, err = s.do(user, http.MethodPut, fmt.Sprintf("/post?postId=%d", postID), bytes.NewReader(payload))
+	return err
+}
+
+// DeletePost deletes a post as user.
+func (s *Server) DeletePost(user User, postID int64) error {
+	_, err := s.do(user, http.MethodDelete, fmt.Sprintf("/post?postId=%d", postID), nil)
+	return err
+}
+
+// GetPost fetches a post as user.
+func (s *Server) GetPost(user User, postID int64) (realtimeforum.Posts, error) {
+	body, err := s.do(user, http.MethodGet, fmt.Sprintf("/post?postId=%d", postID), nil)
+	if err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	var response struct {
+		Post realtimeforum.Posts `json:"post"`
+	}
+	err = json.Unmarshal(body, &response)
+	return response.Post, err
+}
+
+// MakeModerator gives user the moderator role through the admin API, which the server only
+// serves to localhost unless it has an admin token.
+func (s *Server) MakeModerator(user User) error {
+	_, err := s.post("/admin/moderators", map[string]int64{"user_id": user.ID})
+	return err
+}
+
+// Search runs a search as user and returns the first page of its results.
+func (s *Server) Search(user User, query string) ([]realtimeforum.SearchResult, error) {
+	body, err := s.do(user, http.MethodGet, "/search?q="+url.QueryEscape(query), nil)
+	if err != nil {
+		return nil, fmt.Errorf("searching as %s: %w", user.Username, err)
+	}
+	var page struct {
+		Results []realtimeforum.SearchResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("searching as %s: %w", user.Username, err)
+	}
+	return page.Results, nil
+}
+
+// Comment adds a comment to a post as user, replying to parentID unless it is 0.
+func (s *Server) Comment(user User, postID, parentID int64, content string) (realtimeforum.Comments, error) {
+	request := map[string]interface{}{"post_id": postID, "parent_comment_id": parentID, "content": content}
+	body, err := s.postAs(user, "/comments", request)
+	if err != nil {
+		return realtimeforum.Comments{}, fmt.Errorf("commenting as %s: %w", user.Username, err)
+	}
+	var comment realtimeforum.Comments
+	err = json.Unmarshal(body, &comment)
+	return comment, err
+}
+
+// Comments lists comments of a post as user. query holds the parameters of /comments after
+// postId, such as "format=flat&limit=2". The cursor to the next comments is returned with them.
+func (s *Server) Comments(user User, postID int64, query string) ([]realtimeforum.Comments, int, error) {
+	body, err := s.do(user, http.MethodGet, fmt.Sprintf("/comments?postId=%d&%s", postID, query), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing comments as %s: %w", user.Username, err)
+	}
+	var page struct {
+		Comments   []realtimeforum.Comments `json:"comments"`
+		NextCursor int                      `json:"nextCursor"`
+	}
+	err = json.Unmarshal(body, &page)
+	return page.Comments, page.NextCursor, err
+}
+
+// Vote votes as user in the poll of a post and returns the poll with the vote counted.
+func (s *Server) Vote(user User, postID int64, optionIDs ...int) (realtimeforum.Poll, error) {
+	body, err := s.postAs(user, fmt.Sprintf("/poll?postId=%d", postID), map[string][]int{"option_ids": optionIDs})
+	if err != nil {
+		return realtimeforum.Poll{}, fmt.Errorf("voting as %s: %w", user.Username, err)
+	}
+	var poll realtimeforum.Poll
+	err = json.Unmarshal(body, &poll)
+	return poll, err
+}
+
+// Upload uploads a file as user, to be attached to a post or message.
+func (s *Server) Upload(user User, filename string, data []byte) (realtimeforum.Attachment, error) {
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+	if err := writer.Close(); err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+
+	req, err := s.request(user, http.MethodPost, "/attachments", &form)
+	if err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	_, body, err := s.send(req)
+	if err != nil {
+		return realtimeforum.Attachment{}, fmt.Errorf("uploading as %s: %w", user.Username, err)
+	}
+	var upload realtimeforum.Attachment
+	err = json.Unmarshal(body, &upload)
+	return upload, err
+}
+
+// Download fetches an attachment, or its thumbnail, as user and returns its content with the
+// headers of the response.
+func (s *Server) Download(user User, attachmentID int64, thumbnail bool) ([]byte, http.Header, error) {
+	path := fmt.Sprintf("/attachment?attachmentId=%d", attachmentID)
+	if thumbnail {
+		path += "&size=thumbnail"
+	}
+	req, err := s.request(user, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, body, err := s.send(req)
+	return body, header, err
+}
+
+// Block makes user block another user.
+func (s *Server) Block(user, blocked User) error {
+	_, err := s.postAs(user, "/blocks", map[string]int64{"user_id": blocked.ID})
+	return err
+}
+
+// Mute makes user mute another user.
+func (s *Server) Mute(user, muted User) error {
+	_, err := s.postAs(user, "/mutes", map[string]int64{"user_id": muted.ID})
+	return err
+}
+
+// Bookmark makes user bookmark a post.
+func (s *Server) Bookmark(user User, postID int64) error {
+	_, err := s.postAs(user, "/bookmarks", map[string]int64{"post_id": postID})
+	return err
+}
+
+// Bookmarks lists the posts user bookmarked.
+func (s *Server) Bookmarks(user User) ([]realtimeforum.Posts, error) {
+	body, err := s.do(user, http.MethodGet, "/bookmarks", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing bookmarks as %s: %w", user.Username, err)
+	}
+	var posts []realtimeforum.Posts
+	err = json.Unmarshal(body, &posts)
+	return posts, err
+}
+
+// Watch makes user watch a post or a category, kind telling which.
+func (s *Server) Watch(user User, kind string, targetID int64) error {
+	_, err := s.postAs(user, "/watches", map[string]interface{}{"kind": kind, "target_id": targetID})
+	return err
+}
+
+// Notifications lists the notifications of user, with the number of those not read yet. query
+// holds the parameters of /notifications, such as "limit=2".
+func (s *Server) Notifications(user User, query string) ([]realtimeforum.Notification, int, error) {
+	body, err := s.do(user, http.MethodGet, "/notifications?"+query, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing notifications as %s: %w", user.Username, err)
+	}
+	var page struct {
+		Notifications []realtimeforum.Notification `json:"notifications"`
+		Unread        int                          `json:"unread"`
+	}
+	err = json.Unmarshal(body, &page)
+	return page.Notifications, page.Unread, err
+}
+
+// ReadNotifications marks the notifications of user up to upTo as read, or all of them if upTo is 0.
+func (s *Server) ReadNotifications(user User, upTo int64) error {
+	_, err := s.postAs(user, "/notifications/read", map[string]int64{"up_to": upTo})
+	return err
+}
+
+// post sends v as JSON and returns the body of a successful response.
+func (s *Server) post(path string, v interface{}) ([]byte, error) {
+	return s.postAs(User{}, path, v)
+}
+
+// postAs is post for routes that need user to be logged in. A User without a Token sends
+// the request anonymously.
+func (s *Server) postAs(user User, path string, v interface{}) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(user, http.MethodPost, path, bytes.NewReader(payload))
+}
+
+// StatusError is returned for a response other than 200 or 201.
+type StatusError struct {
+	Path   string
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s answered %d: %s", e.Path, e.Status, e.Body)
+}
+
+// HasStatus reports whether err is a StatusError with that status.
+func HasStatus(err error, status int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Status == status
+}
+
+// do sends a request as user and returns the body of a 200 or 201 response, or a *StatusError.
+func (s *Server) do(user User, method, path string, body io.Reader) ([]byte, error) {
+	req, err := s.request(user, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	_, respBody, err := s.send(req)
+	return respBody, err
+}
+
+// request returns a request to path, sent as user.
+func (s *Server) request(user User, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if user.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+	}
+	return req, nil
+}
+
+// send sends a request and returns the headers and body of a 200 or 201 response, or a *StatusError.
+func (s *Server) send(req *http.Request) (http.Header, []byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, nil, &StatusError{Path: req.URL.RequestURI(), Status: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	return resp.Header, respBody, nil
+}
+
+// Frame is a frame received from the server. Replies that only report a failure carry Error instead.
+// The text of a chat message is Frame.Message.Message, the embedded Message being the frame.
+type Frame struct {
+	realtimeforum.Message
+	Error string          `json:"error"`
+	Raw   json.RawMessage `json:"-"`
+}
+
+func (f Frame) String() string { return string(f.Raw) }
+
+// Client is a connection of a user, over WebSocket, Server-Sent Events or long-polling. Frames
+// are read in the background and consumed in order by Next, Expect and WaitFor, whatever the
+// transport, so scenarios can run over any of them.
+type Client struct {
+	User    User
+	Timeout time.Duration // How long Expect and WaitFor wait; DefaultTimeout if zero
+
+	send   func(realtimeforum.Message) error
+	hangUp func() error
+	frames chan Frame
+	done   chan struct{} // Closed when the connection stopped reading
+	err    error         // Why reading stopped, set before done is closed
+	close  sync.Once
+}
+
+func newClient(user User) *Client {
+	return &Client{User: user, frames: make(chan Frame, 256), done: make(chan struct{})}
+}
+
+// Dial opens a /ws connection for user.
+func (s *Server) Dial(user User) (*Client, error) {
+	return s.Resume(user, -1)
+}
+
+// Resume opens a /ws connection for user, resuming from lastSeq, the sequence number of the last
+// frame a previous connection received, unless it is negative.
+func (s *Server) Resume(user User, lastSeq int64) (*Client, error) {
+	wsURL := "ws" + strings.TrimPrefix(s.URL, "http") + "/ws?token=" + url.QueryEscape(user.Token)
+	if lastSeq >= 0 {
+		wsURL += "&lastSeq=" + strconv.FormatInt(lastSeq, 10)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connecting %s: %w", user.Username, err)
+	}
+	c := newClient(user)
+	c.send = func(message realtimeforum.Message) error { return conn.WriteJSON(message) }
+	c.hangUp = func() error {
+		deadline := time.Now().Add(time.Second)
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+		return conn.Close()
+	}
+	go func() {
+		defer close(c.done)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				c.err = err
+				return
+			}
+			if err := c.deliver(data); err != nil {
+				c.err = err
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// deliver decodes a frame and queues it for Next.
+func (c *Client) deliver(data []byte) error {
+	frame := Frame{Raw: data}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return fmt.Errorf("decoding frame %s: %w", data, err)
+	}
+	c.frames <- frame
+	return nil
+}
+
+// Send writes a frame. SenderID is left to the server, which ignores it anyway.
+func (c *Client) Send(message realtimeforum.Message) error {
+	return c.send(message)
+}
+
+// Close closes the connection with a normal closure. Closing twice is a no-op.
+func (c *Client) Close() error {
+	var err error
+	c.close.Do(func() {
+		err = c.hangUp()
+	})
+	return err
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// Next returns the next frame, waiting at most timeout.
+func (c *Client) Next(timeout time.Duration) (Frame, error) {
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	default:
+	}
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	case <-c.done:
+		// Frames read before the connection stopped are still delivered
+		select {
+		case frame := <-c.frames:
+			return frame, nil
+		default:
+		}
+		return Frame{}, fmt.Errorf("%s: connection closed: %v", c.User.Username, c.err)
+	case <-time.After(timeout):
+		return Frame{}, fmt.Errorf("%s: no frame within %v", c.User.Username, timeout)
+	}
+}
+
+// Expect requires the next frame to match; what describes it in the error.
+func (c *Client) Expect(what string, match func(Frame) bool) (Frame, error) {
+	frame, err := c.Next(c.timeout())
+	if err != nil {
+		return Frame{}, fmt.Errorf("expecting %s: %w", what, err)
+	}
+	if !match(frame) {
+		return Frame{}, fmt.Errorf("%s: expecting %s, got %s", c.User.Username, what, frame)
+	}
+	return frame, nil
+}
+
+// Snapshot returns the presence snapshot that starts a connection. Status changes broadcast
+// while the server was registering the connection, such as those of the users of the previous
+// scenario going offline, can arrive first and are skipped.
+func (c *Client) Snapshot() (Frame, error) {
+	for {
+		frame, err := c.Next(c.timeout())
+		if err != nil {
+			return Frame{}, fmt.Errorf("expecting presence snapshot: %w", err)
+		}
+		switch frame.Type {
+		case "onlineUsers":
+			return frame, nil
+		case "userStatusChange":
+			continue
+		}
+		return Frame{}, fmt.Errorf("%s: expecting presence snapshot, got %s", c.User.Username, frame)
+	}
+}
+
+// WaitFor skips frames until one matches.
+func (c *Client) WaitFor(what string, match func(Frame) bool) (Frame, error) {
+	deadline := time.Now().Add(c.timeout())
+	var skipped []string
+	for {
+		frame, err := c.Next(time.Until(deadline))
+		if err != nil {
+			return Frame{}, fmt.Errorf("waiting for %s (skipped %v): %w", what, skipped, err)
+		}
+		if match(frame) {
+			return frame, nil
+		}
+		skipped = append(skipped, frame.String())
+	}
+}
+
+// ExpectNone requires that no matching frame arrives during d. Other frames are consumed.
+// With a d of zero, only the frames already received are checked.
+func (c *Client) ExpectNone(what string, d time.Duration, match func(Frame) bool) error {
+	deadline := time.Now().Add(d)
+	for {
+		select {
+		case frame := <-c.frames:
+			if match(frame) {
+				return fmt.Errorf("%s: expecting no %s, got %s", c.User.Username, what, frame)
+			}
+			continue
+		default:
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil
+		}
+		select {
+		case frame := <-c.frames:
+			if match(frame) {
+				return fmt.Errorf("%s: expecting no %s, got %s", c.User.Username, what, frame)
+			}
+		case <-c.done:
+			return nil
+		case <-time.After(remaining):
+			return nil
+		}
+	}
+}
+
+// OfType matches frames of type frameType.
+func OfType(frameType string) func(Frame) bool {
+	return func(f Frame) bool { return f.Type == frameType }
+}
+
+// NotPresence matches every frame except presence snapshots and status changes, which
+// users of other scenarios can cause at any time.
+func NotPresence(f Frame) bool {
+	return f.Type != "onlineUsers" && f.Type != "userStatusChange"
+}
+
+// StatusChange matches the "userStatusChange" frame telling that userID went online or offline.
+func StatusChange(userID int64, online bool) func(Frame) bool {
+	return func(f Frame) bool {
+		if f.Type != "userStatusChange" || len(f.OnlineUsers) != 1 {
+			return false
+		}
+		status := f.OnlineUsers[0]
+		return status.UserID == userID && status.IsOnline == online
+	}
+}
@@ -0,0 +1,288 @@
+package e2e
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+var clusterScenarios = []scenario{
+	{"presence across nodes", testClusterPresence},
+	{"private delivery across nodes", testClusterPrivateDelivery},
+	{"broadcast across nodes", testClusterBroadcast},
+	{"post feed across nodes", testClusterPostFeed},
+	{"resume on the other node", testClusterResume},
+}
+
+// TestCluster runs the scenarios that need two nodes sharing a database and the NATS backplane
+// at LIVECHAT_TEST_NATS_URL, and is skipped without it. Users are registered on the first node
+// and connect to either.
+func TestCluster(t *testing.T) {
+	natsURL := os.Getenv(envNATSURL)
+	if natsURL == "" {
+		t.Skip(envNATSURL + " is not set")
+	}
+
+	// Tokens issued by one node must be accepted by the other
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	node := func(id, database string) *Server {
+		return startServer(t, Options{
+			Env:      []string{"LIVECHAT_SECRET_KEY=" + hex.EncodeToString(key)},
+			Database: database,
+			Args:     []string{"--backplane", "nats", "--backplane-url", natsURL, "--node-id", id},
+		})
+	}
+	a := node("e2e-a", "")
+	b := node("e2e-b", a.Database)
+
+	for _, sc := range clusterScenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			if err := runScenario(a, b, sc); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func testClusterPresence(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	// Presence reaches the other node asynchronously: once carol, connected there, saw alice
+	// come online, that node knows about alice
+	if _, err := sc.dialTo(sc.peer, carol); err != nil {
+		return err
+	}
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+
+	// The snapshot of the other node includes alice
+	bobRemote, err := sc.peer.Dial(bob)
+	if err != nil {
+		return err
+	}
+	sc.clients = append(sc.clients, bobRemote)
+	snapshot, err := bobRemote.Snapshot()
+	if err != nil {
+		return err
+	}
+	if online := onlineIDs(snapshot); !online[alice.ID] || !online[bob.ID] {
+		return fmt.Errorf("snapshot %s should list %s, connected to the other node, and %s online", snapshot, alice.Username, bob.Username)
+	}
+	if _, err := aliceClient.WaitFor(bob.Username+" online on the other node", StatusChange(bob.ID, true)); err != nil {
+		return err
+	}
+
+	// bob stays online while connected to either node
+	bobLocal, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	sc.hangUp(bobRemote)
+	if err := aliceClient.ExpectNone(bob.Username+" offline while connected to this node", quietPeriod, StatusChange(bob.ID, false)); err != nil {
+		return err
+	}
+	bobRemote, err = sc.dialTo(sc.peer, bob)
+	if err != nil {
+		return err
+	}
+	sc.hangUp(bobLocal)
+	if err := aliceClient.ExpectNone(bob.Username+" offline while connected to the other node", quietPeriod, StatusChange(bob.ID, false)); err != nil {
+		return err
+	}
+
+	sc.hangUp(bobRemote)
+	_, err = aliceClient.WaitFor(bob.Username+" offline", StatusChange(bob.ID, false))
+	return err
+}
+
+func testClusterPrivateDelivery(sc *scene) error {
+	users, err := sc.users("alice", "bob")
+	if err != nil {
+		return err
+	}
+	alice, bob := users[0], users[1]
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	bobClient, err := sc.dialTo(sc.peer, bob)
+	if err != nil {
+		return err
+	}
+
+	err = aliceClient.Send(realtimeforum.Message{Type: "private", ReceiverID: bob.ID, Message: "hi bob", ClientMessageID: "e2e-cluster-1"})
+	if err != nil {
+		return err
+	}
+	ack, err := sc.ack(aliceClient)
+	if err != nil {
+		return err
+	}
+	if ack.Status != realtimeforum.MessageStatusDelivered {
+		return fmt.Errorf("ack %s should report the message delivered to the other node", ack)
+	}
+	message, err := bobClient.WaitFor("private message", OfType("private"))
+	if err != nil {
+		return err
+	}
+	if message.Message.Message != "hi bob" || message.SenderID != alice.ID || message.MessageID != ack.MessageID {
+		return fmt.Errorf("private message %s does not match what %s sent", message, alice.Username)
+	}
+
+	// And back, from the other node
+	if err := bobClient.Send(realtimeforum.Message{Type: "private", ReceiverID: alice.ID, Message: "hi alice", ClientMessageID: "e2e-cluster-2"}); err != nil {
+		return err
+	}
+	if _, err := sc.ack(bobClient); err != nil {
+		return err
+	}
+	reply, err := aliceClient.WaitFor("reply", OfType("private"))
+	if err != nil {
+		return err
+	}
+	if reply.Message.Message != "hi alice" || reply.SenderID != bob.ID {
+		return fmt.Errorf("reply %s does not match what %s sent", reply, bob.Username)
+	}
+	return nil
+}
+
+func testClusterBroadcast(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	bobClient, err := sc.dialTo(sc.peer, bob)
+	if err != nil {
+		return err
+	}
+	carolClient, err := sc.dial(carol)
+	if err != nil {
+		return err
+	}
+	// The sender's devices on the other node do not get the broadcast either
+	aliceRemote, err := sc.dialTo(sc.peer, alice)
+	if err != nil {
+		return err
+	}
+
+	if err := aliceClient.Send(realtimeforum.Message{Type: "broadcast", Message: "hi all", ClientMessageID: "e2e-cluster-3"}); err != nil {
+		return err
+	}
+	ack, err := sc.ack(aliceClient)
+	if err != nil {
+		return err
+	}
+	for _, client := range []*Client{bobClient, carolClient} {
+		message, err := client.WaitFor("broadcast", OfType("broadcast"))
+		if err != nil {
+			return err
+		}
+		if message.Message.Message != "hi all" || message.SenderID != alice.ID || message.MessageID != ack.MessageID {
+			return fmt.Errorf("broadcast %s does not match what %s sent", message, alice.Username)
+		}
+	}
+	if err := aliceRemote.ExpectNone("broadcast on the sender's other device", quietPeriod, NotPresence); err != nil {
+		return err
+	}
+	return aliceClient.ExpectNone("frame besides the ack", 0, NotPresence)
+}
+
+func testClusterPostFeed(sc *scene) error {
+	users, err := sc.users("alice", "bob")
+	if err != nil {
+		return err
+	}
+	alice, bob := users[0], users[1]
+
+	bobClient, err := sc.dialTo(sc.peer, bob)
+	if err != nil {
+		return err
+	}
+	if err := sc.subscribe(bobClient, "subscribe", 3); err != nil {
+		return err
+	}
+	if _, err := sc.server.NewPost(alice, "from the other node", "posted on a", 3); err != nil {
+		return err
+	}
+	return newPost(bobClient, alice, "from the other node")
+}
+
+// testClusterResume checks that a client resuming on another node than the one it was connected
+// to is asked to resync: sessions are kept per node, so the other node cannot know what it missed
+// and must not replay the events of its own session instead.
+func testClusterResume(sc *scene) error {
+	users, err := sc.users("alice", "bob")
+	if err != nil {
+		return err
+	}
+	alice, bob := users[0], users[1]
+
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	// alice also has a session on the other node, which records the same events
+	if _, err := sc.dialTo(sc.peer, alice); err != nil {
+		return err
+	}
+
+	send := func(text, clientMessageID string) error {
+		if err := bobClient.Send(realtimeforum.Message{Type: "private", ReceiverID: alice.ID, Message: text, ClientMessageID: clientMessageID}); err != nil {
+			return err
+		}
+		_, err := sc.ack(bobClient)
+		return err
+	}
+	if err := send("before", "e2e-cluster-resume-1"); err != nil {
+		return err
+	}
+	last, err := aliceClient.WaitFor("private message", OfType("private"))
+	if err != nil {
+		return err
+	}
+	sc.hangUp(aliceClient)
+	if err := send("missed", "e2e-cluster-resume-2"); err != nil {
+		return err
+	}
+
+	resumed, err := sc.peer.Resume(alice, last.Seq)
+	if err != nil {
+		return err
+	}
+	sc.clients = append(sc.clients, resumed)
+	resync, err := resumed.Expect("resync", OfType("resync"))
+	if err != nil {
+		return err
+	}
+	if _, err := resumed.Snapshot(); err != nil {
+		return err
+	}
+	if resync.Seq == last.Seq {
+		return fmt.Errorf("resync %s should give the sequence of the other node, not %d", resync, last.Seq)
+	}
+	return resumed.ExpectNone("replayed private message", quietPeriod, OfType("private"))
+}
@@ -0,0 +1,71 @@
+package e2e
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// envNATSURL names the NATS server the cluster tests connect their nodes through, such as
+// nats://localhost:4222. The cluster tests are skipped without it.
+const envNATSURL = "LIVECHAT_TEST_NATS_URL"
+
+// serverBinary is the server built with the race detector by TestMain, which every test runs.
+var serverBinary string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() {
+		os.Exit(m.Run())
+	}
+
+	dir, err := os.MkdirTemp("", "livechat-e2e-build")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "building the server:", err)
+		os.Exit(1)
+	}
+	serverBinary = filepath.Join(dir, "livechat")
+	if err := Build(serverBinary, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startServer starts a server with its database in a directory of t, and stops it when t
+// ends. t fails if the server did not stop cleanly or the race detector reported a data
+// race, and then shows the logs of the server.
+func startServer(t *testing.T, opts Options) *Server {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("end-to-end tests start a server")
+	}
+	opts.Binary = serverBinary
+	opts.Dir = t.TempDir()
+	s, err := Start(opts)
+	if err != nil {
+		t.Fatalf("starting the server: %v\n%s", err, readLogs(filepath.Join(opts.Dir, "server.log")))
+	}
+	t.Cleanup(func() {
+		if err := s.Stop(); err != nil {
+			t.Error(err)
+		}
+		if t.Failed() {
+			t.Logf("server logs:\n%s", readLogs(s.LogPath))
+		}
+	})
+	return s
+}
+
+func readLogs(path string) string {
+	logs, err := os.ReadFile(path)
+	if err != nil {
+		return err.Error()
+	}
+	return string(logs)
+}
@@ -0,0 +1,117 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// watchedCategory is a category no other scenario posts in, so only this one notifies its watchers.
+const watchedCategory = 4
+
+// testNotifications checks that watchers are notified live of new posts in a category and of new
+// comments on a post, except of what they did and of users they muted, and that the
+// notifications are kept for those who were not connected.
+func testNotifications(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol", "dave")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol, dave := users[0], users[1], users[2], users[3]
+	for _, user := range users {
+		if err := sc.server.Watch(user, realtimeforum.WatchCategory, watchedCategory); err != nil {
+			return err
+		}
+	}
+	if err := sc.server.Mute(carol, alice); err != nil {
+		return err
+	}
+	if err := sc.server.Watch(bob, "thread", 1); !HasStatus(err, http.StatusBadRequest) {
+		return fmt.Errorf("watch of an unknown kind: got error %v, want 400", err)
+	}
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+
+	postID, err := sc.server.NewPost(alice, "watched", "in a watched category", watchedCategory)
+	if err != nil {
+		return err
+	}
+	frame, err := bobClient.WaitFor("post notification", OfType("notification"))
+	if err != nil {
+		return err
+	}
+	n := frame.Notification
+	if n == nil || n.Kind != realtimeforum.NotificationPost || int64(n.PostID) != postID || n.ActorUsername != alice.Username ||
+		n.PostTitle != "watched" || n.CategoryID != watchedCategory || int64(n.UserID) != bob.ID {
+		return fmt.Errorf("post notification %s: want alice's post for bob", frame)
+	}
+
+	if err := sc.server.Watch(bob, realtimeforum.WatchPost, postID); err != nil {
+		return err
+	}
+	if err := sc.server.Bookmark(bob, postID); err != nil {
+		return err
+	}
+	if err := sc.server.Bookmark(bob, postID+1000); !HasStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("bookmark of a missing post: got error %v, want 404", err)
+	}
+	bookmarks, err := sc.server.Bookmarks(bob)
+	if err != nil {
+		return err
+	}
+	if len(bookmarks) != 1 || int64(bookmarks[0].PostID) != postID {
+		return fmt.Errorf("bookmarks of bob: got %+v, want the watched post", bookmarks)
+	}
+
+	comment, err := sc.server.Comment(alice, postID, 0, "a comment to watch")
+	if err != nil {
+		return err
+	}
+	frame, err = bobClient.WaitFor("comment notification", OfType("notification"))
+	if err != nil {
+		return err
+	}
+	if n := frame.Notification; n == nil || n.Kind != realtimeforum.NotificationComment || n.CommentID != comment.CommentID {
+		return fmt.Errorf("comment notification %s: want comment %d", frame, comment.CommentID)
+	}
+	// Nobody is notified of their own comment
+	if _, err := sc.server.Comment(bob, postID, 0, "my own comment"); err != nil {
+		return err
+	}
+	if err := bobClient.ExpectNone("notification of bob's own comment", quietPeriod, OfType("notification")); err != nil {
+		return err
+	}
+
+	notifications, unread, err := sc.server.Notifications(bob, "")
+	if err != nil {
+		return err
+	}
+	if len(notifications) != 2 || unread != 2 || notifications[0].Kind != realtimeforum.NotificationComment {
+		return fmt.Errorf("notifications of bob: got %+v with %d unread, want the comment then the post, unread", notifications, unread)
+	}
+	if err := sc.server.ReadNotifications(bob, 0); err != nil {
+		return err
+	}
+	if _, unread, err = sc.server.Notifications(bob, "limit=1"); err != nil || unread != 0 {
+		return fmt.Errorf("unread notifications of bob after reading them: got %d, %v, want 0", unread, err)
+	}
+
+	// Dave was not connected and finds his notification later; carol muted alice and the author
+	// is not notified of her own post
+	for _, want := range []struct {
+		user  User
+		count int
+	}{{dave, 1}, {carol, 0}, {alice, 0}} {
+		notifications, unread, err := sc.server.Notifications(want.user, "")
+		if err != nil {
+			return err
+		}
+		if len(notifications) != want.count || unread != want.count {
+			return fmt.Errorf("notifications of %s: got %+v with %d unread, want %d", want.user.Username, notifications, unread, want.count)
+		}
+	}
+	return nil
+}
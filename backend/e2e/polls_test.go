@@ -0,0 +1,98 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// testPolls checks that users vote once in the poll of a post, and that the subscribers of its
+// category see the results change without learning who voted.
+func testPolls(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+	carolClient, err := sc.dial(carol)
+	if err != nil {
+		return err
+	}
+	if err := sc.subscribe(carolClient, "subscribe", 1); err != nil {
+		return err
+	}
+
+	closesAt := time.Now().Add(time.Hour)
+	post := realtimeforum.Posts{Title: "Next meetup?", Content: "Vote below", CategoryID: 1}
+	post.Poll = &realtimeforum.Poll{ClosesAt: &closesAt, Options: []realtimeforum.PollOption{{Text: "Paris"}}}
+	if _, err := sc.server.CreatePost(alice, post); !HasStatus(err, http.StatusBadRequest) {
+		return fmt.Errorf("poll with one option: got error %v, want 400", err)
+	}
+	post.Poll.Options = append(post.Poll.Options, realtimeforum.PollOption{Text: "Berlin"})
+	postID, err := sc.server.CreatePost(alice, post)
+	if err != nil {
+		return err
+	}
+	if err := newPost(carolClient, alice, post.Title); err != nil {
+		return err
+	}
+	got, err := sc.server.GetPost(bob, postID)
+	if err != nil {
+		return err
+	}
+	if got.Poll == nil || len(got.Poll.Options) != 2 || got.Poll.Closed || got.Poll.ClosesAt == nil {
+		return fmt.Errorf("poll of the post: got %+v, want an open poll with 2 options", got.Poll)
+	}
+	paris, berlin := got.Poll.Options[0].OptionID, got.Poll.Options[1].OptionID
+
+	poll, err := sc.server.Vote(bob, postID, paris)
+	if err != nil {
+		return err
+	}
+	if poll.Voters != 1 || poll.Options[0].Votes != 1 || !slices.Equal(poll.Options[0].Voters, []string{bob.Username}) ||
+		!slices.Equal(poll.MyVotes, []int{paris}) {
+		return fmt.Errorf("poll after voting: got %+v, want bob's vote for Paris", poll)
+	}
+	frame, err := carolClient.WaitFor("poll results", OfType("pollResults"))
+	if err != nil {
+		return err
+	}
+	if frame.Post == nil || int64(frame.Post.PostID) != postID || frame.Poll == nil || frame.Poll.Options[0].Votes != 1 ||
+		frame.Poll.Options[0].Voters != nil || frame.Poll.MyVotes != nil {
+		return fmt.Errorf("poll results %s: want one vote for Paris, without the voter", frame)
+	}
+
+	if _, err := sc.server.Vote(bob, postID, berlin); !HasStatus(err, http.StatusConflict) {
+		return fmt.Errorf("second vote: got error %v, want 409", err)
+	}
+	if _, err := sc.server.Vote(carol, postID, paris, berlin); !HasStatus(err, http.StatusBadRequest) {
+		return fmt.Errorf("two options in a single choice poll: got error %v, want 400", err)
+	}
+
+	// Several options may be chosen in a multiple choice poll, and nobody sees who chose them
+	post.Poll = &realtimeforum.Poll{Multiple: true, Anonymous: true,
+		Options: []realtimeforum.PollOption{{Text: "Talks"}, {Text: "Workshops"}, {Text: "Drinks"}}}
+	anonymousID, err := sc.server.CreatePost(alice, post)
+	if err != nil {
+		return err
+	}
+	got, err = sc.server.GetPost(carol, anonymousID)
+	if err != nil {
+		return err
+	}
+	options := got.Poll.Options
+	if _, err := sc.server.Vote(carol, anonymousID, options[0].OptionID, options[2].OptionID); err != nil {
+		return err
+	}
+	got, err = sc.server.GetPost(alice, anonymousID)
+	if err != nil {
+		return err
+	}
+	if got.Poll.Voters != 1 || got.Poll.Options[0].Votes != 1 || got.Poll.Options[2].Votes != 1 || got.Poll.Options[0].Voters != nil {
+		return fmt.Errorf("anonymous poll: got %+v, want carol's two votes without her name", got.Poll)
+	}
+	return nil
+}
@@ -0,0 +1,793 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// quietPeriod is how long a client must receive nothing of a kind for it to count as not sent.
+const quietPeriod = 300 * time.Millisecond
+
+// scenario checks one behaviour of the hub against a running server.
+type scenario struct {
+	name string
+	run  func(sc *scene) error
+}
+
+var scenarios = []scenario{
+	{"presence snapshot", testPresenceSnapshot},
+	{"status changes", testStatusChanges},
+	{"private delivery", testPrivateDelivery},
+	{"broadcast excludes sender", testBroadcastExcludesSender},
+	{"server-sent events", func(sc *scene) error { return testFallback(sc, sc.server.DialEvents) }},
+	{"long-polling", func(sc *scene) error { return testFallback(sc, sc.server.DialPoll) }},
+	{"long-polling acknowledgements", testPollAcknowledgements},
+	{"post feed", testPostFeed},
+	{"post edits", testPostEdits},
+	{"search", testSearch},
+	{"comment threads", testCommentThreads},
+	{"markdown", testMarkdown},
+	{"attachments", testAttachments},
+	{"polls", testPolls},
+	{"notifications", testNotifications},
+}
+
+// TestSingleNode runs every scenario against one server. Scenarios create their own users, so
+// they only see each other through presence frames, which they tolerate.
+func TestSingleNode(t *testing.T) {
+	s := startServer(t, Options{})
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			if err := runScenario(s, nil, sc); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func runScenario(s, peer *Server, sc scenario) (err error) {
+	scene := &scene{server: s, peer: peer}
+	defer scene.close()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return sc.run(scene)
+}
+
+// scene holds the clients of one scenario so they are all closed when it ends.
+type scene struct {
+	server  *Server
+	peer    *Server // Second node of a cluster; nil outside cluster scenarios
+	clients []*Client
+}
+
+func (sc *scene) close() {
+	for _, c := range sc.clients {
+		c.Close()
+	}
+}
+
+// user registers a user and logs them in.
+func (sc *scene) user(name string) (User, error) {
+	return sc.server.NewUser(name)
+}
+
+// dial connects user and consumes the frames of the connection settling: the new client's
+// presence snapshot and its own status change, and that status change on the clients
+// already connected.
+func (sc *scene) dial(user User) (*Client, error) {
+	return sc.dialTo(sc.server, user)
+}
+
+// dialTo is dial on a given node, whose status change must also reach the clients connected
+// to the other node.
+func (sc *scene) dialTo(s *Server, user User) (*Client, error) {
+	return sc.connect(s.Dial, user)
+}
+
+// connect is dial over the transport of the given dial function.
+func (sc *scene) connect(dial func(User) (*Client, error), user User) (*Client, error) {
+	client, err := dial(user)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.Snapshot(); err != nil {
+		return nil, err
+	}
+	if _, err := client.WaitFor("own status change", StatusChange(user.ID, true)); err != nil {
+		return nil, err
+	}
+	for _, other := range sc.clients {
+		if _, err := other.WaitFor(user.Username+" online", StatusChange(user.ID, true)); err != nil {
+			return nil, err
+		}
+	}
+	sc.clients = append(sc.clients, client)
+	return client, nil
+}
+
+// hangUp closes a client of the scene, which then stops waiting for its frames.
+func (sc *scene) hangUp(client *Client) {
+	client.Close()
+	for i, c := range sc.clients {
+		if c == client {
+			sc.clients = append(sc.clients[:i], sc.clients[i+1:]...)
+			break
+		}
+	}
+}
+
+// users registers one user per name.
+func (sc *scene) users(names ...string) ([]User, error) {
+	users := make([]User, len(names))
+	for i, name := range names {
+		user, err := sc.user(name)
+		if err != nil {
+			return nil, err
+		}
+		users[i] = user
+	}
+	return users, nil
+}
+
+// ack returns the reply to a chat message, which must be the first frame other than
+// presence the sender receives after sending it.
+func (sc *scene) ack(sender *Client) (Frame, error) {
+	reply, err := sender.WaitFor("reply to the message", NotPresence)
+	if err != nil {
+		return Frame{}, err
+	}
+	if reply.Type != "ack" {
+		return Frame{}, fmt.Errorf("%s: expecting an ack, got %s", sender.User.Username, reply)
+	}
+	return reply, nil
+}
+
+// onlineIDs returns the IDs listed as online in a presence frame.
+func onlineIDs(f Frame) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, status := range f.OnlineUsers {
+		if status.IsOnline {
+			ids[status.UserID] = true
+		}
+	}
+	return ids
+}
+
+func testPresenceSnapshot(sc *scene) error {
+	users, err := sc.users("alice", "bob")
+	if err != nil {
+		return err
+	}
+	alice, bob := users[0], users[1]
+
+	if _, err := sc.dial(alice); err != nil {
+		return err
+	}
+
+	// The snapshot starts a connection and includes the user and everyone online
+	client, err := sc.server.Dial(bob)
+	if err != nil {
+		return err
+	}
+	sc.clients = append(sc.clients, client)
+	snapshot, err := client.Snapshot()
+	if err != nil {
+		return err
+	}
+	online := onlineIDs(snapshot)
+	if !online[alice.ID] || !online[bob.ID] {
+		return fmt.Errorf("snapshot %s should list %s and %s online", snapshot, alice.Username, bob.Username)
+	}
+	return nil
+}
+
+func testStatusChanges(sc *scene) error {
+	users, err := sc.users("alice", "bob")
+	if err != nil {
+		return err
+	}
+	alice, bob := users[0], users[1]
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	// dial waits for alice to see bob come online
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+
+	// A second device does not change bob's status, and neither does closing one of two devices
+	secondDevice, err := sc.server.Dial(bob)
+	if err != nil {
+		return err
+	}
+	if _, err := secondDevice.Snapshot(); err != nil {
+		return err
+	}
+	secondDevice.Close()
+	if err := aliceClient.ExpectNone(bob.Username+" offline while another device is connected", quietPeriod, StatusChange(bob.ID, false)); err != nil {
+		return err
+	}
+
+	bobClient.Close()
+	_, err = aliceClient.WaitFor(bob.Username+" offline", StatusChange(bob.ID, false))
+	return err
+}
+
+func testPrivateDelivery(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	bobPhone, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	bobLaptop, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	carolClient, err := sc.dial(carol)
+	if err != nil {
+		return err
+	}
+
+	err = aliceClient.Send(realtimeforum.Message{Type: "private", ReceiverID: bob.ID, Message: "hi bob", ClientMessageID: "e2e-1"})
+	if err != nil {
+		return err
+	}
+	ack, err := sc.ack(aliceClient)
+	if err != nil {
+		return err
+	}
+	if ack.Status != realtimeforum.MessageStatusDelivered || ack.ClientMessageID != "e2e-1" || ack.MessageID == 0 {
+		return fmt.Errorf("ack %s should report e2e-1 delivered with its message ID", ack)
+	}
+
+	// Every connection of the receiver gets the message, and nobody else
+	for _, client := range []*Client{bobPhone, bobLaptop} {
+		message, err := client.WaitFor("private message", OfType("private"))
+		if err != nil {
+			return err
+		}
+		if message.Message.Message != "hi bob" || message.SenderID != alice.ID || message.SenderUsername != alice.Username ||
+			message.MessageID != ack.MessageID {
+			return fmt.Errorf("private message %s does not match what %s sent", message, alice.Username)
+		}
+	}
+	if err := carolClient.ExpectNone("frame about the private message", quietPeriod, NotPresence); err != nil {
+		return err
+	}
+	return aliceClient.ExpectNone("frame besides the ack", 0, NotPresence)
+}
+
+func testBroadcastExcludesSender(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	carolClient, err := sc.dial(carol)
+	if err != nil {
+		return err
+	}
+
+	if err := aliceClient.Send(realtimeforum.Message{Type: "broadcast", Message: "hi all", ClientMessageID: "e2e-2"}); err != nil {
+		return err
+	}
+	ack, err := sc.ack(aliceClient)
+	if err != nil {
+		return err
+	}
+	for _, client := range []*Client{bobClient, carolClient} {
+		message, err := client.WaitFor("broadcast", OfType("broadcast"))
+		if err != nil {
+			return err
+		}
+		if message.Message.Message != "hi all" || message.SenderID != alice.ID || message.MessageID != ack.MessageID {
+			return fmt.Errorf("broadcast %s does not match what %s sent", message, alice.Username)
+		}
+	}
+	return aliceClient.ExpectNone("frame besides the ack", quietPeriod, NotPresence)
+}
+
+// testFallback checks that a client connected with dial, over a transport other than
+// WebSocket, takes part in presence and chat like a WebSocket client.
+func testFallback(sc *scene, dial func(User) (*Client, error)) error {
+	users, err := sc.users("alice", "bob")
+	if err != nil {
+		return err
+	}
+	alice, bob := users[0], users[1]
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	// connect checks bob's presence snapshot and that alice sees him come online
+	bobClient, err := sc.connect(dial, bob)
+	if err != nil {
+		return err
+	}
+
+	err = aliceClient.Send(realtimeforum.Message{Type: "private", ReceiverID: bob.ID, Message: "hi bob", ClientMessageID: "e2e-fallback-1"})
+	if err != nil {
+		return err
+	}
+	ack, err := sc.ack(aliceClient)
+	if err != nil {
+		return err
+	}
+	if ack.Status != realtimeforum.MessageStatusDelivered {
+		return fmt.Errorf("ack %s should report the message delivered", ack)
+	}
+	message, err := bobClient.WaitFor("private message", OfType("private"))
+	if err != nil {
+		return err
+	}
+	if message.Message.Message != "hi bob" || message.SenderID != alice.ID || message.MessageID != ack.MessageID {
+		return fmt.Errorf("private message %s does not match what %s sent", message, alice.Username)
+	}
+
+	// Frames sent by bob get their replies like over WebSocket
+	if err := bobClient.Send(realtimeforum.Message{Type: "private", ReceiverID: alice.ID, Message: "hi alice", ClientMessageID: "e2e-fallback-2"}); err != nil {
+		return err
+	}
+	if _, err := sc.ack(bobClient); err != nil {
+		return err
+	}
+	reply, err := aliceClient.WaitFor("reply", OfType("private"))
+	if err != nil {
+		return err
+	}
+	if reply.Message.Message != "hi alice" || reply.SenderID != bob.ID {
+		return fmt.Errorf("reply %s does not match what %s sent", reply, bob.Username)
+	}
+
+	sc.hangUp(bobClient)
+	_, err = aliceClient.WaitFor(bob.Username+" offline", StatusChange(bob.ID, false))
+	return err
+}
+
+// testPollAcknowledgements checks that long-polling keeps frames until a poll acknowledges them,
+// so that none is lost with a response that never reached the client.
+func testPollAcknowledgements(sc *scene) error {
+	users, err := sc.users("alice")
+	if err != nil {
+		return err
+	}
+	alice := users[0]
+	first, err := sc.server.poll(context.Background(), alice, "", 0)
+	if err != nil {
+		return err
+	}
+	defer sc.server.closePoll(alice, first.Cursor)
+	if len(first.Frames) == 0 {
+		return errors.New("the first poll returned no presence snapshot")
+	}
+
+	// As if the first response was lost, the next poll acknowledges nothing
+	again, err := sc.server.poll(context.Background(), alice, first.Cursor, 0)
+	if err != nil {
+		return err
+	}
+	if again.Seq < first.Seq || len(again.Frames) < len(first.Frames) {
+		return fmt.Errorf("poll without acknowledgement: got %d frames up to %d, want the %d up to %d again",
+			len(again.Frames), again.Seq, len(first.Frames), first.Seq)
+	}
+	for i, frame := range first.Frames {
+		if string(again.Frames[i]) != string(frame) {
+			return fmt.Errorf("poll without acknowledgement: frame %d is %s, want %s", i, again.Frames[i], frame)
+		}
+	}
+
+	// Once acknowledged, they are gone: the poll waits for new frames
+	ctx, cancel := context.WithTimeout(context.Background(), quietPeriod)
+	defer cancel()
+	if after, err := sc.server.poll(ctx, alice, first.Cursor, first.Seq); err == nil && after.Seq-int64(len(after.Frames)) < first.Seq {
+		return fmt.Errorf("poll acknowledging %d: got %d frames up to %d, some of them again", first.Seq, len(after.Frames), after.Seq)
+	}
+	return nil
+}
+
+// subscribe sends a "subscribe" or "unsubscribe" frame and waits for the resulting subscriptions.
+func (sc *scene) subscribe(client *Client, frameType string, categories ...int) error {
+	if err := client.Send(realtimeforum.Message{Type: frameType, Categories: categories}); err != nil {
+		return err
+	}
+	_, err := client.WaitFor("subscriptions", OfType("subscriptions"))
+	return err
+}
+
+// newPost waits for the "newPost" frame of the post titled title by author.
+func newPost(client *Client, author User, title string) error {
+	frame, err := client.WaitFor("new post", OfType("newPost"))
+	if err != nil {
+		return err
+	}
+	if frame.Post == nil || frame.Post.Title != title || int64(frame.Post.UserID) != author.ID || frame.Post.AuthorUsername != author.Username {
+		return fmt.Errorf("new post %s is not %q by %s", frame, title, author.Username)
+	}
+	return nil
+}
+
+// testPostFeed checks that new posts reach the users subscribed to their category, and only them.
+func testPostFeed(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol", "dave")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol, dave := users[0], users[1], users[2], users[3]
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	// Subscriptions are sent with POST by fallback clients
+	carolClient, err := sc.connect(sc.server.DialEvents, carol)
+	if err != nil {
+		return err
+	}
+	if err := sc.subscribe(aliceClient, "subscribe", 1); err != nil {
+		return err
+	}
+	if err := sc.subscribe(bobClient, "subscribe", 2); err != nil {
+		return err
+	}
+	if err := sc.subscribe(carolClient, "subscribe"); err != nil {
+		return err
+	}
+
+	if _, err := sc.server.NewPost(dave, "first", "in category 1", 1); err != nil {
+		return err
+	}
+	for _, client := range []*Client{aliceClient, carolClient} {
+		if err := newPost(client, dave, "first"); err != nil {
+			return err
+		}
+	}
+	if err := bobClient.ExpectNone("post of another category", quietPeriod, OfType("newPost")); err != nil {
+		return err
+	}
+
+	if err := sc.subscribe(aliceClient, "unsubscribe", 1); err != nil {
+		return err
+	}
+	if _, err := sc.server.NewPost(dave, "second", "in category 1 again", 1); err != nil {
+		return err
+	}
+	if err := newPost(carolClient, dave, "second"); err != nil {
+		return err
+	}
+	return aliceClient.ExpectNone("post after unsubscribing", quietPeriod, OfType("newPost"))
+}
+
+// testPostEdits checks that only the author and moderators can edit and delete a post, that
+// subscribers see the changes live, and that deleted posts are only shown to moderators.
+func testPostEdits(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol", "dave")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol, dave := users[0], users[1], users[2], users[3]
+
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	if err := sc.subscribe(bobClient, "subscribe", 1); err != nil {
+		return err
+	}
+	postID, err := sc.server.NewPost(alice, "draft", "first version", 1)
+	if err != nil {
+		return err
+	}
+	if err := newPost(bobClient, alice, "draft"); err != nil {
+		return err
+	}
+
+	if err := sc.server.EditPost(carol, postID, "hijacked", "not mine", 1); !HasStatus(err, http.StatusForbidden) {
+		return fmt.Errorf("editing someone else's post: got %v, want 403", err)
+	}
+	// Moving the post out of bob's category still tells him about it
+	if err := sc.server.EditPost(alice, postID, "final", "second version", 2); err != nil {
+		return err
+	}
+	frame, err := bobClient.WaitFor("edited post", OfType("postEdited"))
+	if err != nil {
+		return err
+	}
+	if post := frame.Post; post == nil || int64(post.PostID) != postID || post.Title != "final" || post.CategoryID != 2 ||
+		post.PreviousCategoryID != 1 || post.EditedAt == nil {
+		return fmt.Errorf("edited post %s does not match the edit", frame)
+	}
+
+	if err := sc.server.DeletePost(carol, postID); !HasStatus(err, http.StatusForbidden) {
+		return fmt.Errorf("deleting someone else's post: got %v, want 403", err)
+	}
+	if err := sc.server.MakeModerator(dave); err != nil {
+		return err
+	}
+	if err := sc.subscribe(bobClient, "subscribe", 2); err != nil {
+		return err
+	}
+	if err := sc.server.DeletePost(dave, postID); err != nil {
+		return err
+	}
+	frame, err = bobClient.WaitFor("deleted post", OfType("postDeleted"))
+	if err != nil {
+		return err
+	}
+	if frame.Post == nil || int64(frame.Post.PostID) != postID || !frame.Post.Deleted {
+		return fmt.Errorf("deleted post %s does not identify the post", frame)
+	}
+
+	if _, err := sc.server.GetPost(carol, postID); !HasStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("fetching a deleted post: got %v, want 404", err)
+	}
+	post, err := sc.server.GetPost(dave, postID)
+	if err != nil {
+		return err
+	}
+	if post.DeletedAt == nil || int64(post.DeletedBy) != dave.ID {
+		return fmt.Errorf("deleted post seen by a moderator: got %+v, want it marked deleted by %s", post, dave.Username)
+	}
+	return nil
+}
+
+// testSearch checks that posts and private messages are found by search, private messages only
+// by the people in the conversation.
+func testSearch(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+	// Scenarios share the server, so the word searched for is made unique with a username
+	word := "needle" + alice.Username
+
+	if _, err := sc.server.NewPost(alice, "About "+word, "Where to find it", 1); err != nil {
+		return err
+	}
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	err = aliceClient.Send(realtimeforum.Message{Type: "private", ReceiverID: bob.ID, Message: "the " + word + " is here"})
+	if err != nil {
+		return err
+	}
+	if _, err := sc.ack(aliceClient); err != nil {
+		return err
+	}
+
+	for _, check := range []struct {
+		user  User
+		query string
+		want  []string
+	}{
+		{bob, word, []string{realtimeforum.SearchKindChat, realtimeforum.SearchKindPost}}, // Sorted
+		{carol, word, []string{realtimeforum.SearchKindPost}},
+		{bob, "in:chats author:" + alice.Username + " " + word, []string{realtimeforum.SearchKindChat}},
+		{bob, "author:" + carol.Username + " " + word, nil},
+	} {
+		results, err := sc.server.Search(check.user, check.query)
+		if err != nil {
+			return err
+		}
+		var kinds []string
+		for _, result := range results {
+			if !strings.Contains(result.Snippet, "<mark>"+word+"</mark>") {
+				return fmt.Errorf("snippet %q does not highlight %s", result.Snippet, word)
+			}
+			kinds = append(kinds, result.Kind)
+		}
+		slices.Sort(kinds)
+		if !slices.Equal(kinds, check.want) {
+			return fmt.Errorf("%s searching %q found %v, want %v", check.user.Username, check.query, kinds, check.want)
+		}
+	}
+	return nil
+}
+
+// testCommentThreads checks that replies nest up to the maximum depth, that threads are listed
+// as a tree or flat and page by page, and that quotes are rendered as safe HTML, except those of
+// blocked users.
+func testCommentThreads(sc *scene) error {
+	users, err := sc.users("alice", "bob", "carol")
+	if err != nil {
+		return err
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	postID, err := sc.server.NewPost(alice, "threads", "what do you think?", 1)
+	if err != nil {
+		return err
+	}
+	top, err := sc.server.Comment(bob, postID, 0, "<b>bold</b> claim")
+	if err != nil {
+		return err
+	}
+	quoting := fmt.Sprintf(">>comment:%d\nI disagree", top.CommentID)
+	reply, err := sc.server.Comment(carol, postID, int64(top.CommentID), quoting)
+	if err != nil {
+		return err
+	}
+	if reply.Depth != 1 || reply.ParentCommentID != top.CommentID {
+		return fmt.Errorf("reply %+v: want depth 1 under comment %d", reply, top.CommentID)
+	}
+	if !strings.Contains(reply.ContentHTML, `<blockquote class="quote"`) || !strings.Contains(reply.ContentHTML, "&lt;b&gt;bold") ||
+		!strings.Contains(reply.ContentHTML, "<p>I disagree</p>") {
+		return fmt.Errorf("quote rendered as %q, want an escaped blockquote of comment %d", reply.ContentHTML, top.CommentID)
+	}
+
+	// Replies nest down to the default maximum depth of 5
+	parent := reply
+	for depth := 2; depth <= 5; depth++ {
+		if parent, err = sc.server.Comment(alice, postID, int64(parent.CommentID), fmt.Sprintf("level %d", depth)); err != nil {
+			return err
+		}
+	}
+	if _, err := sc.server.Comment(alice, postID, int64(parent.CommentID), "too deep"); !HasStatus(err, http.StatusBadRequest) {
+		return fmt.Errorf("replying below the maximum depth: got %v, want 400", err)
+	}
+
+	flat, _, err := sc.server.Comments(alice, postID, "format=flat&depth=5")
+	if err != nil {
+		return err
+	}
+	var depths []int
+	for _, comment := range flat {
+		depths = append(depths, comment.Depth)
+	}
+	if !slices.Equal(depths, []int{0, 1, 2, 3, 4, 5}) {
+		return fmt.Errorf("flat thread depths: got %v, want 0 to 5 in thread order", depths)
+	}
+	tree, _, err := sc.server.Comments(alice, postID, "depth=1")
+	if err != nil {
+		return err
+	}
+	if len(tree) != 1 || tree[0].ReplyCount != 1 || len(tree[0].Replies) != 1 || len(tree[0].Replies[0].Replies) != 0 ||
+		tree[0].Replies[0].ReplyCount != 1 {
+		return fmt.Errorf("tree of depth 1: got %+v, want the top comment and its reply, whose own reply is only counted", tree)
+	}
+
+	// Pages of replies follow the cursor
+	for i := 0; i < 2; i++ {
+		if _, err := sc.server.Comment(alice, postID, int64(top.CommentID), fmt.Sprintf("more %d", i)); err != nil {
+			return err
+		}
+	}
+	page, next, err := sc.server.Comments(alice, postID, fmt.Sprintf("parentId=%d&limit=2&depth=0", top.CommentID))
+	if err != nil {
+		return err
+	}
+	if len(page) != 2 || next != page[1].CommentID {
+		return fmt.Errorf("first page of replies: got %d comments and cursor %d, want 2 and a cursor", len(page), next)
+	}
+	page, next, err = sc.server.Comments(alice, postID, fmt.Sprintf("parentId=%d&limit=2&depth=0&after=%d", top.CommentID, next))
+	if err != nil {
+		return err
+	}
+	if len(page) != 1 || page[0].Content != "more 1" || next != 0 {
+		return fmt.Errorf("last page of replies: got %+v and cursor %d, want the last reply", page, next)
+	}
+
+	// Carol blocked bob: his comment is a placeholder, and her own quote of it is not shown
+	if err := sc.server.Block(carol, bob); err != nil {
+		return err
+	}
+	tree, _, err = sc.server.Comments(carol, postID, "depth=1&replies=1")
+	if err != nil {
+		return err
+	}
+	if len(tree) != 1 || !tree[0].Hidden || tree[0].Content != "" || tree[0].AuthorUsername != "" {
+		return fmt.Errorf("comment of a blocked user: got %+v, want a hidden placeholder", tree)
+	}
+	if len(tree[0].Replies) != 1 || strings.Contains(tree[0].Replies[0].ContentHTML, "blockquote") ||
+		!strings.Contains(tree[0].Replies[0].ContentHTML, "quote-missing") {
+		return fmt.Errorf("quote of a blocked user: got %+v, want it marked missing", tree[0].Replies)
+	}
+	if tree[0].NextCursor == 0 {
+		return fmt.Errorf("replies of %+v: want a cursor to the replies left out", tree[0])
+	}
+	return nil
+}
+
+// testMarkdown checks that posts, comments and chat messages come with their Markdown rendered as
+// HTML, in which nothing the author wrote can add markup of its own.
+func testMarkdown(sc *scene) error {
+	users, err := sc.users("alice", "bob")
+	if err != nil {
+		return err
+	}
+	alice, bob := users[0], users[1]
+	safe := func(what, rendered string, want ...string) error {
+		for _, fragment := range want {
+			if !strings.Contains(rendered, fragment) {
+				return fmt.Errorf("%s rendered as %q, want it to contain %q", what, rendered, fragment)
+			}
+		}
+		for _, unsafe := range []string{"<script", "<img", `href="javascript:`} {
+			if strings.Contains(rendered, unsafe) {
+				return fmt.Errorf("%s rendered as %q, which contains %q", what, rendered, unsafe)
+			}
+		}
+		return nil
+	}
+
+	content := "**bold** <script>alert(1)</script>\n\n- [safe](https://example.com)\n- [unsafe](javascript:alert(1))"
+	postID, err := sc.server.NewPost(alice, "markdown", content, 1)
+	if err != nil {
+		return err
+	}
+	post, err := sc.server.GetPost(bob, postID)
+	if err != nil {
+		return err
+	}
+	if post.Content != content {
+		return fmt.Errorf("post source: got %q, want it as written", post.Content)
+	}
+	err = safe("post", post.ContentHTML, "<strong>bold</strong>", "&lt;script&gt;", `<li><a href="https://example.com"`, "<li>[unsafe]")
+	if err != nil {
+		return err
+	}
+
+	comment, err := sc.server.Comment(bob, postID, 0, "`code` and _emphasis_ <img src=x onerror=alert(1)>")
+	if err != nil {
+		return err
+	}
+	if err := safe("comment", comment.ContentHTML, "<code>code</code>", "<em>emphasis</em>", "&lt;img"); err != nil {
+		return err
+	}
+
+	aliceClient, err := sc.dial(alice)
+	if err != nil {
+		return err
+	}
+	bobClient, err := sc.dial(bob)
+	if err != nil {
+		return err
+	}
+	err = aliceClient.Send(realtimeforum.Message{Type: "private", ReceiverID: bob.ID, Message: "*hi* <img src=x onerror=alert(1)>"})
+	if err != nil {
+		return err
+	}
+	message, err := bobClient.WaitFor("private message", OfType("private"))
+	if err != nil {
+		return err
+	}
+	return safe("private message", message.MessageHTML, "<em>hi</em>", "&lt;img")
+}
@@ -0,0 +1,257 @@
+// Package e2e drives a real server end to end: it builds the backend, starts it on a free
+// port with an empty database, registers users and talks to /ws, or its fallbacks, like the
+// frontend does.
+//
+//	srv, err := e2e.Start(e2e.Options{Race: true, Dir: t.TempDir()})
+//	...
+//	defer srv.Stop()
+//	alice, err := srv.NewUser("alice")
+//	client, err := srv.Dial(alice)
+//	snapshot, err := client.Snapshot()
+//
+// Built with Race, the server runs under the race detector and Stop fails with ErrDataRace
+// if it reported anything. The tests of this package run the scenarios with go test.
+package e2e
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// serverPackage is the import path of the backend's main package.
+const serverPackage = "livechat-system/backend"
+
+// ErrDataRace is returned by Stop when the race detector reported a data race in the server.
+var ErrDataRace = errors.New("the race detector reported a data race")
+
+// Options configures Start.
+type Options struct {
+	Race bool // Build the server with the race detector
+
+	// Binary is a server already built, used instead of building one.
+	Binary string
+
+	// Args are extra command-line flags for the server, applied after the harness's own.
+	Args []string
+
+	// Env are extra environment variables for the server, as "KEY=value".
+	Env []string
+
+	// Dir holds the database and the logs of the server. Empty means a new temporary
+	// directory, which Stop removes unless the server failed.
+	Dir string
+
+	// Database is the SQLite database of another Server to share, as the instances of a
+	// cluster do. Empty means a new database.
+	Database string
+
+	// StartTimeout bounds how long Start waits for the server to be ready. Zero means 30s.
+	StartTimeout time.Duration
+}
+
+// Server is a running backend.
+type Server struct {
+	// URL is the base URL of the server, such as "http://127.0.0.1:41234".
+	URL string
+	// Dir holds the database and LogPath.
+	Dir string
+	// LogPath is the file the server writes its logs, and race reports, to.
+	LogPath string
+	// Database is the SQLite database file of the server.
+	Database string
+
+	cmd       *exec.Cmd
+	log       *os.File
+	exited    chan struct{}
+	exitErr   error
+	stopOnce  sync.Once
+	stopErr   error
+	temporary bool         // Dir was created by Start, and is removed by Stop
+	users     atomic.Int64 // Number of users created by NewUser
+}
+
+// Start builds the server unless Options.Binary is set, and runs it with a new database on a
+// free port until it reports ready.
+func Start(opts Options) (*Server, error) {
+	dir, temporary := opts.Dir, opts.Dir == ""
+	if temporary {
+		var err error
+		if dir, err = os.MkdirTemp("", "livechat-e2e"); err != nil {
+			return nil, err
+		}
+	}
+	// Removes the temporary directory when the server could not be started
+	removeDir := func() {
+		if temporary {
+			os.RemoveAll(dir)
+		}
+	}
+
+	binary := opts.Binary
+	if binary == "" {
+		binary = filepath.Join(dir, "livechat")
+		if err := Build(binary, opts.Race); err != nil {
+			removeDir()
+			return nil, err
+		}
+	}
+
+	addr, err := freeAddr()
+	if err != nil {
+		removeDir()
+		return nil, err
+	}
+
+	s := &Server{
+		URL:       "http://" + addr,
+		Dir:       dir,
+		LogPath:   filepath.Join(dir, "server.log"),
+		Database:  opts.Database,
+		exited:    make(chan struct{}),
+		temporary: temporary,
+	}
+	if s.Database == "" {
+		s.Database = filepath.Join(dir, "forum.sqlite")
+	}
+	s.log, err = os.Create(s.LogPath)
+	if err != nil {
+		removeDir()
+		return nil, err
+	}
+
+	args := []string{
+		"--addr", addr,
+		"--db", s.Database,
+		"--rate-limit=false", // Scenarios send frames faster than a person would
+		"--shutdown-timeout", "5s",
+		"--drain-delay", "0s", // Nothing routes traffic to it
+	}
+	s.cmd = exec.Command(binary, append(args, opts.Args...)...)
+	s.cmd.Dir = dir
+	s.cmd.Stdout = s.log
+	s.cmd.Stderr = s.log
+	s.cmd.Env = append(append(os.Environ(), "GORACE=halt_on_error=0"), opts.Env...)
+	if err := s.cmd.Start(); err != nil {
+		s.log.Close()
+		removeDir()
+		return nil, err
+	}
+	go func() {
+		s.exitErr = s.cmd.Wait()
+		close(s.exited)
+	}()
+
+	timeout := opts.StartTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	if err := s.waitReady(timeout); err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("%w (logs in %s)", err, s.LogPath)
+	}
+	return s, nil
+}
+
+// Build compiles the server into binary.
+func Build(binary string, race bool) error {
+	args := []string{"build", "-o", binary}
+	if race {
+		args = append(args, "-race")
+	}
+	cmd := exec.Command("go", append(args, serverPackage)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("building the server: %w\n%s", err, output.String())
+	}
+	return nil
+}
+
+// freeAddr returns a loopback address with a port nothing listens on. The port could be
+// taken again before the server binds it, which is unlikely enough for tests.
+func freeAddr() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	return "127.0.0.1:" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// waitReady polls /readyz until the server answers 200, exits or timeout elapses.
+func (s *Server) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	client := &http.Client{Timeout: time.Second}
+	for time.Now().Before(deadline) {
+		select {
+		case <-s.exited:
+			return fmt.Errorf("server exited during startup: %v", s.exitErr)
+		default:
+		}
+		if resp, err := client.Get(s.URL + "/readyz"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("server not ready after %v", timeout)
+}
+
+// Stop shuts the server down gracefully, killing it if it takes more than 10 seconds. It
+// returns ErrDataRace if the race detector reported a data race, or the error of an exit
+// other than a clean one. A temporary directory is kept when Stop fails, for its logs.
+func (s *Server) Stop() error {
+	s.stopOnce.Do(func() {
+		s.stopErr = s.stop()
+		s.log.Close()
+		if s.stopErr == nil && s.temporary {
+			os.RemoveAll(s.Dir)
+		}
+	})
+	return s.stopErr
+}
+
+func (s *Server) stop() error {
+	select {
+	case <-s.exited:
+		return fmt.Errorf("server exited unexpectedly: %v", s.exitErr)
+	default:
+	}
+
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case <-s.exited:
+	case <-time.After(10 * time.Second):
+		s.cmd.Process.Kill()
+		<-s.exited
+		return fmt.Errorf("server did not stop within 10s (logs in %s)", s.LogPath)
+	}
+
+	logs, err := os.ReadFile(s.LogPath)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(logs, []byte("WARNING: DATA RACE")) {
+		return fmt.Errorf("%w (logs in %s)", ErrDataRace, s.LogPath)
+	}
+	if s.exitErr != nil {
+		return fmt.Errorf("server exited with %v (logs in %s)", s.exitErr, s.LogPath)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// closeNotice is how /events and /events/poll report the end of a connection.
+type closeNotice struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// DialEvents opens a Server-Sent Events stream on /events for user. Frames are sent with
+// POST /events/send, and its replies are queued like the frames of the stream.
+func (s *Server) DialEvents(user User) (*Client, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/events?token="+url.QueryEscape(user.Token), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("connecting %s: %w", user.Username, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("connecting %s: /events answered %d", user.Username, resp.StatusCode)
+	}
+
+	c := newClient(user)
+	c.send = func(message realtimeforum.Message) error { return s.sendFrame(c, message) }
+	c.hangUp = func() error {
+		cancel()
+		return nil
+	}
+	go func() {
+		defer close(c.done)
+		defer resp.Body.Close()
+		c.err = readEvents(resp.Body, c)
+	}()
+	return c, nil
+}
+
+// readEvents queues the "message" events of a stream until it ends or sends a "close" event.
+func readEvents(body io.Reader, c *Client) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	var event string
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data == nil {
+				continue
+			}
+			if event == "close" {
+				var notice closeNotice
+				json.Unmarshal(data, &notice)
+				return fmt.Errorf("stream closed with code %d: %s", notice.Code, notice.Reason)
+			}
+			if err := c.deliver(data); err != nil {
+				return err
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = []byte(strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// DialPoll opens a long-polling connection on /events/poll for user and keeps polling in the
+// background. Frames are sent with POST /events/send, like DialEvents.
+func (s *Server) DialPoll(user User) (*Client, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := s.poll(ctx, user, "", 0)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("connecting %s: %w", user.Username, err)
+	}
+
+	c := newClient(user)
+	c.send = func(message realtimeforum.Message) error { return s.sendFrame(c, message) }
+	c.hangUp = func() error {
+		cancel()
+		return s.closePoll(user, first.Cursor)
+	}
+	go func() {
+		defer close(c.done)
+		response := first
+		for {
+			for _, frame := range response.Frames {
+				if err := c.deliver(frame); err != nil {
+					c.err = err
+					return
+				}
+			}
+			if response.Close != nil {
+				c.err = fmt.Errorf("connection closed with code %d: %s", response.Close.Code, response.Close.Reason)
+				return
+			}
+			if response, err = s.poll(ctx, user, first.Cursor, response.Seq); err != nil {
+				c.err = err
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+type pollResponse struct {
+	Cursor string            `json:"cursor"`
+	Frames []json.RawMessage `json:"frames"`
+	Seq    int64             `json:"seq"`
+	Close  *closeNotice      `json:"close"`
+}
+
+// poll sends one poll. With a cursor, it acknowledges the frames up to lastSeq.
+func (s *Server) poll(ctx context.Context, user User, cursor string, lastSeq int64) (pollResponse, error) {
+	target := s.URL + "/events/poll?token=" + url.QueryEscape(user.Token)
+	if cursor != "" {
+		target += "&cursor=" + cursor + "&lastSeq=" + strconv.FormatInt(lastSeq, 10)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return pollResponse{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return pollResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return pollResponse{}, fmt.Errorf("/events/poll answered %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var response pollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return pollResponse{}, err
+	}
+	return response, nil
+}
+
+// closePoll closes the long-polling connection of cursor.
+func (s *Server) closePoll(user User, cursor string) error {
+	req, err := http.NewRequest(http.MethodDelete, s.URL+"/events/poll?cursor="+cursor, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+user.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sendFrame posts a frame to /events/send and queues the replies for c.
+func (s *Server) sendFrame(c *Client, message realtimeforum.Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/events/send", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.User.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusTooManyRequests {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("/events/send answered %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var replies []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&replies); err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if err := c.deliver(reply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
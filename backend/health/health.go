@@ -0,0 +1,118 @@
+// Package health serves the liveness and readiness probes used by process supervisors and load balancers.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds how long all readiness checks together may take.
+const DefaultTimeout = 2 * time.Second
+
+// ErrDraining is reported by the readiness probe once the server has started shutting down.
+var ErrDraining = errors.New("server is shutting down")
+
+// Check reports whether a dependency is usable. It must return promptly once ctx is done.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks.
+type Checker struct {
+	Timeout  time.Duration
+	mu       sync.Mutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// New creates a Checker without checks.
+func New() *Checker {
+	return &Checker{Timeout: DefaultTimeout}
+}
+
+// Add registers a check reported under name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the server report itself as not ready, so traffic is routed elsewhere during shutdown.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Report is the body of a readiness response. Checks maps each check to "ok" or its error.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Run runs every check concurrently and reports whether all of them passed.
+func (c *Checker) Run(ctx context.Context) (Report, bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}(i, nc.check)
+	}
+	wg.Wait()
+
+	report := Report{Status: "ok", Checks: make(map[string]string, len(checks)+1)}
+	ready := true
+	if c.draining.Load() {
+		report.Checks["shutdown"] = ErrDraining.Error()
+		ready = false
+	}
+	for i, nc := range checks {
+		if results[i] != nil {
+			report.Checks[nc.name] = results[i].Error()
+			ready = false
+		} else {
+			report.Checks[nc.name] = "ok"
+		}
+	}
+	if !ready {
+		report.Status = "unavailable"
+	}
+	return report, ready
+}
+
+// ReadyHandler answers 200 when every check passes and 503 otherwise, with the result of each check.
+func (c *Checker) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, ready := c.Run(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// LiveHandler answers 200 as long as the process can serve HTTP requests at all. It checks no
+// dependency, so an unavailable database makes the server unready rather than restarted.
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,64 @@
+// Package httpx holds the HTTP helpers shared by the middlewares of the server.
+package httpx
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// StatusRecorder remembers the status code written by a handler. It passes Hijack and Flush
+// through so WebSocket upgrades and event streams keep working behind the middlewares.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status   int    // The status written, http.StatusOK when the handler wrote none
+	Hijacked bool   // The connection was taken over, by a WebSocket upgrade
+	OnHijack func() // Called once the connection was taken over; may be nil
+
+	wroteHeader bool
+}
+
+// NewStatusRecorder records the status written to w.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *StatusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.Hijacked = true
+		if r.OnHijack != nil {
+			r.OnHijack()
+		}
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
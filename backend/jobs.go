@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"livechat-system/backend/backplane"
+	"livechat-system/backend/config"
+	"livechat-system/backend/scheduler"
+)
+
+// registerJobs registers the maintenance jobs: presence cleanup, purges of expired chat
+// sessions, rate limit state and orphan attachments, the retention policies for chat
+// messages and, in a cluster, the exchange of presence between the instances.
+func (a *app) registerJobs(jobs *scheduler.Scheduler) error {
+	cfg := a.cfg
+	jitter := cfg.Maintenance.Jitter.Duration
+
+	err := jobs.Register(scheduler.Job{
+		Name:     "presence-cleanup",
+		Interval: cfg.Presence.CleanupInterval.Duration,
+		Jitter:   jitter,
+		Run: func(ctx context.Context) error {
+			removed, err := a.forumService.CleanupInactiveUsers(cfg.Presence.InactiveAfter.Duration)
+			if err != nil {
+				return err
+			}
+			slog.Info("Inactive users cleanup completed", "removed", removed)
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = jobs.Register(scheduler.Job{
+		Name:     "session-purge",
+		Interval: cfg.Maintenance.SessionPurgeInterval.Duration,
+		Jitter:   jitter,
+		Run: func(ctx context.Context) error {
+			slog.Debug("Purged expired chat sessions", "count", a.wsServer.PurgeIdleSessions())
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = jobs.Register(scheduler.Job{
+		Name:     "rate-limit-prune",
+		Interval: cfg.Maintenance.RateLimitPruneInterval.Duration,
+		Jitter:   jitter,
+		Run: func(ctx context.Context) error {
+			a.limiter.prune(a.wsServer)
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.Cluster.Backplane != backplane.DriverNone {
+		// Not jittered: the other instances expect presence at every interval
+		err = jobs.Register(scheduler.Job{
+			Name:     "cluster-presence",
+			Interval: cfg.Cluster.PresenceInterval.Duration,
+			Run: func(ctx context.Context) error {
+				a.wsServer.SyncPresence()
+				return nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = jobs.Register(scheduler.Job{
+		Name:     "attachment-purge",
+		Interval: cfg.Maintenance.RetentionInterval.Duration,
+		Jitter:   jitter,
+		Run: func(ctx context.Context) error {
+			removed, err := a.forumService.PurgeOrphanAttachments(ctx, time.Now().Add(-cfg.Attachments.OrphanTTL.Duration))
+			if err != nil {
+				return err
+			}
+			slog.Info("Purged orphan attachments", "count", removed)
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return jobs.Register(scheduler.Job{
+		Name:     "chat-retention",
+		Interval: cfg.Maintenance.RetentionInterval.Duration,
+		Jitter:   jitter,
+		Run: func(ctx context.Context) error {
+			return a.applyRetention()
+		},
+	})
+}
+
+// applyRetention purges deleted chat messages and old edit history. A retention of 0 keeps them forever.
+func (a *app) applyRetention() error {
+	cfg := a.cfg.Maintenance
+	now := time.Now()
+	if retention := cfg.DeletedMessagesRetention.Duration; retention > 0 {
+		removed, err := a.forumService.PurgeDeletedChatMessages(now.Add(-retention))
+		if err != nil {
+			return err
+		}
+		slog.Info("Retention purged deleted chat messages", "count", removed)
+	}
+	if retention := cfg.RevisionsRetention.Duration; retention > 0 {
+		removed, err := a.forumService.PurgeChatRevisions(now.Add(-retention))
+		if err != nil {
+			return err
+		}
+		slog.Info("Retention purged chat revisions", "count", removed)
+	}
+	return nil
+}
+
+// adminOnly protects an admin endpoint. With a configured token the request must carry it in the
+// X-Admin-Token header; without one only requests from the local machine are served.
+func adminOnly(adminConfig config.AdminConfig, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminConfig.Token != "" {
+			given := r.Header.Get("X-Admin-Token")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(adminConfig.Token)) != 1 {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		} else if !isLoopback(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func isLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
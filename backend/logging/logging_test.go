@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// credentials is a value holding secrets under every kind of field Redact recognizes.
+type credentials struct {
+	Username string
+	Password string
+	APIKey   string `json:"api_token"`
+	Session  string `log:"redact"`
+	Note     string `json:"-"`
+}
+
+// secrets are the values logged by TestRedaction, none of which may reach the output.
+var secrets = []string{
+	"header-bearer", "attr-token", "attr-password", "secret-value", "field-password",
+	"field-token", "field-session", "map-password", "header-cookie", "nested-password", "query-token",
+}
+
+// TestRedaction logs secrets in every way the server does, in both formats, and checks that
+// none of them is written.
+func TestRedaction(t *testing.T) {
+	for _, format := range []string{FormatText, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			logger, err := New(&out, "debug", format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header := http.Header{}
+			header.Set("Authorization", "Bearer header-bearer")
+			header.Set("Cookie", "session=header-cookie")
+			header.Set("Accept", "application/json")
+			logger.Info("Request",
+				"headers", header,
+				"Authorization", "Bearer header-bearer",
+				"token", "attr-token",
+				"new_password", "attr-password",
+				"key", Secret("secret-value"),
+				"user", credentials{Username: "alice", Password: "field-password", APIKey: "field-token", Session: "field-session", Note: "note"},
+				"form", map[string]string{"username": "alice", "password": "map-password"},
+				"users", []*credentials{{Username: "bob", Password: "nested-password"}},
+			)
+			logger.With("access_token", "attr-token").WithGroup("login").Warn("Login failed", "password", "attr-password")
+			logger.Error("Opening the database", "err", &fs.PathError{Op: "open", Path: "forum.sqlite", Err: fs.ErrNotExist})
+
+			// The request logger logs the path without the query, where WebSocket clients pass their token
+			previous := slog.Default()
+			slog.SetDefault(logger)
+			defer slog.SetDefault(previous)
+			RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				FromContext(r.Context()).Info("Handling request", "query", r.URL.Query())
+			})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ws?token=query-token", nil))
+
+			logged := out.String()
+			for _, secret := range secrets {
+				if strings.Contains(logged, secret) {
+					t.Errorf("secret %q was logged:\n%s", secret, logged)
+				}
+			}
+			// Redaction hides the values, not the rest of the record
+			for _, kept := range []string{RedactedValue, "alice", "bob", "application/json", "/ws", "Login failed"} {
+				if !strings.Contains(logged, kept) {
+					t.Errorf("%q is missing from the logs:\n%s", kept, logged)
+				}
+			}
+			// Errors are logged by their message, not field by field
+			if !strings.Contains(logged, "open forum.sqlite: file does not exist") {
+				t.Errorf("the error is not logged by its message:\n%s", logged)
+			}
+			if strings.Contains(logged, "note") {
+				t.Errorf("a field without a JSON name was logged:\n%s", logged)
+			}
+		})
+	}
+}
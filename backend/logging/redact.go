@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"encoding"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RedactedValue replaces secrets in log records.
+const RedactedValue = "[REDACTED]"
+
+// Secret is a string that is never written to the logs, such as a token.
+type Secret string
+
+// LogValue implements slog.LogValuer.
+func (Secret) LogValue() slog.Value {
+	return slog.StringValue(RedactedValue)
+}
+
+// sensitiveKeys are attribute and field names whose values are always redacted.
+// A key is sensitive if it contains one of them, ignoring case.
+var sensitiveKeys = []string{"password", "token", "secret", "email", "authorization", "cookie"}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAttr is the ReplaceAttr hook of the handlers created by New.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, RedactedValue)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		a.Value = Redact(a.Value.Any())
+	}
+	return a
+}
+
+// maxRedactDepth stops Redact from following deeply nested or cyclic values.
+const maxRedactDepth = 5
+
+// Redact turns a struct, a slice or map of structs, or a map keyed by strings into a log value
+// where fields tagged `log:"redact"`, and fields or keys whose name or JSON name is sensitive,
+// are replaced by RedactedValue. Other values are returned unchanged.
+func Redact(v interface{}) slog.Value {
+	return redactValue(reflect.ValueOf(v), 0)
+}
+
+func redactValue(v reflect.Value, depth int) slog.Value {
+	if !v.IsValid() {
+		return slog.AnyValue(nil)
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return slog.AnyValue(nil)
+		}
+		// Errors are usually pointers, whose methods the value they point to lacks
+		if v.CanInterface() && formatsItself(v) {
+			return slog.AnyValue(v.Interface())
+		}
+		v = v.Elem()
+	}
+	if depth >= maxRedactDepth || !v.CanInterface() || formatsItself(v) {
+		return slog.AnyValue(interfaceOf(v))
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		attrs := make([]slog.Attr, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := fieldName(field)
+			if name == "-" {
+				continue
+			}
+			if field.Tag.Get("log") == "redact" || isSensitiveKey(field.Name) || isSensitiveKey(name) {
+				attrs = append(attrs, slog.String(name, RedactedValue))
+				continue
+			}
+			attrs = append(attrs, slog.Attr{Key: name, Value: redactValue(v.Field(i), depth+1)})
+		}
+		return slog.GroupValue(attrs...)
+	case reflect.Slice, reflect.Array:
+		if !containsStructs(v.Type().Elem()) {
+			return slog.AnyValue(interfaceOf(v))
+		}
+		attrs := make([]slog.Attr, v.Len())
+		for i := range attrs {
+			attrs[i] = slog.Attr{Key: strconv.Itoa(i), Value: redactValue(v.Index(i), depth+1)}
+		}
+		return slog.GroupValue(attrs...)
+	case reflect.Map:
+		// Maps keyed by name, such as http.Header, may hold secrets under a sensitive key
+		if !containsStructs(v.Type().Elem()) && v.Type().Key().Kind() != reflect.String {
+			return slog.AnyValue(interfaceOf(v))
+		}
+		attrs := make([]slog.Attr, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(interfaceOf(iter.Key()))
+			if isSensitiveKey(key) {
+				attrs = append(attrs, slog.String(key, RedactedValue))
+				continue
+			}
+			attrs = append(attrs, slog.Attr{Key: key, Value: redactValue(iter.Value(), depth+1)})
+		}
+		return slog.GroupValue(attrs...)
+	}
+	return slog.AnyValue(interfaceOf(v))
+}
+
+// formatsItself reports whether a value controls its own representation, like time.Time
+// or errors, in which case it is logged as is rather than field by field.
+func formatsItself(v reflect.Value) bool {
+	switch v.Interface().(type) {
+	case slog.LogValuer, error, fmt.Stringer, encoding.TextMarshaler:
+		return true
+	}
+	return false
+}
+
+func containsStructs(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Interface
+}
+
+func fieldName(field reflect.StructField) string {
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func interfaceOf(v reflect.Value) interface{} {
+	if !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"livechat-system/backend/internal/httpx"
+)
+
+// RequestIDHeader carries the request ID. An ID sent by the client (or a proxy in front of the
+// server) is kept so the same request can be followed across systems; otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied IDs, which end up in every log record of the request.
+const maxRequestIDLength = 64
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// WithLogger returns a context carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger of the request, tagged with its request ID, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// RequestIDFromContext returns the ID of the request, or "" outside of a request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RequestID gives every request an ID, returns it in the X-Request-ID response header, stores a
+// logger tagged with it in the request context and logs the outcome of the request.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		ctx := context.WithValue(WithLogger(r.Context(), logger), requestIDKey, id)
+
+		recorder := httpx.NewStatusRecorder(w)
+		start := time.Now()
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		// Upgraded WebSocket connections log their own lifecycle
+		if recorder.Hijacked {
+			return
+		}
+		level := slog.LevelDebug
+		if recorder.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(ctx, level, "HTTP request",
+			"method", r.Method, "path", r.URL.Path, "status", recorder.Status, "duration", time.Since(start))
+	})
+}
+
+// validRequestID accepts short IDs made of characters that are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,164 +1,232 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
-	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"livechat-system/backend/backplane"
+	"livechat-system/backend/blob"
+	"livechat-system/backend/config"
+	"livechat-system/backend/health"
+	"livechat-system/backend/logging"
+	"livechat-system/backend/metrics"
 	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/ratelimit"
+	"livechat-system/backend/scheduler"
 	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+	"livechat-system/backend/storage/sqlstore"
+	"livechat-system/backend/version"
 	websocket "livechat-system/backend/websocket"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// Global variables
-var (
-	db           *sql.DB
-	forumService *service.ForumService
-	secretKey    = generateSecretKey()
-)
+// rateLimitIdle is how long a rate limit key must be unused before its state is forgotten.
+const rateLimitIdle = 10 * time.Minute
 
 type CustomClaims struct {
 	UserID int `json:"user_id"`
 	jwt.StandardClaims
 }
 
-func init() {
-	var err error
-	db, err = sql.Open("sqlite3", "db/forumDB.sqlite")
+func main() {
+	// Load the configuration: defaults < config file < environment < flags
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
 	if err != nil {
-		panic(err)
+		fatal("Failed to load configuration", "err", err)
 	}
-
-}
-
-func cleanupInactiveUsers(db *sql.DB) {
-	// SQL query to delete inactive users
-	query := `
-    DELETE FROM online_users
-    WHERE last_activity < DATETIME('now', '-30 minutes');
-    `
-	_, err := db.Exec(query)
-	if err != nil {
-		log.Fatalf("Failed to cleanup inactive users: %v", err)
+	if cfg.PrintConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(cfg.Redacted()); err != nil {
+			fatal("Failed to print configuration", "err", err)
+		}
+		return
 	}
-	log.Println("Inactive users cleanup completed successfully.")
-}
 
-func enableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")                                // Allow all origins
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS") // Allow specific methods
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")     // Allow headers such as 'Content-Type' and 'Authorization'
-}
-
-func main() {
-	// Set up database connection
-	var err error
-	db, err = sql.Open("sqlite3", "db/forumDB.sqlite")
+	// From here on everything, including the standard log package, goes through the structured logger
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
-		return
+		fatal("Failed to set up logging", "err", err)
 	}
+	slog.SetDefault(logger)
 
-	// Ensure the database connection is alive
-	err = db.Ping()
+	// Set up the database connection
+	var store storage.Store
+	store, err = sqlstore.Open(cfg.Database.Driver, cfg.Database.DataSource())
 	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
-		return
+		fatal("Failed to connect to the database", "driver", cfg.Database.Driver, "err", err)
 	}
 
-	// Initialize the forumService with the database
-	forumService = service.NewForumService(db)
-	if forumService == nil {
-		log.Fatalf("Failed to initialize ForumService")
+	// Bring the schema up to date before anything touches the database
+	if err := store.Migrate(); err != nil {
+		fatal("Failed to apply database migrations", "err", err)
 	}
 
-	// Initialize WebSocket server with forumService and db
-	wsServer := websocket.NewWebSocketServer(db, forumService, secretKey)
-	if wsServer == nil {
-		log.Fatalf("Failed to initialize WebSocketServer")
+	// Every call to the database is timed
+	registry := metrics.NewRegistry()
+	store = observeStore(registry, store)
+
+	// Uploaded files are kept outside the database
+	blobs, err := blob.Open(cfg.Attachments.Store, cfg.Attachments.Dir)
+	if err != nil {
+		fatal("Failed to open the attachment store", "store", cfg.Attachments.Store, "dir", cfg.Attachments.Dir, "err", err)
 	}
 
+	// The forum service and the WebSocket hub the handlers share
+	a := newApp(cfg, store, blobs)
+	mux := a.routes()
+
 	// Start broadcasting user statuses periodically in a separate goroutine
 	// go wsServer.BroadcastUserStatusesPeriodically()
-	// Start the HTTP server
-	setupHTTPServer(wsServer)
 
-	// Call the cleanup function periodically
-	ticker := time.NewTicker(1 * time.Hour) // Adjust the duration according to your needs
-	defer ticker.Stop()
+	// SIGINT or SIGTERM starts a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	for {
-		select {
-		case <-ticker.C:
-			cleanupInactiveUsers(db)
+	// Maintenance jobs, started once the server is fully set up
+	jobs := scheduler.New()
+	if err := a.registerJobs(jobs); err != nil {
+		fatal("Failed to register maintenance jobs", "err", err)
+	}
+	mux.HandleFunc("/admin/jobs", adminOnly(cfg.Admin, jobs.Handler()))
+	mux.HandleFunc("/admin/moderators", adminOnly(cfg.Admin, a.moderatorsHandler))
+
+	// Prometheus metrics, protected like the other admin endpoints
+	registerMetrics(registry, a.wsServer, jobs)
+	mux.HandleFunc("/metrics", adminOnly(cfg.Admin, registry.Handler()))
+
+	// Reach the users connected to the other instances, if there are any. Events from the
+	// backplane are handled from now on, concurrently with everything else: the app must not
+	// be changed after this point.
+	bp, err := joinCluster(cfg.Cluster, a.wsServer)
+	if err != nil {
+		fatal("Failed to join the cluster", "backplane", cfg.Cluster.Backplane, "err", err)
+	}
+	jobs.Start(ctx)
+
+	// Probes for the process supervisor and the load balancer
+	checker := health.New()
+	checker.Add("database", store.Ping)
+	checker.Add("migrations", store.CheckMigrations)
+	checker.Add("websocket", a.wsServer.Check)
+	checker.Add("attachments", blobs.Ping)
+	if bp != nil {
+		checker.Add("backplane", bp.Ping)
+	}
+	mux.HandleFunc("/healthz", health.LiveHandler)
+	mux.HandleFunc("/readyz", checker.ReadyHandler())
+	mux.HandleFunc("/version", version.Handler)
+
+	// Start the HTTP server in the background
+	httpServer := &http.Server{Addr: cfg.Server.Addr, Handler: a.handler(mux, metrics.NewHTTPMetrics(registry))}
+	httpServer.RegisterOnShutdown(a.wsServer.CloseConnections) // Ends the event streams and polls the HTTP server waits for
+	go func() {
+		slog.Info("Server listening", "addr", httpServer.Addr, "commit", version.Get().Commit)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("HTTP server failed", "err", err)
 		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	checker.Drain()
+	drain(cfg.Server.DrainDelay.Duration)
+	slog.Info("Shutting down, press Ctrl+C again to force")
+	a.shutdown(httpServer, bp, jobs)
+}
+
+// drain waits for delay while /readyz fails, so load balancers stop routing new clients here
+// before the listener closes. A second signal ends the wait; after it, signals are handled by
+// default again and a third one kills the process.
+func drain(delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	slog.Info("Draining before shutdown, press Ctrl+C again to shut down now", "delay", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-signals:
 	}
 }
 
-func setupHTTPServer(wsServer *websocket.WebSocketServer) {
-	// CORS configuration
-	allowedHeaders := "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization,X-CSRF-Token"
-	allowedMethods := "GET, POST, PUT, DELETE, OPTIONS"
-
-	// CORS middleware
-	corsHandler := func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
-			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
-			if r.Method == "OPTIONS" {
-				return
-			}
-			h.ServeHTTP(w, r)
-		})
+// shutdown stops the server in dependency order: first no new HTTP requests while the real-time
+// clients are told to reconnect later, then their pending chat writes are allowed to finish,
+// the other instances are told this one left, and the database is closed last, once nothing
+// can use it anymore. bp is nil for a single instance.
+func (a *app) shutdown(httpServer *http.Server, bp backplane.Backplane, jobs *scheduler.Scheduler) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownTimeout.Duration)
+	defer cancel()
+
+	// Stops the listener and waits for in-flight requests, including the event streams and
+	// polls that CloseConnections ends. WebSocket connections were hijacked from the HTTP
+	// server, so they are not waited for here.
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP server did not shut down cleanly", "err", err)
+	}
+	if err := a.wsServer.Shutdown(ctx); err != nil {
+		slog.Warn("WebSocket connections did not close in time", "err", err)
+	}
+	if bp != nil {
+		if err := bp.Close(); err != nil {
+			slog.Warn("Failed to close the backplane", "err", err)
+		}
 	}
 
-	// Configure routes
-	http.HandleFunc("/users", Users)
-	http.HandleFunc("/login", LoginRouteHandler(wsServer)) // Wrap the login function with WebSocket server
-	http.HandleFunc("/register", Register)
-	http.HandleFunc("/newpost", jwtMiddleware(NewPost))
-	http.HandleFunc("/posts", jwtMiddleware(Posts))
-	http.HandleFunc("/ws", wsServer.HandleConnections)
-	http.HandleFunc("/chat-history", chatHistoryHandler)
+	// The jobs saw the cancelled context; wait for a run in progress to finish
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		slog.Warn("Maintenance jobs did not stop in time")
+	}
 
-	// Start the server
-	port := ":8080"
-	fmt.Printf("Server listening on port %s\n", port)
-	log.Fatal(http.ListenAndServe(port, corsHandler(http.DefaultServeMux)))
+	if err := a.store.Close(); err != nil {
+		slog.Error("Failed to close database", "err", err)
+	}
+	slog.Info("Server stopped")
 }
 
-func AuthenticateUser(db *sql.DB, username string, password string) (int64, string, error) {
-	var storedPassword string
-	var userID int64
-	query := "SELECT user_id, password FROM Users WHERE username = ?"
-	err := db.QueryRow(query, username).Scan(&userID, &storedPassword)
+// fatal logs an error and exits. Deferred calls do not run, so it is only used during startup.
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func (a *app) AuthenticateUser(username string, password string) (int64, string, error) {
+	userID, storedPassword, err := a.forumService.GetCredentials(username)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Println("User not found for username:", username)
+		if errors.Is(err, storage.ErrNotFound) {
 			return 0, "", nil // Handle user not found scenario
 		}
-		fmt.Println("Error fetching user details:", err)
 		return 0, "", err // Handle other DB-related errors
 	}
 
-	// Print retrieved values for debugging
-	fmt.Println("Retrieved stored password:", storedPassword)
-	fmt.Println("Input username:", username)
-
 	if password != storedPassword {
 		return 0, "", nil // Passwords don't match
 	}
-	fmt.Println(userID)
 	return userID, username, nil // User authenticated successfully
 }
 
@@ -174,9 +242,9 @@ func generateSecretKey() string {
 	return base64.URLEncoding.EncodeToString(key)
 }
 
-func Users(w http.ResponseWriter, r *http.Request) {
+func (a *app) Users(w http.ResponseWriter, r *http.Request) {
 	// Assuming forumService is initialized in your main function
-	users, err := forumService.GetAllUsers()
+	users, err := a.forumService.GetAllUsers()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -189,19 +257,9 @@ func Users(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Login(w http.ResponseWriter, r *http.Request, server *websocket.WebSocketServer) {
+func (a *app) Login(w http.ResponseWriter, r *http.Request) {
 
-	// Enable CORS for this request
-	enableCors(&w)
-
-	// Handle preflight OPTIONS request
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	// Log the action for debugging purposes
-	fmt.Println("Login attempt")
+	logger := logging.FromContext(r.Context())
 
 	// Parse the username and password from the request body
 	var credentials struct {
@@ -213,20 +271,22 @@ func Login(w http.ResponseWriter, r *http.Request, server *websocket.WebSocketSe
 		return
 	}
 
-	isValidUser, username, err := AuthenticateUser(db, credentials.Username, credentials.Password)
+	isValidUser, username, err := a.AuthenticateUser(credentials.Username, credentials.Password)
 	if err != nil {
+		logger.Error("Failed to authenticate user", "username", credentials.Username, "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	if isValidUser == 0 {
+		logger.Info("Login failed", "username", credentials.Username)
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
 	// Update user last activity
-	if err := forumService.UpdateUserLastActivity(db, isValidUser); err != nil {
-		log.Printf("Failed to update last activity for user %d: %v", isValidUser, err)
+	if err := a.forumService.UpdateUserLastActivity(isValidUser); err != nil {
+		logger.Error("Failed to update last activity", "user_id", isValidUser, "err", err)
 		http.Error(w, "Failed to update user activity", http.StatusInternalServerError)
 		return
 	}
@@ -236,7 +296,7 @@ func Login(w http.ResponseWriter, r *http.Request, server *websocket.WebSocketSe
 	claims := CustomClaims{
 		UserID: int(isValidUser),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
+			ExpiresAt: time.Now().Add(a.cfg.Auth.TokenTTL.Duration).Unix(),
 		},
 	}
 
@@ -244,12 +304,11 @@ func Login(w http.ResponseWriter, r *http.Request, server *websocket.WebSocketSe
 
 	token.Claims.Valid()
 
-	tokenString, err := token.SignedString([]byte(secretKey))
+	tokenString, err := token.SignedString([]byte(a.secretKey))
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
-	fmt.Println("intial token on login ", tokenString)
 
 	// Respond with the token
 	response := map[string]interface{}{
@@ -258,7 +317,7 @@ func Login(w http.ResponseWriter, r *http.Request, server *websocket.WebSocketSe
 		"userId":   isValidUser, // include this to directly send userId
 	}
 
-	log.Printf("Login response: %+v", response) // Add this line to log the response
+	logger.Info("User logged in", "user_id", isValidUser, "username", username)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -267,19 +326,9 @@ func Login(w http.ResponseWriter, r *http.Request, server *websocket.WebSocketSe
 	}
 }
 
-// This function is used for routing setup, wrapping the Login function with access to the WebSocket server.
-func LoginRouteHandler(server *websocket.WebSocketServer) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		Login(w, r, server)
-	}
-}
-
-func Register(w http.ResponseWriter, r *http.Request) {
+func (a *app) Register(w http.ResponseWriter, r *http.Request) {
 
 	// Parse the username and password from the request body
-
-	fmt.Println("connected")
-
 	var newUser realtimeforum.User
 	err := json.NewDecoder(r.Body).Decode(&newUser)
 	if err != nil {
@@ -287,14 +336,41 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logger := logging.FromContext(r.Context())
+	logger.Info("Registering user", "username", newUser.Username)
+	userID, err := a.forumService.CreateUser(newUser)
+	switch {
+	case errors.Is(err, storage.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		logger.Error("Failed to register user", "username", newUser.Username, "err", err)
+		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("User registered", "username", newUser.Username, "user_id", userID)
+
 	response := map[string]string{"message": "User registered successfully"}
 	json.NewEncoder(w).Encode(response)
-	fmt.Println("new user:", newUser)
-	forumService.CreateUser(newUser)
 }
 
-func Posts(w http.ResponseWriter, r *http.Request) {
-	posts, err := forumService.GetAllPosts()
+func (a *app) Posts(w http.ResponseWriter, r *http.Request) {
+	var posts []realtimeforum.Posts
+	var err error
+	// Posts by users the caller blocked are only hidden on request, and deleted posts only
+	// listed to moderators
+	switch {
+	case r.URL.Query().Get("deleted") == "true":
+		posts, err = a.forumService.GetDeletedPosts(currentUserID(r))
+		if errors.Is(err, service.ErrModeratorsOnly) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	case r.URL.Query().Get("hideBlocked") == "true":
+		posts, err = a.forumService.GetAllPostsVisibleTo(currentUserID(r))
+	default:
+		posts, err = a.forumService.GetAllPosts()
+	}
 	if err != nil {
 		http.Error(w, "error retrieving all posts", http.StatusInternalServerError)
 		return
@@ -307,55 +383,130 @@ func Posts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func NewPost(w http.ResponseWriter, r *http.Request) {
+// maxContentBody bounds the body of the requests that carry a post or a comment, which the
+// services then check against the longest content they accept.
+const maxContentBody = 1 << 20
 
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		http.Error(w, "Unauthroized", http.StatusUnauthorized)
+// NewPost serves /newpost, pushing every new post to the feed subscribers.
+func (a *app) NewPost(w http.ResponseWriter, r *http.Request) {
+	userID := int(currentUserID(r))
+	var newPost realtimeforum.Posts
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxContentBody)).Decode(&newPost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
 
-	if err != nil {
-		http.Error(w, "error parsing with claims", http.StatusInternalServerError)
+	newPost.UserID = userID
+	newPost.CreatedAt = time.Now().UTC()
+	postID, err := a.forumService.CreatePost(newPost)
+	if errors.Is(err, storage.ErrAttachmentUnavailable) || errors.Is(err, service.ErrTooManyAttachments) ||
+		errors.Is(err, service.ErrInvalidPoll) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	claims, ok := token.Claims.(*CustomClaims)
-	if !ok || !token.Valid {
-		http.Error(w, "Invalid Token", http.StatusUnauthorized)
+	if errors.Is(err, service.ErrPostTooLong) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
 		return
 	}
-
-	//fmt.Println("token claims:", claims)
-
-	userID := claims.UserID
-	var newPost realtimeforum.Posts
-	err = json.NewDecoder(r.Body).Decode(&newPost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		logging.FromContext(r.Context()).Error("Failed to create post", "user_id", userID, "err", err)
+		http.Error(w, "error creating post", http.StatusInternalServerError)
 		return
 	}
+	newPost.PostID = int(postID)
 
-	newPost.UserID = userID
-	forumService.CreatePost(newPost)
+	// Feeds update live instead of waiting for the next fetch of /posts
+	a.wsServer.PublishPost(newPost)
+	notifications, err := a.forumService.NotifyNewPost(newPost)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to notify watchers of post", "post_id", postID, "err", err)
+	}
+	a.wsServer.SendNotifications(notifications)
 
 	// Update last activity
-	if err := forumService.UpdateUserLastActivity(db, int64(userID)); err != nil {
-		log.Printf("Failed to update last activity for user %d after posting: %v", userID, err)
+	if err := a.forumService.UpdateUserLastActivity(int64(userID)); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to update last activity after posting", "user_id", userID, "err", err)
 	}
 
-	response := map[string]string{"message": "new post created successfully"}
+	response := map[string]interface{}{"message": "new post created successfully", "post_id": postID}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-	fmt.Println("new post:", newPost)
+	logging.FromContext(r.Context()).Info("New post created", "user_id", userID, "title", newPost.Title)
+}
+
+// contextKey is the type of the keys this package stores in request contexts.
+type contextKey string
+
+// userIDContextKey holds the ID of the user authenticated by jwtMiddleware.
+const userIDContextKey contextKey = "userID"
+
+// currentUserID returns the ID of the user authenticated by jwtMiddleware.
+func currentUserID(r *http.Request) int64 {
+	userID, _ := r.Context().Value(userIDContextKey).(int64)
+	return userID
+}
+
+// rateLimitKey limits authenticated requests per user and anonymous ones per client IP.
+func rateLimitKey(r *http.Request) string {
+	if userID := currentUserID(r); userID != 0 {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return ratelimit.IPKey(r)
+}
+
+// httpRateLimiter holds the rate limits of the HTTP routes, keyed by route, and the clients
+// that keep exceeding them. A nil limits group means rate limiting is disabled.
+type httpRateLimiter struct {
+	limits    *ratelimit.Group
+	offenders *ratelimit.Offenders
+}
+
+func newHTTPRateLimiter(cfg config.RateLimitConfig) *httpRateLimiter {
+	if !cfg.Enabled {
+		return &httpRateLimiter{}
+	}
+	return &httpRateLimiter{
+		limits:    ratelimit.NewGroup(ratePolicies(cfg.HTTP)),
+		offenders: ratelimit.NewOffenders(cfg.OffenderThreshold, cfg.OffenderWindow.Duration),
+	}
+}
+
+// ratePolicies converts configured rate limits to the policies of the ratelimit package.
+func ratePolicies(configured map[string]config.RateLimitPolicy) map[string]ratelimit.Policy {
+	policies := make(map[string]ratelimit.Policy, len(configured))
+	for name, policy := range configured {
+		policies[name] = ratelimit.Policy{Rate: policy.Rate, Burst: policy.Burst}
+	}
+	return policies
+}
+
+// limit applies the rate limit policy of route to a handler. Wrap it inside
+// jwtMiddleware so authenticated requests are limited per user.
+func (l *httpRateLimiter) limit(route string, next http.HandlerFunc) http.HandlerFunc {
+	if l.limits == nil {
+		return next
+	}
+	return l.limits.Middleware(route, rateLimitKey, l.offenders, next)
+}
+
+// prune forgets the rate limit state of clients that have gone quiet.
+func (l *httpRateLimiter) prune(wsServer *websocket.WebSocketServer) {
+	pruned := 0
+	if l.limits != nil {
+		pruned += l.limits.Prune(rateLimitIdle) + l.offenders.Prune()
+	}
+	if wsServer.RateLimits != nil {
+		pruned += wsServer.RateLimits.Prune(rateLimitIdle)
+	}
+	if wsServer.Offenders != nil {
+		pruned += wsServer.Offenders.Prune()
+	}
+	slog.Debug("Pruned idle rate limit entries", "count", pruned)
 }
 
 // Creates a middleware function for jwt authentication
-func jwtMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func (a *app) jwtMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	// Return a new function that conforms to http.HandlerFunc
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract the Authorization header from the request
@@ -370,7 +521,7 @@ func jwtMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Parse the JWT token into a token object, using a callback function to validate the token
 		//&CustomClaims{} indicates that the token shoud be mapped to the CustomClaims struct
 		token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
+			return []byte(a.secretKey), nil
 		})
 
 		// If parsing the token resulted in an error, or if the token is invalid return an error
@@ -382,31 +533,49 @@ func jwtMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			http.Error(w, `{"message": "Authorization header is required"}`, http.StatusUnauthorized)
 			return
 		}
+		// Make the authenticated user available to the next handler
+		claims := token.Claims.(*CustomClaims)
+		ctx := context.WithValue(r.Context(), userIDContextKey, int64(claims.UserID))
+
 		// If the token is valid proceed with the next handler in the chain
 		// The next handler is passed as an argument to the middleware function
 		// allowing the request to contine through the chain only if the jwt token is valid
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 
 	}
 }
 
-func chatHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	senderIDStr := r.URL.Query().Get("senderId")
-	receiverIDStr := r.URL.Query().Get("receiverId")
+// chatHistoryHandler returns the private messages between the authenticated user and the user
+// given by the "receiverId" parameter. Clients may also name the authenticated user as "senderId",
+// or give it as "receiverId" and the other user as "senderId"; the history of two other users is
+// answered 403 Forbidden.
+func (a *app) chatHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
 
-	senderID, err := strconv.ParseInt(senderIDStr, 10, 64)
+	receiverID, err := strconv.ParseInt(r.URL.Query().Get("receiverId"), 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid sender ID", http.StatusBadRequest)
+		http.Error(w, "Invalid receiver ID", http.StatusBadRequest)
 		return
 	}
 
-	receiverID, err := strconv.ParseInt(receiverIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid receiver ID", http.StatusBadRequest)
-		return
+	otherID := receiverID
+	if senderIDStr := r.URL.Query().Get("senderId"); senderIDStr != "" {
+		senderID, err := strconv.ParseInt(senderIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid sender ID", http.StatusBadRequest)
+			return
+		}
+		switch userID {
+		case senderID:
+		case receiverID:
+			otherID = senderID
+		default:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 	}
 
-	history, err := forumService.GetChatHistory(senderID, receiverID)
+	history, err := a.forumService.GetChatHistory(userID, otherID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to fetch chat history: %v", err), http.StatusInternalServerError)
 		return
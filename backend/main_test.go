@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"livechat-system/backend/blob"
+	"livechat-system/backend/config"
+	"livechat-system/backend/metrics"
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage/memstore"
+)
+
+// testConfig is the configuration of the apps under test: a fixed secret key and no rate limits.
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.Auth.SecretKey = "test-secret"
+	cfg.RateLimit.Enabled = false
+	return cfg
+}
+
+// newTestServer serves a new app on an empty in-memory store, with the uploads in a directory
+// of t, until t ends.
+func newTestServer(t *testing.T, cfg config.Config) *httptest.Server {
+	t.Helper()
+	blobs, err := blob.Open(config.AttachmentStoreFS, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newApp(cfg, memstore.New(), blobs)
+	srv := httptest.NewServer(a.handler(a.routes(), metrics.NewHTTPMetrics(metrics.NewRegistry())))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testUser is a registered user, logged in.
+type testUser struct {
+	ID    int64
+	Name  string
+	Token string
+}
+
+// do sends a request as user, who may be nil, with body encoded as JSON unless it is nil or
+// already a reader, and returns the status and the body of the response.
+func do(t *testing.T, srv *httptest.Server, user *testUser, method, path string, body interface{}) (int, []byte) {
+	t.Helper()
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = body
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// decode decodes the JSON body of a response into v.
+func decode(t *testing.T, data []byte, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+}
+
+func newUser(name string) realtimeforum.User {
+	return realtimeforum.User{
+		Username: name, Age: 30, Gender: "other", FirstName: name, LastName: "Test",
+		Email: name + "@example.com", Password: name + "-password",
+	}
+}
+
+// register registers a user named name and logs them in.
+func register(t *testing.T, srv *httptest.Server, name string) *testUser {
+	t.Helper()
+	if status, body := do(t, srv, nil, http.MethodPost, "/register", newUser(name)); status != http.StatusOK {
+		t.Fatalf("registering %s: %d %s", name, status, body)
+	}
+	status, body := do(t, srv, nil, http.MethodPost, "/login", map[string]string{"username": name, "password": name + "-password"})
+	if status != http.StatusOK {
+		t.Fatalf("logging in %s: %d %s", name, status, body)
+	}
+	var login struct {
+		Token  string `json:"token"`
+		UserID int64  `json:"userId"`
+	}
+	decode(t, body, &login)
+	return &testUser{ID: login.UserID, Name: name, Token: login.Token}
+}
+
+// newPost creates a post by user and returns its ID.
+func newPost(t *testing.T, srv *httptest.Server, user *testUser, title string) int64 {
+	t.Helper()
+	status, body := do(t, srv, user, http.MethodPost, "/newpost",
+		realtimeforum.Posts{Title: title, Content: title + " content", CategoryID: 1})
+	if status != http.StatusOK {
+		t.Fatalf("creating post %q: %d %s", title, status, body)
+	}
+	var created struct {
+		PostID int64 `json:"post_id"`
+	}
+	decode(t, body, &created)
+	return created.PostID
+}
+
+func postTitles(posts []realtimeforum.Posts) []string {
+	titles := []string{}
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func TestRegister(t *testing.T) {
+	srv := newTestServer(t, testConfig())
+
+	if status, body := do(t, srv, nil, http.MethodPost, "/register", newUser("alice")); status != http.StatusOK {
+		t.Fatalf("registering alice: %d %s", status, body)
+	}
+
+	taken := newUser("alice")
+	taken.Email = "other@example.com"
+	if status, body := do(t, srv, nil, http.MethodPost, "/register", taken); status != http.StatusConflict {
+		t.Errorf("registering a second alice: got %d %s, want %d", status, body, http.StatusConflict)
+	}
+	taken = newUser("bob")
+	taken.Email = "alice@example.com"
+	if status, body := do(t, srv, nil, http.MethodPost, "/register", taken); status != http.StatusConflict {
+		t.Errorf("registering with the email of alice: got %d %s, want %d", status, body, http.StatusConflict)
+	}
+	if status, _ := do(t, srv, nil, http.MethodPost, "/register", bytes.NewReader([]byte("{"))); status != http.StatusBadRequest {
+		t.Errorf("registering with an invalid body: got %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	srv := newTestServer(t, testConfig())
+	alice := register(t, srv, "alice")
+	if alice.ID == 0 || alice.Token == "" {
+		t.Fatalf("login of alice returned ID %d and token %q", alice.ID, alice.Token)
+	}
+
+	for _, credentials := range []map[string]string{
+		{"username": "alice", "password": "wrong"},
+		{"username": "nobody", "password": "nobody-password"},
+	} {
+		status, body := do(t, srv, nil, http.MethodPost, "/login", credentials)
+		if status != http.StatusUnauthorized {
+			t.Errorf("logging in as %s with password %s: got %d %s, want %d", credentials["username"],
+				credentials["password"], status, body, http.StatusUnauthorized)
+		}
+	}
+
+	// The token authenticates the routes behind jwtMiddleware, and nothing else does
+	if status, body := do(t, srv, alice, http.MethodGet, "/posts", nil); status != http.StatusOK {
+		t.Errorf("listing posts with the token: got %d %s", status, body)
+	}
+	if status, _ := do(t, srv, nil, http.MethodGet, "/posts", nil); status != http.StatusUnauthorized {
+		t.Errorf("listing posts without a token: got %d, want %d", status, http.StatusUnauthorized)
+	}
+	forged := &testUser{Token: alice.Token + "x"}
+	if status, _ := do(t, srv, forged, http.MethodGet, "/posts", nil); status != http.StatusUnauthorized {
+		t.Errorf("listing posts with a forged token: got %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestPosts(t *testing.T) {
+	srv := newTestServer(t, testConfig())
+	alice, bob := register(t, srv, "alice"), register(t, srv, "bob")
+	newPost(t, srv, alice, "By alice")
+	newPost(t, srv, bob, "By bob")
+
+	list := func(query string) []string {
+		t.Helper()
+		status, body := do(t, srv, alice, http.MethodGet, "/posts"+query, nil)
+		if status != http.StatusOK {
+			t.Fatalf("listing posts%s: %d %s", query, status, body)
+		}
+		var posts []realtimeforum.Posts
+		decode(t, body, &posts)
+		return postTitles(posts)
+	}
+	if titles := list(""); len(titles) != 2 {
+		t.Errorf("posts: got %q, want both", titles)
+	}
+
+	// Blocking bob hides his posts only on request
+	if status, body := do(t, srv, alice, http.MethodPost, "/blocks", map[string]int64{"user_id": bob.ID}); status != http.StatusCreated {
+		t.Fatalf("blocking bob: %d %s", status, body)
+	}
+	if titles := list(""); len(titles) != 2 {
+		t.Errorf("posts after blocking bob: got %q, want both", titles)
+	}
+	if titles := list("?hideBlocked=true"); len(titles) != 1 || titles[0] != "By alice" {
+		t.Errorf("posts hiding blocked users: got %q, want only the post by alice", titles)
+	}
+
+	if status, _ := do(t, srv, alice, http.MethodGet, "/posts?deleted=true", nil); status != http.StatusForbidden {
+		t.Errorf("listing deleted posts as a user: got %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+// postPath returns the path of a post for the /post route.
+func postPath(postID int64) string {
+	return "/post?postId=" + strconv.FormatInt(postID, 10)
+}
@@ -0,0 +1,455 @@
+// Package markdown renders the Markdown written in posts, comments and chat messages to HTML that
+// is safe to insert in a page. Only a small dialect is understood:
+//
+//	**bold** or __bold__, *italics* or _italics_, `code`
+//	[links](https://example.com), to http, https and mailto URLs or paths on this site
+//	- unordered lists (also with *)
+//	1. ordered lists
+//	```
+//	code blocks
+//	```
+//
+// Paragraphs are separated by blank lines, and single line breaks are kept. Everything else,
+// including any HTML in the source, is shown as written: the output is built from escaped text
+// and the few elements above, so nothing the author writes can add markup of its own.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxNesting bounds how deeply emphasis may nest. Deeper markers are shown as written.
+const maxNesting = 8
+
+// linkRel is the rel attribute of links, which are written by users.
+const linkRel = "nofollow ugc noopener noreferrer"
+
+var (
+	unorderedItem = regexp.MustCompile(`^\s{0,3}[-*]\s+(.*)$`)
+	orderedItem   = regexp.MustCompile(`^\s{0,3}[0-9]{1,9}[.)]\s+(.*)$`)
+	fence         = regexp.MustCompile("^\\s{0,3}```")
+)
+
+// Options extend the rendering.
+type Options struct {
+	// Embed, when set, is offered each line that could start a paragraph. When it reports ok, the
+	// line is ended by embedHTML, which is inserted as is, and the rest of the line is rendered
+	// as the start of the next paragraph.
+	Embed func(line string) (embedHTML, rest string, ok bool)
+}
+
+// Render returns source rendered as safe HTML.
+func Render(source string) string {
+	return RenderWith(source, Options{})
+}
+
+// RenderWith is Render with extensions.
+func RenderWith(source string, opts Options) string {
+	r := renderer{opts: opts}
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			r.closeBlock()
+
+		case fence.MatchString(line):
+			r.closeBlock()
+			var code []string
+			for i++; i < len(lines) && !fence.MatchString(lines[i]); i++ {
+				code = append(code, lines[i])
+			}
+			// An unclosed block runs to the end
+			r.b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+
+		case unorderedItem.MatchString(line):
+			r.listItem("ul", unorderedItem.FindStringSubmatch(line)[1])
+
+		case orderedItem.MatchString(line):
+			r.listItem("ol", orderedItem.FindStringSubmatch(line)[1])
+
+		default:
+			r.paragraphLine(line)
+		}
+	}
+	r.closeBlock()
+	return r.b.String()
+}
+
+// renderer writes the blocks of a text in order, keeping the paragraph or list being written open
+// until a line of another kind ends it.
+type renderer struct {
+	b    strings.Builder
+	opts Options
+	open string // Element of the block being written: "p", "ul", "ol" or "" for none
+}
+
+func (r *renderer) closeBlock() {
+	if r.open != "" {
+		r.b.WriteString("</" + r.open + ">")
+		r.open = ""
+	}
+}
+
+func (r *renderer) listItem(list, text string) {
+	if r.open != list {
+		r.closeBlock()
+		r.b.WriteString("<" + list + ">")
+		r.open = list
+	}
+	r.b.WriteString("<li>" + inline(text) + "</li>")
+}
+
+func (r *renderer) paragraphLine(line string) {
+	if r.opts.Embed != nil {
+		if embedHTML, rest, ok := r.opts.Embed(line); ok {
+			r.closeBlock()
+			r.b.WriteString(embedHTML)
+			if strings.TrimSpace(rest) != "" {
+				r.paragraphLine(rest)
+			}
+			return
+		}
+	}
+	if r.open == "p" {
+		r.b.WriteString("<br>")
+	} else {
+		r.closeBlock()
+		r.b.WriteString("<p>")
+		r.open = "p"
+	}
+	r.b.WriteString(inline(strings.TrimSpace(line)))
+}
+
+// inline renders the emphasis, code and links of a line of text.
+func inline(text string) string {
+	p := inlineParser{text: text, paren: -1}
+	return p.parse()
+}
+
+// inlineParser renders a line of text in a single pass. Code spans and links are rendered as they
+// are read. Each run of emphasis markers is matched, as it is read, against the runs before it
+// that may still open emphasis, kept on a stack, so no text takes more than linear time.
+type inlineParser struct {
+	text  string
+	label bool // Rendering a link label, in which emphasis and links are shown as written
+
+	parts  []part
+	runs   []markerRun
+	pairs  []emphasisPair
+	stack  []int        // Runs that may still open emphasis, in order
+	bottom map[byte]int // By marker, the height of stack below which no run may open it
+
+	backticks map[int][]int // Start of every run of backticks, by length
+	passed    map[int]int   // By length, how many of those runs start before the text being read
+	paren     int           // The next ')' found by nextParen, len(text) for none, -1 before any search
+}
+
+// part is a piece of the rendered line: HTML, or a run of emphasis markers when run is not -1.
+type part struct {
+	html string
+	run  int
+}
+
+// markerRun is a run of emphasis markers. The markers it does not use to open or close emphasis
+// are shown as written.
+type markerRun struct {
+	marker            byte
+	unused            int
+	canOpen, canClose bool
+	opens, closes     []int // Pairs the run opens and closes, innermost first
+}
+
+// emphasisPair is the emphasis between two runs of markers.
+type emphasisPair struct {
+	element string // "em" or "strong"
+	markers string // Shown as written instead when the emphasis nests too deeply
+}
+
+func (p *inlineParser) parse() string {
+	text := p.text
+	plain := 0 // Start of the text not written yet
+	flush := func(end int) {
+		if end > plain {
+			p.parts = append(p.parts, part{html: html.EscapeString(unescape(text[plain:end])), run: -1})
+		}
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isPunct(text[i+1]):
+			// Kept for unescape, which drops the backslash once the text is written
+			i += 2
+			continue
+
+		case c == '`':
+			run := runLength(text, i, '`')
+			end, ok := p.closingBackticks(i, run)
+			if !ok {
+				i += run
+				continue
+			}
+			flush(i)
+			code := strings.TrimSpace(text[i+run : end])
+			p.parts = append(p.parts, part{html: "<code>" + html.EscapeString(code) + "</code>", run: -1})
+			i = end + run
+			plain = i
+			continue
+
+		case (c == '*' || c == '_') && !p.label:
+			run := runLength(text, i, c)
+			flush(i)
+			p.addRun(i, run)
+			i += run
+			plain = i
+			continue
+
+		case c == '[' && !p.label:
+			if label, href, next, ok := p.link(i); ok {
+				flush(i)
+				labelParser := inlineParser{text: label, label: true, paren: -1}
+				p.parts = append(p.parts, part{html: `<a href="` + html.EscapeString(href) + `" rel="` + linkRel + `">` +
+					labelParser.parse() + "</a>", run: -1})
+				i, plain = next, next
+				continue
+			}
+		}
+		i++
+	}
+	flush(len(text))
+	return p.render()
+}
+
+// addRun reads the run of n emphasis markers at i. Markers must touch the text they emphasize,
+// and underscores inside words, as in snake_case, are not markers.
+func (p *inlineParser) addRun(i, n int) {
+	text := p.text
+	before, after := byte(' '), byte(' ')
+	if i > 0 {
+		before = text[i-1]
+	}
+	if i+n < len(text) {
+		after = text[i+n]
+	}
+	run := markerRun{marker: text[i], unused: n, canOpen: !isSpace(after), canClose: !isSpace(before)}
+	if run.marker == '_' {
+		run.canOpen = run.canOpen && !isWord(before)
+		run.canClose = run.canClose && !isWord(after)
+	}
+
+	index := len(p.runs)
+	p.runs = append(p.runs, run)
+	p.parts = append(p.parts, part{run: index})
+	if run.canClose {
+		p.closeEmphasis(index)
+	}
+	if p.runs[index].unused > 0 && run.canOpen {
+		p.stack = append(p.stack, index)
+	}
+}
+
+// closeEmphasis closes, innermost first, the emphasis opened by the runs on the stack with the
+// run at index. Two markers on each side make bold, one makes italics. The runs between an opener
+// and the run closing it can no longer open anything, and are shown as written.
+func (p *inlineParser) closeEmphasis(index int) {
+	if p.bottom == nil {
+		p.bottom = make(map[byte]int)
+	}
+	closer := &p.runs[index]
+	for closer.unused > 0 {
+		k := len(p.stack) - 1
+		for k >= p.bottom[closer.marker] && p.runs[p.stack[k]].marker != closer.marker {
+			k--
+		}
+		if k < p.bottom[closer.marker] {
+			// The runs read later need not look below here again
+			p.bottom[closer.marker] = len(p.stack)
+			return
+		}
+
+		opener := &p.runs[p.stack[k]]
+		n := 1
+		if opener.unused >= 2 && closer.unused >= 2 {
+			n = 2
+		}
+		pair := emphasisPair{element: "em", markers: strings.Repeat(string(closer.marker), n)}
+		if n == 2 {
+			pair.element = "strong"
+		}
+		p.pairs = append(p.pairs, pair)
+		opener.opens = append(opener.opens, len(p.pairs)-1)
+		closer.closes = append(closer.closes, len(p.pairs)-1)
+		opener.unused -= n
+		closer.unused -= n
+
+		if opener.unused == 0 {
+			k--
+		}
+		p.stack = p.stack[:k+1]
+		for marker, bottom := range p.bottom {
+			p.bottom[marker] = min(bottom, len(p.stack))
+		}
+	}
+}
+
+// render writes the parts of the line, with the emphasis nesting deeper than maxNesting shown
+// as written.
+func (p *inlineParser) render() string {
+	var b strings.Builder
+	literal := make([]bool, len(p.pairs))
+	depth := 0
+	for _, part := range p.parts {
+		if part.run < 0 {
+			b.WriteString(part.html)
+			continue
+		}
+		run := p.runs[part.run]
+		for _, i := range run.closes {
+			depth--
+			if literal[i] {
+				b.WriteString(p.pairs[i].markers)
+			} else {
+				b.WriteString("</" + p.pairs[i].element + ">")
+			}
+		}
+		b.WriteString(strings.Repeat(string(run.marker), run.unused))
+		for j := len(run.opens) - 1; j >= 0; j-- {
+			i := run.opens[j]
+			depth++
+			literal[i] = depth > maxNesting
+			if literal[i] {
+				b.WriteString(p.pairs[i].markers)
+			} else {
+				b.WriteString("<" + p.pairs[i].element + ">")
+			}
+		}
+	}
+	return b.String()
+}
+
+// closingBackticks returns where the code span opened by the run of n backticks at i ends: at the
+// next run of exactly n backticks.
+func (p *inlineParser) closingBackticks(i, n int) (int, bool) {
+	if p.backticks == nil {
+		p.backticks, p.passed = make(map[int][]int), make(map[int]int)
+		for j := 0; j < len(p.text); {
+			if p.text[j] != '`' {
+				j++
+				continue
+			}
+			run := runLength(p.text, j, '`')
+			p.backticks[run] = append(p.backticks[run], j)
+			j += run
+		}
+	}
+	starts := p.backticks[n]
+	k := p.passed[n]
+	for k < len(starts) && starts[k] <= i {
+		k++
+	}
+	p.passed[n] = k
+	if k == len(starts) {
+		return 0, false
+	}
+	return starts[k], true
+}
+
+// link reads the link starting at i, written [label](href). Links to URLs that are not allowed
+// are not links, and are shown as written.
+func (p *inlineParser) link(i int) (label, href string, next int, ok bool) {
+	text := p.text
+	closing := strings.IndexAny(text[i+1:], "[]")
+	if closing <= 0 {
+		return "", "", 0, false
+	}
+	closing += i + 1
+	if text[closing] != ']' || closing+1 >= len(text) || text[closing+1] != '(' {
+		return "", "", 0, false
+	}
+	end := p.nextParen(closing + 2)
+	if end < 0 {
+		return "", "", 0, false
+	}
+	href = strings.TrimSpace(text[closing+2 : end])
+	if !allowedURL(href) {
+		return "", "", 0, false
+	}
+	return text[i+1 : closing], href, end + 1, true
+}
+
+// nextParen returns the position of the first ')' at or after from, or -1. The positions asked
+// for only grow, so the text is searched once.
+func (p *inlineParser) nextParen(from int) int {
+	if p.paren < from {
+		if end := strings.IndexByte(p.text[from:], ')'); end >= 0 {
+			p.paren = from + end
+		} else {
+			p.paren = len(p.text)
+		}
+	}
+	if p.paren == len(p.text) {
+		return -1
+	}
+	return p.paren
+}
+
+// allowedURL reports whether a link may point to href: http, https and mailto URLs, and paths on
+// this site. Other schemes, such as javascript:, could run code when the link is followed.
+func allowedURL(href string) bool {
+	if href == "" || strings.ContainsAny(href, " \t\n\"'<>`\\") {
+		return false
+	}
+	if strings.HasPrefix(href, "/") {
+		return !strings.HasPrefix(href, "//")
+	}
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		return parsed.Host != ""
+	case "mailto":
+		return parsed.Opaque != ""
+	}
+	return false
+}
+
+func runLength(text string, i int, c byte) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// unescape drops the backslashes written before punctuation to show it as is.
+func unescape(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) && isPunct(text[i+1]) {
+			i++
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("\\`*_[]()#+-.!>", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,91 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	for _, tc := range []struct {
+		name, source, want string
+	}{
+		{"bold and italics", "**bold**, __bold__, *it* and _it_",
+			"<p><strong>bold</strong>, <strong>bold</strong>, <em>it</em> and <em>it</em></p>"},
+		{"italics in bold", "**bold *both* bold**", "<p><strong>bold <em>both</em> bold</strong></p>"},
+		{"bold in italics", "*it **both** it*", "<p><em>it <strong>both</strong> it</em></p>"},
+		{"bold in bold", "**a **b** c**", "<p><strong>a <strong>b</strong> c</strong></p>"},
+		{"bold italics", "***both***", "<p><em><strong>both</strong></em></p>"},
+		{"inside words", "a*b*c", "<p>a<em>b</em>c</p>"},
+		{"underscores inside words", "snake_case_name and _a_b", "<p>snake_case_name and _a_b</p>"},
+		{"unclosed", "*open and **open", "<p>*open and **open</p>"},
+		{"closed by a shorter run", "**a*", "<p>*<em>a</em></p>"},
+		{"closed by a longer run", "*a**", "<p><em>a</em>*</p>"},
+		{"markers apart from text", "a * b * c", "<p>a * b * c</p>"},
+		{"crossing", "*a _b* c_", "<p><em>a _b</em> c_</p>"},
+		{"escaped markers", `\*not\* \_not\_`, "<p>*not* _not_</p>"},
+		{"code", "`*not* <b>` and ``a ` b``", "<p><code>*not* &lt;b&gt;</code> and <code>a ` b</code></p>"},
+		{"unclosed code", "`open *it*", "<p>`open <em>it</em></p>"},
+		{"code in italics", "*a `*` b*", "<p><em>a <code>*</code> b</em></p>"},
+		{"raw HTML", `<script>alert("x")</script> <img src=x onerror=alert(1)>`,
+			"<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &lt;img src=x onerror=alert(1)&gt;</p>"},
+		{"link", "[site](https://example.com/a?b=1&c=2)",
+			`<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow ugc noopener noreferrer">site</a></p>`},
+		{"link on this site", "[post](/post?postId=1)",
+			`<p><a href="/post?postId=1" rel="nofollow ugc noopener noreferrer">post</a></p>`},
+		{"link in italics", "*see [site](https://example.com)*",
+			`<p><em>see <a href="https://example.com" rel="nofollow ugc noopener noreferrer">site</a></em></p>`},
+		{"markers in a link label", "[**x**](/y)", `<p><a href="/y" rel="nofollow ugc noopener noreferrer">**x**</a></p>`},
+		{"javascript link", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>"},
+		{"javascript link in capitals", "[x](JavaScript:alert(1))", "<p>[x](JavaScript:alert(1))</p>"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>[x](data:text/html;base64,PHNjcmlwdD4=)</p>"},
+		{"protocol-relative link", "[x](//evil.example)", "<p>[x](//evil.example)</p>"},
+		{"attribute in a link", `[x](https://example.com/"onmouseover=alert(1))`,
+			"<p>[x](https://example.com/&#34;onmouseover=alert(1))</p>"},
+		{"escaped link", `\[a](/b)`, "<p>[a](/b)</p>"},
+		{"paragraphs and line breaks", "a\nb\n\nc", "<p>a<br>b</p><p>c</p>"},
+		{"lists", "- a\n* b\n1. c", "<ul><li>a</li><li>b</li></ul><ol><li>c</li></ol>"},
+		{"code block", "```\n*not* <b>\n```\nafter", "<pre><code>*not* &lt;b&gt;</code></pre><p>after</p>"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Render(tc.source); got != tc.want {
+				t.Errorf("Render(%q)\ngot  %s\nwant %s", tc.source, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestRenderNesting checks that emphasis nesting deeper than maxNesting is shown as written.
+func TestRenderNesting(t *testing.T) {
+	var open, closing []string
+	for level := 1; level <= maxNesting+2; level++ {
+		marker := "*"
+		if level%2 == 0 {
+			marker = "_"
+		}
+		open = append(open, marker+strconv.Itoa(level))
+		closing = append([]string{strconv.Itoa(level) + marker}, closing...)
+	}
+	got := Render(strings.Join(open, " ") + " x " + strings.Join(closing, " "))
+	if n := strings.Count(got, "<em>"); n != maxNesting || strings.Count(got, "</em>") != n {
+		t.Errorf("%d levels of italics: got %d rendered in %s, want %d", maxNesting+2, n, got, maxNesting)
+	}
+	if !strings.Contains(got, "*9 _10 x 10_ 9*") {
+		t.Errorf("%d levels of italics: got %s, want the deepest levels as written", maxNesting+2, got)
+	}
+}
+
+// TestRenderLargeInput checks that rendering takes linear time: text that makes a renderer
+// scan ahead from every marker takes seconds at this size when that time is quadratic.
+func TestRenderLargeInput(t *testing.T) {
+	const size = 64 << 10
+	for _, unit := range []string{"*a ", "a* ", "_a *b ", "**a _b ", "a*b", "`a ", "[a", "[a](", "[a](b) *"} {
+		source := strings.Repeat(unit, size/len(unit))
+		start := time.Now()
+		Render(source)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("rendering %d bytes of %q took %v", len(source), unit, elapsed)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"livechat-system/backend/metrics"
+	"livechat-system/backend/scheduler"
+	"livechat-system/backend/storage"
+	websocket "livechat-system/backend/websocket"
+)
+
+// observeStore returns store timing each of its calls in a histogram per method.
+func observeStore(registry *metrics.Registry, store storage.Store) storage.Store {
+	queries := registry.NewHistogramVec("livechat_db_query_duration_seconds",
+		"Time spent in calls to the database store, by store method.", nil, "method")
+	return storage.Observe(store, func(method string, elapsed time.Duration) {
+		queries.With(method).Observe(elapsed.Seconds())
+	})
+}
+
+// registerMetrics exposes the metrics of the WebSocket hub and the maintenance jobs. Database
+// metrics are recorded by observeStore, HTTP request metrics by the middleware app.handler wraps
+// the routes in. main calls it and serves the registry on /metrics.
+func registerMetrics(registry *metrics.Registry, wsServer *websocket.WebSocketServer, jobs *scheduler.Scheduler) {
+	wsServer.RegisterMetrics(registry)
+
+	// The scheduler already keeps these numbers, they are read when the metrics are scraped
+	registry.NewFunc("livechat_job_runs_total", "Completed runs of the maintenance jobs by outcome.",
+		metrics.TypeCounter, []string{"job", "outcome"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, status := range jobs.Status() {
+				samples = append(samples,
+					metrics.Sample{LabelValues: []string{status.Name, "success"}, Value: float64(status.Runs - status.Failures)},
+					metrics.Sample{LabelValues: []string{status.Name, "error"}, Value: float64(status.Failures - status.Panics)},
+					metrics.Sample{LabelValues: []string{status.Name, "panic"}, Value: float64(status.Panics)},
+				)
+			}
+			return samples
+		})
+	registry.NewFunc("livechat_job_run_duration_seconds_total", "Time spent running the maintenance jobs.",
+		metrics.TypeCounter, []string{"job"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, status := range jobs.Status() {
+				samples = append(samples, metrics.Sample{LabelValues: []string{status.Name}, Value: status.TotalDuration.Seconds()})
+			}
+			return samples
+		})
+	registry.NewFunc("livechat_job_last_run_timestamp_seconds", "Unix time at which each maintenance job last started.",
+		metrics.TypeGauge, []string{"job"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, status := range jobs.Status() {
+				if status.LastRun != nil {
+					samples = append(samples, metrics.Sample{LabelValues: []string{status.Name}, Value: float64(status.LastRun.UnixNano()) / 1e9})
+				}
+			}
+			return samples
+		})
+}
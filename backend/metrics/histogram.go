@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 1ms to 10s.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+	order   map[string][]string
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64 // Observations per bucket, not cumulative; the last entry is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations, such as latencies, in buckets.
+type Histogram struct {
+	h       *histogram
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds (nil for DefaultBuckets) and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		desc:    desc{metricName: name, help: help, metricType: TypeHistogram, labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+		order:   make(map[string][]string),
+	}
+	r.register(h)
+	return h
+}
+
+// With returns the histogram for the given label values.
+func (hv *HistogramVec) With(labelValues ...string) Histogram {
+	key := hv.key(labelValues)
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	h, ok := hv.series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(hv.buckets)+1)}
+		hv.series[key] = h
+		hv.order[key] = append([]string(nil), labelValues...)
+	}
+	return Histogram{h: h, buckets: hv.buckets}
+}
+
+// Observe records one value.
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v) // First bucket whose bound is >= v
+	h.h.mu.Lock()
+	h.h.counts[i]++
+	h.h.sum += v
+	h.h.count++
+	h.h.mu.Unlock()
+}
+
+// ObserveDuration records the time elapsed since start, in seconds.
+func (h Histogram) ObserveDuration(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (hv *HistogramVec) write(w io.Writer) {
+	hv.writeHeader(w)
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	keys := make([]string, 0, len(hv.series))
+	for key := range hv.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h, labels := hv.series[key], hv.order[key]
+		h.mu.Lock()
+		var cumulative uint64
+		for i, bound := range hv.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", hv.metricName, hv.labelPairs(labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", hv.metricName, hv.labelPairs(labels, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", hv.metricName, hv.labelPairs(labels), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", hv.metricName, hv.labelPairs(labels), h.count)
+		h.mu.Unlock()
+	}
+}
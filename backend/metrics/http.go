@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"livechat-system/backend/internal/httpx"
+)
+
+// HTTPMetrics counts HTTP requests and measures their latency per route.
+type HTTPMetrics struct {
+	requests  *CounterVec
+	durations *HistogramVec
+}
+
+// NewHTTPMetrics registers the HTTP request metrics.
+func NewHTTPMetrics(r *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: r.NewCounterVec("livechat_http_requests_total",
+			"HTTP requests by route, method and status code.", "route", "method", "code"),
+		durations: r.NewHistogramVec("livechat_http_request_duration_seconds",
+			"Time to serve HTTP requests by route and method.", nil, "route", "method"),
+	}
+}
+
+// Middleware records every request served by next. The route label is the pattern of mux that
+// matches the request rather than the raw path, so paths that no route serves cannot create
+// new series. Upgraded WebSocket connections are counted when they are upgraded and their
+// duration is not observed, as it is the lifetime of the connection.
+func (m *HTTPMetrics) Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		method := methodLabel(r.Method)
+
+		recorder := httpx.NewStatusRecorder(w)
+		recorder.OnHijack = func() {
+			m.requests.With(route, method, strconv.Itoa(http.StatusSwitchingProtocols)).Inc()
+		}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+
+		if recorder.Hijacked {
+			return
+		}
+		m.requests.With(route, method, strconv.Itoa(recorder.Status)).Inc()
+		m.durations.With(route, method).ObserveDuration(start)
+	})
+}
+
+// methodLabel maps unusual methods to "other", since clients choose the method freely.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,272 @@
+// Package metrics implements counters, gauges and histograms exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types, as written in the # TYPE line.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// family is a metric name with its help text, type and label names.
+type family interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metric families served by Handler.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.families[f.name()]; exists {
+		panic("metrics: duplicate metric " + f.name())
+	}
+	r.families[f.name()] = f
+}
+
+// Handler serves every registered metric in the Prometheus text exposition format.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		families := make([]family, 0, len(r.families))
+		for _, f := range r.families {
+			families = append(families, f)
+		}
+		r.mu.Unlock()
+		sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, f := range families {
+			f.write(w)
+		}
+	}
+}
+
+// desc is the part shared by every family.
+type desc struct {
+	metricName string
+	help       string
+	metricType string
+	labels     []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, escapeHelp(d.help), d.metricName, d.metricType)
+}
+
+// key joins label values into a map key.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats label values as {a="x",b="y"}, with extra pairs appended.
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(d.labels)+len(extra)/2)
+	for i, label := range d.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// value is a float64 guarded by a mutex; no metric is on a path hot enough to need atomics.
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (v *value) set(x float64) {
+	v.mu.Lock()
+	v.v = x
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// vec holds one value per combination of label values.
+type vec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*value
+	order  map[string][]string
+}
+
+func newVec(name, help, metricType string, labels []string) vec {
+	return vec{
+		desc:   desc{metricName: name, help: help, metricType: metricType, labels: labels},
+		values: make(map[string]*value),
+		order:  make(map[string][]string),
+	}
+}
+
+func (v *vec) with(labelValues []string) *value {
+	key := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	val, ok := v.values[key]
+	if !ok {
+		val = &value{}
+		v.values[key] = val
+		v.order[key] = append([]string(nil), labelValues...)
+	}
+	return val
+}
+
+func (v *vec) write(w io.Writer) {
+	v.writeHeader(w)
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, v.labelPairs(v.order[key]), formatFloat(v.values[key].get()))
+	}
+	v.mu.Unlock()
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct{ vec }
+
+// Counter is a value that only goes up.
+type Counter struct{ v *value }
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, TypeCounter, labels)}
+	r.register(c)
+	return c
+}
+
+// With returns the counter for the given label values, in the order the labels were declared.
+func (c *CounterVec) With(labelValues ...string) Counter {
+	return Counter{c.with(labelValues)}
+}
+
+// Inc adds one to the counter.
+func (c Counter) Inc() { c.v.add(1) }
+
+// Add adds a non-negative amount to the counter.
+func (c Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.v.add(delta)
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct{ vec }
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ v *value }
+
+// NewGaugeVec registers a gauge with the given label names.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, TypeGauge, labels)}
+	r.register(g)
+	return g
+}
+
+// With returns the gauge for the given label values.
+func (g *GaugeVec) With(labelValues ...string) Gauge {
+	return Gauge{g.with(labelValues)}
+}
+
+// Set replaces the value of the gauge.
+func (g Gauge) Set(x float64) { g.v.set(x) }
+
+// Add adds delta, which may be negative, to the gauge.
+func (g Gauge) Add(delta float64) { g.v.add(delta) }
+
+// Inc adds one to the gauge.
+func (g Gauge) Inc() { g.v.add(1) }
+
+// Dec subtracts one from the gauge.
+func (g Gauge) Dec() { g.v.add(-1) }
+
+// Sample is one value of a metric computed when the metrics are scraped.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type funcFamily struct {
+	desc
+	collect func() []Sample
+}
+
+// NewFunc registers a counter or gauge whose values are computed by collect at scrape time,
+// for values that already live elsewhere, such as the number of open connections.
+func (r *Registry) NewFunc(name, help, metricType string, labels []string, collect func() []Sample) {
+	r.register(&funcFamily{desc: desc{metricName: name, help: help, metricType: metricType, labels: labels}, collect: collect})
+}
+
+func (f *funcFamily) write(w io.Writer) {
+	f.writeHeader(w)
+	for _, sample := range f.collect() {
+		f.key(sample.LabelValues) // Validates the number of label values
+		fmt.Fprintf(w, "%s%s %s\n", f.metricName, f.labelPairs(sample.LabelValues), formatFloat(sample.Value))
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
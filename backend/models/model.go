@@ -10,27 +10,155 @@ type User struct {
 	Gender    string `json:"gender"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
+	Email     string `json:"email" log:"redact"`
+	Password  string `json:"password" log:"redact"`
 }
 
-// Post represents the Posts table in the database
+// Roles of users. Moderators may edit and delete every post, and see deleted posts.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+)
+
+// UserRole is a user and their role.
+type UserRole struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Post represents the Posts table in the database. Content is the Markdown source written by the
+// author, and ContentHTML its rendering, stored with it.
 type Posts struct {
-	PostID     int       `json:"post_id"`
-	UserID     int       `json:"user_id"`
-	Title      string    `json:"post_title"`
-	Content    string    `json:"post_content"`
-	CategoryID int       `json:"category_id"`
-	CreatedAt  time.Time `json:"created_at"`
+	PostID      int        `json:"post_id"`
+	UserID      int        `json:"user_id"`
+	Title       string     `json:"post_title"`
+	Content     string     `json:"post_content"`
+	ContentHTML string     `json:"post_content_html"`
+	CategoryID  int        `json:"category_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`  // Last edit, if any
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // Set once the post is deleted; only moderators see deleted posts
+	DeletedBy   int        `json:"deleted_by,omitempty"` // Author or moderator who deleted the post
+
+	AttachmentIDs []int64      `json:"attachment_ids,omitempty"` // Uploads of the author to attach when creating the post
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	Poll          *Poll        `json:"poll,omitempty"` // Given with the options when creating the post; returned with the votes
+}
+
+// Poll is the poll of a post, from the Polls table. Its question is the title of the post. The
+// votes are counted when it is read; MyVotes and the voters of the options depend on who reads it.
+type Poll struct {
+	PostID    int          `json:"post_id"`
+	Multiple  bool         `json:"multiple"`            // Voters may choose several options, instead of one
+	Anonymous bool         `json:"anonymous"`           // Who voted for what is never shown
+	ClosesAt  *time.Time   `json:"closes_at,omitempty"` // No votes are taken from then on; open forever when nil
+	Closed    bool         `json:"closed"`
+	Options   []PollOption `json:"options"`
+	Voters    int          `json:"voters"`             // Number of users who voted
+	MyVotes   []int        `json:"my_votes,omitempty"` // Options the reader voted for
+}
+
+// PollOption is one of the answers of a poll, from the Poll_Options table.
+type PollOption struct {
+	OptionID int      `json:"option_id"`
+	Text     string   `json:"text"`
+	Votes    int      `json:"votes"`
+	Voters   []string `json:"voters,omitempty"` // Usernames of the voters, unless the poll is anonymous
+}
+
+// PostEdit is the new version of a post given when editing it.
+type PostEdit struct {
+	Title       string `json:"post_title"`
+	Content     string `json:"post_content"`
+	ContentHTML string `json:"-"` // Rendered by the server
+	CategoryID  int    `json:"category_id"`
+}
+
+// PostRevision is a version of a post replaced by an edit, from the Post_Revisions table.
+type PostRevision struct {
+	RevisionID     int        `json:"revision_id"`
+	PostID         int        `json:"post_id"`
+	Title          string     `json:"post_title"`
+	Content        string     `json:"post_content"`
+	CategoryID     int        `json:"category_id"`
+	EditorID       int        `json:"editor_id"` // User whose edit replaced this version
+	EditorUsername string     `json:"editor_username"`
+	RevisedAt      time.Time  `json:"revised_at"`     // When this version was replaced
+	Diff           []DiffLine `json:"diff,omitempty"` // Changes of the content made by the edit, line by line
+}
+
+// Operations of a DiffLine.
+const (
+	DiffEqual  = " "
+	DiffDelete = "-"
+	DiffInsert = "+"
+)
+
+// DiffLine is a line of a line-by-line difference between two texts.
+type DiffLine struct {
+	Op   string `json:"op"` // DiffEqual, DiffDelete or DiffInsert
+	Text string `json:"text"`
+}
+
+// PostSummary is what "newPost" and "postEdited" frames tell feed subscribers about a post:
+// enough to list it without fetching /posts again. "postDeleted" and "pollResults" frames only
+// identify the post.
+type PostSummary struct {
+	PostID             int        `json:"post_id"`
+	UserID             int        `json:"user_id"`
+	AuthorUsername     string     `json:"author_username,omitempty"`
+	Title              string     `json:"post_title,omitempty"`
+	Excerpt            string     `json:"excerpt,omitempty"` // Start of the content, cut at a word boundary
+	CategoryID         int        `json:"category_id"`
+	PreviousCategoryID int        `json:"previous_category_id,omitempty"` // Category an edit moved the post out of
+	CreatedAt          time.Time  `json:"created_at"`
+	EditedAt           *time.Time `json:"edited_at,omitempty"`
+	Deleted            bool       `json:"deleted,omitempty"`
 }
 
-// Comment represents the Comments table in the database
+// Kinds of SearchResult.
+const (
+	SearchKindPost    = "post"
+	SearchKindComment = "comment"
+	SearchKindChat    = "chat"
+)
+
+// SearchResult is a post, comment or chat message matching a search.
+type SearchResult struct {
+	Kind           string    `json:"kind"`                  // SearchKindPost, SearchKindComment or SearchKindChat
+	ID             int64     `json:"id"`                    // ID of the post, comment or chat message
+	PostID         int64     `json:"post_id,omitempty"`     // Post a comment belongs to
+	ReceiverID     int64     `json:"receiver_id,omitempty"` // Receiver of a private message; 0 for the lobby
+	AuthorID       int64     `json:"author_id"`
+	AuthorUsername string    `json:"author_username"`
+	Title          string    `json:"title,omitempty"`       // Title of a post, or of the post of a comment
+	CategoryID     int       `json:"category_id,omitempty"` // Category of a post, or of the post of a comment
+	Snippet        string    `json:"snippet"`               // HTML excerpt with the matches wrapped in <mark>
+	CreatedAt      time.Time `json:"created_at"`
+	Score          float64   `json:"score"` // Relevance; higher is better, only comparable within one search
+}
+
+// Comment represents the Comments table in the database. Comments form a tree under their
+// post: top-level comments have no parent and a Depth of 0, and replies are one level deeper
+// than the comment they answer. Content is Markdown, stored with its rendering in ContentHTML;
+// quotes are rendered for each reader.
 type Comments struct {
-	CommentID int       `json:"comment_id"`
-	AuthorID  int       `json:"author_id"`
-	PostID    int       `json:"post_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	CommentID       int       `json:"comment_id"`
+	AuthorID        int       `json:"author_id"`
+	AuthorUsername  string    `json:"author_username,omitempty"`
+	PostID          int       `json:"post_id"`
+	ParentCommentID int       `json:"parent_comment_id,omitempty"` // Comment this one replies to; 0 for a top-level comment
+	Depth           int       `json:"depth"`
+	Content         string    `json:"content"`
+	CreatedAt       time.Time `json:"created_at"`
+	ContentHTML     string    `json:"content_html,omitempty"` // Content as safe HTML, with quotes rendered by the comments API
+
+	// Filled by the comments API
+	Hidden     bool       `json:"hidden,omitempty"`      // Written by a user the viewer blocked; content and author are left out
+	ReplyCount int        `json:"reply_count"`           // Direct replies, whether listed or not
+	Replies    []Comments `json:"replies,omitempty"`     // Replies listed in the tree format
+	NextCursor int        `json:"next_cursor,omitempty"` // Set when more replies follow: pass it as after to list them
 }
 
 // Like represents the Likes table in the database
@@ -52,16 +180,107 @@ type PostCategory struct {
 	CategoryID int `json:"category_id"`
 }
 
-// Chat represents the Chats table in the database
+// Chat represents the Chats table in the database. MessageContent is the Markdown source, stored
+// with its rendering in MessageHTML.
 type Chats struct {
-	MessageID      int       `json:"message_id"`
-	SenderID       int       `json:"sender_id"`
-	ReceiverID     int       `json:"receiver_id"`
-	MessageContent string    `json:"message_content"`
-	SentAt         time.Time `json:"sent_at"`
-	SenderUsername string    `json:"senderUsername"`
+	MessageID       int               `json:"message_id"`
+	SenderID        int               `json:"sender_id"`
+	ReceiverID      int               `json:"receiver_id"`
+	MessageContent  string            `json:"message_content"`
+	MessageHTML     string            `json:"message_html,omitempty"`
+	SentAt          time.Time         `json:"sent_at"`
+	SenderUsername  string            `json:"senderUsername"`
+	ClientMessageID string            `json:"clientMessageId,omitempty"`
+	DeliveredAt     *time.Time        `json:"delivered_at,omitempty"`
+	EditedAt        *time.Time        `json:"edited_at,omitempty"`
+	Deleted         bool              `json:"deleted,omitempty"`
+	Reactions       []ReactionSummary `json:"reactions,omitempty"`
+	AttachmentIDs   []int64           `json:"-"` // Uploads of the sender to attach when storing the message
+	Attachments     []Attachment      `json:"attachments,omitempty"`
+}
+
+// Attachment represents the Attachments table: a file uploaded by a user, whose content is kept
+// in the blob store. An upload belongs to its uploader alone until it is attached to one post or
+// chat message, after which whoever may see the post or message may download it.
+type Attachment struct {
+	AttachmentID int       `json:"attachment_id"`
+	UploaderID   int       `json:"uploader_id"`
+	PostID       int       `json:"post_id,omitempty"`    // Post it is attached to, if any
+	MessageID    int       `json:"message_id,omitempty"` // Chat message it is attached to, if any
+	Filename     string    `json:"filename"`             // Name given by the uploader, only used when downloading
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"` // In bytes
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	HasThumbnail bool      `json:"has_thumbnail"` // Images have a thumbnail, served with size=thumbnail
+	CreatedAt    time.Time `json:"created_at"`
+	BlobKey      string    `json:"-"`
+	ThumbnailKey string    `json:"-"` // Empty when there is no thumbnail
+}
+
+// ReactionSummary aggregates the reactions with one emoji on a chat message.
+type ReactionSummary struct {
+	Emoji   string  `json:"emoji"`
+	Count   int     `json:"count"`
+	UserIDs []int64 `json:"userIds"`
+}
+
+// LobbyReceiverID is the receiver_id used when a broadcast (lobby) message is stored in the Chats table.
+const LobbyReceiverID = 0
+
+// UserRelation represents a block or a mute in the User_Relations table
+type UserRelation struct {
+	UserID         int       `json:"user_id"`
+	TargetID       int       `json:"target_id"`
+	TargetUsername string    `json:"target_username"`
+	Kind           string    `json:"kind"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
+// Kinds of UserRelation. Blocking stops private messages, hides presence and can hide posts;
+// muting only suppresses notifications.
+const (
+	RelationBlock = "block"
+	RelationMute  = "mute"
+)
+
+// Watch represents a post or a category watched by a user, in the Watches table. Watchers are
+// notified of the new comments of a watched post and of the new posts of a watched category.
+type Watch struct {
+	UserID    int       `json:"user_id"`
+	Kind      string    `json:"kind"`
+	TargetID  int       `json:"target_id"` // Post or category ID, depending on Kind
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Kinds of Watch.
+const (
+	WatchPost     = "post"
+	WatchCategory = "category"
+)
+
+// Notification tells a user about a new comment on a post they watch, or a new post in a
+// category they watch, from the Notifications table. ActorUsername and PostTitle are read with it.
+type Notification struct {
+	NotificationID int        `json:"notification_id"`
+	UserID         int        `json:"user_id"`
+	Kind           string     `json:"kind"`
+	ActorID        int        `json:"actor_id"` // Author of the comment or of the post
+	ActorUsername  string     `json:"actor_username"`
+	PostID         int        `json:"post_id"`
+	PostTitle      string     `json:"post_title"`
+	CategoryID     int        `json:"category_id"`
+	CommentID      int        `json:"comment_id,omitempty"` // Set on comment notifications
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+// Kinds of Notification.
+const (
+	NotificationComment = "comment"
+	NotificationPost    = "post"
+)
+
 // OnlineUser represents the Online_Users table in the database
 type OnlineUsers struct {
 	UserID           int       `json:"user_id"`
@@ -70,15 +289,38 @@ type OnlineUsers struct {
 
 // Message struct consolidates WebSocket message structure with necessary user and message info.
 type Message struct {
-	Type           string       `json:"type"`                     // Type of message (e.g., "chat", "notification")
-	SenderID       int64        `json:"senderId,omitempty"`       // For identifying the sender
-	SenderUsername string       `json:"senderUsername,omitempty"` // For displaying to users (filled server-side)
-	ReceiverID     int64        `json:"receiverId,omitempty"`     // For routing the message (client-side may leave blank for broadcasts)
-	Message        string       `json:"message"`                  // The actual message content
-	SentAt         time.Time    `json:"sentAt,omitempty"`         // Timestamp (can be set server-side)
-	OnlineUsers    []UserStatus `json:"onlineUsers,omitempty"`    // List of online users' usernames
+	Type            string            `json:"type"`                      // Type of message (e.g., "chat", "notification")
+	SenderID        int64             `json:"senderId,omitempty"`        // For identifying the sender
+	SenderUsername  string            `json:"senderUsername,omitempty"`  // For displaying to users (filled server-side)
+	ReceiverID      int64             `json:"receiverId,omitempty"`      // For routing the message (client-side may leave blank for broadcasts)
+	Message         string            `json:"message"`                   // The actual message content
+	MessageHTML     string            `json:"messageHtml,omitempty"`     // The content rendered as safe HTML (filled server-side)
+	SentAt          time.Time         `json:"sentAt,omitempty"`          // Timestamp (can be set server-side)
+	OnlineUsers     []UserStatus      `json:"onlineUsers,omitempty"`     // List of online users' usernames
+	MessageID       int64             `json:"messageId,omitempty"`       // Persisted message ID (filled server-side)
+	ClientMessageID string            `json:"clientMessageId,omitempty"` // Client-generated ID so retries can be de-duplicated
+	Status          string            `json:"status,omitempty"`          // Delivery status reported in "ack" frames
+	Seq             int64             `json:"seq,omitempty"`             // Per-user event sequence number, used to resume after a reconnect
+	EditedAt        *time.Time        `json:"editedAt,omitempty"`        // Set on "edit" frames
+	Deleted         bool              `json:"deleted,omitempty"`         // Set on "delete" frames
+	Emoji           string            `json:"emoji,omitempty"`           // Emoji of "addReaction" and "removeReaction" frames
+	Reactions       []ReactionSummary `json:"reactions,omitempty"`       // All reactions of the message, sent in "reaction" frames
+	Muted           bool              `json:"muted,omitempty"`           // The receiver muted the sender, so clients should not notify
+	Post            *PostSummary      `json:"post,omitempty"`            // The post of "newPost", "postEdited", "postDeleted" and "pollResults" frames
+	Poll            *Poll             `json:"poll,omitempty"`            // The results of "pollResults" frames, without the voters
+	Categories      []int             `json:"categories,omitempty"`      // Categories of "subscribe", "unsubscribe" and "subscriptions" frames
+	AllCategories   bool              `json:"allCategories,omitempty"`   // Set on "subscriptions" frames when subscribed to every category
+	AttachmentIDs   []int64           `json:"attachmentIds,omitempty"`   // Uploads of the sender to attach to a "broadcast" or "private" message
+	Attachments     []Attachment      `json:"attachments,omitempty"`     // Files attached to the message (filled server-side)
+	Notification    *Notification     `json:"notification,omitempty"`    // The notification of "notification" frames
 }
 
+// Delivery statuses reported back to the sender in "ack" frames.
+const (
+	MessageStatusStored    = "stored"    // Persisted, but no recipient was connected
+	MessageStatusDelivered = "delivered" // Persisted and written to at least one recipient connection
+)
+
 type UserStatus struct {
 	UserID   int64  `json:"userId"` // UserID to identify the user uniquely
 	Username string `json:"username"`
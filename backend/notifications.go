@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"livechat-system/backend/logging"
+	realtimeforum "livechat-system/backend/models"
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+)
+
+// notificationsResponse is the body of a GET /notifications response.
+type notificationsResponse struct {
+	Notifications []realtimeforum.Notification `json:"notifications"`
+	Unread        int                          `json:"unread"` // Notifications not read yet, listed or not
+}
+
+// bookmarksHandler serves /bookmarks for the authenticated user:
+//
+//	GET                     lists the bookmarked posts, most recently bookmarked first
+//	POST {"post_id": 1}     bookmarks a post
+//	DELETE ?postId=1        removes a bookmark
+func (a *app) bookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		posts, err := a.forumService.GetBookmarkedPosts(userID)
+		if err != nil {
+			writeNotificationError(w, r, err)
+			return
+		}
+		writeJSON(w, posts)
+
+	case http.MethodPost:
+		var request struct {
+			PostID int64 `json:"post_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.PostID == 0 {
+			http.Error(w, "post_id is required", http.StatusBadRequest)
+			return
+		}
+		if err := a.forumService.AddBookmark(userID, request.PostID); err != nil {
+			writeNotificationError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"message": "bookmark added"})
+
+	case http.MethodDelete:
+		postID, err := strconv.ParseInt(r.URL.Query().Get("postId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		if err := a.forumService.RemoveBookmark(userID, postID); err != nil {
+			writeNotificationError(w, r, err)
+			return
+		}
+		writeJSON(w, map[string]string{"message": "bookmark removed"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// watchesHandler serves /watches for the authenticated user, who is notified of the new comments
+// of the posts they watch and of the new posts of the categories they watch:
+//
+//	GET                                     lists the watched posts and categories
+//	POST {"kind": "post", "target_id": 1}   watches a post, or a category with "category"
+//	DELETE ?kind=post&targetId=1            stops watching it
+func (a *app) watchesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		watches, err := a.forumService.ListWatches(userID)
+		if err != nil {
+			writeNotificationError(w, r, err)
+			return
+		}
+		writeJSON(w, watches)
+
+	case http.MethodPost:
+		var request struct {
+			Kind     string `json:"kind"`
+			TargetID int64  `json:"target_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.TargetID == 0 {
+			http.Error(w, "kind and target_id are required", http.StatusBadRequest)
+			return
+		}
+		if err := a.forumService.AddWatch(userID, request.Kind, request.TargetID); err != nil {
+			writeNotificationError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"message": request.Kind + " watched"})
+
+	case http.MethodDelete:
+		params := r.URL.Query()
+		targetID, err := strconv.ParseInt(params.Get("targetId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+		kind := params.Get("kind")
+		if err := a.forumService.RemoveWatch(userID, kind, targetID); err != nil {
+			writeNotificationError(w, r, err)
+			return
+		}
+		writeJSON(w, map[string]string{"message": kind + " unwatched"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// notificationsHandler serves GET /notifications for the authenticated user, most recent first,
+// with the number of notifications not read yet:
+//
+//	GET ?before=40&limit=20   lists the notifications older than 40, 20 at most
+//
+// The same notifications are sent live in "notification" frames over /ws.
+func (a *app) notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := currentUserID(r)
+	params := r.URL.Query()
+	var beforeID int64
+	if before := params.Get("before"); before != "" {
+		id, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || id < 1 {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+		beforeID = id
+	}
+	limit := service.DefaultNotificationLimit
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > service.MaxNotificationLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	notifications, unread, err := a.forumService.GetNotifications(userID, beforeID, limit)
+	if err != nil {
+		writeNotificationError(w, r, err)
+		return
+	}
+	writeJSON(w, notificationsResponse{Notifications: notifications, Unread: unread})
+}
+
+// notificationsReadHandler serves POST /notifications/read for the authenticated user:
+//
+//	POST {"up_to": 42}   marks the notifications up to 42 as read, or all of them without up_to
+func (a *app) notificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := currentUserID(r)
+	var request struct {
+		UpTo int64 `json:"up_to"`
+	}
+	// An empty body marks all of them
+	if err := json.NewDecoder(r.Body).Decode(&request); (err != nil && !errors.Is(err, io.EOF)) || request.UpTo < 0 {
+		http.Error(w, "Invalid up_to", http.StatusBadRequest)
+		return
+	}
+	marked, err := a.forumService.MarkNotificationsRead(userID, request.UpTo)
+	if err != nil {
+		writeNotificationError(w, r, err)
+		return
+	}
+	writeJSON(w, map[string]int64{"marked": marked})
+}
+
+func writeNotificationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Post or category not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrPostDeleted):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, service.ErrInvalidWatchKind):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.FromContext(r.Context()).Error("Failed to serve bookmarks or notifications", "err", err)
+		http.Error(w, "Failed to serve bookmarks or notifications", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"livechat-system/backend/logging"
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+)
+
+// pollHandler serves /poll for the authenticated user, pushing the results to the feed
+// subscribers of wsServer as votes come in:
+//
+//	GET ?postId=1                        returns the poll of the post
+//	POST ?postId=1 {"option_ids": [3]}   votes, once, and returns the poll with the vote counted
+//
+// Polls are created with their post, in the poll of /newpost.
+func (a *app) pollHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	postID, err := strconv.ParseInt(r.URL.Query().Get("postId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		poll, err := a.forumService.GetPoll(userID, postID)
+		if err != nil {
+			writePollError(w, r, err)
+			return
+		}
+		writeJSON(w, poll)
+
+	case http.MethodPost:
+		var ballot struct {
+			OptionIDs []int64 `json:"option_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&ballot); err != nil {
+			http.Error(w, "Invalid vote", http.StatusBadRequest)
+			return
+		}
+		post, poll, err := a.forumService.Vote(userID, postID, ballot.OptionIDs)
+		if err != nil {
+			writePollError(w, r, err)
+			return
+		}
+		a.wsServer.PublishPollResults(post, poll)
+		logging.FromContext(r.Context()).Info("Vote cast", "user_id", userID, "post_id", postID)
+		writeJSON(w, poll)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writePollError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Poll not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrAlreadyVoted), errors.Is(err, storage.ErrPollClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrPostDeleted):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, service.ErrInvalidVote):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.FromContext(r.Context()).Error("Failed to serve poll", "err", err)
+		http.Error(w, "Failed to serve poll", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"livechat-system/backend/logging"
+	realtimeforum "livechat-system/backend/models"
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+)
+
+// postHandler serves /post for the authenticated user, pushing changes to the feed subscribers
+// of wsServer:
+//
+//	GET ?postId=1                   returns the post and its comments
+//	PUT ?postId=1 {"post_title": "", "post_content": "", "category_id": 1}
+//	                                edits the post, keeping the previous version
+//	DELETE ?postId=1                soft-deletes the post
+//
+// Only the author and moderators may edit or delete a post, and only moderators see deleted posts.
+func (a *app) postHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	postID, err := strconv.ParseInt(r.URL.Query().Get("postId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		post, comments, err := a.forumService.GetPost(userID, postID)
+		if err != nil {
+			writePostError(w, r, err)
+			return
+		}
+		if comments == nil {
+			comments = []realtimeforum.Comments{}
+		}
+		writeJSON(w, map[string]interface{}{"post": post, "comments": comments})
+
+	case http.MethodPut:
+		var edit realtimeforum.PostEdit
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxContentBody)).Decode(&edit); err != nil {
+			http.Error(w, "Invalid post", http.StatusBadRequest)
+			return
+		}
+		post, previousCategoryID, err := a.forumService.EditPost(userID, postID, edit)
+		if err != nil {
+			writePostError(w, r, err)
+			return
+		}
+		a.wsServer.PublishPostEdit(post, previousCategoryID)
+		logging.FromContext(r.Context()).Info("Post edited", "user_id", userID, "post_id", postID)
+		writeJSON(w, post)
+
+	case http.MethodDelete:
+		post, err := a.forumService.DeletePost(userID, postID)
+		if err != nil {
+			writePostError(w, r, err)
+			return
+		}
+		a.wsServer.PublishPostDelete(post)
+		logging.FromContext(r.Context()).Info("Post deleted", "user_id", userID, "post_id", postID)
+		writeJSON(w, map[string]string{"message": "post deleted"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// postRevisionsHandler serves GET /post/revisions?postId=1: the post and its previous versions,
+// oldest first, each with the line-by-line diff of its content to the version that replaced it.
+func (a *app) postRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	postID, err := strconv.ParseInt(r.URL.Query().Get("postId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	post, revisions, err := a.forumService.GetPostRevisions(currentUserID(r), postID)
+	if err != nil {
+		writePostError(w, r, err)
+		return
+	}
+	if revisions == nil {
+		revisions = []realtimeforum.PostRevision{}
+	}
+	writeJSON(w, map[string]interface{}{"post": post, "revisions": revisions})
+}
+
+func writePostError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Post not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrNotPostAuthor), errors.Is(err, service.ErrModeratorsOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrPostDeleted):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, service.ErrInvalidPost):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrPostTooLong):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		logging.FromContext(r.Context()).Error("Failed to serve post", "err", err)
+		http.Error(w, "Failed to serve post", http.StatusInternalServerError)
+	}
+}
+
+// moderatorsHandler serves /admin/moderators:
+//
+//	GET                     lists the moderators
+//	POST {"user_id": 2}     makes a user a moderator
+//	DELETE ?userId=2        makes a moderator an ordinary user again
+func (a *app) moderatorsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		moderators, err := a.forumService.GetModerators()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to list moderators", "err", err)
+			http.Error(w, "Failed to list moderators", http.StatusInternalServerError)
+			return
+		}
+		if moderators == nil {
+			moderators = []realtimeforum.UserRole{}
+		}
+		writeJSON(w, moderators)
+
+	case http.MethodPost:
+		var request struct {
+			UserID int64 `json:"user_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+		a.setUserRole(w, r, request.UserID, realtimeforum.RoleModerator)
+
+	case http.MethodDelete:
+		userID, err := strconv.ParseInt(r.URL.Query().Get("userId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		a.setUserRole(w, r, userID, realtimeforum.RoleUser)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *app) setUserRole(w http.ResponseWriter, r *http.Request, userID int64, role string) {
+	err := a.forumService.SetUserRole(userID, role)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Failed to change user role", "user_id", userID, "role", role, "err", err)
+		http.Error(w, "Failed to change user role", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("User role changed", "user_id", userID, "role", role)
+	writeJSON(w, map[string]string{"message": "role changed to " + role})
+}
+
+// writeJSON answers with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "error encoding json", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+func TestPost(t *testing.T) {
+	srv := newTestServer(t, testConfig())
+	alice, bob := register(t, srv, "alice"), register(t, srv, "bob")
+	postID := newPost(t, srv, alice, "First")
+
+	status, body := do(t, srv, bob, http.MethodGet, postPath(postID), nil)
+	if status != http.StatusOK {
+		t.Fatalf("getting the post: %d %s", status, body)
+	}
+	var got struct {
+		Post     realtimeforum.Posts      `json:"post"`
+		Comments []realtimeforum.Comments `json:"comments"`
+	}
+	decode(t, body, &got)
+	if got.Post.Title != "First" || int64(got.Post.UserID) != alice.ID || got.Comments == nil {
+		t.Errorf("post: got %+v with comments %v, want First by alice with no comments", got.Post, got.Comments)
+	}
+	if status, _ := do(t, srv, bob, http.MethodGet, "/post?postId=x", nil); status != http.StatusBadRequest {
+		t.Errorf("getting an invalid post ID: got %d, want %d", status, http.StatusBadRequest)
+	}
+	if status, _ := do(t, srv, bob, http.MethodGet, postPath(postID+100), nil); status != http.StatusNotFound {
+		t.Errorf("getting an unknown post: got %d, want %d", status, http.StatusNotFound)
+	}
+
+	// Only the author edits and deletes
+	edit := realtimeforum.PostEdit{Title: "Second", Content: "Edited content", CategoryID: 2}
+	if status, _ := do(t, srv, bob, http.MethodPut, postPath(postID), edit); status != http.StatusForbidden {
+		t.Errorf("editing the post of alice as bob: got %d, want %d", status, http.StatusForbidden)
+	}
+	status, body = do(t, srv, alice, http.MethodPut, postPath(postID), edit)
+	if status != http.StatusOK {
+		t.Fatalf("editing the post: %d %s", status, body)
+	}
+	var edited realtimeforum.Posts
+	decode(t, body, &edited)
+	if edited.Title != "Second" || edited.CategoryID != 2 || edited.EditedAt == nil {
+		t.Errorf("edited post: got %+v, want Second in category 2 with an edit time", edited)
+	}
+	if status, _ := do(t, srv, alice, http.MethodPut, postPath(postID), realtimeforum.PostEdit{CategoryID: 2}); status != http.StatusBadRequest {
+		t.Errorf("editing the post to an empty one: got %d, want %d", status, http.StatusBadRequest)
+	}
+	long := realtimeforum.PostEdit{Title: "Long", Content: strings.Repeat("a", 50001), CategoryID: 1}
+	if status, _ := do(t, srv, alice, http.MethodPut, postPath(postID), long); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("editing the post to a too long one: got %d, want %d", status, http.StatusRequestEntityTooLarge)
+	}
+	huge := realtimeforum.Posts{Title: "Huge", Content: strings.Repeat("a", maxContentBody), CategoryID: 1}
+	if status, _ := do(t, srv, alice, http.MethodPost, "/newpost", huge); status != http.StatusBadRequest {
+		t.Errorf("creating a post larger than the body limit: got %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if status, _ := do(t, srv, bob, http.MethodDelete, postPath(postID), nil); status != http.StatusForbidden {
+		t.Errorf("deleting the post of alice as bob: got %d, want %d", status, http.StatusForbidden)
+	}
+	if status, body := do(t, srv, alice, http.MethodDelete, postPath(postID), nil); status != http.StatusOK {
+		t.Fatalf("deleting the post: %d %s", status, body)
+	}
+	// Deleted posts are only shown to moderators
+	if status, _ := do(t, srv, alice, http.MethodGet, postPath(postID), nil); status != http.StatusNotFound {
+		t.Errorf("getting the deleted post: got %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,148 @@
+// Package quote renders comments that quote other comments or posts. A quote is a reference at
+// the start of a line:
+//
+//	>>comment:12 I disagree with this
+//	>>post:45
+//
+// Render turns the text into HTML that is safe to insert in a page: the text is rendered as
+// Markdown, and each reference becomes a blockquote with the author and an excerpt of what it
+// points to, looked up by the caller.
+package quote
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"livechat-system/backend/markdown"
+)
+
+// Kinds of things a quote can point to.
+const (
+	KindComment = "comment"
+	KindPost    = "post"
+)
+
+// ExcerptLength is the number of characters of the quoted text shown in a quote.
+const ExcerptLength = 200
+
+// maxRefs bounds the number of references looked up in one text. Later references are left as
+// plain text.
+const maxRefs = 10
+
+var refPattern = regexp.MustCompile(`(?m)^[ \t]*>>(comment|post):([0-9]{1,18})\b`)
+
+// Ref is a reference to a comment or a post.
+type Ref struct {
+	Kind string // KindComment or KindPost
+	ID   int64
+}
+
+// String returns the reference the way it is written.
+func (r Ref) String() string {
+	return ">>" + r.Kind + ":" + strconv.FormatInt(r.ID, 10)
+}
+
+// Quoted is what a reference points to.
+type Quoted struct {
+	Author string
+	Title  string // Title of a quoted post; empty for comments
+	Text   string
+}
+
+// Resolver looks up what a reference points to. It reports false when the comment or post does
+// not exist or the reader may not see it.
+type Resolver func(ref Ref) (Quoted, bool)
+
+// Refs returns the references in text, in order and without repeats.
+func Refs(text string) []Ref {
+	var refs []Ref
+	seen := map[Ref]bool{}
+	for _, match := range refPattern.FindAllStringSubmatch(text, -1) {
+		ref, ok := parseRef(match)
+		if !ok || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+		if len(refs) == maxRefs {
+			break
+		}
+	}
+	return refs
+}
+
+func parseRef(match []string) (Ref, bool) {
+	id, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil || id <= 0 {
+		return Ref{}, false
+	}
+	return Ref{Kind: match[1], ID: id}, true
+}
+
+// Render returns text as HTML: rendered as Markdown, with each reference among the first few
+// replaced by the quote resolve finds for it. References resolve cannot find are kept as text,
+// marked as missing.
+func Render(text string, resolve Resolver) string {
+	allowed := map[Ref]bool{}
+	for _, ref := range Refs(text) {
+		allowed[ref] = true
+	}
+	if len(allowed) == 0 {
+		return markdown.Render(text)
+	}
+	resolved := map[Ref]string{}
+
+	return markdown.RenderWith(text, markdown.Options{
+		Embed: func(line string) (string, string, bool) {
+			loc := refPattern.FindStringSubmatchIndex(line)
+			if loc == nil {
+				return "", "", false
+			}
+			ref, ok := parseRef([]string{line[loc[0]:loc[1]], line[loc[2]:loc[3]], line[loc[4]:loc[5]]})
+			if !ok || !allowed[ref] {
+				return "", "", false
+			}
+			quoteHTML, done := resolved[ref]
+			if !done {
+				quoteHTML = renderRef(ref, resolve)
+				resolved[ref] = quoteHTML
+			}
+			return quoteHTML, line[loc[1]:], true
+		},
+	})
+}
+
+func renderRef(ref Ref, resolve Resolver) string {
+	quoted, ok := resolve(ref)
+	if !ok {
+		return `<span class="quote-missing">` + html.EscapeString(ref.String()) + `</span>`
+	}
+	var b strings.Builder
+	b.WriteString(`<blockquote class="quote" data-` + ref.Kind + `-id="` + strconv.FormatInt(ref.ID, 10) + `">`)
+	b.WriteString(`<cite>` + html.EscapeString(quoted.Author) + `</cite>`)
+	if quoted.Title != "" {
+		b.WriteString(` <strong>` + html.EscapeString(quoted.Title) + `</strong>`)
+	}
+	// Quotes are not nested: the references of the quoted text are left out of the excerpt
+	text := strings.Join(strings.Fields(refPattern.ReplaceAllString(quoted.Text, "")), " ")
+	b.WriteString(` <span class="quote-text">` + html.EscapeString(Excerpt(text, ExcerptLength)) + `</span>`)
+	b.WriteString(`</blockquote>`)
+	return b.String()
+}
+
+// Excerpt returns the first limit characters of text, cut before the last word that does not
+// fit entirely and followed by an ellipsis when anything was left out.
+func Excerpt(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	cut := string([]rune(text)[:limit])
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \t\n.,;:") + "…"
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc returns the key a request is limited by, typically "user:<id>" or "ip:<address>".
+type KeyFunc func(r *http.Request) string
+
+// ClientIP returns the IP address of the client that sent the request.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// IPKey limits requests by client IP address.
+func IPKey(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds, as used by the Retry-After header.
+func RetryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// Middleware limits the requests of a route with the policy registered for route in the group.
+// Rejected requests get 429 Too Many Requests with a Retry-After header. Once a key is a repeat
+// offender its connection is also closed after the response.
+func (g *Group) Middleware(route string, key KeyFunc, offenders *Offenders, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Preflight requests are answered by the CORS middleware and cost nothing
+		if r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		k := key(r)
+		allowed, wait := g.Allow(route, k)
+		if allowed {
+			next(w, r)
+			return
+		}
+
+		if offenders != nil && offenders.Strike(k) {
+			w.Header().Set("Connection", "close")
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(wait)))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,189 @@
+// Package ratelimit implements token-bucket rate limiting for HTTP routes and WebSocket messages.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Policy describes a token bucket: it holds at most Burst tokens and refills at Rate tokens per second.
+// Every allowed request takes one token.
+type Policy struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// PerMinute returns a policy allowing n requests per minute, with bursts of up to n.
+func PerMinute(n int) Policy {
+	return Policy{Rate: float64(n) / 60, Burst: n}
+}
+
+// PerSecond returns a policy allowing n requests per second, with bursts of up to burst.
+func PerSecond(n float64, burst int) Policy {
+	return Policy{Rate: n, Burst: burst}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter applies one Policy independently to every key (a user ID, an IP address...).
+type Limiter struct {
+	policy  Policy
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// NewLimiter creates a limiter that applies policy to each key.
+func NewLimiter(policy Policy) *Limiter {
+	return &Limiter{
+		policy:  policy,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the key's bucket. If the bucket is empty it returns false
+// and how long to wait until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.policy.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request, up to the burst size
+	b.tokens = math.Min(float64(l.policy.Burst), b.tokens+now.Sub(b.last).Seconds()*l.policy.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.policy.Rate <= 0 {
+		return false, time.Hour
+	}
+	wait := time.Duration((1 - b.tokens) / l.policy.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Prune forgets keys that have not been seen for longer than idle. Their buckets would be full by
+// now anyway, so forgetting them does not change any decision.
+func (l *Limiter) Prune(idle time.Duration) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	pruned := 0
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// DefaultName is the name of the policy used by a Group for names without their own policy.
+const DefaultName = "default"
+
+// Group holds one limiter per name, such as an HTTP route or a WebSocket message type.
+// Names without their own policy share the DefaultName policy.
+type Group struct {
+	limiters map[string]*Limiter
+}
+
+// NewGroup creates a limiter for every policy. policies should contain a DefaultName entry;
+// without one, names that have no policy are not limited.
+func NewGroup(policies map[string]Policy) *Group {
+	g := &Group{limiters: make(map[string]*Limiter, len(policies))}
+	for name, policy := range policies {
+		g.limiters[name] = NewLimiter(policy)
+	}
+	return g
+}
+
+// Allow applies the policy of name to key.
+func (g *Group) Allow(name, key string) (bool, time.Duration) {
+	limiter, ok := g.limiters[name]
+	if !ok {
+		limiter, ok = g.limiters[DefaultName]
+		if !ok {
+			return true, 0
+		}
+		name = DefaultName
+	}
+	return limiter.Allow(name + "|" + key)
+}
+
+// Prune forgets idle keys in every limiter of the group.
+func (g *Group) Prune(idle time.Duration) int {
+	pruned := 0
+	for _, limiter := range g.limiters {
+		pruned += limiter.Prune(idle)
+	}
+	return pruned
+}
+
+// Offenders counts rate limit violations per key, so clients that keep hitting the limit can be cut off.
+type Offenders struct {
+	Threshold int           // Violations within Window after which a key is an offender
+	Window    time.Duration // Period over which violations are counted
+
+	mu      sync.Mutex
+	strikes map[string]*strikes
+	now     func() time.Time
+}
+
+type strikes struct {
+	count int
+	since time.Time
+}
+
+// NewOffenders creates a tracker that flags keys with threshold violations within window.
+func NewOffenders(threshold int, window time.Duration) *Offenders {
+	return &Offenders{
+		Threshold: threshold,
+		Window:    window,
+		strikes:   make(map[string]*strikes),
+		now:       time.Now,
+	}
+}
+
+// Strike records a violation by key and reports whether key is now a repeat offender.
+func (o *Offenders) Strike(key string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := o.now()
+	s, ok := o.strikes[key]
+	if !ok || now.Sub(s.since) > o.Window {
+		s = &strikes{since: now}
+		o.strikes[key] = s
+	}
+	s.count++
+	return s.count >= o.Threshold
+}
+
+// Prune forgets violations older than the window.
+func (o *Offenders) Prune() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := o.now()
+	pruned := 0
+	for key, s := range o.strikes {
+		if now.Sub(s.since) > o.Window {
+			delete(o.strikes, key)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// clock is a time that only moves when told to.
+type clock struct {
+	t time.Time
+}
+
+func newClock() *clock { return &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)} }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// withClock makes every limiter of g read its time from c.
+func (g *Group) withClock(c *clock) *Group {
+	for _, limiter := range g.limiters {
+		limiter.now = c.now
+	}
+	return g
+}
+
+// allowN reports how many of n requests by key are allowed.
+func allowN(l *Limiter, key string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := l.Allow(key); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestBurst(t *testing.T) {
+	l := NewLimiter(PerSecond(1, 5))
+	l.now = newClock().now
+
+	if got := allowN(l, "a", 10); got != 5 {
+		t.Errorf("requests allowed at once: got %d, want the burst of 5", got)
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != time.Second {
+		t.Errorf("request past the burst: got %v, wait %v, want refused, wait 1s", ok, wait)
+	}
+}
+
+func TestRefill(t *testing.T) {
+	c := newClock()
+	l := NewLimiter(PerSecond(2, 4))
+	l.now = c.now
+	allowN(l, "a", 4)
+
+	// Tokens come back at the rate, in fractions
+	c.advance(250 * time.Millisecond)
+	if ok, wait := l.Allow("a"); ok || wait != 250*time.Millisecond {
+		t.Errorf("after half a token: got %v, wait %v, want refused, wait 250ms", ok, wait)
+	}
+	c.advance(250 * time.Millisecond)
+	if got := allowN(l, "a", 2); got != 1 {
+		t.Errorf("after one token: got %d requests allowed, want 1", got)
+	}
+
+	// Refills stop at the burst
+	c.advance(time.Hour)
+	if got := allowN(l, "a", 10); got != 4 {
+		t.Errorf("after an hour: got %d requests allowed, want the burst of 4", got)
+	}
+}
+
+func TestZeroRate(t *testing.T) {
+	c := newClock()
+	l := NewLimiter(Policy{Rate: 0, Burst: 1})
+	l.now = c.now
+	allowN(l, "a", 1)
+	c.advance(time.Hour)
+	if ok, wait := l.Allow("a"); ok || wait != time.Hour {
+		t.Errorf("without refills: got %v, wait %v, want refused, wait 1h", ok, wait)
+	}
+}
+
+func TestKeysAreIsolated(t *testing.T) {
+	l := NewLimiter(PerSecond(1, 2))
+	l.now = newClock().now
+	allowN(l, "a", 2)
+	if got := allowN(l, "b", 3); got != 2 {
+		t.Errorf("requests of b once a is limited: got %d allowed, want 2", got)
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Errorf("request of a past its burst: allowed")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	c := newClock()
+	g := NewGroup(map[string]Policy{"broadcast": PerSecond(1, 1), DefaultName: PerSecond(1, 2)}).withClock(c)
+
+	if ok, _ := g.Allow("broadcast", "user:1"); !ok {
+		t.Fatal("first broadcast: refused")
+	}
+	if ok, _ := g.Allow("broadcast", "user:1"); ok {
+		t.Error("second broadcast: allowed past a burst of 1")
+	}
+	if ok, _ := g.Allow("broadcast", "user:2"); !ok {
+		t.Error("broadcast of another user: refused")
+	}
+
+	// Names without a policy share the default one, apart from the named policies
+	for i, name := range []string{"private", "edit"} {
+		if ok, _ := g.Allow(name, "user:1"); !ok {
+			t.Errorf("frame %d without its own policy: refused", i+1)
+		}
+	}
+	if ok, _ := g.Allow("delete", "user:1"); ok {
+		t.Error("third frame without its own policy: allowed past the default burst of 2")
+	}
+
+	// Without a default policy, other names are not limited
+	g = NewGroup(map[string]Policy{"broadcast": PerSecond(1, 1)}).withClock(c)
+	for i := 0; i < 10; i++ {
+		if ok, _ := g.Allow("private", "user:1"); !ok {
+			t.Fatalf("frame %d without any policy: refused", i+1)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	c := newClock()
+	g := NewGroup(map[string]Policy{"broadcast": PerSecond(1, 1), DefaultName: PerSecond(1, 1)}).withClock(c)
+	g.Allow("broadcast", "user:1")
+	g.Allow("private", "user:1")
+	c.advance(time.Minute)
+	g.Allow("broadcast", "user:2")
+
+	if pruned := g.Prune(30 * time.Second); pruned != 2 {
+		t.Errorf("pruning keys idle for 30s: got %d pruned, want 2", pruned)
+	}
+	if pruned := g.Prune(30 * time.Second); pruned != 0 {
+		t.Errorf("pruning again: got %d pruned, want 0", pruned)
+	}
+	// The key still in use keeps its empty bucket
+	if ok, _ := g.Allow("broadcast", "user:2"); ok {
+		t.Error("request of the key that was kept: allowed past its burst")
+	}
+	// A pruned key starts again from a full bucket, as it would have refilled anyway
+	if ok, _ := g.Allow("broadcast", "user:1"); !ok {
+		t.Error("request of a pruned key: refused")
+	}
+}
+
+func TestOffenders(t *testing.T) {
+	c := newClock()
+	o := NewOffenders(3, time.Minute)
+	o.now = c.now
+
+	for i := 1; i <= 3; i++ {
+		if offender := o.Strike("a"); offender != (i == 3) {
+			t.Errorf("strike %d: got offender %v", i, offender)
+		}
+	}
+	if o.Strike("b") {
+		t.Error("first strike of another key: offender")
+	}
+
+	// Strikes older than the window are forgotten
+	c.advance(2 * time.Minute)
+	if o.Strike("a") {
+		t.Error("strike after the window: offender")
+	}
+	c.advance(2 * time.Minute)
+	if pruned := o.Prune(); pruned != 2 {
+		t.Errorf("pruning strikes older than the window: got %d pruned, want 2", pruned)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	g := NewGroup(map[string]Policy{"/login": PerSecond(0.5, 1)}).withClock(newClock())
+	offenders := NewOffenders(2, time.Minute)
+	handler := g.Middleware("/login", IPKey, offenders, func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(method string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/login", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := request(http.MethodPost); w.Code != http.StatusOK {
+		t.Fatalf("first request: got %d", w.Code)
+	}
+	if w := request(http.MethodOptions); w.Code != http.StatusOK {
+		t.Errorf("preflight request: got %d, want it never limited", w.Code)
+	}
+	w := request(http.MethodPost)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" || w.Header().Get("Connection") != "" {
+		t.Errorf("second request: got %d, Retry-After %q, Connection %q, want 429 after 2s",
+			w.Code, w.Header().Get("Retry-After"), w.Header().Get("Connection"))
+	}
+	if w := request(http.MethodPost); w.Code != http.StatusTooManyRequests || w.Header().Get("Connection") != "close" {
+		t.Errorf("request of a repeat offender: got %d, Connection %q, want 429 and the connection closed",
+			w.Code, w.Header().Get("Connection"))
+	}
+}
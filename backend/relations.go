@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"livechat-system/backend/logging"
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+)
+
+// userRelationsHandler serves /blocks and /mutes for the authenticated user:
+//
+//	GET                     lists the blocked or muted users
+//	POST {"user_id": 2}     blocks or mutes a user
+//	DELETE ?userId=2        unblocks or unmutes a user
+func (a *app) userRelationsHandler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := currentUserID(r)
+
+		switch r.Method {
+		case http.MethodGet:
+			relations, err := a.forumService.ListUserRelations(userID, kind)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Failed to list user relations", "kind", kind, "user_id", userID, "err", err)
+				http.Error(w, "Failed to list users", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(relations); err != nil {
+				http.Error(w, "error encoding json", http.StatusInternalServerError)
+			}
+
+		case http.MethodPost:
+			var request struct {
+				UserID int64 `json:"user_id"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+				http.Error(w, "user_id is required", http.StatusBadRequest)
+				return
+			}
+			if err := a.forumService.AddUserRelation(userID, request.UserID, kind); err != nil {
+				writeRelationError(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"message": kind + " added"})
+
+		case http.MethodDelete:
+			targetID, err := strconv.ParseInt(r.URL.Query().Get("userId"), 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			if err := a.forumService.RemoveUserRelation(userID, targetID, kind); err != nil {
+				writeRelationError(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": kind + " removed"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeRelationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrRelationToSelf), errors.Is(err, service.ErrInvalidRelationKind):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.FromContext(r.Context()).Error("Failed to update user relation", "err", err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+func TestBlocks(t *testing.T) {
+	srv := newTestServer(t, testConfig())
+	alice, bob := register(t, srv, "alice"), register(t, srv, "bob")
+
+	blocked := func() []realtimeforum.UserRelation {
+		t.Helper()
+		status, body := do(t, srv, alice, http.MethodGet, "/blocks", nil)
+		if status != http.StatusOK {
+			t.Fatalf("listing blocks: %d %s", status, body)
+		}
+		var relations []realtimeforum.UserRelation
+		decode(t, body, &relations)
+		return relations
+	}
+
+	if status, body := do(t, srv, alice, http.MethodPost, "/blocks", map[string]int64{"user_id": bob.ID}); status != http.StatusCreated {
+		t.Fatalf("blocking bob: %d %s", status, body)
+	}
+	if relations := blocked(); len(relations) != 1 || int64(relations[0].TargetID) != bob.ID ||
+		relations[0].TargetUsername != "bob" || relations[0].Kind != realtimeforum.RelationBlock {
+		t.Errorf("blocks: got %+v, want bob", relations)
+	}
+
+	for _, tc := range []struct {
+		what   string
+		body   interface{}
+		status int
+	}{
+		{"without a user", map[string]int64{}, http.StatusBadRequest},
+		{"oneself", map[string]int64{"user_id": alice.ID}, http.StatusBadRequest},
+		{"an unknown user", map[string]int64{"user_id": bob.ID + 100}, http.StatusNotFound},
+	} {
+		if status, body := do(t, srv, alice, http.MethodPost, "/blocks", tc.body); status != tc.status {
+			t.Errorf("blocking %s: got %d %s, want %d", tc.what, status, body, tc.status)
+		}
+	}
+
+	// Blocks are separate from mutes, and only the user's own
+	if status, body := do(t, srv, alice, http.MethodGet, "/mutes", nil); status != http.StatusOK || string(body) != "[]\n" {
+		t.Errorf("mutes: got %d %s, want none", status, body)
+	}
+	if status, body := do(t, srv, bob, http.MethodGet, "/blocks", nil); status != http.StatusOK || string(body) != "[]\n" {
+		t.Errorf("blocks of bob: got %d %s, want none", status, body)
+	}
+
+	if status, body := do(t, srv, alice, http.MethodDelete, "/blocks?userId="+strconv.FormatInt(bob.ID, 10), nil); status != http.StatusOK {
+		t.Fatalf("unblocking bob: %d %s", status, body)
+	}
+	if relations := blocked(); len(relations) != 0 {
+		t.Errorf("blocks after unblocking bob: got %+v, want none", relations)
+	}
+	if status, _ := do(t, srv, alice, http.MethodDelete, "/blocks?userId=x", nil); status != http.StatusBadRequest {
+		t.Errorf("unblocking an invalid user ID: got %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,206 @@
+// Package scheduler runs named maintenance jobs in the background at fixed intervals.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job is a task run every Interval. A random delay of up to Jitter is added before each run so
+// jobs started together, or on several servers, do not all hit the database at the same moment.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Jitter   time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// JobStatus describes the runs of a job so far.
+type JobStatus struct {
+	Name          string        `json:"name"`
+	Interval      time.Duration `json:"interval"`
+	Running       bool          `json:"running"`
+	Runs          int64         `json:"runs"`
+	Failures      int64         `json:"failures"` // Runs that returned an error or panicked
+	Panics        int64         `json:"panics"`
+	TotalDuration time.Duration `json:"totalDuration"`
+	LastRun       *time.Time    `json:"lastRun,omitempty"`
+	LastDuration  time.Duration `json:"lastDuration"`
+	LastError     string        `json:"lastError,omitempty"`
+	NextRun       *time.Time    `json:"nextRun,omitempty"`
+}
+
+// MarshalJSON writes durations as strings such as "1m30s" rather than nanoseconds.
+func (js JobStatus) MarshalJSON() ([]byte, error) {
+	type plain JobStatus
+	return json.Marshal(struct {
+		plain
+		Interval      string `json:"interval"`
+		TotalDuration string `json:"totalDuration"`
+		LastDuration  string `json:"lastDuration"`
+	}{
+		plain:         plain(js),
+		Interval:      js.Interval.String(),
+		TotalDuration: js.TotalDuration.String(),
+		LastDuration:  js.LastDuration.String(),
+	})
+}
+
+// Errors returned when registering a job.
+var (
+	ErrDuplicateJob = errors.New("a job with this name is already registered")
+	ErrInvalidJob   = errors.New("a job needs a name, a positive interval and a Run function")
+	ErrStarted      = errors.New("jobs cannot be registered after Start")
+)
+
+type entry struct {
+	job    Job
+	status JobStatus
+}
+
+// Scheduler runs registered jobs until its context is cancelled.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	started bool
+	wg      sync.WaitGroup
+}
+
+// New creates an empty scheduler.
+func New() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*entry)}
+}
+
+// Register adds a job. All jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Interval <= 0 || job.Run == nil || job.Jitter < 0 {
+		return ErrInvalidJob
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return ErrStarted
+	}
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, job.Name)
+	}
+	s.jobs[job.Name] = &entry{job: job, status: JobStatus{Name: job.Name, Interval: job.Interval}}
+	return nil
+}
+
+// Start runs every job in its own goroutine until ctx is cancelled. Use Wait to block until
+// the jobs have stopped; a run in progress is given ctx so it can stop early.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+	for _, e := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, e)
+	}
+}
+
+// Wait blocks until every job has stopped after the context given to Start was cancelled.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	defer s.wg.Done()
+	for {
+		delay := e.job.Interval
+		if e.job.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(e.job.Jitter)))
+		}
+		next := time.Now().Add(delay)
+		s.mu.Lock()
+		e.status.NextRun = &next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.run(ctx, e)
+		}
+	}
+}
+
+// run executes the job once and records the outcome. A panic is recovered and counted
+// as a failure, so a broken job cannot take the server down.
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+	s.mu.Lock()
+	e.status.Running = true
+	e.status.NextRun = nil
+	s.mu.Unlock()
+
+	start := time.Now()
+	panicked, err := runSafely(ctx, e.job)
+	duration := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.status.Running = false
+	e.status.Runs++
+	e.status.TotalDuration += duration
+	e.status.LastRun = &start
+	e.status.LastDuration = duration
+	e.status.LastError = ""
+	if panicked {
+		e.status.Panics++
+	}
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		slog.Error("Job failed", "job", e.job.Name, "duration", duration, "err", err)
+	}
+}
+
+func runSafely(ctx context.Context, job Job) (panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Recovered from panic in job", "job", job.Name, "panic", r, "stack", string(debug.Stack()))
+			panicked, err = true, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return false, job.Run(ctx)
+}
+
+// Status returns the status of every job, sorted by name.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		statuses = append(statuses, e.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Handler serves the status of every job as JSON.
+func (s *Scheduler) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Status()); err != nil {
+			http.Error(w, "error encoding json", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// timeout bounds how long a test waits for jobs that run every few milliseconds.
+const timeout = 5 * time.Second
+
+// start starts s until the test ends, and returns the function stopping it.
+func start(t *testing.T, s *Scheduler) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			s.Wait()
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// status returns the status of the job named name.
+func status(s *Scheduler, name string) JobStatus {
+	for _, js := range s.Status() {
+		if js.Name == name {
+			return js
+		}
+	}
+	return JobStatus{}
+}
+
+func TestRegister(t *testing.T) {
+	s := New()
+	run := func(context.Context) error { return nil }
+	for _, tc := range []struct {
+		name string
+		job  Job
+		want error
+	}{
+		{"valid", Job{Name: "a", Interval: time.Minute, Run: run}, nil},
+		{"duplicate", Job{Name: "a", Interval: time.Minute, Run: run}, ErrDuplicateJob},
+		{"without a name", Job{Interval: time.Minute, Run: run}, ErrInvalidJob},
+		{"without an interval", Job{Name: "b", Run: run}, ErrInvalidJob},
+		{"with a negative jitter", Job{Name: "b", Interval: time.Minute, Jitter: -time.Second, Run: run}, ErrInvalidJob},
+		{"without Run", Job{Name: "b", Interval: time.Minute}, ErrInvalidJob},
+	} {
+		if err := s.Register(tc.job); !errors.Is(err, tc.want) {
+			t.Errorf("registering a job %s: got error %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	start(t, s)
+	if err := s.Register(Job{Name: "late", Interval: time.Minute, Run: run}); !errors.Is(err, ErrStarted) {
+		t.Errorf("registering a job after Start: got error %v, want %v", err, ErrStarted)
+	}
+}
+
+// TestInterval checks that a job runs repeatedly, an interval apart, and that its runs and
+// failures are reported.
+func TestInterval(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	runs := make(chan time.Time, 100)
+	s := New()
+	s.Register(Job{Name: "tick", Interval: interval, Run: func(context.Context) error {
+		runs <- time.Now()
+		return errors.New("tick failed")
+	}})
+	started := time.Now()
+	stop := start(t, s)
+
+	previous := started
+	for i := 0; i < 3; i++ {
+		select {
+		case at := <-runs:
+			if gap := at.Sub(previous); gap < interval {
+				t.Errorf("run %d: %v after the previous one, want at least %v", i+1, gap, interval)
+			}
+			previous = at
+		case <-time.After(timeout):
+			t.Fatalf("run %d: the job did not run within %v", i+1, timeout)
+		}
+	}
+	stop()
+
+	js := status(s, "tick")
+	if js.Runs < 3 || js.Failures != js.Runs || js.LastError != "tick failed" || js.LastRun == nil {
+		t.Errorf("status after 3 runs: got %+v, want every run counted as failed", js)
+	}
+}
+
+// TestNoOverlap checks that a run taking longer than the interval delays the next run instead
+// of overlapping with it.
+func TestNoOverlap(t *testing.T) {
+	const interval, duration = 5 * time.Millisecond, 30 * time.Millisecond
+	var running, overlaps int32
+	done := make(chan struct{})
+	var runs int32
+	s := New()
+	s.Register(Job{Name: "slow", Interval: interval, Run: func(context.Context) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(duration)
+		atomic.AddInt32(&running, -1)
+		if atomic.AddInt32(&runs, 1) == 3 {
+			close(done)
+		}
+		return nil
+	}})
+	start(t, s)
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("the job did not run 3 times within %v", timeout)
+	}
+	if n := atomic.LoadInt32(&overlaps); n > 0 {
+		t.Errorf("%d runs started while another was still running", n)
+	}
+}
+
+// TestStop checks that cancelling the context cancels the run in progress, and that Wait returns
+// once every job has stopped, after which none runs again.
+func TestStop(t *testing.T) {
+	var runs int32
+	running := make(chan struct{}, 1)
+	s := New()
+	s.Register(Job{Name: "blocking", Interval: time.Millisecond, Run: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		select {
+		case running <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	s.Register(Job{Name: "idle", Interval: time.Hour, Run: func(context.Context) error { return nil }})
+	stop := start(t, s)
+
+	select {
+	case <-running:
+	case <-time.After(timeout):
+		t.Fatalf("the job did not run within %v", timeout)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		t.Fatalf("Wait did not return within %v of the context being cancelled", timeout)
+	}
+
+	after := atomic.LoadInt32(&runs)
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != after {
+		t.Errorf("the job ran %d more times after stopping", n-after)
+	}
+	if js := status(s, "blocking"); js.Running || js.LastError != context.Canceled.Error() {
+		t.Errorf("status after stopping: got %+v, want the cancelled run recorded", js)
+	}
+}
+
+// TestPanic checks that a panicking job is counted as failed and keeps being run.
+func TestPanic(t *testing.T) {
+	var runs int32
+	done := make(chan struct{})
+	s := New()
+	s.Register(Job{Name: "panicking", Interval: time.Millisecond, Run: func(context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 2 {
+			close(done)
+		}
+		panic("broken job")
+	}})
+	stop := start(t, s)
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("the job did not run again after panicking within %v", timeout)
+	}
+	stop()
+	if js := status(s, "panicking"); js.Panics < 1 || js.Failures != js.Panics || js.LastError != "panic: broken job" {
+		t.Errorf("status after panics: got %+v, want each panic counted as a failure", js)
+	}
+}
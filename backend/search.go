@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"livechat-system/backend/logging"
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/search"
+)
+
+// Limits of the pages of /search. Deep pages cost as much as all the pages before them, so
+// there is a last one.
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 50
+	maxSearchResults      = 1000
+)
+
+// searchResponse is the body of a /search response.
+type searchResponse struct {
+	Results []realtimeforum.SearchResult `json:"results"`
+	Page    int                          `json:"page"`
+	HasMore bool                         `json:"hasMore"`
+}
+
+// searchHandler serves GET /search?q=...&page=1&limit=20 for the authenticated user. The syntax
+// of q is described in the search package; chat messages are limited to the user's own.
+func (a *app) searchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := currentUserID(r)
+
+	params := r.URL.Query()
+	page, pageSize := 1, defaultSearchPageSize
+	if value := params.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+		page = n
+	}
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSearchPageSize {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxSearchPageSize), http.StatusBadRequest)
+			return
+		}
+		pageSize = n
+	}
+	if page*pageSize > maxSearchResults {
+		http.Error(w, "Only the first "+strconv.Itoa(maxSearchResults)+" results can be listed", http.StatusBadRequest)
+		return
+	}
+
+	results, hasMore, err := a.forumService.Search(userID, params.Get("q"), page, pageSize)
+	switch {
+	case errors.Is(err, search.ErrEmptyQuery), errors.Is(err, search.ErrTooManyTerms), errors.Is(err, search.ErrInvalidFilter):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Failed to search", "user_id", userID, "err", err)
+		http.Error(w, "Failed to search", http.StatusInternalServerError)
+		return
+	}
+	if page*pageSize >= maxSearchResults {
+		hasMore = false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(searchResponse{Results: results, Page: page, HasMore: hasMore}); err != nil {
+		http.Error(w, "error encoding json", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,261 @@
+package search
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// Markers around the matches in a raw snippet, turned into <mark> elements by Highlight. They
+// are control characters, which people rarely write; cutSnippet and Markers.Highlight remove
+// them from the text of documents so they are never mistaken for a match.
+const (
+	MarkStart = "\x02"
+	MarkEnd   = "\x03"
+	Ellipsis  = "…"
+)
+
+// TitleWeight is how much more a match in the title of a post counts than one in its content.
+const TitleWeight = 10
+
+// SnippetWords is the number of words in a snippet.
+const SnippetWords = 16
+
+// snippetLead is how many words a snippet shows before the first match, when it can.
+const snippetLead = 3
+
+// Constants of the BM25 ranking function, with the usual values. Documents are assumed to be
+// averageWords long, which is enough to prefer short documents without collection statistics.
+const (
+	bm25K1       = 1.2
+	bm25B        = 0.75
+	averageWords = 64
+)
+
+// Field is a piece of text of a document, such as the title of a post. A match in a field with
+// a higher Weight counts for more.
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+// token is a word of a text, lowercased, and where it is in the text.
+type token struct {
+	word       string
+	start, end int // Byte offsets in the text
+}
+
+// tokenize splits text into words made of letters and digits, like the unicode61 tokenizer
+// of SQLite's full-text index.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			tokens = append(tokens, token{word: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{word: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// matchesAt reports whether the term occurs in tokens starting at i.
+func (t Term) matchesAt(tokens []token, i int) bool {
+	if i+len(t.Words) > len(tokens) {
+		return false
+	}
+	last := len(t.Words) - 1
+	for k, word := range t.Words[:last] {
+		if tokens[i+k].word != word {
+			return false
+		}
+	}
+	if t.Prefix {
+		return strings.HasPrefix(tokens[i+last].word, t.Words[last])
+	}
+	return tokens[i+last].word == t.Words[last]
+}
+
+// Evaluate reports whether a document made of fields contains every term of the query, in any
+// of its fields, and if so its score, higher for better matches, and a snippet of the field with
+// the most matches, as HTML with the matches highlighted. Filters are not checked.
+func (q Query) Evaluate(fields ...Field) (score float64, snippet string, ok bool) {
+	tokens := make([][]token, len(fields))
+	matched := make([][]bool, len(fields)) // Tokens that are part of a match, per field
+	hits := make([]int, len(fields))
+	for f, field := range fields {
+		tokens[f] = tokenize(field.Text)
+		matched[f] = make([]bool, len(tokens[f]))
+	}
+
+	for _, term := range q.Terms {
+		found := false
+		for f, field := range fields {
+			occurrences := 0
+			for i := range tokens[f] {
+				if !term.matchesAt(tokens[f], i) {
+					continue
+				}
+				occurrences++
+				for k := range term.Words {
+					matched[f][i+k] = true
+				}
+			}
+			if occurrences == 0 {
+				continue
+			}
+			found = true
+			hits[f] += occurrences
+			tf := float64(occurrences)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(len(tokens[f]))/averageWords)
+			score += field.Weight * tf * (bm25K1 + 1) / (tf + norm)
+		}
+		if !found {
+			return 0, "", false
+		}
+	}
+
+	best := 0
+	for f := range fields {
+		if hits[f] > hits[best] {
+			best = f
+		}
+	}
+	return score, Highlight(cutSnippet(fields[best].Text, tokens[best], matched[best])), true
+}
+
+// cutSnippet returns the SnippetWords words of text around its first match, with the matched
+// words between MarkStart and MarkEnd, and Ellipsis where text was left out.
+func cutSnippet(text string, tokens []token, matched []bool) string {
+	if len(tokens) == 0 {
+		return strings.TrimSpace(text)
+	}
+	first := 0
+	for i, m := range matched {
+		if m {
+			first = i
+			break
+		}
+	}
+	start := first - snippetLead
+	if start+SnippetWords > len(tokens) {
+		start = len(tokens) - SnippetWords
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + SnippetWords
+	if end > len(tokens) {
+		end = len(tokens)
+	}
+
+	var b strings.Builder
+	from := 0
+	if start > 0 {
+		b.WriteString(Ellipsis)
+		from = tokens[start].start
+	}
+	for i := start; i < end; i++ {
+		b.WriteString(stripMarks(text[from:tokens[i].start]))
+		word := stripMarks(text[tokens[i].start:tokens[i].end])
+		if matched[i] {
+			word = MarkStart + word + MarkEnd
+		}
+		b.WriteString(word)
+		from = tokens[i].end
+	}
+	if end < len(tokens) {
+		b.WriteString(Ellipsis)
+	} else {
+		b.WriteString(stripMarks(text[from:]))
+	}
+	return b.String()
+}
+
+// markStripper removes the markers from text people wrote.
+var markStripper = strings.NewReplacer(MarkStart, "", MarkEnd, "")
+
+func stripMarks(text string) string {
+	return markStripper.Replace(text)
+}
+
+// Highlight turns a raw snippet, with the matches between MarkStart and MarkEnd, into HTML
+// where they are wrapped in <mark> and everything else is escaped.
+func Highlight(raw string) string {
+	escaped := html.EscapeString(raw)
+	return strings.NewReplacer(MarkStart, "<mark>", MarkEnd, "</mark>").Replace(escaped)
+}
+
+// Markers delimit the matches in a snippet cut by the database, which copies the text of the
+// document around them as it is. They are drawn at random for each search so that no document
+// can hold them and have its own text highlighted.
+type Markers struct {
+	Start, End string
+}
+
+// NewMarkers returns markers for one search.
+func NewMarkers() Markers {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		panic("Error generating snippet markers")
+	}
+	tag := hex.EncodeToString(nonce)
+	return Markers{Start: MarkStart + tag + MarkStart, End: MarkEnd + tag + MarkEnd}
+}
+
+// Highlight turns a raw snippet whose matches are between m.Start and m.End into HTML, like
+// the function Highlight. MarkStart and MarkEnd in the text of the document are removed.
+func (m Markers) Highlight(raw string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(raw, m.Start) {
+		if i > 0 {
+			match, rest, _ := strings.Cut(part, m.End)
+			b.WriteString(MarkStart + stripMarks(match) + MarkEnd)
+			part = rest
+		}
+		b.WriteString(stripMarks(part))
+	}
+	return Highlight(b.String())
+}
+
+// Sort orders results best first; equally relevant results are listed newest first.
+func Sort(results []realtimeforum.SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID > b.ID
+	})
+}
+
+// Page sorts results and returns at most limit of them, skipping the first offset.
+func Page(results []realtimeforum.SearchResult, offset, limit int) []realtimeforum.SearchResult {
+	Sort(results)
+	if offset >= len(results) {
+		return []realtimeforum.SearchResult{}
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
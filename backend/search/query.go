@@ -0,0 +1,185 @@
+// Package search parses the queries of the forum's full-text search and ranks documents
+// against them. Stores with a full-text index (SQLite built with FTS5) only use the parsed
+// Query; the others match, rank and cut snippets with Query.Evaluate, which follows the rules
+// of the SQLite index closely enough for results to look alike:
+//
+//	q, err := search.Parse(`"real time" author:alice since:2024-01-01`)
+//
+// A query is made of words, which must all appear in a result, as whole words and in any case;
+// quoted phrases, whose words must appear in that order; words ending in * matching any word
+// they start; and filters:
+//
+//	author:name          written or sent by that user
+//	category:id          posts, and comments on posts, of that category
+//	since:YYYY-MM-DD     created on that day or later (UTC)
+//	until:YYYY-MM-DD     created on that day or earlier (UTC)
+//	in:posts|comments|chats  only that kind of document; may be repeated
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// MaxTerms bounds the number of words and phrases in a query.
+const MaxTerms = 16
+
+// dateLayout is the layout of the dates of since: and until:.
+const dateLayout = "2006-01-02"
+
+var (
+	// ErrEmptyQuery is returned for a query with filters but nothing to search for.
+	ErrEmptyQuery = errors.New("search query has no words")
+	// ErrTooManyTerms is returned for a query with more than MaxTerms words and phrases.
+	ErrTooManyTerms = fmt.Errorf("search query has more than %d words and phrases", MaxTerms)
+	// ErrInvalidFilter is returned, wrapped with the filter, for a filter whose value cannot be used.
+	ErrInvalidFilter = errors.New("invalid search filter")
+)
+
+// Term is a word or a phrase a result must contain.
+type Term struct {
+	Words  []string // Lowercase words, in order; several for a phrase
+	Prefix bool     // The last word matches any word starting with it
+}
+
+// Query is a parsed search query.
+type Query struct {
+	Terms    []Term
+	Author   string          // Username of the author; empty for any
+	Category int             // Category ID; 0 for any
+	Since    time.Time       // Earliest creation time; zero for no bound
+	Until    time.Time       // Creation times must be before it; zero for no bound
+	Kinds    map[string]bool // Kinds of results, realtimeforum.SearchKind*; empty for all
+}
+
+// Includes reports whether results of kind, a realtimeforum.SearchKind*, are wanted.
+func (q Query) Includes(kind string) bool {
+	if kind == realtimeforum.SearchKindChat && q.Category != 0 {
+		return false // Chat messages have no category
+	}
+	return len(q.Kinds) == 0 || q.Kinds[kind]
+}
+
+// InRange reports whether a document created at t passes the since: and until: filters.
+func (q Query) InRange(t time.Time) bool {
+	return (q.Since.IsZero() || !t.Before(q.Since)) && (q.Until.IsZero() || t.Before(q.Until))
+}
+
+// kindNames maps the values of in: to the kinds of results.
+var kindNames = map[string]string{
+	"posts":    realtimeforum.SearchKindPost,
+	"comments": realtimeforum.SearchKindComment,
+	"chats":    realtimeforum.SearchKindChat,
+}
+
+// Parse parses a search query. Text that is neither a phrase nor a known filter is searched
+// for as words, so "e-mail" looks for the phrase "e mail", like the SQLite tokenizer splits it.
+func Parse(input string) (Query, error) {
+	var q Query
+	for _, token := range splitQuery(input) {
+		if token.quoted {
+			q.addTerm(token.text)
+			continue
+		}
+		name, value, found := strings.Cut(token.text, ":")
+		if !found || value == "" {
+			q.addTerm(token.text)
+			continue
+		}
+		switch strings.ToLower(name) {
+		case "author":
+			q.Author = value
+		case "category":
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				return Query{}, fmt.Errorf("%w: category:%s", ErrInvalidFilter, value)
+			}
+			q.Category = id
+		case "since":
+			day, err := time.Parse(dateLayout, value)
+			if err != nil {
+				return Query{}, fmt.Errorf("%w: since:%s", ErrInvalidFilter, value)
+			}
+			q.Since = day
+		case "until":
+			day, err := time.Parse(dateLayout, value)
+			if err != nil {
+				return Query{}, fmt.Errorf("%w: until:%s", ErrInvalidFilter, value)
+			}
+			q.Until = day.AddDate(0, 0, 1)
+		case "in":
+			kind, ok := kindNames[strings.ToLower(value)]
+			if !ok {
+				return Query{}, fmt.Errorf("%w: in:%s", ErrInvalidFilter, value)
+			}
+			if q.Kinds == nil {
+				q.Kinds = make(map[string]bool)
+			}
+			q.Kinds[kind] = true
+		default:
+			q.addTerm(token.text)
+		}
+	}
+	if len(q.Terms) == 0 {
+		return Query{}, ErrEmptyQuery
+	}
+	if len(q.Terms) > MaxTerms {
+		return Query{}, ErrTooManyTerms
+	}
+	return q, nil
+}
+
+// addTerm adds the words of text as one term. A trailing * makes it a prefix.
+func (q *Query) addTerm(text string) {
+	prefix := strings.HasSuffix(text, "*")
+	var words []string
+	for _, token := range tokenize(text) {
+		words = append(words, token.word)
+	}
+	if len(words) == 0 {
+		return
+	}
+	q.Terms = append(q.Terms, Term{Words: words, Prefix: prefix})
+}
+
+// queryToken is a space-separated part of a query, or a quoted phrase.
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+// splitQuery splits a query on spaces, keeping quoted text together. A token starting with a
+// quote is a phrase; a filter's value may be quoted too, as in author:"a b". An unterminated
+// quote runs to the end of the query.
+func splitQuery(input string) []queryToken {
+	var tokens []queryToken
+	var current strings.Builder
+	quoted, inQuotes := false, false
+	for _, r := range input {
+		switch {
+		case r == '"':
+			if !inQuotes && current.Len() == 0 {
+				quoted = true
+			}
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, queryToken{text: current.String(), quoted: quoted})
+			}
+			current.Reset()
+			quoted = false
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, queryToken{text: current.String(), quoted: quoted})
+	}
+	return tokens
+}
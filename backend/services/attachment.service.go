@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"livechat-system/backend/attachment"
+	"livechat-system/backend/blob"
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// DefaultMaxAttachments is the number of files that may be attached to one post or message.
+const DefaultMaxAttachments = 10
+
+// maxFilenameLength bounds the names of uploads, in characters. Longer names are cut.
+const maxFilenameLength = 200
+
+// ErrTooManyAttachments is returned when a post or message lists more than MaxAttachments files.
+var ErrTooManyAttachments = errors.New("too many files attached")
+
+// errNoBlobStore is returned by uploads when the service was set up without a blob store.
+var errNoBlobStore = errors.New("no blob store to keep attachments in")
+
+// UploadAttachment checks a file uploaded by userID against UploadLimits and stores it, without
+// its metadata, with a thumbnail when it is an image. It stays the uploader's alone until they
+// attach it to a post or message.
+func (fs *ForumService) UploadAttachment(ctx context.Context, userID int64, filename string, data []byte) (realtimeforum.Attachment, error) {
+	if fs.Blobs == nil {
+		return realtimeforum.Attachment{}, errNoBlobStore
+	}
+	file, err := attachment.Process(data, fs.UploadLimits)
+	if err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+
+	upload := realtimeforum.Attachment{
+		UploaderID:  int(userID),
+		Filename:    cleanFilename(filename),
+		ContentType: file.ContentType,
+		Size:        int64(len(file.Data)),
+		Width:       file.Width,
+		Height:      file.Height,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if upload.BlobKey, err = fs.putBlob(ctx, file.Data); err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+	if file.Thumbnail != nil {
+		if upload.ThumbnailKey, err = fs.putBlob(ctx, file.Thumbnail); err != nil {
+			fs.deleteBlobs(ctx, upload)
+			return realtimeforum.Attachment{}, err
+		}
+	}
+
+	id, err := fs.Store.CreateAttachment(upload)
+	if err != nil {
+		fs.deleteBlobs(ctx, upload)
+		return realtimeforum.Attachment{}, err
+	}
+	upload.AttachmentID = int(id)
+	upload.HasThumbnail = upload.ThumbnailKey != ""
+	return upload, nil
+}
+
+// putBlob stores data under a new key and returns the key.
+func (fs *ForumService) putBlob(ctx context.Context, data []byte) (string, error) {
+	key, err := blob.NewKey()
+	if err != nil {
+		return "", err
+	}
+	return key, fs.Blobs.Put(ctx, key, bytes.NewReader(data))
+}
+
+// deleteBlobs removes the content and thumbnail of an attachment whose row is gone, or was never
+// stored. Failures only leave unused blobs behind, so they are logged.
+func (fs *ForumService) deleteBlobs(ctx context.Context, a realtimeforum.Attachment) {
+	for _, key := range []string{a.BlobKey, a.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := fs.Blobs.Delete(ctx, key); err != nil {
+			slog.Warn("Failed to delete attachment blob", "attachment_id", a.AttachmentID, "key", key, "err", err)
+		}
+	}
+}
+
+// cleanFilename keeps the last element of the name given by the uploader, without control
+// characters, and not longer than maxFilenameLength.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[:maxFilenameLength])
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// OpenAttachment returns an attachment and its content, or its thumbnail, if viewerID may see
+// it: an upload not attached yet is only shown to its uploader, and an attachment to whoever
+// may see its post or message. Anything else is storage.ErrNotFound, so the IDs of attachments
+// others cannot see are not revealed. The caller closes the content.
+func (fs *ForumService) OpenAttachment(ctx context.Context, viewerID, attachmentID int64, thumbnail bool) (realtimeforum.Attachment, io.ReadSeekCloser, error) {
+	if fs.Blobs == nil {
+		return realtimeforum.Attachment{}, nil, errNoBlobStore
+	}
+	a, err := fs.Store.GetAttachment(attachmentID)
+	if err != nil {
+		return realtimeforum.Attachment{}, nil, err
+	}
+	switch {
+	case a.PostID != 0:
+		_, err = fs.visiblePost(viewerID, int64(a.PostID))
+	case a.MessageID != 0:
+		var chat realtimeforum.Chats
+		chat, err = fs.Store.GetChat(int64(a.MessageID))
+		if err == nil && (chat.Deleted || !canSeeChat(chat, viewerID)) {
+			err = storage.ErrNotFound
+		}
+	case int64(a.UploaderID) != viewerID:
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		return realtimeforum.Attachment{}, nil, err
+	}
+
+	key := a.BlobKey
+	if thumbnail {
+		if key = a.ThumbnailKey; key == "" {
+			return realtimeforum.Attachment{}, nil, storage.ErrNotFound
+		}
+	}
+	content, err := fs.Blobs.Open(ctx, key)
+	if errors.Is(err, blob.ErrNotFound) {
+		return realtimeforum.Attachment{}, nil, storage.ErrNotFound
+	}
+	return a, content, err
+}
+
+// PurgeOrphanAttachments deletes the uploads never attached since before cutoff and the
+// attachments of purged messages, with their blobs, and returns how many were deleted.
+func (fs *ForumService) PurgeOrphanAttachments(ctx context.Context, cutoff time.Time) (int, error) {
+	purged, err := fs.Store.PurgeOrphanAttachments(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	// The rows are gone first, so no attachment is ever left without its content
+	if fs.Blobs != nil {
+		for _, a := range purged {
+			fs.deleteBlobs(ctx, a)
+		}
+	}
+	return len(purged), nil
+}
+
+// checkAttachmentIDs returns the attachments listed for a new post or message without repeats,
+// or ErrTooManyAttachments.
+func (fs *ForumService) checkAttachmentIDs(ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > fs.MaxAttachments {
+		return nil, ErrTooManyAttachments
+	}
+	return unique, nil
+}
+
+// withPostAttachments fills in the attachments of posts.
+func (fs *ForumService) withPostAttachments(posts []realtimeforum.Posts) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(posts))
+	for i, post := range posts {
+		ids[i] = int64(post.PostID)
+	}
+	attachments, err := fs.Store.GetPostAttachments(ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Attachments = attachments[int64(posts[i].PostID)]
+	}
+	return nil
+}
+
+// withChatAttachments fills in the attachments of chat messages. Deleted messages have none.
+func (fs *ForumService) withChatAttachments(chats []realtimeforum.Chats) error {
+	ids := make([]int64, 0, len(chats))
+	for _, chat := range chats {
+		if !chat.Deleted {
+			ids = append(ids, int64(chat.MessageID))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	attachments, err := fs.Store.GetChatAttachments(ids)
+	if err != nil {
+		return err
+	}
+	for i := range chats {
+		if !chats[i].Deleted {
+			chats[i].Attachments = attachments[int64(chats[i].MessageID)]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"livechat-system/backend/markdown"
+	realtimeforum "livechat-system/backend/models"
+)
+
+// Errors returned when a chat message cannot be edited or deleted.
+var (
+	ErrNotMessageAuthor   = errors.New("only the author can change this message")
+	ErrEditWindowExpired  = errors.New("this message can no longer be changed")
+	ErrMessageDeleted     = errors.New("this message has been deleted")
+	ErrNotPrivateMessage  = errors.New("only private messages can be changed")
+	ErrEmptyMessageEdited = errors.New("an edited message cannot be empty")
+	ErrMessageTooLong     = errors.New("a message may have at most 4000 characters")
+)
+
+// maxMessageLength is the longest chat message accepted, in characters.
+const maxMessageLength = 4000
+
+// GetChatMessage returns a single chat message by its ID.
+func (fs *ForumService) GetChatMessage(messageID int64) (realtimeforum.Chats, error) {
+	chat, err := fs.Store.GetChat(messageID)
+	renderChat(&chat)
+	return chat, err
+}
+
+// checkChangeAllowed verifies that userID may still edit or delete the message.
+func checkChangeAllowed(chat realtimeforum.Chats, userID int64, window time.Duration, now time.Time) error {
+	if chat.ReceiverID == realtimeforum.LobbyReceiverID {
+		return ErrNotPrivateMessage
+	}
+	if int64(chat.SenderID) != userID {
+		return ErrNotMessageAuthor
+	}
+	if chat.Deleted {
+		return ErrMessageDeleted
+	}
+	if now.Sub(chat.SentAt) > window {
+		return ErrEditWindowExpired
+	}
+	return nil
+}
+
+// EditChatMessage replaces the content of a private message. Only the author may edit it, and only
+// within window of sending it. The previous content is kept in Chat_Revisions, and the new one is
+// stored with its rendering.
+func (fs *ForumService) EditChatMessage(messageID, userID int64, content string, window time.Duration) (realtimeforum.Chats, error) {
+	if content == "" {
+		return realtimeforum.Chats{}, ErrEmptyMessageEdited
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return realtimeforum.Chats{}, ErrMessageTooLong
+	}
+
+	now := time.Now().UTC()
+	return fs.Store.EditChat(messageID, content, markdown.Render(content), now, func(chat realtimeforum.Chats) error {
+		return checkChangeAllowed(chat, userID, window, now)
+	})
+}
+
+// DeleteChatMessage soft-deletes a private message. Only the author may delete it, and only
+// within window of sending it. The row and its revisions are kept but the content is no longer returned.
+func (fs *ForumService) DeleteChatMessage(messageID, userID int64, window time.Duration) (realtimeforum.Chats, error) {
+	now := time.Now().UTC()
+	return fs.Store.DeleteChat(messageID, now, func(chat realtimeforum.Chats) error {
+		return checkChangeAllowed(chat, userID, window, now)
+	})
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"livechat-system/backend/markdown"
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/quote"
+	"livechat-system/backend/storage"
+)
+
+// DefaultMaxCommentDepth lets replies nest five levels below a top-level comment.
+const DefaultMaxCommentDepth = 5
+
+// maxCommentLength is the longest comment accepted, in characters.
+const maxCommentLength = 10000
+
+// Errors returned when a comment cannot be written or listed.
+var (
+	ErrInvalidComment = errors.New("a comment needs content of at most 10000 characters")
+	ErrInvalidParent  = errors.New("the comment replied to does not belong to this post")
+	ErrCommentTooDeep = errors.New("replies cannot be nested this deep")
+	ErrInvalidCursor  = errors.New("the cursor does not name a reply of this comment")
+)
+
+// CommentQuery selects the part of the comment tree of a post that GetCommentThread returns.
+type CommentQuery struct {
+	ParentID int64 // Comment whose replies are listed; 0 lists the top-level comments
+	After    int64 // Cursor: list the comments following this one, which has the same parent
+	Limit    int   // Comments listed at the first level
+	Replies  int   // Replies listed below each listed comment
+	Depth    int   // Levels of replies listed below the first one
+	Flat     bool  // List the comments in thread order with their depth, instead of as a tree
+}
+
+// CreateComment adds a comment to a post, replying to the comment parentID unless it is 0. Replies
+// may nest MaxCommentDepth levels below the top-level comments. The comment is returned with its
+// content rendered for userID.
+func (fs *ForumService) CreateComment(userID, postID, parentID int64, content string) (realtimeforum.Comments, error) {
+	content = strings.TrimSpace(content)
+	if content == "" || utf8.RuneCountInString(content) > maxCommentLength {
+		return realtimeforum.Comments{}, ErrInvalidComment
+	}
+	post, err := fs.visiblePost(userID, postID)
+	if err != nil {
+		return realtimeforum.Comments{}, err
+	}
+	if post.DeletedAt != nil {
+		return realtimeforum.Comments{}, ErrPostDeleted
+	}
+
+	comment := realtimeforum.Comments{AuthorID: int(userID), PostID: int(postID), Content: content,
+		ContentHTML: markdown.Render(content), CreatedAt: time.Now().UTC()}
+	if parentID != 0 {
+		parent, err := fs.Store.GetComment(parentID)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && int64(parent.PostID) != postID) {
+			return realtimeforum.Comments{}, ErrInvalidParent
+		}
+		if err != nil {
+			return realtimeforum.Comments{}, err
+		}
+		if parent.Depth+1 > fs.MaxCommentDepth {
+			return realtimeforum.Comments{}, ErrCommentTooDeep
+		}
+		comment.ParentCommentID = parent.CommentID
+		comment.Depth = parent.Depth + 1
+	}
+
+	commentID, err := fs.Store.CreateComment(comment)
+	if err != nil {
+		return realtimeforum.Comments{}, err
+	}
+	comment, err = fs.Store.GetComment(commentID)
+	if err != nil {
+		return realtimeforum.Comments{}, err
+	}
+	blocked, err := fs.GetRelationTargets(userID, realtimeforum.RelationBlock)
+	if err != nil {
+		return realtimeforum.Comments{}, err
+	}
+	renderComment(&comment, fs.quoteResolver(blocked, nil))
+	return comment, nil
+}
+
+// renderComment fills in the rendering of a comment for a reader. The stored rendering leaves
+// quotes as written, so comments that quote something are rendered again with resolve, which
+// knows what the reader may see.
+func renderComment(comment *realtimeforum.Comments, resolve quote.Resolver) {
+	if len(quote.Refs(comment.Content)) > 0 {
+		comment.ContentHTML = quote.Render(comment.Content, resolve)
+	} else if comment.ContentHTML == "" && comment.Content != "" {
+		comment.ContentHTML = markdown.Render(comment.Content)
+	}
+}
+
+// GetCommentThread returns part of the comment tree of a post for viewerID: up to query.Limit
+// comments with the same parent, each with its first replies down to query.Depth levels below.
+// Every listed comment says how many replies it has and, when only some of them are listed, the
+// cursor to list the next ones. The cursor of the first level is returned with the comments.
+//
+// Comments of users the viewer blocked are kept as Hidden placeholders, so the replies to them
+// still have a place in the tree. Deleted posts, like their comments, are only shown to moderators.
+func (fs *ForumService) GetCommentThread(viewerID, postID int64, query CommentQuery) ([]realtimeforum.Comments, int, error) {
+	if _, err := fs.visiblePost(viewerID, postID); err != nil {
+		return nil, 0, err
+	}
+	comments, err := fs.Store.GetComments(postID)
+	if err != nil {
+		return nil, 0, err
+	}
+	blocked, err := fs.GetRelationTargets(viewerID, realtimeforum.RelationBlock)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The comments come oldest first, so every list of replies is too
+	byID := make(map[int64]realtimeforum.Comments, len(comments))
+	replies := map[int64][]int64{}
+	for _, comment := range comments {
+		id, parentID := int64(comment.CommentID), int64(comment.ParentCommentID)
+		byID[id] = comment
+		replies[parentID] = append(replies[parentID], id)
+	}
+	if query.ParentID != 0 {
+		if _, ok := byID[query.ParentID]; !ok {
+			return nil, 0, storage.ErrNotFound
+		}
+	}
+
+	t := thread{
+		byID:    byID,
+		replies: replies,
+		blocked: blocked,
+		resolve: fs.quoteResolver(blocked, byID),
+		perNode: query.Replies,
+	}
+	listed, next, err := t.list(query.ParentID, query.After, query.Limit, query.Depth)
+	if err != nil {
+		return nil, 0, err
+	}
+	if query.Flat {
+		listed = flatten(listed, nil)
+	}
+	return listed, next, nil
+}
+
+// thread builds the listing of GetCommentThread from all the comments of a post.
+type thread struct {
+	byID    map[int64]realtimeforum.Comments
+	replies map[int64][]int64 // IDs of the replies to each comment, oldest first; top-level comments under 0
+	blocked map[int64]bool
+	resolve quote.Resolver
+	perNode int // Replies listed below each comment
+}
+
+// list returns up to limit replies to parentID following the reply after, with depth levels of
+// their own replies, and the cursor to the next ones, or 0 when there are none.
+func (t thread) list(parentID, after int64, limit, depth int) ([]realtimeforum.Comments, int, error) {
+	ids := t.replies[parentID]
+	if after != 0 {
+		start := -1
+		for i, id := range ids {
+			if id == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, 0, ErrInvalidCursor
+		}
+		ids = ids[start:]
+	}
+
+	next := 0
+	if len(ids) > limit {
+		ids = ids[:limit]
+		next = int(ids[limit-1])
+	}
+	listed := make([]realtimeforum.Comments, 0, len(ids))
+	for _, id := range ids {
+		comment := t.byID[id]
+		comment.ReplyCount = len(t.replies[id])
+		if depth > 0 && comment.ReplyCount > 0 {
+			// Every cursor is checked above, so the replies cannot fail
+			comment.Replies, comment.NextCursor, _ = t.list(id, 0, t.perNode, depth-1)
+		}
+		if t.blocked[int64(comment.AuthorID)] {
+			comment.AuthorID, comment.AuthorUsername, comment.Content, comment.ContentHTML = 0, "", "", ""
+			comment.Hidden = true
+		} else {
+			renderComment(&comment, t.resolve)
+		}
+		listed = append(listed, comment)
+	}
+	return listed, next, nil
+}
+
+// flatten appends the comments of a tree to flat in thread order: each comment followed by its
+// replies.
+func flatten(tree []realtimeforum.Comments, flat []realtimeforum.Comments) []realtimeforum.Comments {
+	if flat == nil {
+		flat = []realtimeforum.Comments{}
+	}
+	for _, comment := range tree {
+		replies := comment.Replies
+		comment.Replies = nil
+		flat = flatten(replies, append(flat, comment))
+	}
+	return flat
+}
+
+// quoteResolver looks up the comments and posts quoted in what a user reads. known holds comments
+// already loaded, which are used instead of querying the store again. Quotes of deleted posts, of
+// their comments and of the users in blocked are not shown.
+func (fs *ForumService) quoteResolver(blocked map[int64]bool, known map[int64]realtimeforum.Comments) quote.Resolver {
+	posts := map[int64]realtimeforum.Posts{}
+	visible := func(postID int64) (realtimeforum.Posts, bool) {
+		post, ok := posts[postID]
+		if !ok {
+			var err error
+			if post, err = fs.Store.GetPost(postID); err != nil {
+				return realtimeforum.Posts{}, false
+			}
+			posts[postID] = post
+		}
+		return post, post.DeletedAt == nil
+	}
+
+	return func(ref quote.Ref) (quote.Quoted, bool) {
+		switch ref.Kind {
+		case quote.KindPost:
+			post, ok := visible(ref.ID)
+			if !ok || blocked[int64(post.UserID)] {
+				return quote.Quoted{}, false
+			}
+			author, err := fs.Store.GetUsernameByID(int64(post.UserID))
+			if err != nil {
+				return quote.Quoted{}, false
+			}
+			return quote.Quoted{Author: author, Title: post.Title, Text: post.Content}, true
+
+		case quote.KindComment:
+			comment, ok := known[ref.ID]
+			if !ok {
+				var err error
+				if comment, err = fs.Store.GetComment(ref.ID); err != nil {
+					return quote.Quoted{}, false
+				}
+			}
+			if _, ok := visible(int64(comment.PostID)); !ok || blocked[int64(comment.AuthorID)] {
+				return quote.Quoted{}, false
+			}
+			return quote.Quoted{Author: comment.AuthorUsername, Text: comment.Content}, true
+		}
+		return quote.Quoted{}, false
+	}
+}
@@ -1,210 +1,222 @@
 package service
 
 import (
-	"database/sql"
-	"fmt"
+	"errors"
+	"livechat-system/backend/attachment"
+	"livechat-system/backend/blob"
+	"livechat-system/backend/markdown"
 	realtimeforum "livechat-system/backend/models"
-	"log"
+	"livechat-system/backend/storage"
+	"log/slog"
 	"runtime/debug"
 	"time"
+	"unicode/utf8"
 )
 
 type ForumService struct {
-	DB *sql.DB
-}
-
-func NewForumService(db *sql.DB) *ForumService {
-	return &ForumService{DB: db}
-}
+	Store storage.Store
 
-func (fs *ForumService) GetAllUsers() ([]realtimeforum.User, error) {
-	rows, err := fs.DB.Query("SELECT * FROM Users")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	// MaxCommentDepth is how many levels of replies may nest below a top-level comment.
+	MaxCommentDepth int
 
-	var users []realtimeforum.User
-	for rows.Next() {
-		var user realtimeforum.User
-		err := rows.Scan(&user.UserID, &user.Username, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &user.Password)
-		if err != nil {
-			return nil, err
-		}
-		fmt.Println(user, users)
-		users = append(users, user)
+	// Blobs keeps the content of attachments. Without it, nothing can be uploaded.
+	Blobs blob.Store
+	// UploadLimits bound the files that can be uploaded.
+	UploadLimits attachment.Limits
+	// MaxAttachments is the number of files that may be attached to one post or message.
+	MaxAttachments int
+}
 
+func NewForumService(store storage.Store) *ForumService {
+	return &ForumService{
+		Store:           store,
+		MaxCommentDepth: DefaultMaxCommentDepth,
+		UploadLimits:    attachment.DefaultLimits(),
+		MaxAttachments:  DefaultMaxAttachments,
 	}
+}
 
-	return users, nil
+func (fs *ForumService) GetAllUsers() ([]realtimeforum.User, error) {
+	return fs.Store.GetAllUsers()
 }
 
 // GetUserIDByUsername returns the user ID for a given username.
-// Returns an error if the user cannot be found or there's a database issue.
+// Returns storage.ErrNotFound if the user cannot be found, or the database error.
 func (fs *ForumService) GetUserIDByUsername(username string) (int64, error) {
-	var userID int64
-	query := "SELECT user_id FROM Users WHERE username = ? LIMIT 1"
-
-	err := fs.DB.QueryRow(query, username).Scan(&userID)
-	if err != nil {
-		return 0, err // Could be sql.ErrNoRows if the user is not found, or another error if there's a problem with the database
-	}
-
-	return userID, nil
+	return fs.Store.GetUserIDByUsername(username)
 }
 
 func (fs *ForumService) GetUsernameByID(userID int64) (string, error) {
-	var username string
-	query := "SELECT username FROM Users WHERE user_id = ? LIMIT 1"
-
-	err := fs.DB.QueryRow(query, userID).Scan(&username)
-	if err != nil {
-		return "", err
-	}
-
-	return username, nil
+	return fs.Store.GetUsernameByID(userID)
+}
 
+// GetCredentials returns the ID and stored password of a user, or storage.ErrNotFound.
+func (fs *ForumService) GetCredentials(username string) (int64, string, error) {
+	return fs.Store.GetCredentials(username)
 }
 
 func (fs *ForumService) CreateUser(newUser realtimeforum.User) (int64, error) {
-	//stmt to insert new user
-	query := "INSERT INTO Users(username, age, gender, first_name, last_name, email, password) VALUES (?,?,?,?,?,?,?)"
-
-	//execute stmt
-	result, err := fs.DB.Exec(query, newUser.Username, newUser.Age, newUser.Gender, newUser.FirstName, newUser.LastName, newUser.Email, newUser.Password)
-	if err != nil {
-		return 0, err
-	}
-
-	//get id of nee registered user
-	userID, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	fmt.Println(userID)
-	return userID, nil
+	return fs.Store.CreateUser(newUser)
 }
 
+// CreatePost stores a new post with the rendering of its content. The uploads of the author in
+// AttachmentIDs are attached to it, or it fails with storage.ErrAttachmentUnavailable, and its
+// Poll is stored with it, or it fails with ErrInvalidPoll. Content longer than maxPostLength fails
+// with ErrPostTooLong.
 func (fs *ForumService) CreatePost(newPost realtimeforum.Posts) (int64, error) {
-	query := "INSERT INTO Posts(user_id, title, content, category_id, created_at) VALUES (?,?,?,?,?)"
-
-	result, err := fs.DB.Exec(query, newPost.UserID, newPost.Title, newPost.Content, newPost.CategoryID, newPost.CreatedAt)
-	if err != nil {
-		return 0, err
+	if utf8.RuneCountInString(newPost.Content) > maxPostLength {
+		return 0, ErrPostTooLong
 	}
-
-	postID, err := result.LastInsertId()
+	attachmentIDs, err := fs.checkAttachmentIDs(newPost.AttachmentIDs)
 	if err != nil {
 		return 0, err
 	}
-
-	return postID, nil
+	newPost.AttachmentIDs = attachmentIDs
+	if newPost.Poll != nil {
+		poll, err := checkPoll(*newPost.Poll, time.Now())
+		if err != nil {
+			return 0, err
+		}
+		newPost.Poll = &poll
+	}
+	newPost.ContentHTML = markdown.Render(newPost.Content)
+	return fs.Store.CreatePost(newPost)
 }
 
 func (fs *ForumService) GetAllPosts() ([]realtimeforum.Posts, error) {
-	rows, err := fs.DB.Query("SELECT * FROM Posts")
+	posts, err := fs.Store.GetAllPosts()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var posts []realtimeforum.Posts
-	for rows.Next() {
-		var post realtimeforum.Posts
-		err := rows.Scan(&post.PostID, &post.UserID, &post.Title, &post.Content, &post.CategoryID, &post.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		fmt.Println(post)
-		posts = append(posts, post)
+	renderPosts(posts)
+	return posts, fs.withPostDetails(posts, 0)
+}
 
+// GetAllPostsVisibleTo returns every post except those written by users the viewer has blocked.
+func (fs *ForumService) GetAllPostsVisibleTo(viewerID int64) ([]realtimeforum.Posts, error) {
+	posts, err := fs.Store.GetPostsVisibleTo(viewerID)
+	if err != nil {
+		return nil, err
 	}
-
-	return posts, nil
+	renderPosts(posts)
+	return posts, fs.withPostDetails(posts, viewerID)
 }
-func (fs *ForumService) SaveChatMessage(chat realtimeforum.Chats) error {
+
+// SaveChatMessage inserts a chat message with the rendering of its content and returns its message ID.
+// Content longer than maxMessageLength fails with ErrMessageTooLong.
+func (fs *ForumService) SaveChatMessage(chat realtimeforum.Chats) (int64, error) {
+	if utf8.RuneCountInString(chat.MessageContent) > maxMessageLength {
+		return 0, ErrMessageTooLong
+	}
+	renderChat(&chat)
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in SaveChatMessage: %v", r)
-			debug.PrintStack()
+			slog.Error("Recovered from panic in SaveChatMessage", "panic", r, "stack", string(debug.Stack()))
 		}
 	}()
 
 	// Log the chat message details before attempting to save
-	log.Printf("Saving chat message: %+v", chat)
-
-	// Check for valid database connection
-	if fs.DB == nil {
-		err := fmt.Errorf("database connection is nil")
-		log.Printf("Error: %v", err)
-		return err
-	}
-
-	// SQL query to insert new chat message
-	query := "INSERT INTO Chats(sender_id, receiver_id, message, sent_at, sender_username) VALUES (?,?,?,?,?)"
+	slog.Debug("Saving chat message", "sender_id", chat.SenderID, "receiver_id", chat.ReceiverID)
 
-	// Executing the query with the chat details
-	_, err := fs.DB.Exec(query, chat.SenderID, chat.ReceiverID, chat.MessageContent, chat.SentAt.Format(time.RFC3339), chat.SenderUsername)
+	messageID, err := fs.Store.SaveChat(chat)
 	if err != nil {
-		log.Printf("Error executing query: %v", err)
-		return err
+		slog.Error("Failed to save chat message", "err", err)
+		return 0, err
 	}
 
 	// Log successful message save
-	log.Printf("Chat message saved successfully")
+	slog.Debug("Chat message saved", "message_id", messageID)
 
-	// Return no error
-	return nil
+	return messageID, nil
 }
 
-func (fs *ForumService) GetChatHistory(senderID, receiverID int64) ([]realtimeforum.Chats, error) {
-	// SQL query to fetch chat history between two users
-	query := `
-	SELECT c.message_id, c.sender_id, c.receiver_id, c.message, c.sent_at, u.username 
-	FROM Chats c
-	JOIN Users u ON c.sender_id = u.user_id
-	WHERE (c.sender_id = ? AND c.receiver_id = ?) OR (c.sender_id = ? AND c.receiver_id = ?)
-	ORDER BY c.sent_at ASC
-`
-	rows, err := fs.DB.Query(query, senderID, receiverID, receiverID, senderID)
+// SaveChatMessageOnce stores a chat message unless the sender already stored one with the
+// same client message ID. It returns the stored message, with its rendering and attachments, and
+// whether it was a duplicate. The uploads of the sender in AttachmentIDs are attached to it, or it
+// fails with storage.ErrAttachmentUnavailable.
+func (fs *ForumService) SaveChatMessageOnce(chat realtimeforum.Chats) (realtimeforum.Chats, bool, error) {
+	if utf8.RuneCountInString(chat.MessageContent) > maxMessageLength {
+		return realtimeforum.Chats{}, false, ErrMessageTooLong
+	}
+	renderChat(&chat)
+	attachmentIDs, err := fs.checkAttachmentIDs(chat.AttachmentIDs)
 	if err != nil {
-		return nil, err
+		return realtimeforum.Chats{}, false, err
 	}
-	defer rows.Close()
-	// Create a slice of chats to store the chat history
-	var chats []realtimeforum.Chats
-	for rows.Next() {
-		var chat realtimeforum.Chats
-		var sentAt string
-		err := rows.Scan(&chat.MessageID, &chat.SenderID, &chat.ReceiverID, &chat.MessageContent, &sentAt, &chat.SenderUsername)
-		if err != nil {
-			return nil, err
+	chat.AttachmentIDs = attachmentIDs
+	if chat.ClientMessageID != "" {
+		existing, err := fs.GetChatMessageByClientID(int64(chat.SenderID), chat.ClientMessageID)
+		if err == nil {
+			return existing, true, nil
 		}
-		// log.Printf("Fetched chat: %+v with SentAt: %s", chat, sentAt)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return realtimeforum.Chats{}, false, err
+		}
+	}
 
-		chat.SentAt, err = time.Parse(time.RFC3339, sentAt)
-		if err != nil {
-			log.Printf("Error parsing sentAt: %v", err)
-			return nil, err
+	messageID, err := fs.SaveChatMessage(chat)
+	if err != nil {
+		// A concurrent retry may have won the race on the uniqueness index
+		if chat.ClientMessageID != "" {
+			if existing, lookupErr := fs.GetChatMessageByClientID(int64(chat.SenderID), chat.ClientMessageID); lookupErr == nil {
+				return existing, true, nil
+			}
 		}
-		chats = append(chats, chat)
+		return realtimeforum.Chats{}, false, err
 	}
-	return chats, nil
+
+	chat.MessageID = int(messageID)
+	chat.AttachmentIDs = nil
+	if len(attachmentIDs) > 0 {
+		saved := []realtimeforum.Chats{chat}
+		if err := fs.withChatAttachments(saved); err != nil {
+			return realtimeforum.Chats{}, false, err
+		}
+		chat = saved[0]
+	}
+	return chat, false, nil
+}
+
+// GetChatMessageByClientID looks up a message by its sender and client message ID.
+// Returns storage.ErrNotFound if the sender never stored a message with that ID.
+func (fs *ForumService) GetChatMessageByClientID(senderID int64, clientMessageID string) (realtimeforum.Chats, error) {
+	chat, err := fs.Store.GetChatByClientID(senderID, clientMessageID)
+	if err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	renderChat(&chat)
+	chats := []realtimeforum.Chats{chat}
+	if err := fs.withChatAttachments(chats); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	return chats[0], nil
+}
+
+// MarkChatMessageDelivered records the first time a message reached a recipient connection.
+func (fs *ForumService) MarkChatMessageDelivered(messageID int64, deliveredAt time.Time) error {
+	return fs.Store.MarkChatDelivered(messageID, deliveredAt)
 }
 
-// UpdateUserLastActivity updates the last_activity timestamp for a user in the online_users table.
-func (fs *ForumService) UpdateUserLastActivity(db *sql.DB, userID int64) error {
-	// Prepare the SQL statement for upserting last activity
-	query := `
-    INSERT INTO online_users (user_id, last_activity) VALUES (?, CURRENT_TIMESTAMP)
-ON CONFLICT(user_id) DO UPDATE SET last_activity = CURRENT_TIMESTAMP;
-    `
-	_, err := db.Exec(query, userID)
+func (fs *ForumService) GetChatHistory(senderID, receiverID int64) ([]realtimeforum.Chats, error) {
+	chats, err := fs.Store.GetChatHistory(senderID, receiverID)
 	if err != nil {
-		return err
+		slog.Error("Error reading chat history", "err", err)
+		return nil, err
+	}
+
+	renderChats(chats)
+	if err := fs.withChatAttachments(chats); err != nil {
+		return nil, err
 	}
-	return nil
+
+	// Reactions are stored separately and aggregated per emoji
+	if err := fs.attachReactions(chats); err != nil {
+		return nil, err
+	}
+	return chats, nil
 }
 
-// Add other methods for CRUD operations like CreateUser, UpdateUser, DeleteUser, etc.
+// UpdateUserLastActivity records that the user is active now, for the presence cleanup.
+func (fs *ForumService) UpdateUserLastActivity(userID int64) error {
+	return fs.Store.TouchUser(userID, time.Now())
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"time"
+)
+
+// CleanupInactiveUsers removes users from online_users whose last activity is older than inactiveAfter.
+// It returns the number of users removed.
+func (fs *ForumService) CleanupInactiveUsers(inactiveAfter time.Duration) (int64, error) {
+	return fs.Store.RemoveInactiveUsers(time.Now().Add(-inactiveAfter))
+}
+
+// PurgeDeletedChatMessages permanently removes chat messages that were deleted before cutoff,
+// together with their revisions and reactions. It returns the number of messages removed.
+func (fs *ForumService) PurgeDeletedChatMessages(cutoff time.Time) (int64, error) {
+	return fs.Store.PurgeDeletedChats(cutoff)
+}
+
+// PurgeChatRevisions removes the edit history of chat messages recorded before cutoff.
+// It returns the number of revisions removed.
+func (fs *ForumService) PurgeChatRevisions(cutoff time.Time) (int64, error) {
+	return fs.Store.PurgeChatRevisions(cutoff)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// Number of notifications GetNotifications returns when no limit is given, and at most.
+const (
+	DefaultNotificationLimit = 20
+	MaxNotificationLimit     = 100
+)
+
+// ErrInvalidWatchKind is returned when a watch is neither of a post nor of a category.
+var ErrInvalidWatchKind = errors.New("kind must be post or category")
+
+func validWatchKind(kind string) bool {
+	return kind == realtimeforum.WatchPost || kind == realtimeforum.WatchCategory
+}
+
+// AddBookmark bookmarks a post for userID. Adding it twice is a no-op.
+func (fs *ForumService) AddBookmark(userID, postID int64) error {
+	if err := fs.checkPostOpen(userID, postID); err != nil {
+		return err
+	}
+	return fs.Store.AddBookmark(userID, postID, time.Now())
+}
+
+// RemoveBookmark removes a bookmark. Removing one that does not exist is a no-op.
+func (fs *ForumService) RemoveBookmark(userID, postID int64) error {
+	return fs.Store.RemoveBookmark(userID, postID)
+}
+
+// GetBookmarkedPosts returns the posts userID bookmarked, most recently bookmarked first, leaving
+// out deleted posts and those written by users userID has blocked.
+func (fs *ForumService) GetBookmarkedPosts(userID int64) ([]realtimeforum.Posts, error) {
+	bookmarked, err := fs.Store.GetBookmarkedPosts(userID)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := fs.Store.GetRelationTargets(userID, realtimeforum.RelationBlock)
+	if err != nil {
+		return nil, err
+	}
+	posts := []realtimeforum.Posts{}
+	for _, post := range bookmarked {
+		if !blocked[int64(post.UserID)] {
+			posts = append(posts, post)
+		}
+	}
+	renderPosts(posts)
+	return posts, fs.withPostDetails(posts, userID)
+}
+
+// AddWatch records that userID watches a post, to be notified of its new comments, or a
+// category, to be notified of its new posts. Adding it twice is a no-op.
+func (fs *ForumService) AddWatch(userID int64, kind string, targetID int64) error {
+	if !validWatchKind(kind) {
+		return ErrInvalidWatchKind
+	}
+	if kind == realtimeforum.WatchPost {
+		if err := fs.checkPostOpen(userID, targetID); err != nil {
+			return err
+		}
+	} else if targetID <= 0 {
+		// Categories are not managed, so any other ID may be watched
+		return storage.ErrNotFound
+	}
+	return fs.Store.AddWatch(userID, kind, targetID, time.Now())
+}
+
+// RemoveWatch removes a watch. Removing one that does not exist is a no-op.
+func (fs *ForumService) RemoveWatch(userID int64, kind string, targetID int64) error {
+	if !validWatchKind(kind) {
+		return ErrInvalidWatchKind
+	}
+	return fs.Store.RemoveWatch(userID, kind, targetID)
+}
+
+// ListWatches returns the posts and categories userID watches, most recent first.
+func (fs *ForumService) ListWatches(userID int64) ([]realtimeforum.Watch, error) {
+	return fs.Store.ListWatches(userID)
+}
+
+// checkPostOpen returns storage.ErrNotFound unless userID may see the post, and ErrPostDeleted
+// if it is deleted.
+func (fs *ForumService) checkPostOpen(userID, postID int64) error {
+	post, err := fs.visiblePost(userID, postID)
+	if err != nil {
+		return err
+	}
+	if post.DeletedAt != nil {
+		return ErrPostDeleted
+	}
+	return nil
+}
+
+// GetNotifications returns up to limit notifications of userID, most recent first, starting
+// before the notification beforeID unless it is 0, and the number of those not read yet. The
+// limit defaults to DefaultNotificationLimit and is capped at MaxNotificationLimit.
+func (fs *ForumService) GetNotifications(userID, beforeID int64, limit int) ([]realtimeforum.Notification, int, error) {
+	if limit <= 0 {
+		limit = DefaultNotificationLimit
+	}
+	limit = min(limit, MaxNotificationLimit)
+	notifications, err := fs.Store.GetNotifications(userID, beforeID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	unread, err := fs.Store.CountUnreadNotifications(userID)
+	return notifications, unread, err
+}
+
+// MarkNotificationsRead marks the notifications of userID up to upToID as read, or all of them
+// when upToID is 0, and returns how many were not read yet.
+func (fs *ForumService) MarkNotificationsRead(userID, upToID int64) (int64, error) {
+	return fs.Store.MarkNotificationsRead(userID, upToID, time.Now())
+}
+
+// NotifyNewComment notifies the watchers of the post of a new comment, and returns the
+// notifications to deliver live.
+func (fs *ForumService) NotifyNewComment(comment realtimeforum.Comments) ([]realtimeforum.Notification, error) {
+	post, err := fs.Store.GetPost(int64(comment.PostID))
+	if err != nil {
+		return nil, err
+	}
+	watchers, err := fs.Store.GetWatchers(realtimeforum.WatchPost, int64(post.PostID))
+	if err != nil {
+		return nil, err
+	}
+	notification := realtimeforum.Notification{Kind: realtimeforum.NotificationComment, ActorID: comment.AuthorID,
+		CommentID: comment.CommentID, CreatedAt: comment.CreatedAt}
+	return fs.notify(notification, post, watchers)
+}
+
+// NotifyNewPost notifies the watchers of the category of a new post, and returns the
+// notifications to deliver live.
+func (fs *ForumService) NotifyNewPost(post realtimeforum.Posts) ([]realtimeforum.Notification, error) {
+	watchers, err := fs.Store.GetWatchers(realtimeforum.WatchCategory, int64(post.CategoryID))
+	if err != nil {
+		return nil, err
+	}
+	notification := realtimeforum.Notification{Kind: realtimeforum.NotificationPost, ActorID: post.UserID,
+		CreatedAt: post.CreatedAt}
+	return fs.notify(notification, post, watchers)
+}
+
+// notify stores notification, about post, for watchers. The actor is not notified of what they
+// did themselves, nor are the watchers who blocked or muted them.
+func (fs *ForumService) notify(notification realtimeforum.Notification, post realtimeforum.Posts, watchers map[int64]bool) ([]realtimeforum.Notification, error) {
+	actorID := int64(notification.ActorID)
+	delete(watchers, actorID)
+	for _, kind := range []string{realtimeforum.RelationBlock, realtimeforum.RelationMute} {
+		owners, err := fs.Store.GetRelationOwners(actorID, kind)
+		if err != nil {
+			return nil, err
+		}
+		for ownerID := range owners {
+			delete(watchers, ownerID)
+		}
+	}
+	if len(watchers) == 0 {
+		return nil, nil
+	}
+
+	recipients := make([]int64, 0, len(watchers))
+	for userID := range watchers {
+		recipients = append(recipients, userID)
+	}
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i] < recipients[j] })
+	notification.PostID = post.PostID
+	ids, err := fs.Store.CreateNotifications(notification, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filled in as GetNotifications reads them
+	username, err := fs.Store.GetUsernameByID(actorID)
+	if err != nil {
+		return nil, err
+	}
+	notification.ActorUsername = username
+	notification.PostTitle = post.Title
+	notification.CategoryID = post.CategoryID
+	notification.CreatedAt = notification.CreatedAt.UTC().Truncate(time.Second)
+	notifications := make([]realtimeforum.Notification, len(recipients))
+	for i, userID := range recipients {
+		notifications[i] = notification
+		notifications[i].NotificationID = int(ids[i])
+		notifications[i].UserID = int(userID)
+	}
+	return notifications, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// Limits of the polls of posts.
+const (
+	MinPollOptions      = 2
+	MaxPollOptions      = 20
+	maxPollOptionLength = 200 // In characters
+)
+
+// Errors returned when a poll cannot be created or voted in.
+var (
+	ErrInvalidPoll = errors.New("a poll needs 2 to 20 different options of up to 200 characters, and a closing time in the future")
+	ErrInvalidVote = errors.New("choose one option of the poll, or several if it allows it")
+)
+
+// checkPoll returns the poll of a new post as it is stored: its options trimmed, and nothing
+// that is counted when reading it. It returns ErrInvalidPoll unless the poll has between
+// MinPollOptions and MaxPollOptions different options and closes after now, if ever.
+func checkPoll(poll realtimeforum.Poll, now time.Time) (realtimeforum.Poll, error) {
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		return realtimeforum.Poll{}, ErrInvalidPoll
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(now) {
+		return realtimeforum.Poll{}, ErrInvalidPoll
+	}
+	checked := realtimeforum.Poll{Multiple: poll.Multiple, Anonymous: poll.Anonymous}
+	if poll.ClosesAt != nil {
+		closesAt := poll.ClosesAt.UTC()
+		checked.ClosesAt = &closesAt
+	}
+	seen := make(map[string]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		text := strings.TrimSpace(option.Text)
+		if text == "" || utf8.RuneCountInString(text) > maxPollOptionLength || seen[text] {
+			return realtimeforum.Poll{}, ErrInvalidPoll
+		}
+		seen[text] = true
+		checked.Options = append(checked.Options, realtimeforum.PollOption{Text: text})
+	}
+	return checked, nil
+}
+
+// GetPoll returns the poll of a post as viewerID sees it, or storage.ErrNotFound when the post
+// has none or viewerID may not see the post.
+func (fs *ForumService) GetPoll(viewerID, postID int64) (realtimeforum.Poll, error) {
+	if _, err := fs.visiblePost(viewerID, postID); err != nil {
+		return realtimeforum.Poll{}, err
+	}
+	return fs.poll(viewerID, postID)
+}
+
+// Vote records the vote of userID in the poll of a post: one option, or several when the poll
+// allows it. Every user votes once, until the poll closes. It returns the post and its poll
+// with the vote counted, as userID sees it.
+func (fs *ForumService) Vote(userID, postID int64, optionIDs []int64) (realtimeforum.Posts, realtimeforum.Poll, error) {
+	post, err := fs.visiblePost(userID, postID)
+	if err != nil {
+		return realtimeforum.Posts{}, realtimeforum.Poll{}, err
+	}
+	if post.DeletedAt != nil {
+		return realtimeforum.Posts{}, realtimeforum.Poll{}, ErrPostDeleted
+	}
+	poll, err := fs.poll(userID, postID)
+	if err != nil {
+		return realtimeforum.Posts{}, realtimeforum.Poll{}, err
+	}
+	if poll.Closed {
+		return realtimeforum.Posts{}, realtimeforum.Poll{}, storage.ErrPollClosed
+	}
+	if err := checkVote(poll, optionIDs); err != nil {
+		return realtimeforum.Posts{}, realtimeforum.Poll{}, err
+	}
+
+	if err := fs.Store.CastVote(postID, userID, optionIDs, time.Now().UTC()); err != nil {
+		return realtimeforum.Posts{}, realtimeforum.Poll{}, err
+	}
+	poll, err = fs.poll(userID, postID)
+	return post, poll, err
+}
+
+// checkVote returns ErrInvalidVote unless optionIDs are different options of poll, only one
+// unless the poll allows several.
+func checkVote(poll realtimeforum.Poll, optionIDs []int64) error {
+	if len(optionIDs) == 0 || (len(optionIDs) > 1 && !poll.Multiple) {
+		return ErrInvalidVote
+	}
+	valid := make(map[int64]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		valid[int64(option.OptionID)] = true
+	}
+	chosen := make(map[int64]bool, len(optionIDs))
+	for _, optionID := range optionIDs {
+		if !valid[optionID] || chosen[optionID] {
+			return ErrInvalidVote
+		}
+		chosen[optionID] = true
+	}
+	return nil
+}
+
+// poll returns the poll of a post as viewerID sees it, or storage.ErrNotFound.
+func (fs *ForumService) poll(viewerID, postID int64) (realtimeforum.Poll, error) {
+	polls, err := fs.Store.GetPolls([]int64{postID}, viewerID)
+	if err != nil {
+		return realtimeforum.Poll{}, err
+	}
+	poll, ok := polls[postID]
+	if !ok {
+		return realtimeforum.Poll{}, storage.ErrNotFound
+	}
+	markClosed(&poll, time.Now())
+	return poll, nil
+}
+
+// withPostDetails fills in what is stored apart from posts: their attachments, and their polls as
+// viewerID sees them.
+func (fs *ForumService) withPostDetails(posts []realtimeforum.Posts, viewerID int64) error {
+	if err := fs.withPostAttachments(posts); err != nil {
+		return err
+	}
+	return fs.withPolls(posts, viewerID)
+}
+
+// withPolls fills in the polls of posts as viewerID sees them.
+func (fs *ForumService) withPolls(posts []realtimeforum.Posts, viewerID int64) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(posts))
+	for i, post := range posts {
+		ids[i] = int64(post.PostID)
+	}
+	polls, err := fs.Store.GetPolls(ids, viewerID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range posts {
+		if poll, ok := polls[int64(posts[i].PostID)]; ok {
+			markClosed(&poll, now)
+			posts[i].Poll = &poll
+		}
+	}
+	return nil
+}
+
+func markClosed(poll *realtimeforum.Poll, now time.Time) {
+	poll.Closed = poll.ClosesAt != nil && !now.Before(*poll.ClosesAt)
+}
+
+// PollResults returns the results of a poll anyone who can see it may be sent: the votes per
+// option, without who cast them.
+func PollResults(poll realtimeforum.Poll) realtimeforum.Poll {
+	results := poll
+	results.MyVotes = nil
+	results.Options = make([]realtimeforum.PollOption, len(poll.Options))
+	for i, option := range poll.Options {
+		option.Voters = nil
+		results.Options[i] = option
+	}
+	return results
+}
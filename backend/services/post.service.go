@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"livechat-system/backend/diff"
+	"livechat-system/backend/markdown"
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// Errors returned when a post cannot be edited, deleted or seen.
+var (
+	ErrNotPostAuthor  = errors.New("only the author or a moderator can change this post")
+	ErrPostDeleted    = errors.New("this post has been deleted")
+	ErrInvalidPost    = errors.New("a post needs a title, content and a category")
+	ErrModeratorsOnly = errors.New("only moderators can do this")
+	ErrPostTooLong    = errors.New("a post may have at most 50000 characters")
+)
+
+// maxPostLength is the longest post content accepted, in characters.
+const maxPostLength = 50000
+
+// errPostUnchanged stops an edit that would change nothing, so no revision is recorded for it.
+var errPostUnchanged = errors.New("post unchanged")
+
+// checkPostChangeAllowed verifies that userID, a moderator or not, may edit or delete the post.
+func checkPostChangeAllowed(post realtimeforum.Posts, userID int64, moderator bool) error {
+	if post.DeletedAt != nil {
+		return ErrPostDeleted
+	}
+	if int64(post.UserID) != userID && !moderator {
+		return ErrNotPostAuthor
+	}
+	return nil
+}
+
+// visiblePost returns the post if viewerID may see it: deleted posts are only shown to
+// moderators, and are storage.ErrNotFound to everyone else.
+func (fs *ForumService) visiblePost(viewerID, postID int64) (realtimeforum.Posts, error) {
+	post, err := fs.Store.GetPost(postID)
+	if err != nil || post.DeletedAt == nil {
+		return post, err
+	}
+	moderator, err := fs.IsModerator(viewerID)
+	if err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	if !moderator {
+		return realtimeforum.Posts{}, storage.ErrNotFound
+	}
+	return post, nil
+}
+
+// GetPost returns a post with its attachments and comments, oldest first, rendered for viewerID. Deleted posts,
+// whose comments are kept, are only returned to moderators.
+func (fs *ForumService) GetPost(viewerID, postID int64) (realtimeforum.Posts, []realtimeforum.Comments, error) {
+	post, err := fs.visiblePost(viewerID, postID)
+	if err != nil {
+		return realtimeforum.Posts{}, nil, err
+	}
+	renderPost(&post)
+	posts := []realtimeforum.Posts{post}
+	if err := fs.withPostDetails(posts, viewerID); err != nil {
+		return realtimeforum.Posts{}, nil, err
+	}
+	post = posts[0]
+	comments, err := fs.Store.GetComments(postID)
+	if err != nil {
+		return realtimeforum.Posts{}, nil, err
+	}
+	blocked, err := fs.GetRelationTargets(viewerID, realtimeforum.RelationBlock)
+	if err != nil {
+		return realtimeforum.Posts{}, nil, err
+	}
+	resolve := fs.quoteResolver(blocked, nil)
+	for i := range comments {
+		renderComment(&comments[i], resolve)
+	}
+	return post, comments, nil
+}
+
+// GetDeletedPosts returns the deleted posts, most recently deleted first, to moderators.
+func (fs *ForumService) GetDeletedPosts(viewerID int64) ([]realtimeforum.Posts, error) {
+	moderator, err := fs.IsModerator(viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !moderator {
+		return nil, ErrModeratorsOnly
+	}
+	posts, err := fs.Store.GetDeletedPosts()
+	if err != nil {
+		return nil, err
+	}
+	renderPosts(posts)
+	return posts, fs.withPostDetails(posts, viewerID)
+}
+
+// EditPost replaces the title, content and category of a post. Only its author and moderators
+// may edit it. The previous version is kept in Post_Revisions, unless the edit changes nothing.
+// The category the post was in before is returned with it.
+func (fs *ForumService) EditPost(userID, postID int64, edit realtimeforum.PostEdit) (realtimeforum.Posts, int, error) {
+	edit.Title, edit.Content = strings.TrimSpace(edit.Title), strings.TrimSpace(edit.Content)
+	if edit.Title == "" || edit.Content == "" || edit.CategoryID <= 0 {
+		return realtimeforum.Posts{}, 0, ErrInvalidPost
+	}
+	if utf8.RuneCountInString(edit.Content) > maxPostLength {
+		return realtimeforum.Posts{}, 0, ErrPostTooLong
+	}
+	edit.ContentHTML = markdown.Render(edit.Content)
+	moderator, err := fs.IsModerator(userID)
+	if err != nil {
+		return realtimeforum.Posts{}, 0, err
+	}
+
+	var current realtimeforum.Posts
+	post, err := fs.Store.EditPost(postID, userID, edit, time.Now().UTC(), func(post realtimeforum.Posts) error {
+		if err := checkPostChangeAllowed(post, userID, moderator); err != nil {
+			return err
+		}
+		current = post
+		if post.Title == edit.Title && post.Content == edit.Content && post.CategoryID == edit.CategoryID {
+			return errPostUnchanged
+		}
+		return nil
+	})
+	if errors.Is(err, errPostUnchanged) {
+		renderPost(&current)
+		return current, current.CategoryID, nil
+	}
+	return post, current.CategoryID, err
+}
+
+// DeletePost soft-deletes a post. Only its author and moderators may delete it. The post, its
+// revisions and its comments are kept for moderators, but no longer listed.
+func (fs *ForumService) DeletePost(userID, postID int64) (realtimeforum.Posts, error) {
+	moderator, err := fs.IsModerator(userID)
+	if err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	post, err := fs.Store.DeletePost(postID, userID, time.Now().UTC(), func(post realtimeforum.Posts) error {
+		return checkPostChangeAllowed(post, userID, moderator)
+	})
+	renderPost(&post)
+	return post, err
+}
+
+// GetPostRevisions returns a post and its previous versions, oldest first, each with the diff
+// of its content to the version that replaced it. Like GetPost, the history of deleted posts is
+// only returned to moderators.
+func (fs *ForumService) GetPostRevisions(viewerID, postID int64) (realtimeforum.Posts, []realtimeforum.PostRevision, error) {
+	post, err := fs.visiblePost(viewerID, postID)
+	if err != nil {
+		return realtimeforum.Posts{}, nil, err
+	}
+	renderPost(&post)
+	revisions, err := fs.Store.GetPostRevisions(postID)
+	if err != nil {
+		return realtimeforum.Posts{}, nil, err
+	}
+	for i := range revisions {
+		next := post.Content
+		if i+1 < len(revisions) {
+			next = revisions[i+1].Content
+		}
+		revisions[i].Diff = diff.Lines(revisions[i].Content, next)
+	}
+	return post, revisions, nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// Errors returned when a reaction cannot be added or removed.
+var (
+	ErrInvalidEmoji      = errors.New("reaction must be a single emoji")
+	ErrMessageNotVisible = errors.New("you cannot react to this message")
+)
+
+// maxEmojiRunes bounds the length of a reaction. Emoji built from several code points
+// (skin tones, ZWJ sequences, flags) need more than one rune.
+const maxEmojiRunes = 8
+
+// validEmoji rejects anything that is not a short sequence of non-ASCII code points.
+// Digits, '#' and '*' are allowed because keycap emoji start with them.
+func validEmoji(emoji string) bool {
+	if emoji == "" || !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > maxEmojiRunes {
+		return false
+	}
+	for _, r := range emoji {
+		if r < utf8.RuneSelf && !strings.ContainsRune("0123456789#*", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// canSeeChat reports whether userID is allowed to see the message: lobby messages
+// are visible to everyone, private messages only to their two participants.
+func canSeeChat(chat realtimeforum.Chats, userID int64) bool {
+	if chat.ReceiverID == realtimeforum.LobbyReceiverID {
+		return true
+	}
+	return int64(chat.SenderID) == userID || int64(chat.ReceiverID) == userID
+}
+
+// SetReaction adds (or removes, when add is false) userID's emoji reaction on a chat message.
+// It returns the message and its reactions after the change.
+func (fs *ForumService) SetReaction(messageID, userID int64, emoji string, add bool) (realtimeforum.Chats, []realtimeforum.ReactionSummary, error) {
+	if !validEmoji(emoji) {
+		return realtimeforum.Chats{}, nil, ErrInvalidEmoji
+	}
+
+	chat, err := fs.GetChatMessage(messageID)
+	if err != nil {
+		return realtimeforum.Chats{}, nil, err
+	}
+	if !canSeeChat(chat, userID) {
+		return realtimeforum.Chats{}, nil, ErrMessageNotVisible
+	}
+	if chat.Deleted {
+		return realtimeforum.Chats{}, nil, ErrMessageDeleted
+	}
+
+	if add {
+		// Reacting twice with the same emoji is a no-op
+		err = fs.Store.AddReaction(messageID, userID, emoji, time.Now())
+	} else {
+		err = fs.Store.RemoveReaction(messageID, userID, emoji)
+	}
+	if err != nil {
+		return realtimeforum.Chats{}, nil, err
+	}
+
+	reactions, err := fs.GetReactions([]int64{messageID})
+	if err != nil {
+		return realtimeforum.Chats{}, nil, err
+	}
+	return chat, reactions[messageID], nil
+}
+
+// GetReactions returns the reactions of the given messages, aggregated per emoji
+// and keyed by message ID. Emoji are ordered by when they were first used on the message.
+func (fs *ForumService) GetReactions(messageIDs []int64) (map[int64][]realtimeforum.ReactionSummary, error) {
+	return fs.Store.GetReactions(messageIDs)
+}
+
+// attachReactions fills in the reactions of each chat message.
+func (fs *ForumService) attachReactions(chats []realtimeforum.Chats) error {
+	messageIDs := make([]int64, len(chats))
+	for i, chat := range chats {
+		messageIDs[i] = int64(chat.MessageID)
+	}
+	reactions, err := fs.GetReactions(messageIDs)
+	if err != nil {
+		return err
+	}
+	for i := range chats {
+		chats[i].Reactions = reactions[int64(chats[i].MessageID)]
+	}
+	return nil
+}
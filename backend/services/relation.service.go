@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// Errors returned when a block or mute cannot be changed, or when a block prevents an action.
+var (
+	ErrInvalidRelationKind = errors.New("kind must be block or mute")
+	ErrRelationToSelf      = errors.New("you cannot block or mute yourself")
+	ErrBlocked             = errors.New("you cannot send messages to this user")
+)
+
+func validRelationKind(kind string) bool {
+	return kind == realtimeforum.RelationBlock || kind == realtimeforum.RelationMute
+}
+
+// AddUserRelation records that userID blocks or mutes targetID. Adding it twice is a no-op.
+func (fs *ForumService) AddUserRelation(userID, targetID int64, kind string) error {
+	if !validRelationKind(kind) {
+		return ErrInvalidRelationKind
+	}
+	if userID == targetID {
+		return ErrRelationToSelf
+	}
+	// Make sure the target exists; storage.ErrNotFound is returned otherwise
+	if _, err := fs.GetUsernameByID(targetID); err != nil {
+		return err
+	}
+
+	return fs.Store.AddUserRelation(userID, targetID, kind, time.Now())
+}
+
+// RemoveUserRelation removes a block or mute. Removing one that does not exist is a no-op.
+func (fs *ForumService) RemoveUserRelation(userID, targetID int64, kind string) error {
+	if !validRelationKind(kind) {
+		return ErrInvalidRelationKind
+	}
+	return fs.Store.RemoveUserRelation(userID, targetID, kind)
+}
+
+// ListUserRelations returns the users that userID has blocked or muted, most recent first.
+func (fs *ForumService) ListUserRelations(userID int64, kind string) ([]realtimeforum.UserRelation, error) {
+	if !validRelationKind(kind) {
+		return nil, ErrInvalidRelationKind
+	}
+
+	return fs.Store.ListUserRelations(userID, kind)
+}
+
+// HasUserRelation reports whether userID has blocked or muted targetID.
+func (fs *ForumService) HasUserRelation(userID, targetID int64, kind string) (bool, error) {
+	return fs.Store.HasUserRelation(userID, targetID, kind)
+}
+
+// GetRelationTargets returns the set of users that userID has blocked or muted.
+func (fs *ForumService) GetRelationTargets(userID int64, kind string) (map[int64]bool, error) {
+	return fs.Store.GetRelationTargets(userID, kind)
+}
+
+// GetRelationOwners returns the set of users who have blocked or muted targetID.
+func (fs *ForumService) GetRelationOwners(targetID int64, kind string) (map[int64]bool, error) {
+	return fs.Store.GetRelationOwners(targetID, kind)
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"livechat-system/backend/markdown"
+	realtimeforum "livechat-system/backend/models"
+)
+
+// Posts, comments and chat messages are stored with the rendering of their Markdown, made when they
+// are written. Those written before renderings were stored have none, and are rendered when read;
+// clearing the stored renderings has the same effect, should the dialect change.
+
+// renderPost fills in the rendering of a post stored without one.
+func renderPost(post *realtimeforum.Posts) {
+	if post.ContentHTML == "" && post.Content != "" {
+		post.ContentHTML = markdown.Render(post.Content)
+	}
+}
+
+func renderPosts(posts []realtimeforum.Posts) {
+	for i := range posts {
+		renderPost(&posts[i])
+	}
+}
+
+// renderChat fills in the rendering of a chat message stored without one. Deleted messages have
+// neither content nor rendering.
+func renderChat(chat *realtimeforum.Chats) {
+	if chat.MessageHTML == "" && chat.MessageContent != "" {
+		chat.MessageHTML = markdown.Render(chat.MessageContent)
+	}
+}
+
+func renderChats(chats []realtimeforum.Chats) {
+	for i := range chats {
+		renderChat(&chats[i])
+	}
+}
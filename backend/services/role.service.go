@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// ErrInvalidRole is returned when a user is given a role that does not exist.
+var ErrInvalidRole = errors.New("role must be user or moderator")
+
+// IsModerator reports whether userID is a moderator. Unknown users are not.
+func (fs *ForumService) IsModerator(userID int64) (bool, error) {
+	role, err := fs.Store.GetUserRole(userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return role == realtimeforum.RoleModerator, err
+}
+
+// SetUserRole makes userID a moderator or an ordinary user again.
+func (fs *ForumService) SetUserRole(userID int64, role string) error {
+	if role != realtimeforum.RoleUser && role != realtimeforum.RoleModerator {
+		return ErrInvalidRole
+	}
+	return fs.Store.SetUserRole(userID, role)
+}
+
+// GetModerators returns the moderators, by ID.
+func (fs *ForumService) GetModerators() ([]realtimeforum.UserRole, error) {
+	return fs.Store.GetUsersWithRole(realtimeforum.RoleModerator)
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/search"
+)
+
+// Search parses input and returns one page of its results for viewerID, best first, and whether
+// there are more. Pages are numbered from 1. Parse errors, such as search.ErrEmptyQuery, are
+// returned as they are.
+func (fs *ForumService) Search(viewerID int64, input string, page, pageSize int) ([]realtimeforum.SearchResult, bool, error) {
+	q, err := search.Parse(input)
+	if err != nil {
+		return nil, false, err
+	}
+	// One more result than asked for tells whether there is a next page
+	results, err := fs.Store.Search(q, viewerID, (page-1)*pageSize, pageSize+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(results) > pageSize {
+		return results[:pageSize], true, nil
+	}
+	return results, false, nil
+}
@@ -0,0 +1,124 @@
+package memstore
+
+import (
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// CreateAttachment stores a new upload, not attached to anything yet, and returns its ID.
+func (s *Store) CreateAttachment(a realtimeforum.Attachment) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	id := s.nextAttachmentID
+	s.nextAttachmentID++
+	a.AttachmentID = int(id)
+	a.PostID, a.MessageID = 0, 0
+	a.HasThumbnail = a.ThumbnailKey != ""
+	a.CreatedAt = timestamp(a.CreatedAt)
+	s.attachments = append(s.attachments, a)
+	return id, nil
+}
+
+// GetAttachment returns an attachment, or storage.ErrNotFound.
+func (s *Store) GetAttachment(attachmentID int64) (realtimeforum.Attachment, error) {
+	if err := s.lock(); err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+	defer s.mu.Unlock()
+
+	for _, a := range s.attachments {
+		if int64(a.AttachmentID) == attachmentID {
+			return a, nil
+		}
+	}
+	return realtimeforum.Attachment{}, storage.ErrNotFound
+}
+
+// GetPostAttachments returns the attachments of the given posts, keyed by post ID.
+func (s *Store) GetPostAttachments(postIDs []int64) (map[int64][]realtimeforum.Attachment, error) {
+	return s.attachmentsOf(postIDs, func(a realtimeforum.Attachment) int64 { return int64(a.PostID) })
+}
+
+// GetChatAttachments returns the attachments of the given messages, keyed by message ID.
+func (s *Store) GetChatAttachments(messageIDs []int64) (map[int64][]realtimeforum.Attachment, error) {
+	return s.attachmentsOf(messageIDs, func(a realtimeforum.Attachment) int64 { return int64(a.MessageID) })
+}
+
+// attachmentsOf returns the attachments whose owner, as returned by owner, is one of ids.
+func (s *Store) attachmentsOf(ids []int64, owner func(realtimeforum.Attachment) int64) (map[int64][]realtimeforum.Attachment, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	attachments := make(map[int64][]realtimeforum.Attachment)
+	for _, a := range s.attachments { // In ID order, like the SQL stores
+		if id := owner(a); id != 0 && wanted[id] {
+			attachments[id] = append(attachments[id], a)
+		}
+	}
+	return attachments, nil
+}
+
+// PurgeOrphanAttachments removes the uploads never attached since before cutoff, and the
+// attachments of messages that no longer exist, and returns them.
+func (s *Store) PurgeOrphanAttachments(cutoff time.Time) ([]realtimeforum.Attachment, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	messages := make(map[int64]bool, len(s.chats))
+	for _, c := range s.chats {
+		messages[c.id] = true
+	}
+	before := timestamp(cutoff)
+	var purged []realtimeforum.Attachment
+	kept := s.attachments[:0]
+	for _, a := range s.attachments {
+		unattached := a.PostID == 0 && a.MessageID == 0 && a.CreatedAt.Before(before)
+		if unattached || (a.MessageID != 0 && !messages[int64(a.MessageID)]) {
+			purged = append(purged, a)
+			continue
+		}
+		kept = append(kept, a)
+	}
+	s.attachments = kept
+	return purged, nil
+}
+
+// attach attaches the uploads of uploaderID in attachmentIDs with set, which records what they
+// are attached to, or fails with storage.ErrAttachmentUnavailable, attaching nothing, unless
+// every upload can be attached. The caller holds the lock.
+func (s *Store) attach(uploaderID int64, attachmentIDs []int64, set func(a *realtimeforum.Attachment)) error {
+	indexes := make(map[int64]int, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		indexes[id] = -1
+	}
+	for i, a := range s.attachments {
+		if _, ok := indexes[int64(a.AttachmentID)]; ok {
+			if int64(a.UploaderID) != uploaderID || a.PostID != 0 || a.MessageID != 0 {
+				return storage.ErrAttachmentUnavailable
+			}
+			indexes[int64(a.AttachmentID)] = i
+		}
+	}
+	for _, i := range indexes {
+		if i < 0 {
+			return storage.ErrAttachmentUnavailable
+		}
+	}
+	for _, i := range indexes {
+		set(&s.attachments[i])
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// bookmark is a post bookmarked by userID.
+type bookmark struct {
+	userID    int64
+	postID    int64
+	createdAt time.Time
+}
+
+// AddBookmark bookmarks a post for userID. Adding it twice is a no-op.
+func (s *Store) AddBookmark(userID, postID int64, createdAt time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, b := range s.bookmarks {
+		if b.userID == userID && b.postID == postID {
+			return nil
+		}
+	}
+	s.bookmarks = append(s.bookmarks, bookmark{userID: userID, postID: postID, createdAt: timestamp(createdAt)})
+	return nil
+}
+
+// RemoveBookmark removes a bookmark if it exists.
+func (s *Store) RemoveBookmark(userID, postID int64) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for i, b := range s.bookmarks {
+		if b.userID == userID && b.postID == postID {
+			s.bookmarks = append(s.bookmarks[:i], s.bookmarks[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// GetBookmarkedPosts returns the posts userID bookmarked that are not deleted, most recently
+// bookmarked first.
+func (s *Store) GetBookmarkedPosts(userID int64) ([]realtimeforum.Posts, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var bookmarks []bookmark
+	for _, b := range s.bookmarks {
+		if b.userID == userID {
+			bookmarks = append(bookmarks, b)
+		}
+	}
+	sort.Slice(bookmarks, func(i, j int) bool {
+		if !bookmarks[i].createdAt.Equal(bookmarks[j].createdAt) {
+			return bookmarks[i].createdAt.After(bookmarks[j].createdAt)
+		}
+		return bookmarks[i].postID > bookmarks[j].postID
+	})
+
+	var posts []realtimeforum.Posts
+	for _, b := range bookmarks {
+		if i, ok := s.postIndex(b.postID); ok && s.posts[i].DeletedAt == nil {
+			posts = append(posts, s.posts[i])
+		}
+	}
+	return posts, nil
+}
@@ -0,0 +1,275 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// chat is a stored message. The sender's username is looked up when the message is read.
+type chat struct {
+	id              int64
+	senderID        int64
+	receiverID      int64
+	content         string
+	contentHTML     string
+	sentAt          time.Time
+	clientMessageID string
+	deliveredAt     *time.Time
+	editedAt        *time.Time
+	deletedAt       *time.Time
+}
+
+// revision is content replaced by an edit.
+type revision struct {
+	messageID int64
+	content   string
+	revisedAt time.Time
+}
+
+// view returns the message as the services see it. Like the join of the SQL stores, a message
+// whose sender no longer exists is not found. The caller holds the lock.
+func (s *Store) view(c *chat) (realtimeforum.Chats, bool) {
+	sender, ok := s.user(c.senderID)
+	if !ok {
+		return realtimeforum.Chats{}, false
+	}
+	view := realtimeforum.Chats{
+		MessageID:       int(c.id),
+		SenderID:        int(c.senderID),
+		ReceiverID:      int(c.receiverID),
+		MessageContent:  c.content,
+		MessageHTML:     c.contentHTML,
+		SentAt:          c.sentAt,
+		SenderUsername:  sender.Username,
+		ClientMessageID: c.clientMessageID,
+		DeliveredAt:     copyTime(c.deliveredAt),
+		EditedAt:        copyTime(c.editedAt),
+	}
+	// The content of deleted messages never leaves the store
+	if c.deletedAt != nil {
+		view.Deleted = true
+		view.MessageContent, view.MessageHTML = "", ""
+	}
+	return view, true
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
+
+// find returns the message with the given ID and its view, or storage.ErrNotFound.
+// The caller holds the lock.
+func (s *Store) find(messageID int64) (*chat, realtimeforum.Chats, error) {
+	for _, c := range s.chats {
+		if c.id == messageID {
+			if view, ok := s.view(c); ok {
+				return c, view, nil
+			}
+			break
+		}
+	}
+	return nil, realtimeforum.Chats{}, storage.ErrNotFound
+}
+
+// SaveChat stores a new message and returns its ID. A sender cannot reuse a client message ID.
+func (s *Store) SaveChat(message realtimeforum.Chats) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	if message.ClientMessageID != "" {
+		for _, c := range s.chats {
+			if c.senderID == int64(message.SenderID) && c.clientMessageID == message.ClientMessageID {
+				return 0, uniqueViolation("Chats", "sender_id, Chats.client_message_id")
+			}
+		}
+	}
+	id := s.nextMessageID
+	err := s.attach(int64(message.SenderID), message.AttachmentIDs, func(a *realtimeforum.Attachment) { a.MessageID = int(id) })
+	if err != nil {
+		return 0, err
+	}
+	s.nextMessageID++
+	s.chats = append(s.chats, &chat{
+		id:              id,
+		senderID:        int64(message.SenderID),
+		receiverID:      int64(message.ReceiverID),
+		content:         message.MessageContent,
+		contentHTML:     message.MessageHTML,
+		sentAt:          timestamp(message.SentAt),
+		clientMessageID: message.ClientMessageID,
+	})
+	return id, nil
+}
+
+// GetChat returns a single message, or storage.ErrNotFound.
+func (s *Store) GetChat(messageID int64) (realtimeforum.Chats, error) {
+	if err := s.lock(); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	defer s.mu.Unlock()
+
+	_, view, err := s.find(messageID)
+	return view, err
+}
+
+// GetChatByClientID returns storage.ErrNotFound if the sender never stored a message with that client ID.
+func (s *Store) GetChatByClientID(senderID int64, clientMessageID string) (realtimeforum.Chats, error) {
+	if err := s.lock(); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	defer s.mu.Unlock()
+
+	for _, c := range s.chats {
+		if c.senderID == senderID && c.clientMessageID != "" && c.clientMessageID == clientMessageID {
+			if view, ok := s.view(c); ok {
+				return view, nil
+			}
+		}
+	}
+	return realtimeforum.Chats{}, storage.ErrNotFound
+}
+
+// GetChatHistory returns the messages exchanged between two users, oldest first.
+func (s *Store) GetChatHistory(userA, userB int64) ([]realtimeforum.Chats, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var chats []realtimeforum.Chats
+	for _, c := range s.chats {
+		if (c.senderID == userA && c.receiverID == userB) || (c.senderID == userB && c.receiverID == userA) {
+			if view, ok := s.view(c); ok {
+				chats = append(chats, view)
+			}
+		}
+	}
+	// Messages are kept in ID order, so a stable sort keeps it for equal times
+	sort.SliceStable(chats, func(i, j int) bool { return chats[i].SentAt.Before(chats[j].SentAt) })
+	return chats, nil
+}
+
+// MarkChatDelivered records the first time a message reached a recipient connection.
+func (s *Store) MarkChatDelivered(messageID int64, deliveredAt time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, c := range s.chats {
+		if c.id == messageID && c.deliveredAt == nil {
+			at := timestamp(deliveredAt)
+			c.deliveredAt = &at
+		}
+	}
+	return nil
+}
+
+// changeChat applies change to a message if check allows it. Holding the lock for the whole
+// call gives the same guarantee as the transaction of the SQL stores.
+func (s *Store) changeChat(messageID int64, check storage.ChangeCheck, change func(c *chat, view *realtimeforum.Chats)) (realtimeforum.Chats, error) {
+	if err := s.lock(); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	defer s.mu.Unlock()
+
+	c, view, err := s.find(messageID)
+	if err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	if err := check(view); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	change(c, &view)
+	return view, nil
+}
+
+// EditChat keeps the current content as a revision and replaces it, if check allows it.
+func (s *Store) EditChat(messageID int64, content, contentHTML string, editedAt time.Time, check storage.ChangeCheck) (realtimeforum.Chats, error) {
+	return s.changeChat(messageID, check, func(c *chat, view *realtimeforum.Chats) {
+		s.revisions = append(s.revisions, revision{messageID: messageID, content: view.MessageContent, revisedAt: timestamp(editedAt)})
+		at := timestamp(editedAt)
+		c.content, c.contentHTML = content, contentHTML
+		c.editedAt = &at
+		view.MessageContent, view.MessageHTML = content, contentHTML
+		view.EditedAt = &editedAt
+	})
+}
+
+// DeleteChat soft-deletes a message, if check allows it.
+func (s *Store) DeleteChat(messageID int64, deletedAt time.Time, check storage.ChangeCheck) (realtimeforum.Chats, error) {
+	return s.changeChat(messageID, check, func(c *chat, view *realtimeforum.Chats) {
+		if c.deletedAt == nil {
+			at := timestamp(deletedAt)
+			c.deletedAt = &at
+		}
+		view.Deleted = true
+		view.MessageContent, view.MessageHTML = "", ""
+	})
+}
+
+// PurgeDeletedChats permanently removes messages deleted before cutoff, together with their
+// revisions and reactions, and returns the number of messages removed.
+func (s *Store) PurgeDeletedChats(cutoff time.Time) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	before := timestamp(cutoff)
+	purged := make(map[int64]bool)
+	kept := s.chats[:0]
+	for _, c := range s.chats {
+		if c.deletedAt != nil && c.deletedAt.Before(before) {
+			purged[c.id] = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	s.chats = kept
+
+	revisions := s.revisions[:0]
+	for _, r := range s.revisions {
+		if !purged[r.messageID] {
+			revisions = append(revisions, r)
+		}
+	}
+	s.revisions = revisions
+
+	reactions := s.reactions[:0]
+	for _, r := range s.reactions {
+		if !purged[r.messageID] {
+			reactions = append(reactions, r)
+		}
+	}
+	s.reactions = reactions
+	return int64(len(purged)), nil
+}
+
+// PurgeChatRevisions removes the edit history recorded before cutoff and returns the number of revisions removed.
+func (s *Store) PurgeChatRevisions(cutoff time.Time) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	before := timestamp(cutoff)
+	kept := s.revisions[:0]
+	for _, r := range s.revisions {
+		if !r.revisedAt.Before(before) {
+			kept = append(kept, r)
+		}
+	}
+	removed := len(s.revisions) - len(kept)
+	s.revisions = kept
+	return int64(removed), nil
+}
@@ -0,0 +1,70 @@
+package memstore
+
+import (
+	"sort"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// CreateComment stores a new comment and returns its ID.
+func (s *Store) CreateComment(comment realtimeforum.Comments) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	id := s.nextCommentID
+	s.nextCommentID++
+	comment.CommentID = int(id)
+	comment.CreatedAt = comment.CreatedAt.Round(0)
+	comment.AuthorUsername = ""
+	s.comments = append(s.comments, comment)
+	return id, nil
+}
+
+// GetComment returns a single comment, or storage.ErrNotFound.
+func (s *Store) GetComment(commentID int64) (realtimeforum.Comments, error) {
+	if err := s.lock(); err != nil {
+		return realtimeforum.Comments{}, err
+	}
+	defer s.mu.Unlock()
+
+	for _, comment := range s.comments {
+		if int64(comment.CommentID) == commentID {
+			if comment, ok := s.withAuthor(comment); ok {
+				return comment, nil
+			}
+		}
+	}
+	return realtimeforum.Comments{}, storage.ErrNotFound
+}
+
+// GetComments returns the comments of a post, oldest first.
+func (s *Store) GetComments(postID int64) ([]realtimeforum.Comments, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	comments := []realtimeforum.Comments{}
+	for _, comment := range s.comments {
+		if int64(comment.PostID) != postID {
+			continue
+		}
+		if comment, ok := s.withAuthor(comment); ok {
+			comments = append(comments, comment)
+		}
+	}
+	// Comments are appended in ID order, so a stable sort keeps it for equal times
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt.Before(comments[j].CreatedAt) })
+	return comments, nil
+}
+
+// withAuthor fills in the username of the author of a comment. Like the join of the SQL
+// stores, it reports false when the author no longer exists. The caller holds the lock.
+func (s *Store) withAuthor(comment realtimeforum.Comments) (realtimeforum.Comments, bool) {
+	author, ok := s.user(int64(comment.AuthorID))
+	comment.AuthorUsername = author.Username
+	return comment, ok
+}
@@ -0,0 +1,132 @@
+// Package memstore implements the storage repositories in memory. It behaves like the SQLite
+// store of package sqlstore: the same uniqueness errors, ordering and timestamp precision, so
+// handlers and the WebSocket hub can be exercised quickly without a database file.
+//
+//	store := memstore.New()
+//	forumService := service.NewForumService(store)
+//
+// Nothing is persisted; every Store starts empty.
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// ErrUniqueConstraint is returned, wrapped with the table and column, when a row would
+// duplicate a unique value, as SQLite fails with "UNIQUE constraint failed".
+var ErrUniqueConstraint = errors.New("UNIQUE constraint failed")
+
+// ErrClosed is returned by every method once the store is closed.
+var ErrClosed = errors.New("memstore: store is closed")
+
+// Store implements storage.Store in memory. It is safe for concurrent use; a single mutex
+// serializes every call, like the database lock taken by a SQLite write.
+type Store struct {
+	mu     sync.Mutex
+	closed bool
+
+	// Each table keeps the next ID to hand out; like AUTOINCREMENT, IDs are never reused
+	users              []realtimeforum.User
+	nextUserID         int64
+	roles              map[int64]string // Roles other than the default, by user ID
+	posts              []realtimeforum.Posts
+	nextPostID         int64
+	postRevisions      []realtimeforum.PostRevision
+	nextPostRevisionID int64
+	comments           []realtimeforum.Comments
+	nextCommentID      int64
+	chats              []*chat
+	nextMessageID      int64
+	attachments        []realtimeforum.Attachment
+	nextAttachmentID   int64
+	polls              map[int64]*poll // By post ID
+	nextPollOptionID   int64
+	revisions          []revision
+	reactions          []reaction
+	relations          []relation
+	bookmarks          []bookmark
+	watches            []watch
+	notifications      []realtimeforum.Notification // ActorUsername, PostTitle and CategoryID are left empty
+	nextNotificationID int64
+	lastActivities     map[int64]time.Time
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// New returns an empty store.
+func New() *Store {
+	return &Store{
+		nextUserID:         1,
+		roles:              make(map[int64]string),
+		nextPostID:         1,
+		nextPostRevisionID: 1,
+		nextCommentID:      1,
+		nextMessageID:      1,
+		nextAttachmentID:   1,
+		polls:              make(map[int64]*poll),
+		nextPollOptionID:   1,
+		nextNotificationID: 1,
+		lastActivities:     make(map[int64]time.Time),
+	}
+}
+
+// lock acquires the store, or returns ErrClosed. Callers defer s.mu.Unlock() on success.
+func (s *Store) lock() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// Migrate does nothing: the store has no schema.
+func (s *Store) Migrate() error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// CheckMigrations never reports pending migrations.
+func (s *Store) CheckMigrations(ctx context.Context) error {
+	return s.Ping(ctx)
+}
+
+// Ping only fails once the store is closed.
+func (s *Store) Ping(ctx context.Context) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	s.mu.Unlock()
+	return ctx.Err()
+}
+
+// Close discards the data. Closing twice is a no-op, as for *sql.DB.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.users, s.roles, s.posts, s.postRevisions, s.comments, s.chats = nil, nil, nil, nil, nil, nil
+	s.attachments, s.polls, s.revisions, s.reactions, s.relations, s.lastActivities = nil, nil, nil, nil, nil, nil
+	s.bookmarks, s.watches, s.notifications = nil, nil, nil
+	return nil
+}
+
+// uniqueViolation builds the error of a duplicate value in table.column.
+func uniqueViolation(table, column string) error {
+	return fmt.Errorf("%w: %s.%s", ErrUniqueConstraint, table, column)
+}
+
+// timestamp truncates t the way the SQL stores keep it: UTC, to the second.
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,21 @@
+package memstore_test
+
+import (
+	"testing"
+	"time"
+
+	"livechat-system/backend/storage"
+	"livechat-system/backend/storage/memstore"
+	"livechat-system/backend/storage/storagetest"
+)
+
+func TestMemstore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store { return memstore.New() })
+}
+
+// TestObserved checks that timing the calls to a store changes nothing about them.
+func TestObserved(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.Observe(memstore.New(), func(string, time.Duration) {})
+	})
+}
@@ -0,0 +1,190 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// watch is a post or a category watched by userID.
+type watch struct {
+	userID    int64
+	kind      string
+	targetID  int64
+	createdAt time.Time
+}
+
+// AddWatch records that userID watches a post or a category. Adding it twice is a no-op.
+func (s *Store) AddWatch(userID int64, kind string, targetID int64, createdAt time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, w := range s.watches {
+		if w.userID == userID && w.kind == kind && w.targetID == targetID {
+			return nil
+		}
+	}
+	s.watches = append(s.watches, watch{userID: userID, kind: kind, targetID: targetID, createdAt: timestamp(createdAt)})
+	return nil
+}
+
+// RemoveWatch removes a watch if it exists.
+func (s *Store) RemoveWatch(userID int64, kind string, targetID int64) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for i, w := range s.watches {
+		if w.userID == userID && w.kind == kind && w.targetID == targetID {
+			s.watches = append(s.watches[:i], s.watches[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// ListWatches returns the posts and categories userID watches, most recent first.
+func (s *Store) ListWatches(userID int64) ([]realtimeforum.Watch, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	watches := []realtimeforum.Watch{}
+	for _, w := range s.watches {
+		if w.userID == userID {
+			watches = append(watches, realtimeforum.Watch{UserID: int(w.userID), Kind: w.kind, TargetID: int(w.targetID), CreatedAt: w.createdAt})
+		}
+	}
+	sort.Slice(watches, func(i, j int) bool {
+		if !watches[i].CreatedAt.Equal(watches[j].CreatedAt) {
+			return watches[i].CreatedAt.After(watches[j].CreatedAt)
+		}
+		if watches[i].Kind != watches[j].Kind {
+			return watches[i].Kind < watches[j].Kind
+		}
+		return watches[i].TargetID < watches[j].TargetID
+	})
+	return watches, nil
+}
+
+// GetWatchers returns the set of users who watch the post or the category targetID.
+func (s *Store) GetWatchers(kind string, targetID int64) (map[int64]bool, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	watchers := make(map[int64]bool)
+	for _, w := range s.watches {
+		if w.kind == kind && w.targetID == targetID {
+			watchers[w.userID] = true
+		}
+	}
+	return watchers, nil
+}
+
+// CreateNotifications stores a copy of notification for each of userIDs and returns their IDs in
+// the same order.
+func (s *Store) CreateNotifications(notification realtimeforum.Notification, userIDs []int64) ([]int64, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]int64, len(userIDs))
+	for i, userID := range userIDs {
+		stored := realtimeforum.Notification{
+			NotificationID: int(s.nextNotificationID),
+			UserID:         int(userID),
+			Kind:           notification.Kind,
+			ActorID:        notification.ActorID,
+			PostID:         notification.PostID,
+			CommentID:      notification.CommentID,
+			CreatedAt:      timestamp(notification.CreatedAt),
+		}
+		s.notifications = append(s.notifications, stored)
+		ids[i] = s.nextNotificationID
+		s.nextNotificationID++
+	}
+	return ids, nil
+}
+
+// GetNotifications returns up to limit notifications of userID, most recent first, starting
+// before beforeID unless it is 0.
+func (s *Store) GetNotifications(userID, beforeID int64, limit int) ([]realtimeforum.Notification, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	notifications := []realtimeforum.Notification{}
+	// Notifications are kept in ID order
+	for i := len(s.notifications) - 1; i >= 0 && len(notifications) < limit; i-- {
+		n := s.notifications[i]
+		if int64(n.UserID) != userID || (beforeID != 0 && int64(n.NotificationID) >= beforeID) {
+			continue
+		}
+		actor, ok := s.user(int64(n.ActorID))
+		if !ok {
+			continue
+		}
+		p, ok := s.postIndex(int64(n.PostID))
+		if !ok {
+			continue
+		}
+		n.ActorUsername = actor.Username
+		n.PostTitle = s.posts[p].Title
+		n.CategoryID = s.posts[p].CategoryID
+		if n.ReadAt != nil {
+			readAt := *n.ReadAt
+			n.ReadAt = &readAt
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks the unread notifications of userID up to upToID, or all of them
+// when upToID is 0, as read at readAt, and returns how many it marked.
+func (s *Store) MarkNotificationsRead(userID, upToID int64, readAt time.Time) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	var marked int64
+	for i := range s.notifications {
+		n := &s.notifications[i]
+		if int64(n.UserID) != userID || n.ReadAt != nil || (upToID != 0 && int64(n.NotificationID) > upToID) {
+			continue
+		}
+		read := timestamp(readAt)
+		n.ReadAt = &read
+		marked++
+	}
+	return marked, nil
+}
+
+// CountUnreadNotifications returns the number of notifications of userID not read yet.
+func (s *Store) CountUnreadNotifications(userID int64) (int, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	unread := 0
+	for _, n := range s.notifications {
+		if int64(n.UserID) == userID && n.ReadAt == nil {
+			unread++
+		}
+	}
+	return unread, nil
+}
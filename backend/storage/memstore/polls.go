@@ -0,0 +1,132 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// poll is a row of Polls with its options and votes.
+type poll struct {
+	multiple  bool
+	anonymous bool
+	closesAt  *time.Time
+	options   []realtimeforum.PollOption // OptionID and Text only
+	votedAt   map[int64]time.Time        // By voter
+	votes     map[int64][]int64          // Options chosen, by voter
+}
+
+// createPoll stores the poll of a new post. The caller holds the lock.
+func (s *Store) createPoll(postID int64, definition realtimeforum.Poll) {
+	p := &poll{
+		multiple:  definition.Multiple,
+		anonymous: definition.Anonymous,
+		votedAt:   make(map[int64]time.Time),
+		votes:     make(map[int64][]int64),
+	}
+	if definition.ClosesAt != nil {
+		closesAt := definition.ClosesAt.Round(0)
+		p.closesAt = &closesAt
+	}
+	for _, option := range definition.Options {
+		p.options = append(p.options, realtimeforum.PollOption{OptionID: int(s.nextPollOptionID), Text: option.Text})
+		s.nextPollOptionID++
+	}
+	s.polls[postID] = p
+}
+
+// GetPolls returns the polls of the given posts, keyed by post ID, with their votes counted, the
+// options viewerID voted for and the voters of the polls that are not anonymous.
+func (s *Store) GetPolls(postIDs []int64, viewerID int64) (map[int64]realtimeforum.Poll, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	polls := make(map[int64]realtimeforum.Poll)
+	for _, postID := range postIDs {
+		p, ok := s.polls[postID]
+		if !ok {
+			continue
+		}
+		result := realtimeforum.Poll{
+			PostID:    int(postID),
+			Multiple:  p.multiple,
+			Anonymous: p.anonymous,
+			Options:   make([]realtimeforum.PollOption, len(p.options)),
+			Voters:    len(p.votedAt),
+		}
+		if p.closesAt != nil {
+			closesAt := *p.closesAt
+			result.ClosesAt = &closesAt
+		}
+		index := make(map[int64]int, len(p.options))
+		for i, option := range p.options {
+			result.Options[i] = option
+			index[int64(option.OptionID)] = i
+		}
+		for voterID, optionIDs := range p.votes {
+			username := ""
+			if user, ok := s.user(voterID); ok {
+				username = user.Username
+			}
+			for _, optionID := range optionIDs {
+				option := &result.Options[index[optionID]]
+				option.Votes++
+				if !p.anonymous {
+					option.Voters = append(option.Voters, username)
+				}
+				if voterID == viewerID {
+					result.MyVotes = append(result.MyVotes, int(optionID))
+				}
+			}
+		}
+		for _, option := range result.Options {
+			sort.Strings(option.Voters)
+		}
+		sort.Ints(result.MyVotes)
+		polls[postID] = result
+	}
+	return polls, nil
+}
+
+// CastVote records the vote of userID for the given options of the poll of a post, or fails
+// with storage.ErrNotFound, storage.ErrPollClosed or storage.ErrAlreadyVoted, recording nothing.
+func (s *Store) CastVote(postID, userID int64, optionIDs []int64, votedAt time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	p, ok := s.polls[postID]
+	if !ok || len(optionIDs) == 0 {
+		return storage.ErrNotFound
+	}
+	if p.closesAt != nil && !votedAt.Before(*p.closesAt) {
+		return storage.ErrPollClosed
+	}
+	if _, voted := p.votedAt[userID]; voted {
+		return storage.ErrAlreadyVoted
+	}
+
+	valid := make(map[int64]bool, len(p.options))
+	for _, option := range p.options {
+		valid[int64(option.OptionID)] = true
+	}
+	chosen := make(map[int64]bool, len(optionIDs))
+	var votes []int64
+	for _, optionID := range optionIDs {
+		if !valid[optionID] {
+			return storage.ErrNotFound
+		}
+		if !chosen[optionID] {
+			chosen[optionID] = true
+			votes = append(votes, optionID)
+		}
+	}
+	p.votedAt[userID] = votedAt.Round(0)
+	p.votes[userID] = votes
+	return nil
+}
@@ -0,0 +1,179 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// CreatePost stores a new post with its attachments and returns its ID.
+func (s *Store) CreatePost(post realtimeforum.Posts) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	id := s.nextPostID
+	err := s.attach(int64(post.UserID), post.AttachmentIDs, func(a *realtimeforum.Attachment) { a.PostID = int(id) })
+	if err != nil {
+		return 0, err
+	}
+	s.nextPostID++
+	post.PostID = int(id)
+	if post.Poll != nil {
+		s.createPoll(id, *post.Poll)
+	}
+	post.AttachmentIDs, post.Attachments, post.Poll = nil, nil, nil
+	post.CreatedAt = post.CreatedAt.Round(0) // Drop the monotonic clock reading, which a database cannot keep
+	post.EditedAt, post.DeletedAt, post.DeletedBy = nil, nil, 0
+	s.posts = append(s.posts, post)
+	return id, nil
+}
+
+// GetPost returns a post, deleted or not, or storage.ErrNotFound.
+func (s *Store) GetPost(postID int64) (realtimeforum.Posts, error) {
+	if err := s.lock(); err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	defer s.mu.Unlock()
+
+	i, ok := s.postIndex(postID)
+	if !ok {
+		return realtimeforum.Posts{}, storage.ErrNotFound
+	}
+	return s.posts[i], nil
+}
+
+// GetAllPosts returns the posts that are not deleted, in the order they were created.
+func (s *Store) GetAllPosts() ([]realtimeforum.Posts, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var posts []realtimeforum.Posts
+	for _, post := range s.posts {
+		if post.DeletedAt == nil {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+// GetPostsVisibleTo returns every post except those written by users the viewer has blocked.
+func (s *Store) GetPostsVisibleTo(viewerID int64) ([]realtimeforum.Posts, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	blocked := s.relationTargets(viewerID, realtimeforum.RelationBlock)
+	var posts []realtimeforum.Posts
+	for _, post := range s.posts {
+		if post.DeletedAt == nil && !blocked[int64(post.UserID)] {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+// GetDeletedPosts returns the deleted posts, most recently deleted first.
+func (s *Store) GetDeletedPosts() ([]realtimeforum.Posts, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var posts []realtimeforum.Posts
+	for _, post := range s.posts {
+		if post.DeletedAt != nil {
+			posts = append(posts, post)
+		}
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].DeletedAt.Equal(*posts[j].DeletedAt) {
+			return posts[i].DeletedAt.After(*posts[j].DeletedAt)
+		}
+		return posts[i].PostID > posts[j].PostID
+	})
+	return posts, nil
+}
+
+// EditPost keeps the current version of a post as a revision and replaces it, if check allows it.
+func (s *Store) EditPost(postID, editorID int64, edit realtimeforum.PostEdit, editedAt time.Time, check storage.PostCheck) (realtimeforum.Posts, error) {
+	return s.changePost(postID, check, func(post *realtimeforum.Posts) {
+		at := editedAt.Round(0)
+		s.postRevisions = append(s.postRevisions, realtimeforum.PostRevision{
+			RevisionID: int(s.nextPostRevisionID), PostID: post.PostID, Title: post.Title, Content: post.Content,
+			CategoryID: post.CategoryID, EditorID: int(editorID), RevisedAt: at,
+		})
+		s.nextPostRevisionID++
+		post.Title, post.Content, post.ContentHTML, post.CategoryID = edit.Title, edit.Content, edit.ContentHTML, edit.CategoryID
+		post.EditedAt = &at
+	})
+}
+
+// DeletePost soft-deletes a post, if check allows it. Its comments and revisions are kept.
+func (s *Store) DeletePost(postID, deletedBy int64, deletedAt time.Time, check storage.PostCheck) (realtimeforum.Posts, error) {
+	return s.changePost(postID, check, func(post *realtimeforum.Posts) {
+		if post.DeletedAt == nil {
+			at := deletedAt.Round(0)
+			post.DeletedAt = &at
+			post.DeletedBy = int(deletedBy)
+		}
+	})
+}
+
+// changePost applies change to a post if check allows it, and returns the changed post.
+func (s *Store) changePost(postID int64, check storage.PostCheck, change func(post *realtimeforum.Posts)) (realtimeforum.Posts, error) {
+	if err := s.lock(); err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	defer s.mu.Unlock()
+
+	i, ok := s.postIndex(postID)
+	if !ok {
+		return realtimeforum.Posts{}, storage.ErrNotFound
+	}
+	if err := check(s.posts[i]); err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	change(&s.posts[i])
+	return s.posts[i], nil
+}
+
+// GetPostRevisions returns the versions of a post replaced by edits, oldest first.
+func (s *Store) GetPostRevisions(postID int64) ([]realtimeforum.PostRevision, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var revisions []realtimeforum.PostRevision
+	for _, r := range s.postRevisions {
+		if int64(r.PostID) != postID {
+			continue
+		}
+		// Like the join of the SQL stores, revisions by users who no longer exist are skipped
+		editor, ok := s.user(int64(r.EditorID))
+		if !ok {
+			continue
+		}
+		r.EditorUsername = editor.Username
+		revisions = append(revisions, r)
+	}
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].RevisedAt.Before(revisions[j].RevisedAt) })
+	return revisions, nil
+}
+
+// postIndex returns the index of a post in s.posts. The caller holds the lock.
+func (s *Store) postIndex(postID int64) (int, bool) {
+	for i, post := range s.posts {
+		if int64(post.PostID) == postID {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package memstore
+
+import (
+	"time"
+)
+
+// TouchUser records activity of userID.
+func (s *Store) TouchUser(userID int64, at time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	s.lastActivities[userID] = timestamp(at)
+	return nil
+}
+
+// RemoveInactiveUsers forgets the users whose last activity is older than cutoff.
+func (s *Store) RemoveInactiveUsers(cutoff time.Time) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	before := timestamp(cutoff)
+	var removed int64
+	for userID, lastActivity := range s.lastActivities {
+		if lastActivity.Before(before) {
+			delete(s.lastActivities, userID)
+			removed++
+		}
+	}
+	return removed, nil
+}
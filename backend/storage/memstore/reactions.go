@@ -0,0 +1,99 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// reaction is one user's emoji on a message.
+type reaction struct {
+	messageID int64
+	userID    int64
+	emoji     string
+	createdAt time.Time
+}
+
+// AddReaction records a reaction. Reacting twice with the same emoji is a no-op.
+func (s *Store) AddReaction(messageID, userID int64, emoji string, createdAt time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, r := range s.reactions {
+		if r.messageID == messageID && r.userID == userID && r.emoji == emoji {
+			return nil
+		}
+	}
+	s.reactions = append(s.reactions, reaction{messageID: messageID, userID: userID, emoji: emoji, createdAt: timestamp(createdAt)})
+	return nil
+}
+
+// RemoveReaction removes a reaction if it exists.
+func (s *Store) RemoveReaction(messageID, userID int64, emoji string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for i, r := range s.reactions {
+		if r.messageID == messageID && r.userID == userID && r.emoji == emoji {
+			s.reactions = append(s.reactions[:i], s.reactions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// GetReactions returns the reactions of the given messages, aggregated per emoji
+// and keyed by message ID. Emoji are ordered by when they were first used on the message.
+func (s *Store) GetReactions(messageIDs []int64) (map[int64][]realtimeforum.ReactionSummary, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	wanted := make(map[int64]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+	var selected []reaction
+	for _, r := range s.reactions {
+		if wanted[r.messageID] {
+			selected = append(selected, r)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		if !selected[i].createdAt.Equal(selected[j].createdAt) {
+			return selected[i].createdAt.Before(selected[j].createdAt)
+		}
+		return selected[i].userID < selected[j].userID
+	})
+
+	reactions := make(map[int64][]realtimeforum.ReactionSummary)
+	for _, r := range selected {
+		summaries := reactions[r.messageID]
+		found := false
+		for i := range summaries {
+			if summaries[i].Emoji == r.emoji {
+				summaries[i].Count++
+				summaries[i].UserIDs = append(summaries[i].UserIDs, r.userID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			summaries = append(summaries, realtimeforum.ReactionSummary{Emoji: r.emoji, Count: 1, UserIDs: []int64{r.userID}})
+		}
+		reactions[r.messageID] = summaries
+	}
+
+	for _, summaries := range reactions {
+		for _, summary := range summaries {
+			sort.Slice(summary.UserIDs, func(i, j int) bool { return summary.UserIDs[i] < summary.UserIDs[j] })
+		}
+	}
+	return reactions, nil
+}
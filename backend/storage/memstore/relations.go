@@ -0,0 +1,129 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// relation is a block or a mute of targetID by userID.
+type relation struct {
+	userID    int64
+	targetID  int64
+	kind      string
+	createdAt time.Time
+}
+
+// AddUserRelation records that userID blocks or mutes targetID. Adding it twice is a no-op.
+func (s *Store) AddUserRelation(userID, targetID int64, kind string, createdAt time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, r := range s.relations {
+		if r.userID == userID && r.targetID == targetID && r.kind == kind {
+			return nil
+		}
+	}
+	s.relations = append(s.relations, relation{userID: userID, targetID: targetID, kind: kind, createdAt: timestamp(createdAt)})
+	return nil
+}
+
+// RemoveUserRelation removes a block or mute if it exists.
+func (s *Store) RemoveUserRelation(userID, targetID int64, kind string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for i, r := range s.relations {
+		if r.userID == userID && r.targetID == targetID && r.kind == kind {
+			s.relations = append(s.relations[:i], s.relations[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// ListUserRelations returns the users that userID has blocked or muted, most recent first.
+// Relations with a user that no longer exists are left out.
+func (s *Store) ListUserRelations(userID int64, kind string) ([]realtimeforum.UserRelation, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	relations := []realtimeforum.UserRelation{}
+	for _, r := range s.relations {
+		if r.userID != userID || r.kind != kind {
+			continue
+		}
+		target, ok := s.user(r.targetID)
+		if !ok {
+			continue
+		}
+		relations = append(relations, realtimeforum.UserRelation{
+			UserID:         int(r.userID),
+			TargetID:       int(r.targetID),
+			TargetUsername: target.Username,
+			Kind:           r.kind,
+			CreatedAt:      r.createdAt,
+		})
+	}
+	sort.Slice(relations, func(i, j int) bool {
+		if !relations[i].CreatedAt.Equal(relations[j].CreatedAt) {
+			return relations[i].CreatedAt.After(relations[j].CreatedAt)
+		}
+		return relations[i].TargetID < relations[j].TargetID
+	})
+	return relations, nil
+}
+
+// HasUserRelation reports whether userID has blocked or muted targetID.
+func (s *Store) HasUserRelation(userID, targetID int64, kind string) (bool, error) {
+	if err := s.lock(); err != nil {
+		return false, err
+	}
+	defer s.mu.Unlock()
+
+	return s.relationTargets(userID, kind)[targetID], nil
+}
+
+// GetRelationTargets returns the set of users that userID has blocked or muted.
+func (s *Store) GetRelationTargets(userID int64, kind string) (map[int64]bool, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	return s.relationTargets(userID, kind), nil
+}
+
+// GetRelationOwners returns the set of users who have blocked or muted targetID.
+func (s *Store) GetRelationOwners(targetID int64, kind string) (map[int64]bool, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	owners := make(map[int64]bool)
+	for _, r := range s.relations {
+		if r.targetID == targetID && r.kind == kind {
+			owners[r.userID] = true
+		}
+	}
+	return owners, nil
+}
+
+// relationTargets returns the users userID has a relation of this kind with. The caller holds the lock.
+func (s *Store) relationTargets(userID int64, kind string) map[int64]bool {
+	targets := make(map[int64]bool)
+	for _, r := range s.relations {
+		if r.userID == userID && r.kind == kind {
+			targets[r.targetID] = true
+		}
+	}
+	return targets
+}
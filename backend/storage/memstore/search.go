@@ -0,0 +1,80 @@
+package memstore
+
+import (
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/search"
+)
+
+// Search ranks the documents with search.Query.Evaluate, as the SQL stores do without a
+// full-text index. Like their joins, documents whose author no longer exists are skipped, and
+// so are those of authors the viewer has blocked.
+func (s *Store) Search(q search.Query, viewerID int64, offset, limit int) ([]realtimeforum.SearchResult, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	blocked := s.relationTargets(viewerID, realtimeforum.RelationBlock)
+	var results []realtimeforum.SearchResult
+	// add evaluates one document and keeps it if it matches
+	add := func(result realtimeforum.SearchResult, fields ...search.Field) {
+		author, ok := s.user(result.AuthorID)
+		if !ok || blocked[result.AuthorID] || (q.Author != "" && author.Username != q.Author) || !q.InRange(result.CreatedAt) {
+			return
+		}
+		score, snippet, ok := q.Evaluate(fields...)
+		if !ok {
+			return
+		}
+		result.AuthorUsername, result.Score, result.Snippet = author.Username, score, snippet
+		results = append(results, result)
+	}
+
+	posts := make(map[int64]realtimeforum.Posts, len(s.posts))
+	for _, post := range s.posts {
+		posts[int64(post.PostID)] = post
+	}
+	if q.Includes(realtimeforum.SearchKindPost) {
+		for _, post := range s.posts {
+			if post.DeletedAt != nil || (q.Category != 0 && post.CategoryID != q.Category) {
+				continue
+			}
+			add(realtimeforum.SearchResult{
+				Kind: realtimeforum.SearchKindPost, ID: int64(post.PostID), AuthorID: int64(post.UserID),
+				Title: post.Title, CategoryID: post.CategoryID, CreatedAt: post.CreatedAt,
+			}, search.Field{Text: post.Title, Weight: search.TitleWeight}, search.Field{Text: post.Content, Weight: 1})
+		}
+	}
+	if q.Includes(realtimeforum.SearchKindComment) {
+		for _, comment := range s.comments {
+			// Like the join of the SQL stores, a comment on a missing post is not found
+			post, ok := posts[int64(comment.PostID)]
+			if !ok || post.DeletedAt != nil || (q.Category != 0 && post.CategoryID != q.Category) {
+				continue
+			}
+			add(realtimeforum.SearchResult{
+				Kind: realtimeforum.SearchKindComment, ID: int64(comment.CommentID), PostID: int64(comment.PostID),
+				AuthorID: int64(comment.AuthorID), Title: post.Title, CategoryID: post.CategoryID,
+				CreatedAt: comment.CreatedAt,
+			}, search.Field{Text: comment.Content, Weight: 1})
+		}
+	}
+	if q.Includes(realtimeforum.SearchKindChat) {
+		for _, c := range s.chats {
+			if c.deletedAt != nil || !visibleChat(c, viewerID) {
+				continue
+			}
+			add(realtimeforum.SearchResult{
+				Kind: realtimeforum.SearchKindChat, ID: c.id, ReceiverID: c.receiverID,
+				AuthorID: c.senderID, CreatedAt: c.sentAt,
+			}, search.Field{Text: c.content, Weight: 1})
+		}
+	}
+	return search.Page(results, offset, limit), nil
+}
+
+// visibleChat reports whether viewerID can see the message: it is in the lobby or in one of
+// their private conversations.
+func visibleChat(c *chat, viewerID int64) bool {
+	return c.receiverID == realtimeforum.LobbyReceiverID || c.senderID == viewerID || c.receiverID == viewerID
+}
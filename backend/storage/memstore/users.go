@@ -0,0 +1,137 @@
+package memstore
+
+import (
+	"fmt"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// GetAllUsers returns the users in the order they were created.
+func (s *Store) GetAllUsers() ([]realtimeforum.User, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	return append([]realtimeforum.User(nil), s.users...), nil
+}
+
+// CreateUser stores a new user and returns its ID. Usernames and emails are unique: a duplicate
+// fails with storage.ErrUserExists.
+func (s *Store) CreateUser(user realtimeforum.User) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return 0, fmt.Errorf("%w: %w", storage.ErrUserExists, uniqueViolation("Users", "username"))
+		}
+		if existing.Email == user.Email {
+			return 0, fmt.Errorf("%w: %w", storage.ErrUserExists, uniqueViolation("Users", "email"))
+		}
+	}
+	id := s.nextUserID
+	s.nextUserID++
+	user.UserID = int(id)
+	s.users = append(s.users, user)
+	return id, nil
+}
+
+// GetUserIDByUsername returns storage.ErrNotFound if no user has that name.
+func (s *Store) GetUserIDByUsername(username string) (int64, error) {
+	userID, _, err := s.GetCredentials(username)
+	return userID, err
+}
+
+// GetUsernameByID returns storage.ErrNotFound if the user does not exist.
+func (s *Store) GetUsernameByID(userID int64) (string, error) {
+	if err := s.lock(); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.user(userID)
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	return user.Username, nil
+}
+
+// GetCredentials returns the ID and the stored password of a user, or storage.ErrNotFound.
+func (s *Store) GetCredentials(username string) (int64, string, error) {
+	if err := s.lock(); err != nil {
+		return 0, "", err
+	}
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return int64(user.UserID), user.Password, nil
+		}
+	}
+	return 0, "", storage.ErrNotFound
+}
+
+// user looks up a user by ID. The caller holds the lock.
+func (s *Store) user(userID int64) (realtimeforum.User, bool) {
+	for _, user := range s.users {
+		if int64(user.UserID) == userID {
+			return user, true
+		}
+	}
+	return realtimeforum.User{}, false
+}
+
+// GetUserRole returns the role of a user, or storage.ErrNotFound.
+func (s *Store) GetUserRole(userID int64) (string, error) {
+	if err := s.lock(); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.user(userID); !ok {
+		return "", storage.ErrNotFound
+	}
+	return s.role(userID), nil
+}
+
+// SetUserRole changes the role of a user, or returns storage.ErrNotFound.
+func (s *Store) SetUserRole(userID int64, role string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.user(userID); !ok {
+		return storage.ErrNotFound
+	}
+	s.roles[userID] = role
+	return nil
+}
+
+// GetUsersWithRole returns the users with a role, by ID.
+func (s *Store) GetUsersWithRole(role string) ([]realtimeforum.UserRole, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var users []realtimeforum.UserRole
+	for _, user := range s.users {
+		if s.role(int64(user.UserID)) == role {
+			users = append(users, realtimeforum.UserRole{UserID: user.UserID, Username: user.Username, Role: role})
+		}
+	}
+	return users, nil
+}
+
+// role returns the role of a user, realtimeforum.RoleUser unless changed. The caller holds the lock.
+func (s *Store) role(userID int64) string {
+	if role, ok := s.roles[userID]; ok {
+		return role
+	}
+	return realtimeforum.RoleUser
+}
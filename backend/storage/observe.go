@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/search"
+)
+
+// Observe wraps store so that every call to it is reported to observe with the name of the
+// method and how long it took, whether it failed or not. Migrate and Close are not reported.
+//
+// Timing the store rather than its callers measures each query once, however many layers
+// above it call each other.
+func Observe(store Store, observe func(method string, elapsed time.Duration)) Store {
+	return observedStore{store: store, observe: observe}
+}
+
+type observedStore struct {
+	store   Store
+	observe func(method string, elapsed time.Duration)
+}
+
+// time starts timing method. The returned function reports the elapsed time:
+//
+//	defer s.time("GetAllUsers")()
+func (s observedStore) time(method string) func() {
+	start := time.Now()
+	return func() { s.observe(method, time.Since(start)) }
+}
+
+func (s observedStore) Migrate() error {
+	return s.store.Migrate()
+}
+
+func (s observedStore) CheckMigrations(ctx context.Context) error {
+	defer s.time("CheckMigrations")()
+	return s.store.CheckMigrations(ctx)
+}
+
+func (s observedStore) Ping(ctx context.Context) error {
+	defer s.time("Ping")()
+	return s.store.Ping(ctx)
+}
+
+func (s observedStore) Close() error {
+	return s.store.Close()
+}
+
+func (s observedStore) GetAllUsers() ([]realtimeforum.User, error) {
+	defer s.time("GetAllUsers")()
+	return s.store.GetAllUsers()
+}
+
+func (s observedStore) CreateUser(user realtimeforum.User) (int64, error) {
+	defer s.time("CreateUser")()
+	return s.store.CreateUser(user)
+}
+
+func (s observedStore) GetUserIDByUsername(username string) (int64, error) {
+	defer s.time("GetUserIDByUsername")()
+	return s.store.GetUserIDByUsername(username)
+}
+
+func (s observedStore) GetUsernameByID(userID int64) (string, error) {
+	defer s.time("GetUsernameByID")()
+	return s.store.GetUsernameByID(userID)
+}
+
+func (s observedStore) GetCredentials(username string) (userID int64, password string, err error) {
+	defer s.time("GetCredentials")()
+	return s.store.GetCredentials(username)
+}
+
+func (s observedStore) GetUserRole(userID int64) (string, error) {
+	defer s.time("GetUserRole")()
+	return s.store.GetUserRole(userID)
+}
+
+func (s observedStore) SetUserRole(userID int64, role string) error {
+	defer s.time("SetUserRole")()
+	return s.store.SetUserRole(userID, role)
+}
+
+func (s observedStore) GetUsersWithRole(role string) ([]realtimeforum.UserRole, error) {
+	defer s.time("GetUsersWithRole")()
+	return s.store.GetUsersWithRole(role)
+}
+
+func (s observedStore) CreatePost(post realtimeforum.Posts) (int64, error) {
+	defer s.time("CreatePost")()
+	return s.store.CreatePost(post)
+}
+
+func (s observedStore) GetPost(postID int64) (realtimeforum.Posts, error) {
+	defer s.time("GetPost")()
+	return s.store.GetPost(postID)
+}
+
+func (s observedStore) GetAllPosts() ([]realtimeforum.Posts, error) {
+	defer s.time("GetAllPosts")()
+	return s.store.GetAllPosts()
+}
+
+func (s observedStore) GetPostsVisibleTo(viewerID int64) ([]realtimeforum.Posts, error) {
+	defer s.time("GetPostsVisibleTo")()
+	return s.store.GetPostsVisibleTo(viewerID)
+}
+
+func (s observedStore) GetDeletedPosts() ([]realtimeforum.Posts, error) {
+	defer s.time("GetDeletedPosts")()
+	return s.store.GetDeletedPosts()
+}
+
+func (s observedStore) EditPost(postID, editorID int64, edit realtimeforum.PostEdit, editedAt time.Time, check PostCheck) (realtimeforum.Posts, error) {
+	defer s.time("EditPost")()
+	return s.store.EditPost(postID, editorID, edit, editedAt, check)
+}
+
+func (s observedStore) DeletePost(postID, deletedBy int64, deletedAt time.Time, check PostCheck) (realtimeforum.Posts, error) {
+	defer s.time("DeletePost")()
+	return s.store.DeletePost(postID, deletedBy, deletedAt, check)
+}
+
+func (s observedStore) GetPostRevisions(postID int64) ([]realtimeforum.PostRevision, error) {
+	defer s.time("GetPostRevisions")()
+	return s.store.GetPostRevisions(postID)
+}
+
+func (s observedStore) CreateComment(comment realtimeforum.Comments) (int64, error) {
+	defer s.time("CreateComment")()
+	return s.store.CreateComment(comment)
+}
+
+func (s observedStore) GetComment(commentID int64) (realtimeforum.Comments, error) {
+	defer s.time("GetComment")()
+	return s.store.GetComment(commentID)
+}
+
+func (s observedStore) GetComments(postID int64) ([]realtimeforum.Comments, error) {
+	defer s.time("GetComments")()
+	return s.store.GetComments(postID)
+}
+
+func (s observedStore) SaveChat(chat realtimeforum.Chats) (int64, error) {
+	defer s.time("SaveChat")()
+	return s.store.SaveChat(chat)
+}
+
+func (s observedStore) GetChat(messageID int64) (realtimeforum.Chats, error) {
+	defer s.time("GetChat")()
+	return s.store.GetChat(messageID)
+}
+
+func (s observedStore) GetChatByClientID(senderID int64, clientMessageID string) (realtimeforum.Chats, error) {
+	defer s.time("GetChatByClientID")()
+	return s.store.GetChatByClientID(senderID, clientMessageID)
+}
+
+func (s observedStore) GetChatHistory(userA, userB int64) ([]realtimeforum.Chats, error) {
+	defer s.time("GetChatHistory")()
+	return s.store.GetChatHistory(userA, userB)
+}
+
+func (s observedStore) MarkChatDelivered(messageID int64, deliveredAt time.Time) error {
+	defer s.time("MarkChatDelivered")()
+	return s.store.MarkChatDelivered(messageID, deliveredAt)
+}
+
+func (s observedStore) EditChat(messageID int64, content, contentHTML string, editedAt time.Time, check ChangeCheck) (realtimeforum.Chats, error) {
+	defer s.time("EditChat")()
+	return s.store.EditChat(messageID, content, contentHTML, editedAt, check)
+}
+
+func (s observedStore) DeleteChat(messageID int64, deletedAt time.Time, check ChangeCheck) (realtimeforum.Chats, error) {
+	defer s.time("DeleteChat")()
+	return s.store.DeleteChat(messageID, deletedAt, check)
+}
+
+func (s observedStore) PurgeDeletedChats(cutoff time.Time) (int64, error) {
+	defer s.time("PurgeDeletedChats")()
+	return s.store.PurgeDeletedChats(cutoff)
+}
+
+func (s observedStore) PurgeChatRevisions(cutoff time.Time) (int64, error) {
+	defer s.time("PurgeChatRevisions")()
+	return s.store.PurgeChatRevisions(cutoff)
+}
+
+func (s observedStore) AddReaction(messageID, userID int64, emoji string, createdAt time.Time) error {
+	defer s.time("AddReaction")()
+	return s.store.AddReaction(messageID, userID, emoji, createdAt)
+}
+
+func (s observedStore) RemoveReaction(messageID, userID int64, emoji string) error {
+	defer s.time("RemoveReaction")()
+	return s.store.RemoveReaction(messageID, userID, emoji)
+}
+
+func (s observedStore) GetReactions(messageIDs []int64) (map[int64][]realtimeforum.ReactionSummary, error) {
+	defer s.time("GetReactions")()
+	return s.store.GetReactions(messageIDs)
+}
+
+func (s observedStore) CreateAttachment(attachment realtimeforum.Attachment) (int64, error) {
+	defer s.time("CreateAttachment")()
+	return s.store.CreateAttachment(attachment)
+}
+
+func (s observedStore) GetAttachment(attachmentID int64) (realtimeforum.Attachment, error) {
+	defer s.time("GetAttachment")()
+	return s.store.GetAttachment(attachmentID)
+}
+
+func (s observedStore) GetPostAttachments(postIDs []int64) (map[int64][]realtimeforum.Attachment, error) {
+	defer s.time("GetPostAttachments")()
+	return s.store.GetPostAttachments(postIDs)
+}
+
+func (s observedStore) GetChatAttachments(messageIDs []int64) (map[int64][]realtimeforum.Attachment, error) {
+	defer s.time("GetChatAttachments")()
+	return s.store.GetChatAttachments(messageIDs)
+}
+
+func (s observedStore) PurgeOrphanAttachments(cutoff time.Time) ([]realtimeforum.Attachment, error) {
+	defer s.time("PurgeOrphanAttachments")()
+	return s.store.PurgeOrphanAttachments(cutoff)
+}
+
+func (s observedStore) GetPolls(postIDs []int64, viewerID int64) (map[int64]realtimeforum.Poll, error) {
+	defer s.time("GetPolls")()
+	return s.store.GetPolls(postIDs, viewerID)
+}
+
+func (s observedStore) CastVote(postID, userID int64, optionIDs []int64, votedAt time.Time) error {
+	defer s.time("CastVote")()
+	return s.store.CastVote(postID, userID, optionIDs, votedAt)
+}
+
+func (s observedStore) AddBookmark(userID, postID int64, createdAt time.Time) error {
+	defer s.time("AddBookmark")()
+	return s.store.AddBookmark(userID, postID, createdAt)
+}
+
+func (s observedStore) RemoveBookmark(userID, postID int64) error {
+	defer s.time("RemoveBookmark")()
+	return s.store.RemoveBookmark(userID, postID)
+}
+
+func (s observedStore) GetBookmarkedPosts(userID int64) ([]realtimeforum.Posts, error) {
+	defer s.time("GetBookmarkedPosts")()
+	return s.store.GetBookmarkedPosts(userID)
+}
+
+func (s observedStore) AddWatch(userID int64, kind string, targetID int64, createdAt time.Time) error {
+	defer s.time("AddWatch")()
+	return s.store.AddWatch(userID, kind, targetID, createdAt)
+}
+
+func (s observedStore) RemoveWatch(userID int64, kind string, targetID int64) error {
+	defer s.time("RemoveWatch")()
+	return s.store.RemoveWatch(userID, kind, targetID)
+}
+
+func (s observedStore) ListWatches(userID int64) ([]realtimeforum.Watch, error) {
+	defer s.time("ListWatches")()
+	return s.store.ListWatches(userID)
+}
+
+func (s observedStore) GetWatchers(kind string, targetID int64) (map[int64]bool, error) {
+	defer s.time("GetWatchers")()
+	return s.store.GetWatchers(kind, targetID)
+}
+
+func (s observedStore) CreateNotifications(notification realtimeforum.Notification, userIDs []int64) ([]int64, error) {
+	defer s.time("CreateNotifications")()
+	return s.store.CreateNotifications(notification, userIDs)
+}
+
+func (s observedStore) GetNotifications(userID, beforeID int64, limit int) ([]realtimeforum.Notification, error) {
+	defer s.time("GetNotifications")()
+	return s.store.GetNotifications(userID, beforeID, limit)
+}
+
+func (s observedStore) MarkNotificationsRead(userID, upToID int64, readAt time.Time) (int64, error) {
+	defer s.time("MarkNotificationsRead")()
+	return s.store.MarkNotificationsRead(userID, upToID, readAt)
+}
+
+func (s observedStore) CountUnreadNotifications(userID int64) (int, error) {
+	defer s.time("CountUnreadNotifications")()
+	return s.store.CountUnreadNotifications(userID)
+}
+
+func (s observedStore) AddUserRelation(userID, targetID int64, kind string, createdAt time.Time) error {
+	defer s.time("AddUserRelation")()
+	return s.store.AddUserRelation(userID, targetID, kind, createdAt)
+}
+
+func (s observedStore) RemoveUserRelation(userID, targetID int64, kind string) error {
+	defer s.time("RemoveUserRelation")()
+	return s.store.RemoveUserRelation(userID, targetID, kind)
+}
+
+func (s observedStore) ListUserRelations(userID int64, kind string) ([]realtimeforum.UserRelation, error) {
+	defer s.time("ListUserRelations")()
+	return s.store.ListUserRelations(userID, kind)
+}
+
+func (s observedStore) HasUserRelation(userID, targetID int64, kind string) (bool, error) {
+	defer s.time("HasUserRelation")()
+	return s.store.HasUserRelation(userID, targetID, kind)
+}
+
+func (s observedStore) GetRelationTargets(userID int64, kind string) (map[int64]bool, error) {
+	defer s.time("GetRelationTargets")()
+	return s.store.GetRelationTargets(userID, kind)
+}
+
+func (s observedStore) GetRelationOwners(targetID int64, kind string) (map[int64]bool, error) {
+	defer s.time("GetRelationOwners")()
+	return s.store.GetRelationOwners(targetID, kind)
+}
+
+func (s observedStore) TouchUser(userID int64, at time.Time) error {
+	defer s.time("TouchUser")()
+	return s.store.TouchUser(userID, at)
+}
+
+func (s observedStore) RemoveInactiveUsers(cutoff time.Time) (int64, error) {
+	defer s.time("RemoveInactiveUsers")()
+	return s.store.RemoveInactiveUsers(cutoff)
+}
+
+func (s observedStore) Search(q search.Query, viewerID int64, offset, limit int) ([]realtimeforum.SearchResult, error) {
+	defer s.time("Search")()
+	return s.store.Search(q, viewerID, offset, limit)
+}
@@ -0,0 +1,209 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// attachmentQueryBatch keeps the number of bound parameters per query below SQLite's limit.
+const attachmentQueryBatch = 500
+
+const attachmentSelect = `SELECT attachment_id, uploader_id, post_id, message_id, filename, content_type, size, width, height,
+	blob_key, thumbnail_key, created_at FROM Attachments `
+
+// scanAttachment reads a row selected with attachmentSelect.
+func scanAttachment(row rowScanner) (realtimeforum.Attachment, error) {
+	var a realtimeforum.Attachment
+	var postID, messageID sql.NullInt64
+	var createdAt string
+	err := row.Scan(&a.AttachmentID, &a.UploaderID, &postID, &messageID, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height,
+		&a.BlobKey, &a.ThumbnailKey, &createdAt)
+	if err != nil {
+		return realtimeforum.Attachment{}, notFound(err)
+	}
+	a.PostID, a.MessageID = int(postID.Int64), int(messageID.Int64)
+	a.HasThumbnail = a.ThumbnailKey != ""
+	if a.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return realtimeforum.Attachment{}, err
+	}
+	return a, nil
+}
+
+// CreateAttachment stores a new upload, not attached to anything yet, and returns its ID.
+func (s *Store) CreateAttachment(a realtimeforum.Attachment) (int64, error) {
+	query := `INSERT INTO Attachments(uploader_id, filename, content_type, size, width, height, blob_key, thumbnail_key, created_at)
+		VALUES (?,?,?,?,?,?,?,?,?) RETURNING attachment_id`
+	return s.insert(query, a.UploaderID, a.Filename, a.ContentType, a.Size, a.Width, a.Height, a.BlobKey, a.ThumbnailKey,
+		timestamp(a.CreatedAt))
+}
+
+// GetAttachment returns an attachment, or storage.ErrNotFound.
+func (s *Store) GetAttachment(attachmentID int64) (realtimeforum.Attachment, error) {
+	return scanAttachment(s.db.QueryRow(s.q(attachmentSelect+"WHERE attachment_id = ?"), attachmentID))
+}
+
+// GetPostAttachments returns the attachments of the given posts, keyed by post ID.
+func (s *Store) GetPostAttachments(postIDs []int64) (map[int64][]realtimeforum.Attachment, error) {
+	return s.attachmentsOf("post_id", postIDs)
+}
+
+// GetChatAttachments returns the attachments of the given messages, keyed by message ID.
+func (s *Store) GetChatAttachments(messageIDs []int64) (map[int64][]realtimeforum.Attachment, error) {
+	return s.attachmentsOf("message_id", messageIDs)
+}
+
+// attachmentsOf returns the attachments whose column is one of ids, keyed by that column.
+func (s *Store) attachmentsOf(column string, ids []int64) (map[int64][]realtimeforum.Attachment, error) {
+	attachments := make(map[int64][]realtimeforum.Attachment)
+	for start := 0; start < len(ids); start += attachmentQueryBatch {
+		placeholders, args := inList(ids[start:min(start+attachmentQueryBatch, len(ids))])
+		found, err := s.queryAttachments(attachmentSelect+"WHERE "+column+" IN ("+placeholders+") ORDER BY attachment_id", args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range found {
+			key := int64(a.PostID)
+			if column == "message_id" {
+				key = int64(a.MessageID)
+			}
+			attachments[key] = append(attachments[key], a)
+		}
+	}
+	return attachments, nil
+}
+
+func (s *Store) queryAttachments(query string, args ...interface{}) ([]realtimeforum.Attachment, error) {
+	rows, err := s.db.Query(s.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []realtimeforum.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// PurgeOrphanAttachments removes the uploads never attached since before cutoff, and the
+// attachments of messages that no longer exist, and returns them.
+func (s *Store) PurgeOrphanAttachments(cutoff time.Time) ([]realtimeforum.Attachment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orphans := `WHERE (post_id IS NULL AND message_id IS NULL AND created_at < ?)
+		OR (message_id IS NOT NULL AND message_id NOT IN (SELECT message_id FROM Chats))`
+	rows, err := tx.Query(s.q(s.forUpdate(attachmentSelect+orphans, "Attachments")), timestamp(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	var purged []realtimeforum.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		purged = append(purged, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(purged); start += attachmentQueryBatch {
+		ids := make([]int64, 0, attachmentQueryBatch)
+		for _, a := range purged[start:min(start+attachmentQueryBatch, len(purged))] {
+			ids = append(ids, int64(a.AttachmentID))
+		}
+		placeholders, args := inList(ids)
+		if _, err := tx.Exec(s.q("DELETE FROM Attachments WHERE attachment_id IN ("+placeholders+")"), args...); err != nil {
+			return nil, err
+		}
+	}
+	return purged, tx.Commit()
+}
+
+// insertAttached runs an INSERT like insert, then attaches the uploads of uploaderID in
+// attachmentIDs to the new row, whose ID goes in column, in the same transaction. It fails with
+// storage.ErrAttachmentUnavailable, inserting nothing, unless every upload can be attached.
+func (s *Store) insertAttached(query string, args []interface{}, column string, uploaderID int64, attachmentIDs []int64) (int64, error) {
+	if len(attachmentIDs) == 0 {
+		return s.insert(query, args...)
+	}
+	return s.insertTx(query, args, func(tx *sql.Tx, id int64) error {
+		return s.attach(tx, column, id, uploaderID, attachmentIDs)
+	})
+}
+
+// insertTx runs an INSERT like insert, then then with the ID of the new row, in one transaction.
+func (s *Store) insertTx(query string, args []interface{}, then func(tx *sql.Tx, id int64) error) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(s.q(query), args...).Scan(&id); err != nil {
+		return 0, err
+	}
+	if err := then(tx, id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// attach attaches the uploads of uploaderID in attachmentIDs to the row id, whose ID goes in
+// column, or fails with storage.ErrAttachmentUnavailable unless every upload can be attached.
+func (s *Store) attach(tx *sql.Tx, column string, id, uploaderID int64, attachmentIDs []int64) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+
+	// Uploads already attached, or uploaded by someone else, are left out by the WHERE clause
+	unique := make(map[int64]bool, len(attachmentIDs))
+	ids := make([]int64, 0, len(attachmentIDs))
+	for _, attachmentID := range attachmentIDs {
+		if !unique[attachmentID] {
+			unique[attachmentID] = true
+			ids = append(ids, attachmentID)
+		}
+	}
+	placeholders, idArgs := inList(ids)
+	result, err := tx.Exec(s.q("UPDATE Attachments SET "+column+` = ?
+		WHERE uploader_id = ? AND post_id IS NULL AND message_id IS NULL AND attachment_id IN (`+placeholders+")"),
+		append([]interface{}{id, uploaderID}, idArgs...)...)
+	if err != nil {
+		return err
+	}
+	attached, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if attached != int64(len(ids)) {
+		return storage.ErrAttachmentUnavailable
+	}
+	return nil
+}
+
+// inList returns the placeholders and arguments of an IN clause listing ids.
+func inList(ids []int64) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","), args
+}
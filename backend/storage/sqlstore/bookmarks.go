@@ -0,0 +1,31 @@
+package sqlstore
+
+import (
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// AddBookmark bookmarks a post for userID. Adding it twice is a no-op.
+func (s *Store) AddBookmark(userID, postID int64, createdAt time.Time) error {
+	query := `INSERT INTO Bookmarks(user_id, post_id, created_at) VALUES (?,?,?)
+		ON CONFLICT(user_id, post_id) DO NOTHING`
+	_, err := s.db.Exec(s.q(query), userID, postID, timestamp(createdAt))
+	return err
+}
+
+// RemoveBookmark removes a bookmark if it exists.
+func (s *Store) RemoveBookmark(userID, postID int64) error {
+	_, err := s.db.Exec(s.q("DELETE FROM Bookmarks WHERE user_id = ? AND post_id = ?"), userID, postID)
+	return err
+}
+
+// GetBookmarkedPosts returns the posts userID bookmarked that are not deleted, most recently
+// bookmarked first.
+func (s *Store) GetBookmarkedPosts(userID int64) ([]realtimeforum.Posts, error) {
+	query := postSelect + `
+	WHERE deleted_at IS NULL
+		AND post_id IN (SELECT post_id FROM Bookmarks WHERE user_id = ?)
+	ORDER BY (SELECT created_at FROM Bookmarks b WHERE b.user_id = ? AND b.post_id = Posts.post_id) DESC, post_id DESC`
+	return s.queryPosts(query, userID, userID)
+}
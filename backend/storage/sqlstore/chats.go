@@ -0,0 +1,212 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// chatSelect is the SELECT clause read by scanChat. Queries add their own WHERE and ORDER BY.
+const chatSelect = `
+	SELECT c.message_id, c.sender_id, c.receiver_id, c.message, c.message_html, c.sent_at, u.username,
+		c.client_message_id, c.delivered_at, c.edited_at, c.deleted_at
+	FROM Chats c
+	JOIN Users u ON c.sender_id = u.user_id
+`
+
+// scanChat reads a row selected with chatSelect. The content of deleted messages is cleared
+// so it never leaves the server; the deleted marker is kept instead.
+func scanChat(row rowScanner) (realtimeforum.Chats, error) {
+	var chat realtimeforum.Chats
+	var sentAt string
+	var clientMessageID, deliveredAt, editedAt, deletedAt sql.NullString
+	err := row.Scan(&chat.MessageID, &chat.SenderID, &chat.ReceiverID, &chat.MessageContent, &chat.MessageHTML, &sentAt, &chat.SenderUsername,
+		&clientMessageID, &deliveredAt, &editedAt, &deletedAt)
+	if err != nil {
+		return realtimeforum.Chats{}, notFound(err)
+	}
+	chat.ClientMessageID = clientMessageID.String
+
+	if chat.SentAt, err = time.Parse(time.RFC3339, sentAt); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	if chat.DeliveredAt, err = parseOptionalTime(deliveredAt); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	if chat.EditedAt, err = parseOptionalTime(editedAt); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	if deletedAt.Valid {
+		chat.Deleted = true
+		chat.MessageContent, chat.MessageHTML = "", ""
+	}
+	return chat, nil
+}
+
+// parseOptionalTime parses a nullable timestamp column. SQLite returns the RFC3339 text it was
+// given and PostgreSQL a time, which database/sql formats as RFC3339 when scanning into a string.
+func parseOptionalTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// timestamp formats a time the way every timestamp is stored: UTC RFC3339 text, which sorts
+// chronologically in SQLite and is parsed into a TIMESTAMPTZ by PostgreSQL.
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// SaveChat stores a new message with its attachments and returns its ID.
+func (s *Store) SaveChat(chat realtimeforum.Chats) (int64, error) {
+	// An empty client ID is stored as NULL so it is ignored by the uniqueness index
+	var clientMessageID sql.NullString
+	if chat.ClientMessageID != "" {
+		clientMessageID = sql.NullString{String: chat.ClientMessageID, Valid: true}
+	}
+	query := `INSERT INTO Chats(sender_id, receiver_id, message, message_html, sent_at, sender_username, client_message_id)
+		VALUES (?,?,?,?,?,?,?) RETURNING message_id`
+	args := []interface{}{chat.SenderID, chat.ReceiverID, chat.MessageContent, chat.MessageHTML, timestamp(chat.SentAt),
+		chat.SenderUsername, clientMessageID}
+	return s.insertAttached(query, args, "message_id", int64(chat.SenderID), chat.AttachmentIDs)
+}
+
+// GetChat returns a single message, or storage.ErrNotFound.
+func (s *Store) GetChat(messageID int64) (realtimeforum.Chats, error) {
+	return scanChat(s.db.QueryRow(s.q(chatSelect+"WHERE c.message_id = ?"), messageID))
+}
+
+// GetChatByClientID returns storage.ErrNotFound if the sender never stored a message with that client ID.
+func (s *Store) GetChatByClientID(senderID int64, clientMessageID string) (realtimeforum.Chats, error) {
+	return scanChat(s.db.QueryRow(s.q(chatSelect+"WHERE c.sender_id = ? AND c.client_message_id = ?"), senderID, clientMessageID))
+}
+
+// GetChatHistory returns the messages exchanged between two users, oldest first.
+func (s *Store) GetChatHistory(userA, userB int64) ([]realtimeforum.Chats, error) {
+	query := chatSelect + `
+	WHERE (c.sender_id = ? AND c.receiver_id = ?) OR (c.sender_id = ? AND c.receiver_id = ?)
+	ORDER BY c.sent_at ASC, c.message_id ASC
+`
+	rows, err := s.db.Query(s.q(query), userA, userB, userB, userA)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []realtimeforum.Chats
+	for rows.Next() {
+		chat, err := scanChat(rows)
+		if err != nil {
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+	return chats, rows.Err()
+}
+
+// MarkChatDelivered records the first time a message reached a recipient connection.
+func (s *Store) MarkChatDelivered(messageID int64, deliveredAt time.Time) error {
+	query := "UPDATE Chats SET delivered_at = ? WHERE message_id = ? AND delivered_at IS NULL"
+	_, err := s.db.Exec(s.q(query), timestamp(deliveredAt), messageID)
+	return err
+}
+
+// changeChat reads a message in a transaction, locking it where the database supports it,
+// and applies change if check allows it.
+func (s *Store) changeChat(messageID int64, check storage.ChangeCheck, change func(tx *sql.Tx, chat *realtimeforum.Chats) error) (realtimeforum.Chats, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	defer tx.Rollback()
+
+	chat, err := scanChat(tx.QueryRow(s.q(s.forUpdate(chatSelect+"WHERE c.message_id = ?", "c")), messageID))
+	if err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	if err := check(chat); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	if err := change(tx, &chat); err != nil {
+		return realtimeforum.Chats{}, err
+	}
+	return chat, tx.Commit()
+}
+
+// EditChat keeps the current content in Chat_Revisions and replaces it, if check allows it.
+func (s *Store) EditChat(messageID int64, content, contentHTML string, editedAt time.Time, check storage.ChangeCheck) (realtimeforum.Chats, error) {
+	return s.changeChat(messageID, check, func(tx *sql.Tx, chat *realtimeforum.Chats) error {
+		// Keep the content being replaced so the full history of the message can be reconstructed
+		_, err := tx.Exec(s.q("INSERT INTO Chat_Revisions(message_id, message, revised_at) VALUES (?,?,?)"),
+			messageID, chat.MessageContent, timestamp(editedAt))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(s.q("UPDATE Chats SET message = ?, message_html = ?, edited_at = ? WHERE message_id = ?"),
+			content, contentHTML, timestamp(editedAt), messageID)
+		if err != nil {
+			return err
+		}
+		chat.MessageContent, chat.MessageHTML = content, contentHTML
+		chat.EditedAt = &editedAt
+		return nil
+	})
+}
+
+// DeleteChat soft-deletes a message, if check allows it. The row and its revisions are kept
+// but the content is no longer returned.
+func (s *Store) DeleteChat(messageID int64, deletedAt time.Time, check storage.ChangeCheck) (realtimeforum.Chats, error) {
+	return s.changeChat(messageID, check, func(tx *sql.Tx, chat *realtimeforum.Chats) error {
+		_, err := tx.Exec(s.q("UPDATE Chats SET deleted_at = ? WHERE message_id = ? AND deleted_at IS NULL"), timestamp(deletedAt), messageID)
+		if err != nil {
+			return err
+		}
+		chat.Deleted = true
+		chat.MessageContent, chat.MessageHTML = "", ""
+		return nil
+	})
+}
+
+// PurgeDeletedChats permanently removes messages deleted before cutoff, together with their
+// revisions and reactions, and returns the number of messages removed.
+func (s *Store) PurgeDeletedChats(cutoff time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	before := timestamp(cutoff)
+	purged := "SELECT message_id FROM Chats WHERE deleted_at IS NOT NULL AND deleted_at < ?"
+	if _, err := tx.Exec(s.q("DELETE FROM Chat_Revisions WHERE message_id IN ("+purged+")"), before); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(s.q("DELETE FROM Reactions WHERE message_id IN ("+purged+")"), before); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(s.q("DELETE FROM Chats WHERE deleted_at IS NOT NULL AND deleted_at < ?"), before)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return removed, tx.Commit()
+}
+
+// PurgeChatRevisions removes the edit history recorded before cutoff and returns the number of revisions removed.
+func (s *Store) PurgeChatRevisions(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(s.q("DELETE FROM Chat_Revisions WHERE revised_at < ?"), timestamp(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,63 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// commentSelect is the SELECT clause read by scanComment. Queries add their own WHERE and ORDER BY.
+const commentSelect = `
+	SELECT c.comment_id, c.author_id, u.username, c.post_id, c.parent_comment_id, c.depth, c.content, c.content_html, c.created_at
+	FROM Comments c
+	JOIN Users u ON u.user_id = c.author_id
+`
+
+func scanComment(row rowScanner) (realtimeforum.Comments, error) {
+	var comment realtimeforum.Comments
+	var parentID sql.NullInt64
+	err := row.Scan(&comment.CommentID, &comment.AuthorID, &comment.AuthorUsername, &comment.PostID, &parentID,
+		&comment.Depth, &comment.Content, &comment.ContentHTML, &comment.CreatedAt)
+	if err != nil {
+		return realtimeforum.Comments{}, notFound(err)
+	}
+	comment.ParentCommentID = int(parentID.Int64)
+	return comment, nil
+}
+
+// CreateComment stores a new comment and returns its ID.
+func (s *Store) CreateComment(comment realtimeforum.Comments) (int64, error) {
+	// Top-level comments have a NULL parent, which the foreign key accepts
+	var parentID sql.NullInt64
+	if comment.ParentCommentID != 0 {
+		parentID = sql.NullInt64{Int64: int64(comment.ParentCommentID), Valid: true}
+	}
+	query := `INSERT INTO Comments(author_id, post_id, parent_comment_id, depth, content, content_html, created_at)
+		VALUES (?,?,?,?,?,?,?) RETURNING comment_id`
+	return s.insert(query, comment.AuthorID, comment.PostID, parentID, comment.Depth, comment.Content, comment.ContentHTML,
+		comment.CreatedAt)
+}
+
+// GetComment returns a single comment, or storage.ErrNotFound.
+func (s *Store) GetComment(commentID int64) (realtimeforum.Comments, error) {
+	return scanComment(s.db.QueryRow(s.q(commentSelect+"WHERE c.comment_id = ?"), commentID))
+}
+
+// GetComments returns the comments of a post, oldest first.
+func (s *Store) GetComments(postID int64) ([]realtimeforum.Comments, error) {
+	rows, err := s.db.Query(s.q(commentSelect+"WHERE c.post_id = ? ORDER BY c.created_at, c.comment_id"), postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []realtimeforum.Comments{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
@@ -0,0 +1,667 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"livechat-system/backend/storage"
+)
+
+// migration is a single versioned schema change. Migrations are applied in order
+// on startup and recorded in the schema_migrations table so they only run once.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// sqliteMigrations lists every schema change in the order it must be applied.
+// Never edit a migration that has already shipped; add a new one instead, to both lists.
+var sqliteMigrations = []migration{
+	{
+		// Matches the schema of db/forumDB.sqlite so a fresh database ends up identical.
+		version: 1,
+		name:    "baseline",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Users (
+				user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username TEXT UNIQUE NOT NULL,
+				age INT NOT NULL,
+				gender TEXT NOT NULL,
+				first_name TEXT NOT NULL,
+				last_name TEXT NOT NULL,
+				email TEXT UNIQUE NOT NULL,
+				password TEXT NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS Posts (
+				post_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				category_id INTEGER NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES Users(user_id),
+				FOREIGN KEY (category_id) REFERENCES Categories(id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Comments (
+				comment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id INTEGER NOT NULL,
+				post_id INTEGER NOT NULL,
+				content TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				FOREIGN KEY (author_id) REFERENCES Users(user_id),
+				FOREIGN KEY (post_id) REFERENCES Post(post_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Likes (
+				like_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				post_id INTEGER NOT NULL,
+				FOREIGN KEY (user_id) REFERENCES Users(user_id),
+				FOREIGN KEY (post_id) REFERENCES Post(post_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Categories (
+				category_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				category Name TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS Post_Category (
+				post_id INTEGER NOT NULL,
+				category_id INTEGER NOT NULL,
+				FOREIGN KEY (post_id) REFERENCES Posts(post_id),
+				FOREIGN KEY (category_id) REFERENCES Categories(category_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Chats (
+				message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				sender_id INTEGER NOT NULL,
+				receiver_id INTEGER NOT NULL,
+				message Content TEXT NOT NULL,
+				sent_at TIMESTAMP NOT NULL,
+				sender_username TEXT,
+				FOREIGN KEY (sender_id) REFERENCES Users(user_id),
+				FOREIGN KEY (receiver_id) REFERENCES Users(user_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS online_users (
+				user_id INTEGER PRIMARY KEY,
+				last_activity TIMESTAMP
+			)`,
+		},
+	},
+	{
+		// Client-generated message IDs let clients retry sends without creating duplicates.
+		version: 2,
+		name:    "chat_client_message_ids",
+		statements: []string{
+			`ALTER TABLE Chats ADD COLUMN client_message_id TEXT`,
+			`ALTER TABLE Chats ADD COLUMN delivered_at TIMESTAMP`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_chats_sender_client_message
+				ON Chats(sender_id, client_message_id)
+				WHERE client_message_id IS NOT NULL`,
+		},
+	},
+	{
+		// Private messages can be edited or soft-deleted; every edit keeps the replaced content.
+		version: 3,
+		name:    "chat_edits",
+		statements: []string{
+			`ALTER TABLE Chats ADD COLUMN edited_at TIMESTAMP`,
+			`ALTER TABLE Chats ADD COLUMN deleted_at TIMESTAMP`,
+			`CREATE TABLE IF NOT EXISTS Chat_Revisions (
+				revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				message_id INTEGER NOT NULL,
+				message TEXT NOT NULL,
+				revised_at TIMESTAMP NOT NULL,
+				FOREIGN KEY (message_id) REFERENCES Chats(message_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_chat_revisions_message ON Chat_Revisions(message_id)`,
+		},
+	},
+	{
+		// Emoji reactions on private and lobby chat messages.
+		version: 4,
+		name:    "chat_reactions",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Reactions (
+				message_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				emoji TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (message_id, user_id, emoji),
+				FOREIGN KEY (message_id) REFERENCES Chats(message_id),
+				FOREIGN KEY (user_id) REFERENCES Users(user_id)
+			)`,
+		},
+	},
+	{
+		// Users can block or mute other users.
+		version: 5,
+		name:    "user_relations",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS User_Relations (
+				user_id INTEGER NOT NULL,
+				target_id INTEGER NOT NULL,
+				kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, target_id, kind),
+				FOREIGN KEY (user_id) REFERENCES Users(user_id),
+				FOREIGN KEY (target_id) REFERENCES Users(user_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_user_relations_target ON User_Relations(target_id, kind)`,
+		},
+	},
+	{
+		// Moderators may edit and delete every post.
+		version: 6,
+		name:    "user_roles",
+		statements: []string{
+			`ALTER TABLE Users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator'))`,
+		},
+	},
+	{
+		// Posts can be edited or soft-deleted; every edit keeps the replaced version.
+		version: 7,
+		name:    "post_edits",
+		statements: []string{
+			`ALTER TABLE Posts ADD COLUMN edited_at TIMESTAMP`,
+			`ALTER TABLE Posts ADD COLUMN deleted_at TIMESTAMP`,
+			`ALTER TABLE Posts ADD COLUMN deleted_by INTEGER REFERENCES Users(user_id)`,
+			`CREATE TABLE IF NOT EXISTS Post_Revisions (
+				revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				post_id INTEGER NOT NULL,
+				editor_id INTEGER NOT NULL,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				category_id INTEGER NOT NULL,
+				revised_at TIMESTAMP NOT NULL,
+				FOREIGN KEY (post_id) REFERENCES Posts(post_id),
+				FOREIGN KEY (editor_id) REFERENCES Users(user_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON Post_Revisions(post_id)`,
+		},
+	},
+	{
+		// Comments can reply to other comments of the same post.
+		version: 8,
+		name:    "comment_threads",
+		statements: []string{
+			`ALTER TABLE Comments ADD COLUMN parent_comment_id INTEGER REFERENCES Comments(comment_id)`,
+			`ALTER TABLE Comments ADD COLUMN depth INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX IF NOT EXISTS idx_comments_post ON Comments(post_id, parent_comment_id)`,
+		},
+	},
+	{
+		// The Markdown of posts, comments and messages is stored with its rendering. Rows written
+		// before are rendered when read.
+		version: 9,
+		name:    "rendered_content",
+		statements: []string{
+			`ALTER TABLE Posts ADD COLUMN content_html TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE Comments ADD COLUMN content_html TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE Chats ADD COLUMN message_html TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// Files uploaded by users, kept in the blob store. message_id has no foreign key, so purged
+		// messages can leave their attachments behind for the orphan purge.
+		version: 10,
+		name:    "attachments",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Attachments (
+				attachment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				uploader_id INTEGER NOT NULL,
+				post_id INTEGER,
+				message_id INTEGER,
+				filename TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size INTEGER NOT NULL,
+				width INTEGER NOT NULL DEFAULT 0,
+				height INTEGER NOT NULL DEFAULT 0,
+				blob_key TEXT NOT NULL,
+				thumbnail_key TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				FOREIGN KEY (uploader_id) REFERENCES Users(user_id),
+				FOREIGN KEY (post_id) REFERENCES Posts(post_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_attachments_post ON Attachments(post_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_attachments_message ON Attachments(message_id)`,
+		},
+	},
+	{
+		// A poll belongs to its post. Poll_Voters holds one row per user who voted, which makes a
+		// second vote fail, and Poll_Votes the options they chose.
+		version: 11,
+		name:    "polls",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Polls (
+				post_id INTEGER PRIMARY KEY,
+				multiple INTEGER NOT NULL DEFAULT 0,
+				anonymous INTEGER NOT NULL DEFAULT 0,
+				closes_at TIMESTAMP,
+				FOREIGN KEY (post_id) REFERENCES Posts(post_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Poll_Options (
+				option_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				post_id INTEGER NOT NULL,
+				text TEXT NOT NULL,
+				FOREIGN KEY (post_id) REFERENCES Polls(post_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_poll_options_post ON Poll_Options(post_id)`,
+			`CREATE TABLE IF NOT EXISTS Poll_Voters (
+				post_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				voted_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (post_id, user_id),
+				FOREIGN KEY (post_id) REFERENCES Polls(post_id),
+				FOREIGN KEY (user_id) REFERENCES Users(user_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Poll_Votes (
+				post_id INTEGER NOT NULL,
+				option_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				PRIMARY KEY (post_id, user_id, option_id),
+				FOREIGN KEY (option_id) REFERENCES Poll_Options(option_id),
+				FOREIGN KEY (post_id, user_id) REFERENCES Poll_Voters(post_id, user_id)
+			)`,
+		},
+	},
+	{
+		// A watch is of a post or of a category, which target_id refers to depending on the kind,
+		// so it has no foreign key. Notifications are kept once read, with read_at set.
+		version: 12,
+		name:    "bookmarks_watches_notifications",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Bookmarks (
+				user_id INTEGER NOT NULL,
+				post_id INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, post_id),
+				FOREIGN KEY (user_id) REFERENCES Users(user_id),
+				FOREIGN KEY (post_id) REFERENCES Posts(post_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Watches (
+				user_id INTEGER NOT NULL,
+				kind TEXT NOT NULL CHECK (kind IN ('post', 'category')),
+				target_id INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, kind, target_id),
+				FOREIGN KEY (user_id) REFERENCES Users(user_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_watches_target ON Watches(kind, target_id)`,
+			`CREATE TABLE IF NOT EXISTS Notifications (
+				notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				kind TEXT NOT NULL CHECK (kind IN ('comment', 'post')),
+				actor_id INTEGER NOT NULL,
+				post_id INTEGER NOT NULL,
+				comment_id INTEGER,
+				created_at TIMESTAMP NOT NULL,
+				read_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES Users(user_id),
+				FOREIGN KEY (actor_id) REFERENCES Users(user_id),
+				FOREIGN KEY (post_id) REFERENCES Posts(post_id),
+				FOREIGN KEY (comment_id) REFERENCES Comments(comment_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_notifications_user ON Notifications(user_id, notification_id)`,
+		},
+	},
+	{
+		// Lobby messages use receiver 0, which no user has, so Chats.receiver_id loses its
+		// foreign key as in PostgreSQL. SQLite cannot drop a constraint: the table is rebuilt with
+		// the same rows, and the search index triggers dropped with it are recreated by Migrate.
+		version: 13,
+		name:    "chats_receiver_without_foreign_key",
+		statements: []string{
+			`CREATE TABLE Chats_new (
+				message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				sender_id INTEGER NOT NULL,
+				receiver_id INTEGER NOT NULL,
+				message TEXT NOT NULL,
+				sent_at TIMESTAMP NOT NULL,
+				sender_username TEXT,
+				client_message_id TEXT,
+				delivered_at TIMESTAMP,
+				edited_at TIMESTAMP,
+				deleted_at TIMESTAMP,
+				message_html TEXT NOT NULL DEFAULT '',
+				FOREIGN KEY (sender_id) REFERENCES Users(user_id)
+			)`,
+			`INSERT INTO Chats_new (message_id, sender_id, receiver_id, message, sent_at, sender_username,
+				client_message_id, delivered_at, edited_at, deleted_at, message_html)
+				SELECT message_id, sender_id, receiver_id, message, sent_at, sender_username,
+				client_message_id, delivered_at, edited_at, deleted_at, message_html FROM Chats`,
+			`DROP TABLE Chats`,
+			`ALTER TABLE Chats_new RENAME TO Chats`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_chats_sender_client_message
+				ON Chats(sender_id, client_message_id)
+				WHERE client_message_id IS NOT NULL`,
+		},
+	},
+}
+
+// postgresMigrations is the same schema as sqliteMigrations, version for version. Timestamps are
+// TIMESTAMPTZ. Chats.receiver_id has no foreign key since lobby messages use receiver 0, and
+// Posts.category_id has none because categories are not managed yet.
+var postgresMigrations = []migration{
+	{
+		version: 1,
+		name:    "baseline",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Users (
+				user_id BIGSERIAL PRIMARY KEY,
+				username TEXT UNIQUE NOT NULL,
+				age INT NOT NULL,
+				gender TEXT NOT NULL,
+				first_name TEXT NOT NULL,
+				last_name TEXT NOT NULL,
+				email TEXT UNIQUE NOT NULL,
+				password TEXT NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS Categories (
+				category_id BIGSERIAL PRIMARY KEY,
+				category TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS Posts (
+				post_id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				category_id BIGINT NOT NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS Comments (
+				comment_id BIGSERIAL PRIMARY KEY,
+				author_id BIGINT NOT NULL REFERENCES Users(user_id),
+				post_id BIGINT NOT NULL REFERENCES Posts(post_id),
+				content TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS Likes (
+				like_id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				post_id BIGINT NOT NULL REFERENCES Posts(post_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Post_Category (
+				post_id BIGINT NOT NULL REFERENCES Posts(post_id),
+				category_id BIGINT NOT NULL REFERENCES Categories(category_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Chats (
+				message_id BIGSERIAL PRIMARY KEY,
+				sender_id BIGINT NOT NULL REFERENCES Users(user_id),
+				receiver_id BIGINT NOT NULL,
+				message TEXT NOT NULL,
+				sent_at TIMESTAMPTZ NOT NULL,
+				sender_username TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS online_users (
+				user_id BIGINT PRIMARY KEY,
+				last_activity TIMESTAMPTZ
+			)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "chat_client_message_ids",
+		statements: []string{
+			`ALTER TABLE Chats ADD COLUMN client_message_id TEXT`,
+			`ALTER TABLE Chats ADD COLUMN delivered_at TIMESTAMPTZ`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_chats_sender_client_message
+				ON Chats(sender_id, client_message_id)
+				WHERE client_message_id IS NOT NULL`,
+		},
+	},
+	{
+		version: 3,
+		name:    "chat_edits",
+		statements: []string{
+			`ALTER TABLE Chats ADD COLUMN edited_at TIMESTAMPTZ`,
+			`ALTER TABLE Chats ADD COLUMN deleted_at TIMESTAMPTZ`,
+			`CREATE TABLE IF NOT EXISTS Chat_Revisions (
+				revision_id BIGSERIAL PRIMARY KEY,
+				message_id BIGINT NOT NULL REFERENCES Chats(message_id),
+				message TEXT NOT NULL,
+				revised_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_chat_revisions_message ON Chat_Revisions(message_id)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "chat_reactions",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Reactions (
+				message_id BIGINT NOT NULL REFERENCES Chats(message_id),
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				emoji TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (message_id, user_id, emoji)
+			)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "user_relations",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS User_Relations (
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				target_id BIGINT NOT NULL REFERENCES Users(user_id),
+				kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+				created_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (user_id, target_id, kind)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_user_relations_target ON User_Relations(target_id, kind)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "user_roles",
+		statements: []string{
+			`ALTER TABLE Users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator'))`,
+		},
+	},
+	{
+		version: 7,
+		name:    "post_edits",
+		statements: []string{
+			`ALTER TABLE Posts ADD COLUMN edited_at TIMESTAMPTZ`,
+			`ALTER TABLE Posts ADD COLUMN deleted_at TIMESTAMPTZ`,
+			`ALTER TABLE Posts ADD COLUMN deleted_by BIGINT REFERENCES Users(user_id)`,
+			`CREATE TABLE IF NOT EXISTS Post_Revisions (
+				revision_id BIGSERIAL PRIMARY KEY,
+				post_id BIGINT NOT NULL REFERENCES Posts(post_id),
+				editor_id BIGINT NOT NULL REFERENCES Users(user_id),
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				category_id BIGINT NOT NULL,
+				revised_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON Post_Revisions(post_id)`,
+		},
+	},
+	{
+		version: 8,
+		name:    "comment_threads",
+		statements: []string{
+			`ALTER TABLE Comments ADD COLUMN parent_comment_id BIGINT REFERENCES Comments(comment_id)`,
+			`ALTER TABLE Comments ADD COLUMN depth INT NOT NULL DEFAULT 0`,
+			`CREATE INDEX IF NOT EXISTS idx_comments_post ON Comments(post_id, parent_comment_id)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "rendered_content",
+		statements: []string{
+			`ALTER TABLE Posts ADD COLUMN content_html TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE Comments ADD COLUMN content_html TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE Chats ADD COLUMN message_html TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 10,
+		name:    "attachments",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Attachments (
+				attachment_id BIGSERIAL PRIMARY KEY,
+				uploader_id BIGINT NOT NULL REFERENCES Users(user_id),
+				post_id BIGINT REFERENCES Posts(post_id),
+				message_id BIGINT,
+				filename TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size BIGINT NOT NULL,
+				width INT NOT NULL DEFAULT 0,
+				height INT NOT NULL DEFAULT 0,
+				blob_key TEXT NOT NULL,
+				thumbnail_key TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_attachments_post ON Attachments(post_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_attachments_message ON Attachments(message_id)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "polls",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Polls (
+				post_id BIGINT PRIMARY KEY REFERENCES Posts(post_id),
+				multiple BOOLEAN NOT NULL DEFAULT FALSE,
+				anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+				closes_at TIMESTAMPTZ
+			)`,
+			`CREATE TABLE IF NOT EXISTS Poll_Options (
+				option_id BIGSERIAL PRIMARY KEY,
+				post_id BIGINT NOT NULL REFERENCES Polls(post_id),
+				text TEXT NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_poll_options_post ON Poll_Options(post_id)`,
+			`CREATE TABLE IF NOT EXISTS Poll_Voters (
+				post_id BIGINT NOT NULL REFERENCES Polls(post_id),
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				voted_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (post_id, user_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Poll_Votes (
+				post_id BIGINT NOT NULL,
+				option_id BIGINT NOT NULL REFERENCES Poll_Options(option_id),
+				user_id BIGINT NOT NULL,
+				PRIMARY KEY (post_id, user_id, option_id),
+				FOREIGN KEY (post_id, user_id) REFERENCES Poll_Voters(post_id, user_id)
+			)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "bookmarks_watches_notifications",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Bookmarks (
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				post_id BIGINT NOT NULL REFERENCES Posts(post_id),
+				created_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (user_id, post_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS Watches (
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				kind TEXT NOT NULL CHECK (kind IN ('post', 'category')),
+				target_id BIGINT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (user_id, kind, target_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_watches_target ON Watches(kind, target_id)`,
+			`CREATE TABLE IF NOT EXISTS Notifications (
+				notification_id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL REFERENCES Users(user_id),
+				kind TEXT NOT NULL CHECK (kind IN ('comment', 'post')),
+				actor_id BIGINT NOT NULL REFERENCES Users(user_id),
+				post_id BIGINT NOT NULL REFERENCES Posts(post_id),
+				comment_id BIGINT REFERENCES Comments(comment_id),
+				created_at TIMESTAMPTZ NOT NULL,
+				read_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_notifications_user ON Notifications(user_id, notification_id)`,
+		},
+	},
+	{
+		// Nothing to do: receiver_id never had a foreign key here.
+		version:    13,
+		name:       "chats_receiver_without_foreign_key",
+		statements: nil,
+	},
+}
+
+// Migrate brings the database schema up to date by applying every migration
+// that has not been recorded in schema_migrations yet, then the full-text index.
+func (s *Store) Migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied, err := s.appliedMigrations(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, m := range s.dialect.migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		// Each migration runs in its own transaction so a failure leaves the schema untouched.
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(s.q("INSERT INTO schema_migrations(version, name) VALUES (?, ?)"), m.version, m.name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %d (%s): %w", m.version, m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("Applied migration", "version", m.version, "name", m.name)
+	}
+
+	return s.syncSearchIndex()
+}
+
+// CheckMigrations returns storage.ErrMigrationsPending if any migration has not been applied,
+// for instance because another instance of the server is still migrating the database.
+func (s *Store) CheckMigrations(ctx context.Context) error {
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range s.dialect.migrations {
+		if !applied[m.version] {
+			return fmt.Errorf("%w: %d (%s) not applied", storage.ErrMigrationsPending, m.version, m.name)
+		}
+	}
+	return nil
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations.
+func (s *Store) appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,155 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// AddWatch records that userID watches a post or a category. Adding it twice is a no-op.
+func (s *Store) AddWatch(userID int64, kind string, targetID int64, createdAt time.Time) error {
+	query := `INSERT INTO Watches(user_id, kind, target_id, created_at) VALUES (?,?,?,?)
+		ON CONFLICT(user_id, kind, target_id) DO NOTHING`
+	_, err := s.db.Exec(s.q(query), userID, kind, targetID, timestamp(createdAt))
+	return err
+}
+
+// RemoveWatch removes a watch if it exists.
+func (s *Store) RemoveWatch(userID int64, kind string, targetID int64) error {
+	_, err := s.db.Exec(s.q("DELETE FROM Watches WHERE user_id = ? AND kind = ? AND target_id = ?"), userID, kind, targetID)
+	return err
+}
+
+// ListWatches returns the posts and categories userID watches, most recent first.
+func (s *Store) ListWatches(userID int64) ([]realtimeforum.Watch, error) {
+	query := `SELECT user_id, kind, target_id, created_at FROM Watches
+		WHERE user_id = ?
+		ORDER BY created_at DESC, kind ASC, target_id ASC`
+	watches := []realtimeforum.Watch{}
+	err := s.eachRow(query, []interface{}{userID}, func(row rowScanner) error {
+		var watch realtimeforum.Watch
+		var createdAt string
+		if err := row.Scan(&watch.UserID, &watch.Kind, &watch.TargetID, &createdAt); err != nil {
+			return err
+		}
+		var err error
+		if watch.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return err
+		}
+		watches = append(watches, watch)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return watches, nil
+}
+
+// GetWatchers returns the set of users who watch the post or the category targetID.
+func (s *Store) GetWatchers(kind string, targetID int64) (map[int64]bool, error) {
+	return s.queryIDSet("SELECT user_id FROM Watches WHERE kind = ? AND target_id = ?", kind, targetID)
+}
+
+// CreateNotifications stores a copy of notification for each of userIDs, in one transaction,
+// and returns their IDs in the same order.
+func (s *Store) CreateNotifications(notification realtimeforum.Notification, userIDs []int64) ([]int64, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	// Post notifications are not about a comment
+	var commentID sql.NullInt64
+	if notification.CommentID != 0 {
+		commentID = sql.NullInt64{Int64: int64(notification.CommentID), Valid: true}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := s.q(`INSERT INTO Notifications(user_id, kind, actor_id, post_id, comment_id, created_at)
+		VALUES (?,?,?,?,?,?) RETURNING notification_id`)
+	ids := make([]int64, len(userIDs))
+	for i, userID := range userIDs {
+		err := tx.QueryRow(query, userID, notification.Kind, notification.ActorID, notification.PostID, commentID,
+			timestamp(notification.CreatedAt)).Scan(&ids[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// GetNotifications returns up to limit notifications of userID, most recent first, starting
+// before beforeID unless it is 0.
+func (s *Store) GetNotifications(userID, beforeID int64, limit int) ([]realtimeforum.Notification, error) {
+	query := `SELECT n.notification_id, n.user_id, n.kind, n.actor_id, u.username, n.post_id, p.title, p.category_id,
+			n.comment_id, n.created_at, n.read_at
+		FROM Notifications n
+		JOIN Users u ON u.user_id = n.actor_id
+		JOIN Posts p ON p.post_id = n.post_id
+		WHERE n.user_id = ?`
+	args := []interface{}{userID}
+	if beforeID != 0 {
+		query += " AND n.notification_id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY n.notification_id DESC LIMIT ?"
+	args = append(args, limit)
+
+	notifications := []realtimeforum.Notification{}
+	err := s.eachRow(query, args, func(row rowScanner) error {
+		var n realtimeforum.Notification
+		var commentID sql.NullInt64
+		var createdAt string
+		var readAt sql.NullString
+		err := row.Scan(&n.NotificationID, &n.UserID, &n.Kind, &n.ActorID, &n.ActorUsername, &n.PostID, &n.PostTitle,
+			&n.CategoryID, &commentID, &createdAt, &readAt)
+		if err != nil {
+			return err
+		}
+		n.CommentID = int(commentID.Int64)
+		if n.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return err
+		}
+		if readAt.Valid {
+			read, err := time.Parse(time.RFC3339, readAt.String)
+			if err != nil {
+				return err
+			}
+			n.ReadAt = &read
+		}
+		notifications = append(notifications, n)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks the unread notifications of userID up to upToID, or all of them
+// when upToID is 0, as read at readAt, and returns how many it marked.
+func (s *Store) MarkNotificationsRead(userID, upToID int64, readAt time.Time) (int64, error) {
+	query := "UPDATE Notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{timestamp(readAt), userID}
+	if upToID != 0 {
+		query += " AND notification_id <= ?"
+		args = append(args, upToID)
+	}
+	result, err := s.db.Exec(s.q(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountUnreadNotifications returns the number of notifications of userID not read yet.
+func (s *Store) CountUnreadNotifications(userID int64) (int, error) {
+	var unread int
+	query := "SELECT COUNT(*) FROM Notifications WHERE user_id = ? AND read_at IS NULL"
+	err := s.db.QueryRow(s.q(query), userID).Scan(&unread)
+	return unread, err
+}
@@ -0,0 +1,217 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// pollQueryBatch keeps the number of bound parameters per query below SQLite's limit.
+const pollQueryBatch = 500
+
+// insertPoll stores the poll of a new post with its options, in the order given.
+func (s *Store) insertPoll(tx *sql.Tx, postID int64, poll realtimeforum.Poll) error {
+	_, err := tx.Exec(s.q("INSERT INTO Polls(post_id, multiple, anonymous, closes_at) VALUES (?,?,?,?)"),
+		postID, poll.Multiple, poll.Anonymous, poll.ClosesAt)
+	if err != nil {
+		return err
+	}
+	for _, option := range poll.Options {
+		if _, err := tx.Exec(s.q("INSERT INTO Poll_Options(post_id, text) VALUES (?,?)"), postID, option.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPolls returns the polls of the given posts, keyed by post ID, with their votes counted, the
+// options viewerID voted for and the voters of the polls that are not anonymous.
+func (s *Store) GetPolls(postIDs []int64, viewerID int64) (map[int64]realtimeforum.Poll, error) {
+	polls := make(map[int64]realtimeforum.Poll)
+	for start := 0; start < len(postIDs); start += pollQueryBatch {
+		if err := s.loadPolls(postIDs[start:min(start+pollQueryBatch, len(postIDs))], viewerID, polls); err != nil {
+			return nil, err
+		}
+	}
+	return polls, nil
+}
+
+// loadPolls adds the polls of one batch of posts to polls.
+func (s *Store) loadPolls(postIDs []int64, viewerID int64, polls map[int64]realtimeforum.Poll) error {
+	placeholders, args := inList(postIDs)
+	in := " IN (" + placeholders + ")"
+
+	err := s.eachRow("SELECT post_id, multiple, anonymous, closes_at FROM Polls WHERE post_id"+in, args, func(row rowScanner) error {
+		var poll realtimeforum.Poll
+		var closesAt sql.NullTime
+		if err := row.Scan(&poll.PostID, &poll.Multiple, &poll.Anonymous, &closesAt); err != nil {
+			return err
+		}
+		if closesAt.Valid {
+			poll.ClosesAt = &closesAt.Time
+		}
+		polls[int64(poll.PostID)] = poll
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Where each option is in its poll, to count its votes and list its voters
+	type position struct {
+		postID int64
+		index  int
+	}
+	options := make(map[int64]position)
+	err = s.eachRow("SELECT option_id, post_id, text FROM Poll_Options WHERE post_id"+in+" ORDER BY option_id", args, func(row rowScanner) error {
+		var option realtimeforum.PollOption
+		var postID int64
+		if err := row.Scan(&option.OptionID, &postID, &option.Text); err != nil {
+			return err
+		}
+		poll := polls[postID]
+		options[int64(option.OptionID)] = position{postID, len(poll.Options)}
+		poll.Options = append(poll.Options, option)
+		polls[postID] = poll
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.eachRow("SELECT post_id, COUNT(*) FROM Poll_Voters WHERE post_id"+in+" GROUP BY post_id", args, func(row rowScanner) error {
+		var postID int64
+		var voters int
+		if err := row.Scan(&postID, &voters); err != nil {
+			return err
+		}
+		poll := polls[postID]
+		poll.Voters = voters
+		polls[postID] = poll
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.eachRow("SELECT option_id, COUNT(*) FROM Poll_Votes WHERE post_id"+in+" GROUP BY option_id", args, func(row rowScanner) error {
+		var optionID int64
+		var votes int
+		if err := row.Scan(&optionID, &votes); err != nil {
+			return err
+		}
+		at := options[optionID]
+		polls[at.postID].Options[at.index].Votes = votes
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	voters := `SELECT v.option_id, u.username FROM Poll_Votes v
+		JOIN Polls p ON p.post_id = v.post_id
+		JOIN Users u ON u.user_id = v.user_id
+		WHERE NOT p.anonymous AND v.post_id` + in + " ORDER BY u.username"
+	err = s.eachRow(voters, args, func(row rowScanner) error {
+		var optionID int64
+		var username string
+		if err := row.Scan(&optionID, &username); err != nil {
+			return err
+		}
+		at := options[optionID]
+		option := &polls[at.postID].Options[at.index]
+		option.Voters = append(option.Voters, username)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	mine := append([]interface{}{viewerID}, args...)
+	return s.eachRow("SELECT post_id, option_id FROM Poll_Votes WHERE user_id = ? AND post_id"+in+" ORDER BY option_id", mine, func(row rowScanner) error {
+		var postID int64
+		var optionID int
+		if err := row.Scan(&postID, &optionID); err != nil {
+			return err
+		}
+		poll := polls[postID]
+		poll.MyVotes = append(poll.MyVotes, optionID)
+		polls[postID] = poll
+		return nil
+	})
+}
+
+// eachRow runs a query and calls scan for every row of the result.
+func (s *Store) eachRow(query string, args []interface{}, scan func(row rowScanner) error) error {
+	rows, err := s.db.Query(s.q(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CastVote records the vote of userID for the given options of the poll of a post, or fails
+// with storage.ErrNotFound, storage.ErrPollClosed or storage.ErrAlreadyVoted, recording nothing.
+func (s *Store) CastVote(postID, userID int64, optionIDs []int64, votedAt time.Time) error {
+	if len(optionIDs) == 0 {
+		return storage.ErrNotFound
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var closesAt sql.NullTime
+	if err := tx.QueryRow(s.q("SELECT closes_at FROM Polls WHERE post_id = ?"), postID).Scan(&closesAt); err != nil {
+		return notFound(err)
+	}
+	if closesAt.Valid && !votedAt.Before(closesAt.Time) {
+		return storage.ErrPollClosed
+	}
+
+	// The primary key of Poll_Voters lets a single vote per user in
+	result, err := tx.Exec(s.q("INSERT INTO Poll_Voters(post_id, user_id, voted_at) VALUES (?,?,?) ON CONFLICT(post_id, user_id) DO NOTHING"),
+		postID, userID, votedAt)
+	if err != nil {
+		return err
+	}
+	if voted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if voted == 0 {
+		return storage.ErrAlreadyVoted
+	}
+
+	// Options of other polls are left out by the WHERE clause
+	unique := make(map[int64]bool, len(optionIDs))
+	ids := make([]int64, 0, len(optionIDs))
+	for _, optionID := range optionIDs {
+		if !unique[optionID] {
+			unique[optionID] = true
+			ids = append(ids, optionID)
+		}
+	}
+	placeholders, idArgs := inList(ids)
+	result, err = tx.Exec(s.q(`INSERT INTO Poll_Votes(post_id, option_id, user_id)
+		SELECT post_id, option_id, ? FROM Poll_Options WHERE post_id = ? AND option_id IN (`+placeholders+")"),
+		append([]interface{}{userID, postID}, idArgs...)...)
+	if err != nil {
+		return err
+	}
+	counted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if counted != int64(len(ids)) {
+		return storage.ErrNotFound
+	}
+	return tx.Commit()
+}
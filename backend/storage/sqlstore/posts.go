@@ -0,0 +1,168 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+const postSelect = "SELECT post_id, user_id, title, content, content_html, category_id, created_at, edited_at, deleted_at, deleted_by FROM Posts "
+
+// scanPost reads a row selected with postSelect.
+func scanPost(row rowScanner) (realtimeforum.Posts, error) {
+	var post realtimeforum.Posts
+	var editedAt, deletedAt sql.NullTime
+	var deletedBy sql.NullInt64
+	err := row.Scan(&post.PostID, &post.UserID, &post.Title, &post.Content, &post.ContentHTML, &post.CategoryID, &post.CreatedAt,
+		&editedAt, &deletedAt, &deletedBy)
+	if err != nil {
+		return realtimeforum.Posts{}, notFound(err)
+	}
+	if editedAt.Valid {
+		post.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		post.DeletedAt = &deletedAt.Time
+	}
+	post.DeletedBy = int(deletedBy.Int64)
+	return post, nil
+}
+
+// CreatePost stores a new post with its attachments and poll and returns its ID.
+func (s *Store) CreatePost(post realtimeforum.Posts) (int64, error) {
+	query := "INSERT INTO Posts(user_id, title, content, content_html, category_id, created_at) VALUES (?,?,?,?,?,?) RETURNING post_id"
+	args := []interface{}{post.UserID, post.Title, post.Content, post.ContentHTML, post.CategoryID, post.CreatedAt}
+	if post.Poll == nil {
+		return s.insertAttached(query, args, "post_id", int64(post.UserID), post.AttachmentIDs)
+	}
+	return s.insertTx(query, args, func(tx *sql.Tx, postID int64) error {
+		if err := s.attach(tx, "post_id", postID, int64(post.UserID), post.AttachmentIDs); err != nil {
+			return err
+		}
+		return s.insertPoll(tx, postID, *post.Poll)
+	})
+}
+
+// GetPost returns a post, deleted or not, or storage.ErrNotFound.
+func (s *Store) GetPost(postID int64) (realtimeforum.Posts, error) {
+	return scanPost(s.db.QueryRow(s.q(postSelect+"WHERE post_id = ?"), postID))
+}
+
+func (s *Store) GetAllPosts() ([]realtimeforum.Posts, error) {
+	return s.queryPosts(postSelect + "WHERE deleted_at IS NULL ORDER BY post_id")
+}
+
+// GetPostsVisibleTo returns every post except those written by users the viewer has blocked.
+func (s *Store) GetPostsVisibleTo(viewerID int64) ([]realtimeforum.Posts, error) {
+	query := postSelect + `
+	WHERE deleted_at IS NULL
+		AND user_id NOT IN (SELECT target_id FROM User_Relations WHERE user_id = ? AND kind = ?)
+	ORDER BY post_id`
+	return s.queryPosts(query, viewerID, realtimeforum.RelationBlock)
+}
+
+// GetDeletedPosts returns the deleted posts, most recently deleted first.
+func (s *Store) GetDeletedPosts() ([]realtimeforum.Posts, error) {
+	return s.queryPosts(postSelect + "WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, post_id DESC")
+}
+
+func (s *Store) queryPosts(query string, args ...interface{}) ([]realtimeforum.Posts, error) {
+	rows, err := s.db.Query(s.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []realtimeforum.Posts
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// EditPost keeps the current version of a post as a revision and replaces it, if check allows it.
+func (s *Store) EditPost(postID, editorID int64, edit realtimeforum.PostEdit, editedAt time.Time, check storage.PostCheck) (realtimeforum.Posts, error) {
+	return s.changePost(postID, check, func(tx *sql.Tx, post *realtimeforum.Posts) error {
+		_, err := tx.Exec(s.q(`INSERT INTO Post_Revisions(post_id, editor_id, title, content, category_id, revised_at)
+			VALUES (?,?,?,?,?,?)`), postID, editorID, post.Title, post.Content, post.CategoryID, editedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(s.q("UPDATE Posts SET title = ?, content = ?, content_html = ?, category_id = ?, edited_at = ? WHERE post_id = ?"),
+			edit.Title, edit.Content, edit.ContentHTML, edit.CategoryID, editedAt, postID)
+		if err != nil {
+			return err
+		}
+		post.Title, post.Content, post.ContentHTML, post.CategoryID = edit.Title, edit.Content, edit.ContentHTML, edit.CategoryID
+		post.EditedAt = &editedAt
+		return nil
+	})
+}
+
+// DeletePost soft-deletes a post, if check allows it. Its comments and revisions are kept.
+func (s *Store) DeletePost(postID, deletedBy int64, deletedAt time.Time, check storage.PostCheck) (realtimeforum.Posts, error) {
+	return s.changePost(postID, check, func(tx *sql.Tx, post *realtimeforum.Posts) error {
+		_, err := tx.Exec(s.q("UPDATE Posts SET deleted_at = ?, deleted_by = ? WHERE post_id = ? AND deleted_at IS NULL"),
+			deletedAt, deletedBy, postID)
+		if err != nil {
+			return err
+		}
+		post.DeletedAt = &deletedAt
+		post.DeletedBy = int(deletedBy)
+		return nil
+	})
+}
+
+// changePost reads a post in a transaction, locking it where the database supports it, and
+// applies change if check allows it.
+func (s *Store) changePost(postID int64, check storage.PostCheck, change func(tx *sql.Tx, post *realtimeforum.Posts) error) (realtimeforum.Posts, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	defer tx.Rollback()
+
+	post, err := scanPost(tx.QueryRow(s.q(s.forUpdate(postSelect+"WHERE post_id = ?", "Posts")), postID))
+	if err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	if err := check(post); err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	if err := change(tx, &post); err != nil {
+		return realtimeforum.Posts{}, err
+	}
+	return post, tx.Commit()
+}
+
+// GetPostRevisions returns the versions of a post replaced by edits, oldest first.
+func (s *Store) GetPostRevisions(postID int64) ([]realtimeforum.PostRevision, error) {
+	query := `
+	SELECT r.revision_id, r.post_id, r.title, r.content, r.category_id, r.editor_id, u.username, r.revised_at
+	FROM Post_Revisions r
+	JOIN Users u ON u.user_id = r.editor_id
+	WHERE r.post_id = ?
+	ORDER BY r.revised_at, r.revision_id`
+	rows, err := s.db.Query(s.q(query), postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []realtimeforum.PostRevision
+	for rows.Next() {
+		var r realtimeforum.PostRevision
+		err := rows.Scan(&r.RevisionID, &r.PostID, &r.Title, &r.Content, &r.CategoryID, &r.EditorID, &r.EditorUsername, &r.RevisedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
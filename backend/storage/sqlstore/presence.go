@@ -0,0 +1,22 @@
+package sqlstore
+
+import (
+	"time"
+)
+
+// TouchUser records activity of userID in online_users.
+func (s *Store) TouchUser(userID int64, at time.Time) error {
+	query := `INSERT INTO online_users(user_id, last_activity) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET last_activity = excluded.last_activity`
+	_, err := s.db.Exec(s.q(query), userID, timestamp(at))
+	return err
+}
+
+// RemoveInactiveUsers removes the users whose last activity is older than cutoff from online_users.
+func (s *Store) RemoveInactiveUsers(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(s.q("DELETE FROM online_users WHERE last_activity < ?"), timestamp(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
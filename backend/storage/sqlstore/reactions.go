@@ -0,0 +1,88 @@
+package sqlstore
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// reactionQueryBatch keeps the number of bound parameters per query below SQLite's limit.
+const reactionQueryBatch = 500
+
+// AddReaction records a reaction. Reacting twice with the same emoji is a no-op.
+func (s *Store) AddReaction(messageID, userID int64, emoji string, createdAt time.Time) error {
+	query := `INSERT INTO Reactions(message_id, user_id, emoji, created_at) VALUES (?,?,?,?)
+		ON CONFLICT(message_id, user_id, emoji) DO NOTHING`
+	_, err := s.db.Exec(s.q(query), messageID, userID, emoji, timestamp(createdAt))
+	return err
+}
+
+// RemoveReaction removes a reaction if it exists.
+func (s *Store) RemoveReaction(messageID, userID int64, emoji string) error {
+	_, err := s.db.Exec(s.q("DELETE FROM Reactions WHERE message_id = ? AND user_id = ? AND emoji = ?"), messageID, userID, emoji)
+	return err
+}
+
+// GetReactions returns the reactions of the given messages, aggregated per emoji
+// and keyed by message ID. Emoji are ordered by when they were first used on the message.
+func (s *Store) GetReactions(messageIDs []int64) (map[int64][]realtimeforum.ReactionSummary, error) {
+	reactions := make(map[int64][]realtimeforum.ReactionSummary)
+	for start := 0; start < len(messageIDs); start += reactionQueryBatch {
+		end := start + reactionQueryBatch
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+		if err := s.loadReactions(messageIDs[start:end], reactions); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, summaries := range reactions {
+		for _, summary := range summaries {
+			sort.Slice(summary.UserIDs, func(i, j int) bool { return summary.UserIDs[i] < summary.UserIDs[j] })
+		}
+	}
+	return reactions, nil
+}
+
+// loadReactions adds the reactions of one batch of messages to reactions.
+func (s *Store) loadReactions(messageIDs []int64, reactions map[int64][]realtimeforum.ReactionSummary) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messageIDs)), ",")
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+
+	query := "SELECT message_id, emoji, user_id FROM Reactions WHERE message_id IN (" + placeholders + ") ORDER BY created_at ASC, user_id ASC"
+	rows, err := s.db.Query(s.q(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID, userID int64
+		var emoji string
+		if err := rows.Scan(&messageID, &emoji, &userID); err != nil {
+			return err
+		}
+
+		summaries := reactions[messageID]
+		found := false
+		for i := range summaries {
+			if summaries[i].Emoji == emoji {
+				summaries[i].Count++
+				summaries[i].UserIDs = append(summaries[i].UserIDs, userID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			summaries = append(summaries, realtimeforum.ReactionSummary{Emoji: emoji, Count: 1, UserIDs: []int64{userID}})
+		}
+		reactions[messageID] = summaries
+	}
+	return rows.Err()
+}
@@ -0,0 +1,69 @@
+package sqlstore
+
+import (
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// AddUserRelation records that userID blocks or mutes targetID. Adding it twice is a no-op.
+func (s *Store) AddUserRelation(userID, targetID int64, kind string, createdAt time.Time) error {
+	query := `INSERT INTO User_Relations(user_id, target_id, kind, created_at) VALUES (?,?,?,?)
+		ON CONFLICT(user_id, target_id, kind) DO NOTHING`
+	_, err := s.db.Exec(s.q(query), userID, targetID, kind, timestamp(createdAt))
+	return err
+}
+
+// RemoveUserRelation removes a block or mute if it exists.
+func (s *Store) RemoveUserRelation(userID, targetID int64, kind string) error {
+	_, err := s.db.Exec(s.q("DELETE FROM User_Relations WHERE user_id = ? AND target_id = ? AND kind = ?"), userID, targetID, kind)
+	return err
+}
+
+// ListUserRelations returns the users that userID has blocked or muted, most recent first.
+func (s *Store) ListUserRelations(userID int64, kind string) ([]realtimeforum.UserRelation, error) {
+	query := `
+	SELECT r.user_id, r.target_id, u.username, r.kind, r.created_at
+	FROM User_Relations r
+	JOIN Users u ON r.target_id = u.user_id
+	WHERE r.user_id = ? AND r.kind = ?
+	ORDER BY r.created_at DESC, r.target_id ASC
+`
+	rows, err := s.db.Query(s.q(query), userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relations := []realtimeforum.UserRelation{}
+	for rows.Next() {
+		var relation realtimeforum.UserRelation
+		var createdAt string
+		if err := rows.Scan(&relation.UserID, &relation.TargetID, &relation.TargetUsername, &relation.Kind, &createdAt); err != nil {
+			return nil, err
+		}
+		if relation.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		relations = append(relations, relation)
+	}
+	return relations, rows.Err()
+}
+
+// HasUserRelation reports whether userID has blocked or muted targetID.
+func (s *Store) HasUserRelation(userID, targetID int64, kind string) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS(SELECT 1 FROM User_Relations WHERE user_id = ? AND target_id = ? AND kind = ?)"
+	err := s.db.QueryRow(s.q(query), userID, targetID, kind).Scan(&exists)
+	return exists, err
+}
+
+// GetRelationTargets returns the set of users that userID has blocked or muted.
+func (s *Store) GetRelationTargets(userID int64, kind string) (map[int64]bool, error) {
+	return s.queryIDSet("SELECT target_id FROM User_Relations WHERE user_id = ? AND kind = ?", userID, kind)
+}
+
+// GetRelationOwners returns the set of users who have blocked or muted targetID.
+func (s *Store) GetRelationOwners(targetID int64, kind string) (map[int64]bool, error) {
+	return s.queryIDSet("SELECT user_id FROM User_Relations WHERE target_id = ? AND kind = ?", targetID, kind)
+}
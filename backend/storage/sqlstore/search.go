@@ -0,0 +1,256 @@
+package sqlstore
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/search"
+)
+
+// searchSource describes how to search one kind of document. Every source selects the same
+// columns, in the order scanned by searchKind.
+type searchSource struct {
+	kind     string
+	index    string    // FTS5 table indexing the documents
+	table    string    // Table of the documents, with its alias
+	key      string    // Column the rowid of index refers to
+	joins    string    // Joins adding the author, as u, and other tables
+	columns  string    // ID, post ID, receiver ID, author ID, author name, title, category ID, creation time
+	text     []string  // Searched columns, in the order of the columns of index
+	weights  []float64 // Weight of each searched column
+	created  string    // Creation time column
+	category string    // Category column; empty when the documents have none
+	where    string    // Condition every document must meet, on the viewer's ID where it has ?
+	viewers  int       // Number of ? in where, each bound to the viewer's ID
+	textTime bool      // Times are stored as RFC3339 text, and compared with the same
+}
+
+var searchSources = []searchSource{
+	{
+		kind:     realtimeforum.SearchKindPost,
+		index:    "posts_fts",
+		table:    "Posts p",
+		key:      "p.post_id",
+		joins:    " JOIN Users u ON u.user_id = p.user_id",
+		columns:  "p.post_id, 0, 0, p.user_id, u.username, p.title, p.category_id, p.created_at",
+		text:     []string{"p.title", "p.content"},
+		weights:  []float64{search.TitleWeight, 1},
+		created:  "p.created_at",
+		category: "p.category_id",
+		where:    "p.deleted_at IS NULL",
+	},
+	{
+		kind:     realtimeforum.SearchKindComment,
+		index:    "comments_fts",
+		table:    "Comments c",
+		key:      "c.comment_id",
+		joins:    " JOIN Posts p ON p.post_id = c.post_id JOIN Users u ON u.user_id = c.author_id",
+		columns:  "c.comment_id, c.post_id, 0, c.author_id, u.username, p.title, p.category_id, c.created_at",
+		text:     []string{"c.content"},
+		weights:  []float64{1},
+		created:  "c.created_at",
+		category: "p.category_id",
+		where:    "p.deleted_at IS NULL", // Comments are kept with deleted posts, for moderators only
+	},
+	{
+		kind:     realtimeforum.SearchKindChat,
+		index:    "chats_fts",
+		table:    "Chats c",
+		key:      "c.message_id",
+		joins:    " JOIN Users u ON u.user_id = c.sender_id",
+		columns:  "c.message_id, 0, c.receiver_id, c.sender_id, u.username, '', 0, c.sent_at",
+		text:     []string{"c.message"},
+		weights:  []float64{1},
+		created:  "c.sent_at",
+		where:    "c.deleted_at IS NULL AND (c.receiver_id = 0 OR c.sender_id = ? OR c.receiver_id = ?)",
+		viewers:  2,
+		textTime: true,
+	},
+}
+
+// likeCandidates is how many of the most recent documents of each kind may match, at most,
+// without the full-text index. Each is read and evaluated, so a common word cannot make a search
+// read a whole table.
+const likeCandidates = 2000
+
+// Search uses the FTS5 index when SQLite has one, ranking with BM25 and cutting the snippets in
+// SQLite. Otherwise, and on PostgreSQL, the documents that may match are selected with LIKE and
+// ranked with search.Query.Evaluate, like the in-memory store does.
+func (s *Store) Search(q search.Query, viewerID int64, offset, limit int) ([]realtimeforum.SearchResult, error) {
+	var results []realtimeforum.SearchResult
+	for _, source := range searchSources {
+		if !q.Includes(source.kind) {
+			continue
+		}
+		// The best offset+limit documents of each kind hold the best offset+limit of all
+		found, err := s.searchKind(source, q, viewerID, offset+limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, found...)
+	}
+	return search.Page(results, offset, limit), nil
+}
+
+// searchKind returns the best limit documents of one source matching q. Without the full-text
+// index, they are the best of the most recent likeCandidates that may match.
+func (s *Store) searchKind(source searchSource, q search.Query, viewerID int64, limit int) ([]realtimeforum.SearchResult, error) {
+	var query strings.Builder
+	var args []interface{}
+	markers := search.NewMarkers()
+	query.WriteString("SELECT " + source.columns)
+	if s.fullText {
+		query.WriteString(", snippet(" + source.index + ", -1, ?, ?, ?, ?), bm25(" + source.index + ", " + weightList(source.weights) + ")")
+		query.WriteString(" FROM " + source.index + " JOIN " + source.table + " ON " + source.key + " = " + source.index + ".rowid")
+		args = append(args, markers.Start, markers.End, search.Ellipsis, search.SnippetWords)
+	} else {
+		query.WriteString(", " + strings.Join(source.text, ", "))
+		query.WriteString(" FROM " + source.table)
+	}
+	query.WriteString(source.joins + " WHERE 1 = 1")
+
+	if s.fullText {
+		query.WriteString(" AND " + source.index + " MATCH ?")
+		args = append(args, matchExpression(q))
+	} else {
+		// A prefilter only: Evaluate decides. LOWER only folds ASCII in SQLite, so words with
+		// other letters are left to Evaluate.
+		document := "LOWER(" + strings.Join(source.text, " || ' ' || ") + ")"
+		for _, term := range q.Terms {
+			for _, word := range term.Words {
+				if isASCII(word) {
+					query.WriteString(" AND " + document + " LIKE ?")
+					args = append(args, "%"+word+"%")
+				}
+			}
+		}
+	}
+	if source.where != "" {
+		query.WriteString(" AND " + source.where)
+		for i := 0; i < source.viewers; i++ {
+			args = append(args, viewerID)
+		}
+	}
+	// Like the list of posts, nothing written by users the viewer has blocked is shown
+	query.WriteString(" AND u.user_id NOT IN (SELECT target_id FROM User_Relations WHERE user_id = ? AND kind = ?)")
+	args = append(args, viewerID, realtimeforum.RelationBlock)
+	if q.Author != "" {
+		query.WriteString(" AND u.username = ?")
+		args = append(args, q.Author)
+	}
+	if q.Category != 0 {
+		query.WriteString(" AND " + source.category + " = ?")
+		args = append(args, q.Category)
+	}
+	if !q.Since.IsZero() {
+		query.WriteString(" AND " + source.created + " >= ?")
+		args = append(args, source.timeArg(q.Since))
+	}
+	if !q.Until.IsZero() {
+		query.WriteString(" AND " + source.created + " < ?")
+		args = append(args, source.timeArg(q.Until))
+	}
+	if s.fullText {
+		query.WriteString(" ORDER BY bm25(" + source.index + ", " + weightList(source.weights) + ") LIMIT ?")
+		args = append(args, limit)
+	} else {
+		query.WriteString(" ORDER BY " + source.created + " DESC, " + source.key + " DESC LIMIT ?")
+		args = append(args, max(limit, likeCandidates))
+	}
+
+	rows, err := s.db.Query(s.q(query.String()), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []realtimeforum.SearchResult
+	for rows.Next() {
+		result := realtimeforum.SearchResult{Kind: source.kind}
+		var createdAt string
+		dest := []interface{}{&result.ID, &result.PostID, &result.ReceiverID, &result.AuthorID, &result.AuthorUsername,
+			&result.Title, &result.CategoryID, &createdAt}
+		var snippet string
+		var rank float64
+		texts := make([]string, len(source.text))
+		if s.fullText {
+			dest = append(dest, &snippet, &rank)
+		} else {
+			for i := range texts {
+				dest = append(dest, &texts[i])
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if result.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+
+		if s.fullText {
+			// BM25 is lower for better matches
+			result.Score, result.Snippet = -rank, markers.Highlight(snippet)
+		} else {
+			fields := make([]search.Field, len(texts))
+			for i, text := range texts {
+				fields[i] = search.Field{Text: text, Weight: source.weights[i]}
+			}
+			score, snippet, ok := q.Evaluate(fields...)
+			if !ok {
+				continue
+			}
+			result.Score, result.Snippet = score, snippet
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !s.fullText {
+		search.Sort(results)
+		if len(results) > limit {
+			results = results[:limit]
+		}
+	}
+	return results, nil
+}
+
+// timeArg returns t as the creation times of the source are stored.
+func (source searchSource) timeArg(t time.Time) interface{} {
+	if source.textTime {
+		return timestamp(t)
+	}
+	return t.UTC()
+}
+
+// matchExpression writes q as an FTS5 query. Every term is quoted, so nothing the user typed
+// is read as FTS5 syntax; the words only hold letters and digits anyway.
+func matchExpression(q search.Query) string {
+	terms := make([]string, len(q.Terms))
+	for i, term := range q.Terms {
+		terms[i] = `"` + strings.Join(term.Words, " ") + `"`
+		if term.Prefix {
+			terms[i] += "*"
+		}
+	}
+	return strings.Join(terms, " AND ")
+}
+
+func weightList(weights []float64) string {
+	list := make([]string, len(weights))
+	for i, weight := range weights {
+		list[i] = strconv.FormatFloat(weight, 'f', -1, 64)
+	}
+	return strings.Join(list, ", ")
+}
+
+func isASCII(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if word[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package sqlstore
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// searchIndexTables are the FTS5 tables of SQLite's full-text index. They are external content
+// tables: they index the text of Posts, Comments and Chats without keeping a copy of it.
+var searchIndexTables = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(title, content, content='Posts', content_rowid='post_id')`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5(content, content='Comments', content_rowid='comment_id')`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS chats_fts USING fts5(message, content='Chats', content_rowid='message_id')`,
+}
+
+// searchIndexTriggers keep the full-text index in sync with the tables it indexes, by name.
+var searchIndexTriggers = map[string]string{
+	"search_posts_insert": `CREATE TRIGGER search_posts_insert AFTER INSERT ON Posts BEGIN
+		INSERT INTO posts_fts(rowid, title, content) VALUES (new.post_id, new.title, new.content);
+	END`,
+	"search_posts_delete": `CREATE TRIGGER search_posts_delete AFTER DELETE ON Posts BEGIN
+		INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.post_id, old.title, old.content);
+	END`,
+	"search_posts_update": `CREATE TRIGGER search_posts_update AFTER UPDATE OF title, content ON Posts BEGIN
+		INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.post_id, old.title, old.content);
+		INSERT INTO posts_fts(rowid, title, content) VALUES (new.post_id, new.title, new.content);
+	END`,
+	"search_comments_insert": `CREATE TRIGGER search_comments_insert AFTER INSERT ON Comments BEGIN
+		INSERT INTO comments_fts(rowid, content) VALUES (new.comment_id, new.content);
+	END`,
+	"search_comments_delete": `CREATE TRIGGER search_comments_delete AFTER DELETE ON Comments BEGIN
+		INSERT INTO comments_fts(comments_fts, rowid, content) VALUES ('delete', old.comment_id, old.content);
+	END`,
+	"search_comments_update": `CREATE TRIGGER search_comments_update AFTER UPDATE OF content ON Comments BEGIN
+		INSERT INTO comments_fts(comments_fts, rowid, content) VALUES ('delete', old.comment_id, old.content);
+		INSERT INTO comments_fts(rowid, content) VALUES (new.comment_id, new.content);
+	END`,
+	"search_chats_insert": `CREATE TRIGGER search_chats_insert AFTER INSERT ON Chats BEGIN
+		INSERT INTO chats_fts(rowid, message) VALUES (new.message_id, new.message);
+	END`,
+	"search_chats_delete": `CREATE TRIGGER search_chats_delete AFTER DELETE ON Chats BEGIN
+		INSERT INTO chats_fts(chats_fts, rowid, message) VALUES ('delete', old.message_id, old.message);
+	END`,
+	"search_chats_update": `CREATE TRIGGER search_chats_update AFTER UPDATE OF message ON Chats BEGIN
+		INSERT INTO chats_fts(chats_fts, rowid, message) VALUES ('delete', old.message_id, old.message);
+		INSERT INTO chats_fts(rowid, message) VALUES (new.message_id, new.message);
+	END`,
+}
+
+// hasFTS5 reports whether the SQLite library was built with FTS5, which go-sqlite3 only does
+// with the sqlite_fts5 build tag.
+func (s *Store) hasFTS5() (bool, error) {
+	var used bool
+	err := s.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	return used, err
+}
+
+// syncSearchIndex creates SQLite's full-text index when the library supports it. The index is
+// not part of the versioned migrations, since the same database may be opened by a build without
+// FTS5: such a build drops the triggers, which it could not run, and the next build with FTS5
+// finds them missing and rebuilds the index from the tables.
+func (s *Store) syncSearchIndex() error {
+	if !s.dialect.fullTextIndex {
+		return nil
+	}
+
+	names := make([]string, 0, len(searchIndexTriggers))
+	for name := range searchIndexTriggers {
+		names = append(names, "'"+name+"'")
+	}
+	var present int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (%s)", strings.Join(names, ", "))
+	if err := s.db.QueryRow(query).Scan(&present); err != nil {
+		return err
+	}
+
+	if !s.fullText {
+		if present == 0 {
+			return nil
+		}
+		for name := range searchIndexTriggers {
+			if _, err := s.db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return fmt.Errorf("dropping search index trigger %s: %w", name, err)
+			}
+		}
+		slog.Warn("SQLite was built without FTS5: the search index is no longer kept up to date and will be rebuilt by a build with it")
+		return nil
+	}
+	if present == len(searchIndexTriggers) {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	statements := append([]string(nil), searchIndexTables...)
+	for name, trigger := range searchIndexTriggers {
+		statements = append(statements, "DROP TRIGGER IF EXISTS "+name, trigger)
+	}
+	statements = append(statements,
+		"INSERT INTO posts_fts(posts_fts) VALUES ('rebuild')",
+		"INSERT INTO comments_fts(comments_fts) VALUES ('rebuild')",
+		"INSERT INTO chats_fts(chats_fts) VALUES ('rebuild')",
+	)
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("creating search index: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Built full-text search index")
+	return nil
+}
@@ -0,0 +1,82 @@
+package sqlstore_test
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"livechat-system/backend/storage"
+	"livechat-system/backend/storage/sqlstore"
+	"livechat-system/backend/storage/storagetest"
+)
+
+// envPostgresURL names a PostgreSQL server to run the suite against, such as
+// postgres://postgres@localhost/livechat_test?sslmode=disable. PostgreSQL is skipped without it.
+const envPostgresURL = "LIVECHAT_TEST_POSTGRES_URL"
+
+func TestMain(m *testing.M) {
+	// Every case migrates a new database; only warnings are worth showing
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	os.Exit(m.Run())
+}
+
+func TestSQLite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return openMigrated(t, sqlstore.DriverSQLite, filepath.Join(t.TempDir(), "forum.sqlite"))
+	})
+}
+
+// TestPostgres gives each case its own schema, selected through the search_path connection
+// parameter, so the cases start from an empty database without needing the permission to
+// create databases.
+func TestPostgres(t *testing.T) {
+	dataSource := os.Getenv(envPostgresURL)
+	if dataSource == "" {
+		t.Skip(envPostgresURL + " is not set")
+	}
+	admin, err := sql.Open("postgres", dataSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	n := 0
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		n++
+		schema := fmt.Sprintf("storetest_%d_%d", os.Getpid(), n)
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+				t.Errorf("dropping schema %s: %v", schema, err)
+			}
+		})
+
+		u, err := url.Parse(dataSource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return openMigrated(t, sqlstore.DriverPostgres, u.String())
+	})
+}
+
+func openMigrated(t *testing.T, driver, dataSource string) storage.Store {
+	t.Helper()
+	store, err := sqlstore.Open(driver, dataSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Migrate(); err != nil {
+		store.Close()
+		t.Fatal(err)
+	}
+	return store
+}
@@ -0,0 +1,101 @@
+package sqlstore
+
+import (
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+func (s *Store) GetAllUsers() ([]realtimeforum.User, error) {
+	rows, err := s.db.Query("SELECT user_id, username, age, gender, first_name, last_name, email, password FROM Users ORDER BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []realtimeforum.User
+	for rows.Next() {
+		var user realtimeforum.User
+		err := rows.Scan(&user.UserID, &user.Username, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &user.Password)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CreateUser stores a new user and returns its ID, or storage.ErrUserExists if the username or
+// the email is taken.
+func (s *Store) CreateUser(user realtimeforum.User) (int64, error) {
+	query := `INSERT INTO Users(username, age, gender, first_name, last_name, email, password)
+		VALUES (?,?,?,?,?,?,?) RETURNING user_id`
+	id, err := s.insert(query, user.Username, user.Age, user.Gender, user.FirstName, user.LastName, user.Email, user.Password)
+	if isUniqueViolation(err) {
+		return 0, storage.ErrUserExists
+	}
+	return id, err
+}
+
+// GetUserIDByUsername returns storage.ErrNotFound if no user has that name.
+func (s *Store) GetUserIDByUsername(username string) (int64, error) {
+	var userID int64
+	err := s.db.QueryRow(s.q("SELECT user_id FROM Users WHERE username = ?"), username).Scan(&userID)
+	return userID, notFound(err)
+}
+
+// GetUsernameByID returns storage.ErrNotFound if the user does not exist.
+func (s *Store) GetUsernameByID(userID int64) (string, error) {
+	var username string
+	err := s.db.QueryRow(s.q("SELECT username FROM Users WHERE user_id = ?"), userID).Scan(&username)
+	return username, notFound(err)
+}
+
+// GetCredentials returns the ID and the stored password of a user, or storage.ErrNotFound.
+func (s *Store) GetCredentials(username string) (int64, string, error) {
+	var userID int64
+	var password string
+	err := s.db.QueryRow(s.q("SELECT user_id, password FROM Users WHERE username = ?"), username).Scan(&userID, &password)
+	return userID, password, notFound(err)
+}
+
+// GetUserRole returns the role of a user, or storage.ErrNotFound.
+func (s *Store) GetUserRole(userID int64) (string, error) {
+	var role string
+	err := s.db.QueryRow(s.q("SELECT role FROM Users WHERE user_id = ?"), userID).Scan(&role)
+	return role, notFound(err)
+}
+
+// SetUserRole changes the role of a user, or returns storage.ErrNotFound.
+func (s *Store) SetUserRole(userID int64, role string) error {
+	result, err := s.db.Exec(s.q("UPDATE Users SET role = ? WHERE user_id = ?"), role, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// GetUsersWithRole returns the users with a role, by ID.
+func (s *Store) GetUsersWithRole(role string) ([]realtimeforum.UserRole, error) {
+	rows, err := s.db.Query(s.q("SELECT user_id, username, role FROM Users WHERE role = ? ORDER BY user_id"), role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []realtimeforum.UserRole
+	for rows.Next() {
+		var user realtimeforum.UserRole
+		if err := rows.Scan(&user.UserID, &user.Username, &user.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,245 @@
+// Package storage defines the repositories the forum and the chat are persisted through.
+// The services only depend on these interfaces, so the database behind them can be chosen
+// by configuration; package sqlstore implements them on SQLite and PostgreSQL, and package
+// memstore in memory for tests.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/search"
+)
+
+// ErrNotFound is returned when the requested row does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrUserExists is returned when a new user would take the username or email of another.
+var ErrUserExists = errors.New("username or email already taken")
+
+// ErrAttachmentUnavailable is returned when a post or message would be stored with an attachment
+// that does not exist, was uploaded by someone else or is already attached.
+var ErrAttachmentUnavailable = errors.New("attachment not found or already attached")
+
+// Errors returned when a vote cannot be counted.
+var (
+	ErrPollClosed   = errors.New("poll is closed")
+	ErrAlreadyVoted = errors.New("already voted in this poll")
+)
+
+// ErrMigrationsPending is returned by CheckMigrations when the schema is not up to date.
+var ErrMigrationsPending = errors.New("database migrations are pending")
+
+// Users stores the accounts.
+type Users interface {
+	GetAllUsers() ([]realtimeforum.User, error)
+	// CreateUser stores a new user and returns its ID.
+	CreateUser(user realtimeforum.User) (int64, error)
+	GetUserIDByUsername(username string) (int64, error)
+	GetUsernameByID(userID int64) (string, error)
+	// GetCredentials returns the ID and the stored password of a user.
+	GetCredentials(username string) (userID int64, password string, err error)
+	// GetUserRole returns the role of a user, realtimeforum.RoleUser unless changed, or ErrNotFound.
+	GetUserRole(userID int64) (string, error)
+	// SetUserRole changes the role of a user, or returns ErrNotFound.
+	SetUserRole(userID int64, role string) error
+	// GetUsersWithRole returns the users with a role, by ID.
+	GetUsersWithRole(role string) ([]realtimeforum.UserRole, error)
+}
+
+// PostCheck decides whether a post may be changed. Like ChangeCheck, it sees the post as
+// currently stored, in the same transaction as the change.
+type PostCheck func(current realtimeforum.Posts) error
+
+// Posts stores the forum posts with their edit history. Deleted posts are kept, with DeletedAt
+// set, but only GetPost and GetDeletedPosts return them.
+type Posts interface {
+	// CreatePost stores a new post and returns its ID. The uploads of the author in AttachmentIDs
+	// are attached to it in the same transaction, or it fails with ErrAttachmentUnavailable, and
+	// its Poll, if any, is stored with it.
+	CreatePost(post realtimeforum.Posts) (int64, error)
+	// GetPost returns a post, deleted or not, or ErrNotFound.
+	GetPost(postID int64) (realtimeforum.Posts, error)
+	GetAllPosts() ([]realtimeforum.Posts, error)
+	// GetPostsVisibleTo returns every post except those written by users the viewer has blocked.
+	GetPostsVisibleTo(viewerID int64) ([]realtimeforum.Posts, error)
+	// GetDeletedPosts returns the deleted posts, most recently deleted first.
+	GetDeletedPosts() ([]realtimeforum.Posts, error)
+	// EditPost keeps the current version as a revision and replaces it, if check allows it.
+	EditPost(postID, editorID int64, edit realtimeforum.PostEdit, editedAt time.Time, check PostCheck) (realtimeforum.Posts, error)
+	// DeletePost soft-deletes a post, if check allows it. Its comments and revisions are kept.
+	DeletePost(postID, deletedBy int64, deletedAt time.Time, check PostCheck) (realtimeforum.Posts, error)
+	// GetPostRevisions returns the versions of a post replaced by edits, oldest first, without Diff.
+	GetPostRevisions(postID int64) ([]realtimeforum.PostRevision, error)
+}
+
+// Comments stores the comments on forum posts. Comments are returned with AuthorUsername filled in.
+type Comments interface {
+	// CreateComment stores a new comment, with its ParentCommentID and Depth, and returns its ID.
+	CreateComment(comment realtimeforum.Comments) (int64, error)
+	// GetComment returns a single comment, or ErrNotFound.
+	GetComment(commentID int64) (realtimeforum.Comments, error)
+	// GetComments returns the comments of a post, every level of replies included, oldest first.
+	GetComments(postID int64) ([]realtimeforum.Comments, error)
+}
+
+// ChangeCheck decides whether a chat message may be changed. It sees the message as currently
+// stored and is called in the same transaction as the change, so no one can change the message
+// in between.
+type ChangeCheck func(current realtimeforum.Chats) error
+
+// Chats stores private and lobby chat messages with their edit history and reactions.
+// Messages are returned with SenderUsername filled in, and without content once deleted.
+type Chats interface {
+	// SaveChat stores a new message and returns its ID. A message whose sender already
+	// stored one with the same ClientMessageID fails with a uniqueness violation. Like
+	// CreatePost, the uploads of the sender in AttachmentIDs are attached to it.
+	SaveChat(chat realtimeforum.Chats) (int64, error)
+	GetChat(messageID int64) (realtimeforum.Chats, error)
+	GetChatByClientID(senderID int64, clientMessageID string) (realtimeforum.Chats, error)
+	// GetChatHistory returns the messages exchanged between two users, oldest first, without reactions.
+	GetChatHistory(userA, userB int64) ([]realtimeforum.Chats, error)
+	// MarkChatDelivered records the first time a message reached a recipient; later calls are no-ops.
+	MarkChatDelivered(messageID int64, deliveredAt time.Time) error
+	// EditChat keeps the current content as a revision and replaces it and its rendering, if check allows it.
+	EditChat(messageID int64, content, contentHTML string, editedAt time.Time, check ChangeCheck) (realtimeforum.Chats, error)
+	// DeleteChat soft-deletes a message, if check allows it.
+	DeleteChat(messageID int64, deletedAt time.Time, check ChangeCheck) (realtimeforum.Chats, error)
+	// PurgeDeletedChats permanently removes messages deleted before cutoff, with their revisions and reactions.
+	PurgeDeletedChats(cutoff time.Time) (int64, error)
+	// PurgeChatRevisions removes the revisions recorded before cutoff.
+	PurgeChatRevisions(cutoff time.Time) (int64, error)
+
+	// AddReaction records a reaction; adding it twice is a no-op.
+	AddReaction(messageID, userID int64, emoji string, createdAt time.Time) error
+	// RemoveReaction removes a reaction; removing one that does not exist is a no-op.
+	RemoveReaction(messageID, userID int64, emoji string) error
+	// GetReactions returns the reactions of the given messages aggregated per emoji, keyed by
+	// message ID. Emoji are ordered by first use and user IDs in increasing order.
+	GetReactions(messageIDs []int64) (map[int64][]realtimeforum.ReactionSummary, error)
+}
+
+// Attachments stores the files uploaded by users, which are attached to posts and chat messages.
+// Their content is kept in a blob store; the rows record the keys of the blobs.
+type Attachments interface {
+	// CreateAttachment stores a new upload, not attached to anything yet, and returns its ID.
+	CreateAttachment(attachment realtimeforum.Attachment) (int64, error)
+	// GetAttachment returns an attachment, or ErrNotFound.
+	GetAttachment(attachmentID int64) (realtimeforum.Attachment, error)
+	// GetPostAttachments returns the attachments of the given posts, keyed by post ID, in the order they were uploaded.
+	GetPostAttachments(postIDs []int64) (map[int64][]realtimeforum.Attachment, error)
+	// GetChatAttachments returns the attachments of the given messages, keyed by message ID, in the order they were uploaded.
+	GetChatAttachments(messageIDs []int64) (map[int64][]realtimeforum.Attachment, error)
+	// PurgeOrphanAttachments removes the uploads created before cutoff and never attached, and
+	// the attachments of messages that were purged. It returns them, so their blobs can be deleted.
+	PurgeOrphanAttachments(cutoff time.Time) ([]realtimeforum.Attachment, error)
+}
+
+// Polls stores the polls of posts, which CreatePost stores with their post, and their votes.
+type Polls interface {
+	// GetPolls returns the polls of the given posts, keyed by post ID, with their options in
+	// order and their votes counted. MyVotes holds the options viewerID voted for, and the options
+	// of polls that are not anonymous list their voters by username. Closed is left to the caller.
+	GetPolls(postIDs []int64, viewerID int64) (map[int64]realtimeforum.Poll, error)
+	// CastVote records the vote of userID for the given options of the poll of a post, all at
+	// once. It fails, recording nothing, with ErrNotFound when the post has no poll or an option
+	// is not one of its options, ErrPollClosed when the poll closed at or before votedAt and
+	// ErrAlreadyVoted when the user already voted.
+	CastVote(postID, userID int64, optionIDs []int64, votedAt time.Time) error
+}
+
+// Bookmarks stores the posts users bookmarked.
+type Bookmarks interface {
+	// AddBookmark bookmarks a post for userID; adding it twice is a no-op.
+	AddBookmark(userID, postID int64, createdAt time.Time) error
+	// RemoveBookmark removes a bookmark; removing one that does not exist is a no-op.
+	RemoveBookmark(userID, postID int64) error
+	// GetBookmarkedPosts returns the posts userID bookmarked that are not deleted, most recently
+	// bookmarked first.
+	GetBookmarkedPosts(userID int64) ([]realtimeforum.Posts, error)
+}
+
+// Watches stores the posts and categories users watch.
+type Watches interface {
+	// AddWatch records that userID watches a post or a category; adding it twice is a no-op.
+	AddWatch(userID int64, kind string, targetID int64, createdAt time.Time) error
+	// RemoveWatch removes a watch; removing one that does not exist is a no-op.
+	RemoveWatch(userID int64, kind string, targetID int64) error
+	// ListWatches returns the watches of userID, most recent first.
+	ListWatches(userID int64) ([]realtimeforum.Watch, error)
+	// GetWatchers returns the users who watch the post or the category targetID.
+	GetWatchers(kind string, targetID int64) (map[int64]bool, error)
+}
+
+// Notifications stores the notifications of users until they are read, and after.
+type Notifications interface {
+	// CreateNotifications stores a copy of notification for each of userIDs, with its UserID
+	// set, and returns their IDs in the same order. ActorUsername and PostTitle are not stored.
+	CreateNotifications(notification realtimeforum.Notification, userIDs []int64) ([]int64, error)
+	// GetNotifications returns up to limit notifications of userID, most recent first, starting
+	// before the notification beforeID, or with the most recent one when beforeID is 0.
+	GetNotifications(userID, beforeID int64, limit int) ([]realtimeforum.Notification, error)
+	// MarkNotificationsRead marks the unread notifications of userID up to upToID as read at
+	// readAt, or all of them when upToID is 0, and returns how many it marked.
+	MarkNotificationsRead(userID, upToID int64, readAt time.Time) (int64, error)
+	// CountUnreadNotifications returns the number of notifications of userID not read yet.
+	CountUnreadNotifications(userID int64) (int, error)
+}
+
+// Relations stores the blocks and mutes between users.
+type Relations interface {
+	// AddUserRelation records a relation; adding it twice is a no-op.
+	AddUserRelation(userID, targetID int64, kind string, createdAt time.Time) error
+	// RemoveUserRelation removes a relation; removing one that does not exist is a no-op.
+	RemoveUserRelation(userID, targetID int64, kind string) error
+	// ListUserRelations returns the relations of userID of one kind, most recent first.
+	ListUserRelations(userID int64, kind string) ([]realtimeforum.UserRelation, error)
+	HasUserRelation(userID, targetID int64, kind string) (bool, error)
+	// GetRelationTargets returns the users userID has a relation of this kind with.
+	GetRelationTargets(userID int64, kind string) (map[int64]bool, error)
+	// GetRelationOwners returns the users who have a relation of this kind with targetID.
+	GetRelationOwners(targetID int64, kind string) (map[int64]bool, error)
+}
+
+// Presence stores when each user was last active.
+type Presence interface {
+	// TouchUser records activity of userID at the given time.
+	TouchUser(userID int64, at time.Time) error
+	// RemoveInactiveUsers forgets the users last active before cutoff and returns how many there were.
+	RemoveInactiveUsers(cutoff time.Time) (int64, error)
+}
+
+// Search finds posts, comments and chat messages.
+type Search interface {
+	// Search returns the posts, comments and chat messages matching q, best first, skipping the
+	// first offset and returning at most limit. Chat messages are limited to the lobby and the
+	// private conversations of viewerID. Deleted chat messages and posts, and comments on deleted
+	// posts, are never returned, nor is anything written by users viewerID has blocked.
+	Search(q search.Query, viewerID int64, offset, limit int) ([]realtimeforum.SearchResult, error)
+}
+
+// Store gives access to every repository of one database.
+type Store interface {
+	Users
+	Posts
+	Comments
+	Chats
+	Attachments
+	Polls
+	Relations
+	Bookmarks
+	Watches
+	Notifications
+	Presence
+	Search
+
+	// Migrate brings the schema up to date.
+	Migrate() error
+	// CheckMigrations returns ErrMigrationsPending if the schema is not up to date.
+	CheckMigrations(ctx context.Context) error
+	// Ping checks that the database can be reached.
+	Ping(ctx context.Context) error
+	Close() error
+}
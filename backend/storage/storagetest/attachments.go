@@ -0,0 +1,113 @@
+package storagetest
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+func testAttachments(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob")
+	if !ok {
+		return
+	}
+	alice, bob := ids[0], ids[1]
+	upload := func(uploaderID int64, name string, minutes int) int64 {
+		id, err := s.CreateAttachment(realtimeforum.Attachment{
+			UploaderID: int(uploaderID), Filename: name, ContentType: "image/png", Size: 1234, Width: 640, Height: 480,
+			BlobKey: name + "-blob", ThumbnailKey: name + "-thumbnail", CreatedAt: at(minutes),
+		})
+		noError(t, err, "CreateAttachment "+name)
+		return id
+	}
+	photo, document, other := upload(alice, "photo.png", 0), upload(alice, "document.png", 0), upload(bob, "other.png", 0)
+
+	got, err := s.GetAttachment(photo)
+	if noError(t, err, "GetAttachment") {
+		equal(t, got, realtimeforum.Attachment{
+			AttachmentID: int(photo), UploaderID: int(alice), Filename: "photo.png", ContentType: "image/png", Size: 1234,
+			Width: 640, Height: 480, HasThumbnail: true, CreatedAt: at(0), BlobKey: "photo.png-blob", ThumbnailKey: "photo.png-thumbnail",
+		}, "stored attachment")
+	}
+	_, err = s.GetAttachment(photo + 1000)
+	notFound(t, err, "GetAttachment of a missing attachment")
+
+	// Nothing is stored when one of the attachments belongs to someone else
+	post := realtimeforum.Posts{UserID: int(alice), Title: "Holidays", Content: "Pictures", CategoryID: 1, CreatedAt: at(1)}
+	post.AttachmentIDs = []int64{photo, other}
+	if _, err := s.CreatePost(post); !errors.Is(err, storage.ErrAttachmentUnavailable) {
+		t.Errorf("CreatePost with another user's upload: got error %v, want storage.ErrAttachmentUnavailable", err)
+	}
+	posts, err := s.GetAllPosts()
+	if noError(t, err, "GetAllPosts") {
+		equal(t, len(posts), 0, "posts stored by a failed CreatePost")
+	}
+
+	post.AttachmentIDs = []int64{photo, photo}
+	postID, err := s.CreatePost(post)
+	if !noError(t, err, "CreatePost with an attachment") {
+		return
+	}
+	if stored, err := s.GetPost(postID); noError(t, err, "GetPost") {
+		equal(t, len(stored.AttachmentIDs)+len(stored.Attachments), 0, "attachments returned by GetPost")
+	}
+	byPost, err := s.GetPostAttachments([]int64{postID, postID + 1000})
+	if noError(t, err, "GetPostAttachments") {
+		equal(t, attachmentIDs(byPost[postID]), []int64{photo}, "attachments of the post")
+		equal(t, byPost[postID][0].PostID, int(postID), "post of the attachment")
+		equal(t, len(byPost), 1, "posts with attachments")
+	}
+	if _, err := s.CreatePost(post); !errors.Is(err, storage.ErrAttachmentUnavailable) {
+		t.Errorf("CreatePost with an upload already attached: got error %v, want storage.ErrAttachmentUnavailable", err)
+	}
+
+	message := realtimeforum.Chats{SenderID: int(alice), ReceiverID: int(bob), MessageContent: "The report", SentAt: at(2)}
+	message.AttachmentIDs = []int64{document}
+	messageID, err := s.SaveChat(message)
+	if !noError(t, err, "SaveChat with an attachment") {
+		return
+	}
+	byMessage, err := s.GetChatAttachments([]int64{messageID})
+	if noError(t, err, "GetChatAttachments") {
+		equal(t, attachmentIDs(byMessage[messageID]), []int64{document}, "attachments of the message")
+	}
+	stolen := realtimeforum.Chats{SenderID: int(bob), ReceiverID: int(alice), MessageContent: "Mine now", SentAt: at(3)}
+	stolen.AttachmentIDs = []int64{document}
+	if _, err := s.SaveChat(stolen); !errors.Is(err, storage.ErrAttachmentUnavailable) {
+		t.Errorf("SaveChat with another user's upload: got error %v, want storage.ErrAttachmentUnavailable", err)
+	}
+
+	// Uploads never attached are purged once old enough, like the attachments of purged messages
+	recent := upload(alice, "recent.png", 60)
+	allow := func(realtimeforum.Chats) error { return nil }
+	if _, err := s.DeleteChat(messageID, at(4), allow); !noError(t, err, "DeleteChat") {
+		return
+	}
+	if _, err := s.PurgeDeletedChats(at(5)); !noError(t, err, "PurgeDeletedChats") {
+		return
+	}
+	purged, err := s.PurgeOrphanAttachments(at(30))
+	if noError(t, err, "PurgeOrphanAttachments") {
+		equal(t, attachmentIDs(purged), []int64{document, other}, "purged attachments")
+	}
+	_, err = s.GetAttachment(other)
+	notFound(t, err, "GetAttachment of a purged upload")
+	for _, id := range []int64{photo, recent} {
+		if _, err := s.GetAttachment(id); err != nil {
+			t.Errorf("attachment %d should have been kept: %v", id, err)
+		}
+	}
+}
+
+// attachmentIDs returns the IDs of attachments in increasing order.
+func attachmentIDs(attachments []realtimeforum.Attachment) []int64 {
+	ids := []int64{}
+	for _, a := range attachments {
+		ids = append(ids, int64(a.AttachmentID))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,660 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+func testMigrations(t *testing.T, s storage.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	noError(t, s.Ping(ctx), "ping")
+	noError(t, s.CheckMigrations(ctx), "checking migrations of a migrated store")
+	noError(t, s.Migrate(), "migrating twice")
+}
+
+func testUsers(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob")
+	if !ok {
+		return
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("users got the same ID %d", ids[0])
+	}
+
+	id, err := s.GetUserIDByUsername("bob")
+	if noError(t, err, "GetUserIDByUsername") {
+		equal(t, id, ids[1], "ID of bob")
+	}
+	name, err := s.GetUsernameByID(ids[0])
+	if noError(t, err, "GetUsernameByID") {
+		equal(t, name, "alice", "name of the first user")
+	}
+	id, password, err := s.GetCredentials("alice")
+	if noError(t, err, "GetCredentials") {
+		equal(t, id, ids[0], "ID in the credentials")
+		equal(t, password, "alice-password", "password in the credentials")
+	}
+
+	_, err = s.GetUserIDByUsername("nobody")
+	notFound(t, err, "GetUserIDByUsername of an unknown user")
+	_, err = s.GetUsernameByID(ids[1] + 1000)
+	notFound(t, err, "GetUsernameByID of an unknown user")
+	_, _, err = s.GetCredentials("nobody")
+	notFound(t, err, "GetCredentials of an unknown user")
+
+	if _, err := s.CreateUser(realtimeforum.User{Username: "alice", Email: "other@example.com"}); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("creating a second user named alice: got %v, want %v", err, storage.ErrUserExists)
+	}
+	if _, err := s.CreateUser(realtimeforum.User{Username: "carol", Email: "bob@example.com"}); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("creating a user with the email of bob: got %v, want %v", err, storage.ErrUserExists)
+	}
+
+	role, err := s.GetUserRole(ids[0])
+	if noError(t, err, "GetUserRole") {
+		equal(t, role, realtimeforum.RoleUser, "role of a new user")
+	}
+	if noError(t, s.SetUserRole(ids[1], realtimeforum.RoleModerator), "SetUserRole") {
+		role, err := s.GetUserRole(ids[1])
+		if noError(t, err, "GetUserRole of a moderator") {
+			equal(t, role, realtimeforum.RoleModerator, "role of bob")
+		}
+		moderators, err := s.GetUsersWithRole(realtimeforum.RoleModerator)
+		if noError(t, err, "GetUsersWithRole") {
+			equal(t, moderators, []realtimeforum.UserRole{{UserID: int(ids[1]), Username: "bob", Role: realtimeforum.RoleModerator}}, "moderators")
+		}
+	}
+	_, err = s.GetUserRole(ids[1] + 1000)
+	notFound(t, err, "GetUserRole of an unknown user")
+	notFound(t, s.SetUserRole(ids[1]+1000, realtimeforum.RoleModerator), "SetUserRole of an unknown user")
+
+	users, err := s.GetAllUsers()
+	if noError(t, err, "GetAllUsers") {
+		equal(t, len(users), 2, "number of users")
+		if len(users) == 2 {
+			equal(t, users[0].Username, "alice", "first user")
+			equal(t, users[0].Email, "alice@example.com", "email of the first user")
+			equal(t, int64(users[1].UserID), ids[1], "ID of the second user")
+		}
+	}
+}
+
+func testPosts(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	for i, author := range ids {
+		_, err := s.CreatePost(realtimeforum.Posts{UserID: int(author), Title: "title", Content: "content", CategoryID: 1, CreatedAt: at(i)})
+		if !noError(t, err, "CreatePost") {
+			return
+		}
+	}
+
+	posts, err := s.GetAllPosts()
+	if noError(t, err, "GetAllPosts") {
+		equal(t, len(posts), 3, "number of posts")
+		if len(posts) == 3 {
+			equal(t, int64(posts[2].UserID), ids[2], "author of the last post")
+			equal(t, posts[2].Title, "title", "title")
+			if !posts[2].CreatedAt.Equal(at(2)) {
+				t.Errorf("created_at: got %v, want %v", posts[2].CreatedAt, at(2))
+			}
+		}
+	}
+
+	// Alice blocked Bob and muted Carol: only Bob's post is hidden from her
+	if !noError(t, s.AddUserRelation(ids[0], ids[1], realtimeforum.RelationBlock, at(0)), "blocking") ||
+		!noError(t, s.AddUserRelation(ids[0], ids[2], realtimeforum.RelationMute, at(0)), "muting") {
+		return
+	}
+	posts, err = s.GetPostsVisibleTo(ids[0])
+	if noError(t, err, "GetPostsVisibleTo") {
+		var authors []int64
+		for _, post := range posts {
+			authors = append(authors, int64(post.UserID))
+		}
+		equal(t, authors, []int64{ids[0], ids[2]}, "authors of the posts visible to alice")
+	}
+	posts, err = s.GetPostsVisibleTo(ids[1])
+	if noError(t, err, "GetPostsVisibleTo") {
+		equal(t, len(posts), 3, "number of posts visible to bob")
+	}
+}
+
+func testPostEdits(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob")
+	if !ok {
+		return
+	}
+	alice, bob := ids[0], ids[1]
+	id, err := s.CreatePost(realtimeforum.Posts{UserID: int(alice), Title: "original", Content: "first line\nsecond line",
+		ContentHTML: "<p>first line<br>second line</p>", CategoryID: 1, CreatedAt: at(0)})
+	if !noError(t, err, "CreatePost") {
+		return
+	}
+	commentID, err := s.CreateComment(realtimeforum.Comments{AuthorID: int(bob), PostID: int(id), Content: "kept", CreatedAt: at(1)})
+	if !noError(t, err, "CreateComment") {
+		return
+	}
+
+	var seen realtimeforum.Posts
+	edit := realtimeforum.PostEdit{Title: "edited", Content: "first line\nchanged line", ContentHTML: "<p>first line<br>changed line</p>", CategoryID: 2}
+	edited, err := s.EditPost(id, alice, edit, at(2), func(current realtimeforum.Posts) error {
+		seen = current
+		return nil
+	})
+	if noError(t, err, "EditPost") {
+		equal(t, seen.Title, "original", "title seen by the check")
+		equal(t, seen.ContentHTML, "<p>first line<br>second line</p>", "rendering seen by the check")
+		equal(t, []interface{}{edited.Title, edited.Content, edited.ContentHTML, edited.CategoryID},
+			[]interface{}{edit.Title, edit.Content, edit.ContentHTML, edit.CategoryID}, "post returned by EditPost")
+		if edited.EditedAt == nil || !edited.EditedAt.Equal(at(2)) {
+			t.Errorf("edited_at returned by EditPost: got %v, want %v", edited.EditedAt, at(2))
+		}
+	}
+	_, err = s.EditPost(id, bob, realtimeforum.PostEdit{Title: "moderated", Content: "by bob", CategoryID: 2}, at(3), func(realtimeforum.Posts) error { return nil })
+	noError(t, err, "second EditPost")
+	_, err = s.EditPost(id, bob, realtimeforum.PostEdit{Title: "refused"}, at(4), func(realtimeforum.Posts) error { return errRefused })
+	if !errors.Is(err, errRefused) {
+		t.Errorf("EditPost refused by its check: got error %v, want the check's error", err)
+	}
+	_, err = s.EditPost(id+1000, alice, edit, at(4), func(realtimeforum.Posts) error { return nil })
+	notFound(t, err, "EditPost of an unknown post")
+
+	post, err := s.GetPost(id)
+	if noError(t, err, "GetPost") {
+		equal(t, post.Title, "moderated", "title after a refused edit")
+		equal(t, post.ContentHTML, "", "rendering of an edit without one")
+		if post.EditedAt == nil || !post.EditedAt.Equal(at(3)) {
+			t.Errorf("edited_at: got %v, want %v", post.EditedAt, at(3))
+		}
+		equal(t, post.DeletedAt == nil, true, "post not deleted yet")
+	}
+	revisions, err := s.GetPostRevisions(id)
+	if noError(t, err, "GetPostRevisions") {
+		equal(t, len(revisions), 2, "number of revisions")
+	}
+	if len(revisions) == 2 {
+		first, second := revisions[0], revisions[1]
+		equal(t, []interface{}{first.Title, first.Content, first.CategoryID, first.EditorUsername},
+			[]interface{}{"original", "first line\nsecond line", 1, "alice"}, "first revision")
+		equal(t, []interface{}{second.Title, second.EditorID, second.EditorUsername}, []interface{}{"edited", int(bob), "bob"}, "second revision")
+		if !first.RevisedAt.Equal(at(2)) {
+			t.Errorf("revised_at of the first revision: got %v, want %v", first.RevisedAt, at(2))
+		}
+	}
+
+	_, err = s.DeletePost(id, bob, at(5), func(realtimeforum.Posts) error { return errRefused })
+	if !errors.Is(err, errRefused) {
+		t.Errorf("DeletePost refused by its check: got error %v, want the check's error", err)
+	}
+	deleted, err := s.DeletePost(id, bob, at(5), func(realtimeforum.Posts) error { return nil })
+	if noError(t, err, "DeletePost") {
+		if deleted.DeletedAt == nil || !deleted.DeletedAt.Equal(at(5)) {
+			t.Errorf("deleted_at returned by DeletePost: got %v, want %v", deleted.DeletedAt, at(5))
+		}
+		equal(t, deleted.DeletedBy, int(bob), "deleted_by returned by DeletePost")
+	}
+	_, err = s.DeletePost(id, alice, at(6), func(current realtimeforum.Posts) error {
+		equal(t, current.DeletedAt != nil, true, "deleted post seen by the check")
+		return errRefused
+	})
+	if !errors.Is(err, errRefused) {
+		t.Errorf("deleting a deleted post: got error %v, want the check's error", err)
+	}
+
+	// A deleted post is only returned by GetPost and GetDeletedPosts, and its comments are kept
+	post, err = s.GetPost(id)
+	if noError(t, err, "GetPost after delete") {
+		equal(t, post.Title, "moderated", "title of a deleted post")
+		equal(t, post.DeletedBy, int(bob), "deleted_by")
+	}
+	if posts, err := s.GetAllPosts(); noError(t, err, "GetAllPosts") {
+		equal(t, len(posts), 0, "number of posts after delete")
+	}
+	if posts, err := s.GetPostsVisibleTo(alice); noError(t, err, "GetPostsVisibleTo") {
+		equal(t, len(posts), 0, "number of posts visible after delete")
+	}
+	if posts, err := s.GetDeletedPosts(); noError(t, err, "GetDeletedPosts") {
+		equal(t, len(posts), 1, "number of deleted posts")
+	}
+	if comments, err := s.GetComments(id); noError(t, err, "GetComments of a deleted post") {
+		equal(t, len(comments), 1, "number of comments kept")
+		if len(comments) == 1 {
+			equal(t, comments[0].CommentID, int(commentID), "comment kept")
+		}
+	}
+	if results, err := s.Search(mustParse("moderated"), alice, 0, 10); noError(t, err, "searching a deleted post") {
+		equal(t, len(results), 0, "search results of a deleted post")
+	}
+	if results, err := s.Search(mustParse("kept"), alice, 0, 10); noError(t, err, "searching a comment of a deleted post") {
+		equal(t, len(results), 0, "search results of a comment of a deleted post")
+	}
+}
+
+func testComments(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob")
+	if !ok {
+		return
+	}
+	postID, err := s.CreatePost(realtimeforum.Posts{UserID: int(ids[0]), Title: "t", Content: "c", CategoryID: 1, CreatedAt: at(0)})
+	if !noError(t, err, "CreatePost") {
+		return
+	}
+	otherPostID, err := s.CreatePost(realtimeforum.Posts{UserID: int(ids[0]), Title: "t", Content: "c", CategoryID: 1, CreatedAt: at(0)})
+	if !noError(t, err, "CreatePost") {
+		return
+	}
+
+	comments, err := s.GetComments(postID)
+	if noError(t, err, "GetComments without comments") && (comments == nil || len(comments) != 0) {
+		t.Errorf("GetComments without comments: got %v, want an empty non-nil slice", comments)
+	}
+
+	// Inserted out of order: comments are listed by creation time
+	for _, comment := range []realtimeforum.Comments{
+		{AuthorID: int(ids[1]), PostID: int(postID), Content: "second", CreatedAt: at(2)},
+		{AuthorID: int(ids[0]), PostID: int(postID), Content: "first", CreatedAt: at(1)},
+		{AuthorID: int(ids[0]), PostID: int(otherPostID), Content: "elsewhere", CreatedAt: at(1)},
+	} {
+		if _, err := s.CreateComment(comment); !noError(t, err, "CreateComment") {
+			return
+		}
+	}
+	comments, err = s.GetComments(postID)
+	if noError(t, err, "GetComments") {
+		var contents []string
+		for _, comment := range comments {
+			contents = append(contents, comment.Content)
+		}
+		equal(t, contents, []string{"first", "second"}, "comments of the post")
+		if len(comments) == 2 {
+			equal(t, int64(comments[1].AuthorID), ids[1], "author of the second comment")
+			if !comments[1].CreatedAt.Equal(at(2)) {
+				t.Errorf("created_at: got %v, want %v", comments[1].CreatedAt, at(2))
+			}
+			equal(t, comments[1].AuthorUsername, "bob", "author username of the second comment")
+			equal(t, comments[1].ParentCommentID, 0, "parent of a top-level comment")
+		}
+	}
+
+	// A reply records its parent and depth
+	parentID := 0
+	if len(comments) > 0 {
+		parentID = comments[0].CommentID
+	}
+	replyID, err := s.CreateComment(realtimeforum.Comments{AuthorID: int(ids[1]), PostID: int(postID),
+		ParentCommentID: parentID, Depth: 1, Content: "reply", ContentHTML: "<p>reply</p>", CreatedAt: at(3)})
+	if !noError(t, err, "CreateComment reply") {
+		return
+	}
+	if reply, err := s.GetComment(replyID); noError(t, err, "GetComment") {
+		equal(t, reply.ParentCommentID, parentID, "parent of the reply")
+		equal(t, reply.Depth, 1, "depth of the reply")
+		equal(t, reply.ContentHTML, "<p>reply</p>", "rendering of the reply")
+		equal(t, reply.AuthorUsername, "bob", "author username of the reply")
+		equal(t, int64(reply.PostID), postID, "post of the reply")
+	}
+	if comments, err := s.GetComments(postID); noError(t, err, "GetComments with a reply") {
+		equal(t, len(comments), 3, "comments of the post, replies included")
+	}
+	if _, err := s.GetComment(replyID + 100); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetComment of an unknown comment: got %v, want ErrNotFound", err)
+	}
+}
+
+func testChats(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	alice, bob, carol := ids[0], ids[1], ids[2]
+
+	send := func(from, to int64, text, clientID string, minute int) int64 {
+		id, err := s.SaveChat(realtimeforum.Chats{SenderID: int(from), ReceiverID: int(to), MessageContent: text,
+			SentAt: at(minute), ClientMessageID: clientID})
+		noError(t, err, "SaveChat "+text)
+		return id
+	}
+	first := send(alice, bob, "hi bob", "c1", 1)
+	send(bob, alice, "hi alice", "", 2)
+	send(alice, carol, "hi carol", "", 3)
+	send(alice, realtimeforum.LobbyReceiverID, "hi all", "", 4)
+
+	chat, err := s.GetChat(first)
+	if noError(t, err, "GetChat") {
+		equal(t, chat.MessageContent, "hi bob", "content")
+		equal(t, chat.SenderUsername, "alice", "sender username")
+		equal(t, chat.ClientMessageID, "c1", "client message ID")
+		equal(t, int64(chat.ReceiverID), bob, "receiver")
+		if !chat.SentAt.Equal(at(1)) {
+			t.Errorf("sent_at: got %v, want %v", chat.SentAt, at(1))
+		}
+		if chat.DeliveredAt != nil || chat.EditedAt != nil || chat.Deleted {
+			t.Errorf("a new message is marked delivered, edited or deleted: %+v", chat)
+		}
+	}
+	_, err = s.GetChat(first + 1000)
+	notFound(t, err, "GetChat of an unknown message")
+
+	chat, err = s.GetChatByClientID(alice, "c1")
+	if noError(t, err, "GetChatByClientID") {
+		equal(t, int64(chat.MessageID), first, "message found by client ID")
+	}
+	_, err = s.GetChatByClientID(bob, "c1")
+	notFound(t, err, "GetChatByClientID of another sender")
+	if _, err := s.SaveChat(realtimeforum.Chats{SenderID: int(alice), ReceiverID: int(bob), MessageContent: "again",
+		SentAt: at(5), ClientMessageID: "c1"}); err == nil {
+		t.Errorf("saving a second message with the same client ID succeeded")
+	}
+	// Client IDs are unique per sender only
+	send(bob, alice, "same client ID", "c1", 6)
+
+	history, err := s.GetChatHistory(bob, alice)
+	if noError(t, err, "GetChatHistory") {
+		var contents []string
+		for _, chat := range history {
+			contents = append(contents, chat.MessageContent)
+		}
+		equal(t, contents, []string{"hi bob", "hi alice", "same client ID"}, "history between alice and bob")
+	}
+
+	if !noError(t, s.MarkChatDelivered(first, at(7)), "MarkChatDelivered") ||
+		!noError(t, s.MarkChatDelivered(first, at(8)), "MarkChatDelivered again") {
+		return
+	}
+	chat, err = s.GetChat(first)
+	if noError(t, err, "GetChat after delivery") {
+		if chat.DeliveredAt == nil || !chat.DeliveredAt.Equal(at(7)) {
+			t.Errorf("delivered_at: got %v, want the first delivery %v", chat.DeliveredAt, at(7))
+		}
+	}
+}
+
+var errRefused = errors.New("refused by check")
+
+func testChatEdits(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob")
+	if !ok {
+		return
+	}
+	id, err := s.SaveChat(realtimeforum.Chats{SenderID: int(ids[0]), ReceiverID: int(ids[1]), MessageContent: "original",
+		MessageHTML: "<p>original</p>", SentAt: at(0)})
+	if !noError(t, err, "SaveChat") {
+		return
+	}
+
+	var seen realtimeforum.Chats
+	edited, err := s.EditChat(id, "*edited*", "<p><em>edited</em></p>", at(1), func(current realtimeforum.Chats) error {
+		seen = current
+		return nil
+	})
+	if noError(t, err, "EditChat") {
+		equal(t, seen.MessageHTML, "<p>original</p>", "rendering seen by the check")
+		equal(t, seen.MessageContent, "original", "content seen by the check")
+		equal(t, edited.MessageContent, "*edited*", "content returned by EditChat")
+		equal(t, edited.MessageHTML, "<p><em>edited</em></p>", "rendering returned by EditChat")
+		if edited.EditedAt == nil || !edited.EditedAt.Equal(at(1)) {
+			t.Errorf("edited_at returned by EditChat: got %v, want %v", edited.EditedAt, at(1))
+		}
+	}
+
+	_, err = s.EditChat(id, "refused", "", at(2), func(realtimeforum.Chats) error { return errRefused })
+	if !errors.Is(err, errRefused) {
+		t.Errorf("EditChat refused by its check: got error %v, want the check's error", err)
+	}
+	chat, err := s.GetChat(id)
+	if noError(t, err, "GetChat after edits") {
+		equal(t, chat.MessageContent, "*edited*", "content after a refused edit")
+		equal(t, chat.MessageHTML, "<p><em>edited</em></p>", "rendering after a refused edit")
+		if chat.EditedAt == nil || !chat.EditedAt.Equal(at(1)) {
+			t.Errorf("edited_at: got %v, want %v", chat.EditedAt, at(1))
+		}
+	}
+
+	_, err = s.EditChat(id+1000, "x", "", at(2), func(realtimeforum.Chats) error { return nil })
+	notFound(t, err, "EditChat of an unknown message")
+
+	_, err = s.DeleteChat(id, at(3), func(realtimeforum.Chats) error { return errRefused })
+	if !errors.Is(err, errRefused) {
+		t.Errorf("DeleteChat refused by its check: got error %v, want the check's error", err)
+	}
+	deleted, err := s.DeleteChat(id, at(3), func(realtimeforum.Chats) error { return nil })
+	if noError(t, err, "DeleteChat") {
+		equal(t, deleted.Deleted, true, "deleted flag returned by DeleteChat")
+		equal(t, deleted.MessageContent, "", "content returned by DeleteChat")
+	}
+	chat, err = s.GetChat(id)
+	if noError(t, err, "GetChat after delete") {
+		equal(t, chat.Deleted, true, "deleted flag")
+		equal(t, chat.MessageContent, "", "content of a deleted message")
+		equal(t, chat.MessageHTML, "", "rendering of a deleted message")
+	}
+	_, err = s.DeleteChat(id, at(4), func(current realtimeforum.Chats) error {
+		equal(t, current.Deleted, true, "deleted flag seen by the check")
+		return errRefused
+	})
+	if !errors.Is(err, errRefused) {
+		t.Errorf("deleting a deleted message: got error %v, want the check's error", err)
+	}
+}
+
+func testChatPurges(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob")
+	if !ok {
+		return
+	}
+	save := func(text string) int64 {
+		id, err := s.SaveChat(realtimeforum.Chats{SenderID: int(ids[0]), ReceiverID: int(ids[1]), MessageContent: text, SentAt: at(0)})
+		noError(t, err, "SaveChat")
+		return id
+	}
+	allow := func(realtimeforum.Chats) error { return nil }
+	old, recent, kept := save("old"), save("recent"), save("kept")
+
+	for _, id := range []int64{old, recent, kept} {
+		if _, err := s.EditChat(id, "edit 1", "", at(10), allow); !noError(t, err, "EditChat") {
+			return
+		}
+		if _, err := s.EditChat(id, "edit 2", "", at(30), allow); !noError(t, err, "EditChat") {
+			return
+		}
+		if !noError(t, s.AddReaction(id, ids[1], "👍", at(10)), "AddReaction") {
+			return
+		}
+	}
+	if _, err := s.DeleteChat(old, at(20), allow); !noError(t, err, "DeleteChat") {
+		return
+	}
+	if _, err := s.DeleteChat(recent, at(40), allow); !noError(t, err, "DeleteChat") {
+		return
+	}
+
+	removed, err := s.PurgeDeletedChats(at(30))
+	if noError(t, err, "PurgeDeletedChats") {
+		equal(t, removed, int64(1), "number of purged messages")
+	}
+	_, err = s.GetChat(old)
+	notFound(t, err, "GetChat of a purged message")
+	if _, err := s.GetChat(recent); err != nil {
+		t.Errorf("message deleted after the cutoff was purged: %v", err)
+	}
+	reactions, err := s.GetReactions([]int64{old, kept})
+	if noError(t, err, "GetReactions") {
+		equal(t, len(reactions[old]), 0, "reactions of the purged message")
+		equal(t, len(reactions[kept]), 1, "reactions of a kept message")
+	}
+
+	// Two messages are left with a revision before the cutoff and one after it
+	removed, err = s.PurgeChatRevisions(at(20))
+	if noError(t, err, "PurgeChatRevisions") {
+		equal(t, removed, int64(2), "number of purged revisions")
+	}
+	removed, err = s.PurgeChatRevisions(at(40))
+	if noError(t, err, "PurgeChatRevisions") {
+		equal(t, removed, int64(2), "number of revisions purged by a later cutoff")
+	}
+}
+
+func testReactions(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	first, err := s.SaveChat(realtimeforum.Chats{SenderID: int(ids[0]), ReceiverID: realtimeforum.LobbyReceiverID, MessageContent: "one", SentAt: at(0)})
+	if !noError(t, err, "SaveChat") {
+		return
+	}
+	second, err := s.SaveChat(realtimeforum.Chats{SenderID: int(ids[0]), ReceiverID: realtimeforum.LobbyReceiverID, MessageContent: "two", SentAt: at(0)})
+	if !noError(t, err, "SaveChat") {
+		return
+	}
+
+	// Carol reacts first with 🎉, then Bob and Alice with 👍; Bob's 👍 is added twice
+	for _, r := range []struct {
+		user   int64
+		emoji  string
+		minute int
+	}{{ids[2], "🎉", 1}, {ids[2], "👍", 2}, {ids[1], "👍", 3}, {ids[1], "👍", 4}, {ids[0], "🎉", 5}} {
+		if !noError(t, s.AddReaction(first, r.user, r.emoji, at(r.minute)), "AddReaction") {
+			return
+		}
+	}
+	if !noError(t, s.AddReaction(second, ids[1], "❤️", at(1)), "AddReaction") {
+		return
+	}
+
+	reactions, err := s.GetReactions([]int64{first, second, second + 1000})
+	if noError(t, err, "GetReactions") {
+		equal(t, reactions[first], []realtimeforum.ReactionSummary{
+			{Emoji: "🎉", Count: 2, UserIDs: []int64{ids[0], ids[2]}},
+			{Emoji: "👍", Count: 2, UserIDs: []int64{ids[1], ids[2]}},
+		}, "reactions of the first message")
+		equal(t, reactions[second], []realtimeforum.ReactionSummary{
+			{Emoji: "❤️", Count: 1, UserIDs: []int64{ids[1]}},
+		}, "reactions of the second message")
+		if _, found := reactions[second+1000]; found {
+			t.Errorf("reactions returned for an unknown message")
+		}
+	}
+
+	if !noError(t, s.RemoveReaction(first, ids[2], "🎉"), "RemoveReaction") ||
+		!noError(t, s.RemoveReaction(first, ids[2], "🎉"), "removing a reaction twice") {
+		return
+	}
+	// 🎉 is now first used after 👍, so the order changes
+	reactions, err = s.GetReactions([]int64{first})
+	if noError(t, err, "GetReactions after removal") {
+		equal(t, reactions[first], []realtimeforum.ReactionSummary{
+			{Emoji: "👍", Count: 2, UserIDs: []int64{ids[1], ids[2]}},
+			{Emoji: "🎉", Count: 1, UserIDs: []int64{ids[0]}},
+		}, "reactions after removal")
+	}
+
+	reactions, err = s.GetReactions(nil)
+	if noError(t, err, "GetReactions of no messages") {
+		equal(t, len(reactions), 0, "reactions of no messages")
+	}
+}
+
+func testRelations(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	alice, bob, carol := ids[0], ids[1], ids[2]
+	block, mute := realtimeforum.RelationBlock, realtimeforum.RelationMute
+
+	for _, r := range []struct {
+		user, target int64
+		kind         string
+		minute       int
+	}{{alice, bob, block, 1}, {alice, carol, block, 2}, {alice, bob, block, 3}, {alice, carol, mute, 4}, {carol, bob, block, 5}} {
+		if !noError(t, s.AddUserRelation(r.user, r.target, r.kind, at(r.minute)), "AddUserRelation") {
+			return
+		}
+	}
+
+	relations, err := s.ListUserRelations(alice, block)
+	if noError(t, err, "ListUserRelations") {
+		equal(t, len(relations), 2, "number of users alice blocked")
+		if len(relations) == 2 {
+			equal(t, relations[0].TargetUsername, "carol", "most recent block")
+			equal(t, int64(relations[1].TargetID), bob, "oldest block")
+			equal(t, relations[1].Kind, block, "kind")
+			if !relations[1].CreatedAt.Equal(at(1)) {
+				t.Errorf("adding a block twice changed its created_at to %v", relations[1].CreatedAt)
+			}
+		}
+	}
+	relations, err = s.ListUserRelations(bob, block)
+	if noError(t, err, "ListUserRelations without relations") && (relations == nil || len(relations) != 0) {
+		t.Errorf("ListUserRelations without relations: got %v, want an empty non-nil slice", relations)
+	}
+
+	has, err := s.HasUserRelation(alice, carol, mute)
+	if noError(t, err, "HasUserRelation") {
+		equal(t, has, true, "alice muted carol")
+	}
+	has, err = s.HasUserRelation(carol, alice, mute)
+	if noError(t, err, "HasUserRelation") {
+		equal(t, has, false, "carol muted alice")
+	}
+
+	targets, err := s.GetRelationTargets(alice, block)
+	if noError(t, err, "GetRelationTargets") {
+		equal(t, targets, map[int64]bool{bob: true, carol: true}, "users alice blocked")
+	}
+	owners, err := s.GetRelationOwners(bob, block)
+	if noError(t, err, "GetRelationOwners") {
+		equal(t, owners, map[int64]bool{alice: true, carol: true}, "users who blocked bob")
+	}
+
+	if !noError(t, s.RemoveUserRelation(alice, bob, block), "RemoveUserRelation") ||
+		!noError(t, s.RemoveUserRelation(alice, bob, block), "removing a relation twice") {
+		return
+	}
+	targets, err = s.GetRelationTargets(alice, block)
+	if noError(t, err, "GetRelationTargets after removal") {
+		equal(t, targets, map[int64]bool{carol: true}, "users alice blocked after the unblock")
+	}
+	owners, err = s.GetRelationOwners(alice, block)
+	if noError(t, err, "GetRelationOwners without relations") {
+		equal(t, owners, map[int64]bool{}, "users who blocked alice")
+	}
+}
+
+func testPresence(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	for i, id := range ids {
+		if !noError(t, s.TouchUser(id, at(i*10)), "TouchUser") {
+			return
+		}
+	}
+	// Alice comes back, so only Bob is inactive at minute 15
+	if !noError(t, s.TouchUser(ids[0], at(30)), "touching a user again") {
+		return
+	}
+
+	removed, err := s.RemoveInactiveUsers(at(15))
+	if noError(t, err, "RemoveInactiveUsers") {
+		equal(t, removed, int64(1), "number of inactive users removed")
+	}
+	removed, err = s.RemoveInactiveUsers(at(15))
+	if noError(t, err, "RemoveInactiveUsers again") {
+		equal(t, removed, int64(0), "number of inactive users removed twice")
+	}
+	removed, err = s.RemoveInactiveUsers(at(60))
+	if noError(t, err, "RemoveInactiveUsers") {
+		equal(t, removed, int64(2), "number of users removed by a later cutoff")
+	}
+}
@@ -0,0 +1,179 @@
+package storagetest
+
+import (
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+	"testing"
+)
+
+func testBookmarks(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob")
+	if !ok {
+		return
+	}
+	alice, bob := ids[0], ids[1]
+	var postIDs []int64
+	for i, title := range []string{"first", "second", "third"} {
+		id, err := s.CreatePost(realtimeforum.Posts{UserID: int(bob), Title: title, Content: "text", CategoryID: 1, CreatedAt: at(i)})
+		if !noError(t, err, "CreatePost") {
+			return
+		}
+		postIDs = append(postIDs, id)
+	}
+
+	for _, b := range []struct {
+		postID int64
+		minute int
+	}{{postIDs[1], 10}, {postIDs[0], 11}, {postIDs[2], 12}, {postIDs[1], 13}} {
+		if !noError(t, s.AddBookmark(alice, b.postID, at(b.minute)), "AddBookmark") {
+			return
+		}
+	}
+	noError(t, s.RemoveBookmark(alice, postIDs[2]), "RemoveBookmark")
+	noError(t, s.RemoveBookmark(alice, postIDs[2]), "RemoveBookmark of a post not bookmarked")
+
+	// Adding a bookmark twice keeps its first time
+	posts, err := s.GetBookmarkedPosts(alice)
+	if noError(t, err, "GetBookmarkedPosts") {
+		equal(t, postTitles(posts), []string{"first", "second"}, "bookmarked posts, most recent first")
+	}
+	_, err = s.DeletePost(postIDs[0], bob, at(20), func(realtimeforum.Posts) error { return nil })
+	if !noError(t, err, "DeletePost") {
+		return
+	}
+	posts, err = s.GetBookmarkedPosts(alice)
+	if noError(t, err, "GetBookmarkedPosts after a deletion") {
+		equal(t, postTitles(posts), []string{"second"}, "bookmarked posts left")
+	}
+	posts, err = s.GetBookmarkedPosts(bob)
+	if noError(t, err, "GetBookmarkedPosts without bookmarks") {
+		equal(t, len(posts), 0, "posts bob bookmarked")
+	}
+}
+
+func postTitles(posts []realtimeforum.Posts) []string {
+	titles := []string{}
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func testNotifications(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	alice, bob, carol := ids[0], ids[1], ids[2]
+	postID, err := s.CreatePost(realtimeforum.Posts{UserID: int(alice), Title: "Watched", Content: "text", CategoryID: 2, CreatedAt: at(0)})
+	if !noError(t, err, "CreatePost") {
+		return
+	}
+
+	for _, w := range []struct {
+		user     int64
+		kind     string
+		targetID int64
+		minute   int
+	}{{bob, realtimeforum.WatchPost, postID, 1}, {bob, realtimeforum.WatchCategory, 2, 2}, {carol, realtimeforum.WatchPost, postID, 3},
+		{bob, realtimeforum.WatchPost, postID, 4}, {carol, realtimeforum.WatchCategory, 3, 5}} {
+		if !noError(t, s.AddWatch(w.user, w.kind, w.targetID, at(w.minute)), "AddWatch") {
+			return
+		}
+	}
+	watches, err := s.ListWatches(bob)
+	if noError(t, err, "ListWatches") {
+		equal(t, len(watches), 2, "number of watches of bob")
+		if len(watches) == 2 {
+			equal(t, []string{watches[0].Kind, watches[1].Kind}, []string{realtimeforum.WatchCategory, realtimeforum.WatchPost}, "watches, most recent first")
+			equal(t, int64(watches[1].TargetID), postID, "watched post")
+			if !watches[1].CreatedAt.Equal(at(1)) {
+				t.Errorf("adding a watch twice changed its created_at to %v", watches[1].CreatedAt)
+			}
+		}
+	}
+	watchers, err := s.GetWatchers(realtimeforum.WatchPost, postID)
+	if noError(t, err, "GetWatchers") {
+		equal(t, watchers, map[int64]bool{bob: true, carol: true}, "watchers of the post")
+	}
+	noError(t, s.RemoveWatch(carol, realtimeforum.WatchPost, postID), "RemoveWatch")
+	watchers, err = s.GetWatchers(realtimeforum.WatchPost, postID)
+	if noError(t, err, "GetWatchers after RemoveWatch") {
+		equal(t, watchers, map[int64]bool{bob: true}, "watchers left")
+	}
+	watchers, err = s.GetWatchers(realtimeforum.WatchCategory, postID)
+	if noError(t, err, "GetWatchers of a category") {
+		equal(t, watchers, map[int64]bool{}, "watchers of a category with the ID of the post")
+	}
+
+	commentID, err := s.CreateComment(realtimeforum.Comments{AuthorID: int(alice), PostID: int(postID), Content: "news", CreatedAt: at(6)})
+	if !noError(t, err, "CreateComment") {
+		return
+	}
+	commented := realtimeforum.Notification{Kind: realtimeforum.NotificationComment, ActorID: int(alice), PostID: int(postID),
+		CommentID: int(commentID), CreatedAt: at(6)}
+	first, err := s.CreateNotifications(commented, []int64{bob, carol})
+	if !noError(t, err, "CreateNotifications") {
+		return
+	}
+	posted := realtimeforum.Notification{Kind: realtimeforum.NotificationPost, ActorID: int(alice), PostID: int(postID), CreatedAt: at(7)}
+	second, err := s.CreateNotifications(posted, []int64{bob})
+	if !noError(t, err, "CreateNotifications") {
+		return
+	}
+	if len(first) != 2 || len(second) != 1 {
+		t.Errorf("IDs of the notifications: got %v and %v, want 2 and 1", first, second)
+		return
+	}
+	none, err := s.CreateNotifications(posted, nil)
+	if noError(t, err, "CreateNotifications for nobody") {
+		equal(t, len(none), 0, "IDs of no notifications")
+	}
+
+	notifications, err := s.GetNotifications(bob, 0, 10)
+	if !noError(t, err, "GetNotifications") {
+		return
+	}
+	if len(notifications) != 2 {
+		t.Errorf("notifications of bob: got %+v, want 2", notifications)
+		return
+	}
+	latest, oldest := notifications[0], notifications[1]
+	equal(t, int64(latest.NotificationID), second[0], "most recent notification first")
+	equal(t, []interface{}{latest.Kind, latest.ActorUsername, latest.PostTitle, latest.CategoryID, latest.CommentID},
+		[]interface{}{realtimeforum.NotificationPost, "alice", "Watched", 2, 0}, "post notification")
+	equal(t, []interface{}{int64(oldest.NotificationID), int64(oldest.UserID), oldest.Kind, int64(oldest.CommentID)},
+		[]interface{}{first[0], bob, realtimeforum.NotificationComment, commentID}, "comment notification")
+	equal(t, oldest.CreatedAt.Equal(at(6)) && oldest.ReadAt == nil, true, "created and unread")
+
+	notifications, err = s.GetNotifications(bob, second[0], 10)
+	if noError(t, err, "GetNotifications before an ID") {
+		equal(t, len(notifications), 1, "notifications of bob before the latest")
+	}
+	notifications, err = s.GetNotifications(bob, 0, 1)
+	if noError(t, err, "GetNotifications with a limit") {
+		equal(t, len(notifications), 1, "notifications of bob up to the limit")
+	}
+
+	// Marking them read stops at upToID, and only counts those not read yet
+	marked, err := s.MarkNotificationsRead(bob, first[0], at(10))
+	if noError(t, err, "MarkNotificationsRead") {
+		equal(t, marked, int64(1), "notifications marked up to the first")
+	}
+	unread, err := s.CountUnreadNotifications(bob)
+	if noError(t, err, "CountUnreadNotifications") {
+		equal(t, unread, 1, "unread notifications of bob")
+	}
+	marked, err = s.MarkNotificationsRead(bob, 0, at(11))
+	if noError(t, err, "MarkNotificationsRead of all") {
+		equal(t, marked, int64(1), "notifications marked")
+	}
+	notifications, err = s.GetNotifications(bob, 0, 10)
+	if noError(t, err, "GetNotifications after reading them") && len(notifications) == 2 {
+		equal(t, notifications[1].ReadAt != nil && notifications[1].ReadAt.Equal(at(10)), true, "read time of the first")
+	}
+	unread, err = s.CountUnreadNotifications(carol)
+	if noError(t, err, "CountUnreadNotifications") {
+		equal(t, unread, 1, "unread notifications of carol")
+	}
+}
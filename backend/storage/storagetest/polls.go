@@ -0,0 +1,88 @@
+package storagetest
+
+import (
+	"errors"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+func testPolls(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	alice, bob, carol := ids[0], ids[1], ids[2]
+	closesAt := at(60)
+	post := realtimeforum.Posts{UserID: int(alice), Title: "Colour of the logo?", Content: "Pick one", CategoryID: 1, CreatedAt: at(0)}
+	post.Poll = &realtimeforum.Poll{ClosesAt: &closesAt, Options: []realtimeforum.PollOption{{Text: "Red"}, {Text: "Blue"}, {Text: "Green"}}}
+	postID, err := s.CreatePost(post)
+	if !noError(t, err, "CreatePost with a poll") {
+		return
+	}
+	if stored, err := s.GetPost(postID); noError(t, err, "GetPost") {
+		equal(t, stored.Poll, (*realtimeforum.Poll)(nil), "poll returned by GetPost")
+	}
+	plainID, err := s.CreatePost(realtimeforum.Posts{UserID: int(alice), Title: "No poll", Content: "Just text", CategoryID: 1, CreatedAt: at(0)})
+	if !noError(t, err, "CreatePost without a poll") {
+		return
+	}
+
+	polls, err := s.GetPolls([]int64{postID, plainID}, alice)
+	if !noError(t, err, "GetPolls") {
+		return
+	}
+	equal(t, len(polls), 1, "posts with a poll")
+	poll := polls[postID]
+	if len(poll.Options) != 3 {
+		t.Errorf("options of the poll: got %+v, want 3", poll.Options)
+		return
+	}
+	red, blue, green := int64(poll.Options[0].OptionID), int64(poll.Options[1].OptionID), int64(poll.Options[2].OptionID)
+	equal(t, []string{poll.Options[0].Text, poll.Options[1].Text, poll.Options[2].Text}, []string{"Red", "Blue", "Green"}, "options in order")
+	equal(t, poll.ClosesAt != nil && poll.ClosesAt.Equal(closesAt), true, "closing time")
+	equal(t, poll.Voters, 0, "voters before any vote")
+
+	// A vote counts once, and a failed vote records nothing
+	noError(t, s.CastVote(postID, alice, []int64{red}, at(1)), "CastVote")
+	if err := s.CastVote(postID, alice, []int64{blue}, at(2)); !errors.Is(err, storage.ErrAlreadyVoted) {
+		t.Errorf("second vote: got error %v, want storage.ErrAlreadyVoted", err)
+	}
+	notFound(t, s.CastVote(postID, bob, []int64{red, green + 1000}, at(2)), "CastVote for an option of no poll")
+	notFound(t, s.CastVote(plainID, bob, []int64{red}, at(2)), "CastVote on a post without a poll")
+	noError(t, s.CastVote(postID, bob, []int64{red, blue, red}, at(3)), "CastVote for two options")
+	if err := s.CastVote(postID, carol, []int64{green}, at(60)); !errors.Is(err, storage.ErrPollClosed) {
+		t.Errorf("vote at the closing time: got error %v, want storage.ErrPollClosed", err)
+	}
+
+	polls, err = s.GetPolls([]int64{postID}, bob)
+	if noError(t, err, "GetPolls after voting") {
+		poll := polls[postID]
+		equal(t, poll.Voters, 2, "voters")
+		equal(t, []int{poll.Options[0].Votes, poll.Options[1].Votes, poll.Options[2].Votes}, []int{2, 1, 0}, "votes per option")
+		equal(t, poll.Options[0].Voters, []string{"alice", "bob"}, "voters of the first option")
+		equal(t, poll.MyVotes, []int{int(red), int(blue)}, "options the viewer voted for")
+	}
+
+	// Nobody is listed in an anonymous poll
+	post.Poll = &realtimeforum.Poll{Multiple: true, Anonymous: true, Options: []realtimeforum.PollOption{{Text: "Yes"}, {Text: "No"}}}
+	anonymousID, err := s.CreatePost(post)
+	if !noError(t, err, "CreatePost with an anonymous poll") {
+		return
+	}
+	polls, err = s.GetPolls([]int64{anonymousID}, carol)
+	if !noError(t, err, "GetPolls of the anonymous poll") {
+		return
+	}
+	yes := int64(polls[anonymousID].Options[0].OptionID)
+	noError(t, s.CastVote(anonymousID, carol, []int64{yes}, at(100)), "CastVote in an anonymous poll")
+	polls, err = s.GetPolls([]int64{anonymousID}, alice)
+	if noError(t, err, "GetPolls after the anonymous vote") {
+		poll := polls[anonymousID]
+		equal(t, poll.Options[0].Votes, 1, "votes of the anonymous poll")
+		equal(t, poll.Options[0].Voters, []string(nil), "voters of the anonymous poll")
+		equal(t, poll.MyVotes, []int(nil), "options the viewer voted for in the anonymous poll")
+		equal(t, poll.Multiple && poll.Anonymous && poll.ClosesAt == nil, true, "settings of the anonymous poll")
+	}
+}
@@ -0,0 +1,195 @@
+package storagetest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/search"
+	"livechat-system/backend/storage"
+)
+
+// resultKeys identifies search results as "kind:id", in order.
+func resultKeys(results []realtimeforum.SearchResult) []string {
+	keys := []string{}
+	for _, result := range results {
+		keys = append(keys, fmt.Sprintf("%s:%d", result.Kind, result.ID))
+	}
+	return keys
+}
+
+// sameKeys compares result keys regardless of their order.
+func sameKeys(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, key := range got {
+		seen[key]++
+	}
+	for _, key := range want {
+		if seen[key] == 0 {
+			return false
+		}
+		seen[key]--
+	}
+	return true
+}
+
+func testSearch(t *testing.T, s storage.Store) {
+	ids, ok := createUsers(t, s, "alice", "bob", "carol")
+	if !ok {
+		return
+	}
+	alice, bob, carol := ids[0], ids[1], ids[2]
+
+	posts := []realtimeforum.Posts{
+		{UserID: int(alice), Title: "Gardening tips", Content: "How to grow tomatoes in a small garden", CategoryID: 1, CreatedAt: at(0)},
+		{UserID: int(bob), Title: "Cooking", Content: "A tomato sauce recipe with fresh basil", CategoryID: 2, CreatedAt: at(2 * 24 * 60)},
+		{UserID: int(bob), Title: "Tomatoes everywhere", Content: "Everything about tomatoes in real life", CategoryID: 1, CreatedAt: at(1)},
+		{UserID: int(carol), Title: "Markup", Content: "<script>tomatoes</script>", CategoryID: 2, CreatedAt: at(7)},
+		{UserID: int(carol), Title: "Markers", Content: search.MarkStart + "forged" + search.MarkEnd + " marks around pumpkins", CategoryID: 2, CreatedAt: at(8)},
+	}
+	postKeys := make([]string, len(posts))
+	var firstPostID int64
+	for i, post := range posts {
+		id, err := s.CreatePost(post)
+		if !noError(t, err, "CreatePost") {
+			return
+		}
+		if i == 0 {
+			firstPostID = id
+		}
+		postKeys[i] = fmt.Sprintf("post:%d", id)
+	}
+	commentID, err := s.CreateComment(realtimeforum.Comments{AuthorID: int(carol), PostID: int(firstPostID), Content: "I grow tomatoes too, in real time", CreatedAt: at(2)})
+	if !noError(t, err, "CreateComment") {
+		return
+	}
+	commentKey := fmt.Sprintf("comment:%d", commentID)
+
+	chatKeys := make(map[string]string)
+	var privateID, deletedID int64
+	for _, chat := range []struct {
+		name     string
+		from, to int64
+		text     string
+	}{
+		{"lobby", alice, realtimeforum.LobbyReceiverID, "tomatoes for everyone"},
+		{"mine", alice, bob, "secret tomatoes"},
+		{"theirs", carol, bob, "more secret tomatoes"},
+		{"deleted", alice, realtimeforum.LobbyReceiverID, "deleted tomatoes"},
+	} {
+		id, err := s.SaveChat(realtimeforum.Chats{SenderID: int(chat.from), ReceiverID: int(chat.to), MessageContent: chat.text, SentAt: at(3)})
+		if !noError(t, err, "SaveChat "+chat.text) {
+			return
+		}
+		chatKeys[chat.name] = fmt.Sprintf("chat:%d", id)
+		switch chat.name {
+		case "mine":
+			privateID = id
+		case "deleted":
+			deletedID = id
+		}
+	}
+	if _, err := s.DeleteChat(deletedID, at(4), func(realtimeforum.Chats) error { return nil }); !noError(t, err, "DeleteChat") {
+		return
+	}
+
+	// find runs a search as alice and returns its results
+	find := func(input string, offset, limit int) ([]realtimeforum.SearchResult, bool) {
+		q, err := search.Parse(input)
+		if !noError(t, err, "parsing "+input) {
+			return nil, false
+		}
+		results, err := s.Search(q, alice, offset, limit)
+		return results, noError(t, err, "searching "+input)
+	}
+	expect := func(input string, want ...string) {
+		if results, ok := find(input, 0, 50); ok && !sameKeys(resultKeys(results), want...) {
+			t.Errorf("searching %s: got %v, want %v in any order", input, resultKeys(results), want)
+		}
+	}
+
+	// Whole words only, and chat messages of alice's conversations and the lobby only
+	all := []string{postKeys[0], postKeys[2], postKeys[3], commentKey, chatKeys["lobby"], chatKeys["mine"]}
+	expect("tomatoes", all...)
+	results, ok := find("Tomatoes", 0, 50)
+	if ok && len(results) > 0 {
+		equal(t, resultKeys(results)[0], postKeys[2], "best result, with the word in its title")
+		for _, result := range results {
+			snippet := strings.ToLower(result.Snippet)
+			if !strings.Contains(snippet, "<mark>tomatoes</mark>") {
+				t.Errorf("snippet %q of %s:%d does not highlight the match", result.Snippet, result.Kind, result.ID)
+			}
+			if strings.Contains(snippet, "<script>") {
+				t.Errorf("snippet %q of %s:%d is not escaped", result.Snippet, result.Kind, result.ID)
+			}
+			if result.Kind == realtimeforum.SearchKindComment {
+				equal(t, result.PostID, firstPostID, "post of the comment")
+				equal(t, result.Title, "Gardening tips", "title of the post of the comment")
+				equal(t, result.AuthorUsername, "carol", "author of the comment")
+			}
+		}
+	}
+
+	expect(`"real time"`, commentKey)
+	expect(`"time real"`)
+	expect("tomat*", append(all, postKeys[1])...)
+	expect("author:bob tomatoes", postKeys[2])
+	expect("category:1 tomatoes", postKeys[0], postKeys[2], commentKey)
+	expect("tomat* until:2024-03-01", all...)
+	expect("tomat* since:2024-03-02", postKeys[1])
+	expect("in:chats tomatoes", chatKeys["lobby"], chatKeys["mine"])
+	expect("in:posts in:comments grow", postKeys[0], commentKey)
+	expect("tomatoes nowhere")
+
+	// Only matches are highlighted, whatever the text holds
+	if results, ok := find("pumpkins", 0, 10); ok && len(results) == 1 {
+		equal(t, results[0].Snippet, "forged marks around <mark>pumpkins</mark>", "snippet of a post holding the markers")
+	}
+
+	// Pages follow the order of the full results
+	full, ok := find("tomatoes", 0, 50)
+	first, ok1 := find("tomatoes", 0, 2)
+	rest, ok2 := find("tomatoes", 2, 50)
+	if ok && ok1 && ok2 {
+		equal(t, append(resultKeys(first), resultKeys(rest)...), resultKeys(full), "pages of the results")
+	}
+	beyond, ok := find("tomatoes", 100, 10)
+	if ok && (beyond == nil || len(beyond) != 0) {
+		t.Errorf("page past the results: got %v, want an empty non-nil slice", beyond)
+	}
+
+	// Edits are searched for as soon as they are stored
+	if _, err := s.EditChat(privateID, "secret potatoes", "", at(5), func(realtimeforum.Chats) error { return nil }); !noError(t, err, "EditChat") {
+		return
+	}
+	expect("in:chats tomatoes", chatKeys["lobby"])
+	expect("potatoes", chatKeys["mine"])
+	if results, err := s.Search(mustParse("potatoes"), bob, 0, 10); noError(t, err, "searching as bob") {
+		equal(t, resultKeys(results), []string{chatKeys["mine"]}, "results of bob's search in his conversation")
+	}
+	if results, err := s.Search(mustParse("potatoes"), carol, 0, 10); noError(t, err, "searching as carol") {
+		equal(t, resultKeys(results), []string{}, "results of carol's search in someone else's conversation")
+	}
+
+	// Nothing written by blocked users is found
+	if !noError(t, s.AddUserRelation(bob, carol, realtimeforum.RelationBlock, at(6)), "AddUserRelation") {
+		return
+	}
+	if results, err := s.Search(mustParse("in:posts in:comments tomatoes"), bob, 0, 10); noError(t, err, "searching as bob") {
+		if !sameKeys(resultKeys(results), postKeys[0], postKeys[2]) {
+			t.Errorf("bob's search after blocking carol: got %v, want %v", resultKeys(results), []string{postKeys[0], postKeys[2]})
+		}
+	}
+}
+
+func mustParse(input string) search.Query {
+	q, err := search.Parse(input)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
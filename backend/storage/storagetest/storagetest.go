@@ -0,0 +1,105 @@
+// Package storagetest checks that an implementation of storage.Store behaves the way the
+// services expect. Every implementation must pass it, from a test of its package:
+//
+//	func TestStore(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Store { ... })
+//	}
+//
+// Each case runs as a subtest against a fresh store returned by open, which must be migrated
+// and empty, and closes it when done.
+package storagetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/storage"
+)
+
+// testCase checks one aspect of a store.
+type testCase struct {
+	name string
+	run  func(t *testing.T, s storage.Store)
+}
+
+var cases = []testCase{
+	{"migrations", testMigrations},
+	{"users", testUsers},
+	{"posts", testPosts},
+	{"post edits", testPostEdits},
+	{"comments", testComments},
+	{"chats", testChats},
+	{"chat edits", testChatEdits},
+	{"chat purges", testChatPurges},
+	{"attachments", testAttachments},
+	{"polls", testPolls},
+	{"reactions", testReactions},
+	{"relations", testRelations},
+	{"bookmarks", testBookmarks},
+	{"notifications", testNotifications},
+	{"presence", testPresence},
+	{"search", testSearch},
+}
+
+// Run runs every case as a subtest, each against its own store.
+func Run(t *testing.T, open func(t *testing.T) storage.Store) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() { s.Close() })
+			tc.run(t, s)
+		})
+	}
+}
+
+// noError reports err, which should be nil, and whether the case can go on.
+func noError(t *testing.T, err error, doing string) bool {
+	t.Helper()
+	if err != nil {
+		t.Errorf("%s: %v", doing, err)
+		return false
+	}
+	return true
+}
+
+func equal(t *testing.T, got, want interface{}, what string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func notFound(t *testing.T, err error, what string) {
+	t.Helper()
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("%s: got error %v, want storage.ErrNotFound", what, err)
+	}
+}
+
+// base is a fixed point in time. Stores keep timestamps to the second, so every time used
+// by the cases is whole seconds in UTC.
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return base.Add(time.Duration(minutes) * time.Minute)
+}
+
+// createUsers creates users named after names and returns their IDs.
+func createUsers(t *testing.T, s storage.Store, names ...string) ([]int64, bool) {
+	t.Helper()
+	ids := make([]int64, len(names))
+	for i, name := range names {
+		id, err := s.CreateUser(realtimeforum.User{
+			Username: name, Age: 30, Gender: "other", FirstName: name, LastName: "Test",
+			Email: name + "@example.com", Password: name + "-password",
+		})
+		if !noError(t, err, "creating user "+name) {
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
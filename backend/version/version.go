@@ -0,0 +1,78 @@
+// Package version reports which build of the server is running.
+//
+// The commit and the build time are injected at link time:
+//
+//	go build -ldflags "-X livechat-system/backend/version.Commit=$(git rev-parse HEAD) \
+//		-X livechat-system/backend/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them, the commit is read from the VCS information stamped by the go command, which also
+// gives the time of the commit. That is not the build time, which stays unknown.
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags "-X ..." at build time.
+var (
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Commit     string `json:"commit"`
+	CommitTime string `json:"commitTime"`
+	BuildTime  string `json:"buildTime"`
+	Modified   bool   `json:"modified,omitempty"` // Built from a working tree with uncommitted changes
+	GoVersion  string `json:"goVersion"`
+}
+
+// Get returns the build information, "unknown" for what was neither injected nor stamped.
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		var revision, revisionTime string
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.time":
+				revisionTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+		if info.Commit == "" {
+			info.Commit = revision
+		}
+		// The stamped time is only that of the injected commit if they agree
+		if info.Commit == revision {
+			info.CommitTime = revisionTime
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.CommitTime == "" {
+		info.CommitTime = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
+
+// Handler serves the build information as JSON.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Get())
+}
@@ -0,0 +1,316 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"livechat-system/backend/backplane"
+	realtimeforum "livechat-system/backend/models"
+)
+
+// DefaultPresenceInterval is how often a node tells the others which users are connected to it,
+// which repairs missed presence events and shows that the node is still alive.
+const DefaultPresenceInterval = 10 * time.Second
+
+// presenceExpiryIntervals is how many presence intervals a node may stay silent before the
+// other nodes consider it gone and its users offline.
+const presenceExpiryIntervals = 3
+
+// Kinds of clusterEvent.
+const (
+	eventToUser    = "user"      // Message for every connection of UserID
+	eventBroadcast = "broadcast" // Message for every connection, except the sender and Exclude
+	eventPost      = "post"      // Feed Message ("newPost", "postEdited", "postDeleted", "pollResults") for the subscribers of its post, except Exclude
+	eventPresence  = "presence"  // UserID connected to Node, or lost their last connection there
+	eventSnapshot  = "snapshot"  // Users are all the users connected to Node
+	eventSync      = "sync"      // Node joined and asks the others for a snapshot
+	eventLeave     = "leave"     // Node is shutting down
+)
+
+// clusterEvent is what the nodes of a deployment send each other over the backplane.
+type clusterEvent struct {
+	Kind    string                 `json:"kind"`
+	Node    string                 `json:"node"`
+	UserID  int64                  `json:"userId,omitempty"`
+	Online  bool                   `json:"online,omitempty"`
+	Users   []int64                `json:"users,omitempty"`
+	Exclude []int64                `json:"exclude,omitempty"`
+	Muted   []int64                `json:"muted,omitempty"`
+	Message *realtimeforum.Message `json:"message,omitempty"`
+}
+
+// cluster is the hub's view of the other nodes. Its mutex is never held while calling into
+// the rest of the hub, so it can be taken under clientsMutex or userStatusMutex.
+type cluster struct {
+	backplane   backplane.Backplane
+	channel     string
+	node        string
+	interval    time.Duration
+	unsubscribe func()
+
+	mu    sync.Mutex
+	nodes map[string]*remoteNode
+}
+
+// remoteNode is what is known of another node.
+type remoteNode struct {
+	users    map[int64]bool // Users with at least one connection to the node
+	lastSeen time.Time      // When the node last published anything
+}
+
+// JoinCluster connects the hub to the other nodes publishing on channel of bp, so private
+// messages, broadcasts and presence reach users connected to any node. node identifies this
+// hub and must be unique in the deployment. It must be called before serving connections.
+func (server *WebSocketServer) JoinCluster(bp backplane.Backplane, channel, node string, presenceInterval time.Duration) error {
+	c := &cluster{
+		backplane: bp,
+		channel:   channel,
+		node:      node,
+		interval:  presenceInterval,
+		nodes:     make(map[string]*remoteNode),
+	}
+	server.cluster = c
+	unsubscribe, err := bp.Subscribe(channel, func(data []byte) { server.handleClusterEvent(c, data) })
+	if err != nil {
+		server.cluster = nil
+		return err
+	}
+	c.unsubscribe = unsubscribe
+
+	// The nodes already running answer with who is connected to them
+	server.publish(clusterEvent{Kind: eventSync})
+	slog.Info("Joined cluster", "node", node, "channel", channel)
+	return nil
+}
+
+// leaveCluster tells the other nodes that this one is going away, so they see its users
+// go offline now instead of once it stops answering.
+func (server *WebSocketServer) leaveCluster() {
+	if server.cluster == nil {
+		return
+	}
+	server.publish(clusterEvent{Kind: eventLeave})
+	server.cluster.unsubscribe()
+}
+
+// SyncPresence publishes the users connected to this node and forgets the nodes that stopped
+// publishing theirs. It is run every presence interval; it does nothing on a single node.
+func (server *WebSocketServer) SyncPresence() {
+	c := server.cluster
+	if c == nil {
+		return
+	}
+	server.publish(clusterEvent{Kind: eventSnapshot, Users: server.localOnlineUsers()})
+
+	cutoff := time.Now().Add(-presenceExpiryIntervals * c.interval)
+	var gone []int64
+	c.mu.Lock()
+	for node, remote := range c.nodes {
+		if remote.lastSeen.Before(cutoff) {
+			slog.Warn("Node stopped publishing presence, dropping its users", "node", node)
+			gone = append(gone, keys(remote.users)...)
+			delete(c.nodes, node)
+		}
+	}
+	c.mu.Unlock()
+	server.announceOffline(gone)
+}
+
+// publish sends an event to the other nodes. Failures are logged: the event is lost for
+// them, and presence is repaired by the next snapshot.
+func (server *WebSocketServer) publish(event clusterEvent) {
+	c := server.cluster
+	if c == nil {
+		return
+	}
+	event.Node = c.node
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding cluster event", "kind", event.Kind, "err", err)
+		return
+	}
+	if err := c.backplane.Publish(c.channel, data); err != nil {
+		slog.Warn("Error publishing cluster event", "kind", event.Kind, "err", err)
+	}
+}
+
+// handleClusterEvent applies an event received from the backplane, including the ones this
+// node published itself, which are ignored.
+func (server *WebSocketServer) handleClusterEvent(c *cluster, data []byte) {
+	var event clusterEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		slog.Warn("Ignoring malformed cluster event", "err", err)
+		return
+	}
+	if event.Node == c.node {
+		return
+	}
+
+	c.mu.Lock()
+	remote, known := c.nodes[event.Node]
+	if !known && event.Kind != eventLeave {
+		remote = &remoteNode{users: make(map[int64]bool)}
+		c.nodes[event.Node] = remote
+	}
+	if remote != nil {
+		remote.lastSeen = time.Now()
+	}
+	c.mu.Unlock()
+
+	switch event.Kind {
+	case eventToUser:
+		if event.Message != nil {
+			server.sendToLocalUser(event.UserID, *event.Message)
+		}
+	case eventBroadcast:
+		if event.Message != nil {
+			server.broadcastLocal(*event.Message, set(event.Exclude), set(event.Muted))
+		}
+	case eventPost:
+		if event.Message != nil && event.Message.Post != nil {
+			server.sendPostLocal(*event.Message, set(event.Exclude))
+		}
+	case eventPresence:
+		c.mu.Lock()
+		if event.Online {
+			remote.users[event.UserID] = true
+		} else {
+			delete(remote.users, event.UserID)
+		}
+		c.mu.Unlock()
+		if event.Online {
+			server.broadcastUserStatusChange(event.UserID, true)
+		} else {
+			server.announceOffline([]int64{event.UserID})
+		}
+	case eventSnapshot:
+		// Only differences are announced, so a steady snapshot sends nothing to clients
+		users := set(event.Users)
+		c.mu.Lock()
+		var joined, left []int64
+		for userID := range users {
+			if !remote.users[userID] {
+				joined = append(joined, userID)
+			}
+		}
+		for userID := range remote.users {
+			if !users[userID] {
+				left = append(left, userID)
+			}
+		}
+		remote.users = users
+		c.mu.Unlock()
+		for _, userID := range joined {
+			server.broadcastUserStatusChange(userID, true)
+		}
+		server.announceOffline(left)
+	case eventSync:
+		server.publish(clusterEvent{Kind: eventSnapshot, Users: server.localOnlineUsers()})
+	case eventLeave:
+		var gone []int64
+		c.mu.Lock()
+		if remote != nil {
+			gone = keys(remote.users)
+			delete(c.nodes, event.Node)
+		}
+		c.mu.Unlock()
+		server.announceOffline(gone)
+		slog.Info("Node left the cluster", "node", event.Node)
+	default:
+		slog.Warn("Ignoring unknown cluster event", "kind", event.Kind, "node", event.Node)
+	}
+}
+
+// announceOffline tells the local clients that the given users went offline, for those who
+// are no longer connected to any node.
+func (server *WebSocketServer) announceOffline(userIDs []int64) {
+	for _, userID := range userIDs {
+		if !server.onlineAnywhere(userID) {
+			server.broadcastUserStatusChange(userID, false)
+		}
+	}
+}
+
+// onlineAnywhere reports whether the user has a connection to this node or another one.
+func (server *WebSocketServer) onlineAnywhere(userID int64) bool {
+	server.userStatusMutex.Lock()
+	online := server.onlineUsers[userID]
+	server.userStatusMutex.Unlock()
+	return online || server.onlineElsewhere(userID)
+}
+
+// onlineElsewhere reports whether the user has a connection to another node.
+func (server *WebSocketServer) onlineElsewhere(userID int64) bool {
+	c := server.cluster
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, remote := range c.nodes {
+		if remote.users[userID] {
+			return true
+		}
+	}
+	return false
+}
+
+// anyoneElsewhere reports whether a user other than userID has a connection to another node.
+func (server *WebSocketServer) anyoneElsewhere(userID int64) bool {
+	c := server.cluster
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, remote := range c.nodes {
+		for id := range remote.users {
+			if id != userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// remoteOnlineUsers returns the users connected to other nodes.
+func (server *WebSocketServer) remoteOnlineUsers() map[int64]bool {
+	users := make(map[int64]bool)
+	c := server.cluster
+	if c == nil {
+		return users
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, remote := range c.nodes {
+		for userID := range remote.users {
+			users[userID] = true
+		}
+	}
+	return users
+}
+
+// localOnlineUsers returns the users connected to this node.
+func (server *WebSocketServer) localOnlineUsers() []int64 {
+	server.userStatusMutex.Lock()
+	defer server.userStatusMutex.Unlock()
+	return keys(server.onlineUsers)
+}
+
+func set(ids []int64) map[int64]bool {
+	s := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		s[id] = true
+	}
+	return s
+}
+
+func keys(s map[int64]bool) []int64 {
+	ids := make([]int64, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	return ids
+}
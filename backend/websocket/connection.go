@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connection is one client connection as the hub sees it. WebSocket, Server-Sent Events and
+// long-polling connections all implement it, so routing, presence and sessions treat them alike.
+// No method waits for the client: WebSocket and event stream connections are sendQueues, and
+// long-polling ones hold their frames until polled.
+type connection interface {
+	// WriteJSON sends one frame. Frames are sent in the order of the calls, so senders that must
+	// order a frame against the events recorded in sessions hold clientsMutex.
+	WriteJSON(v interface{}) error
+
+	// WriteClose tells the client that the connection is closing, with a WebSocket close code
+	// whatever the transport, so clients react the same way to a restart or a policy violation.
+	WriteClose(code int, reason string) error
+
+	// Close ends the connection without telling the client. It may be called more than once.
+	Close() error
+}
+
+// wsConnection is a connection over WebSocket, written to by a sendQueue.
+type wsConnection struct {
+	*websocket.Conn
+}
+
+func (c wsConnection) WriteClose(code int, reason string) error {
+	closeFrame := websocket.FormatCloseMessage(code, reason)
+	return c.WriteControl(websocket.CloseMessage, closeFrame, time.Now().Add(closeFrameTimeout))
+}
+
+// closeNotice is how the transports other than WebSocket tell a client the connection closed.
+type closeNotice struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// authenticate returns the user of a request opening a connection or sending a frame. The token
+// is read from the "token" query parameter, since browsers cannot set headers on WebSocket and
+// EventSource requests, or from an "Authorization: Bearer" header. Failures are answered with 401.
+func (server *WebSocketServer) authenticate(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (int64, bool) {
+	tokenString := r.URL.Query().Get("token")
+	if tokenString == "" {
+		tokenString, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if tokenString == "" {
+		logger.Info("Connection without token")
+		http.Error(w, "JWT token is missing", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	claims, err := server.validateToken(tokenString)
+	if err != nil {
+		logger.Info("Connection with invalid token", "err", err)
+		http.Error(w, "Invalid JWT token", http.StatusUnauthorized)
+		return 0, false
+	}
+	return int64(claims.UserID), true
+}
+
+// lastSeqParam returns the last sequence number a reconnecting client saw, from the "lastSeq"
+// query parameter or, for EventSource's own reconnections, the Last-Event-ID header. It returns
+// -1 when the client is not resuming, and answers 400 to an invalid value.
+func lastSeqParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	value := r.URL.Query().Get("lastSeq")
+	if value == "" {
+		value = r.Header.Get("Last-Event-ID")
+	}
+	if value == "" {
+		return -1, true
+	}
+	lastSeq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || lastSeq < 0 {
+		http.Error(w, "Invalid lastSeq", http.StatusBadRequest)
+		return 0, false
+	}
+	return lastSeq, true
+}
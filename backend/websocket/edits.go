@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// DefaultEditWindow is how long after sending a private message its author may still edit or delete it.
+const DefaultEditWindow = 15 * time.Minute
+
+var errMissingMessageID = errors.New("messageId is required")
+
+// editMessage applies an "edit" frame from userID and propagates the new content
+// to every connection of both participants.
+func (server *WebSocketServer) editMessage(userID int64, msg realtimeforum.Message, logger *slog.Logger) error {
+	if msg.MessageID == 0 {
+		return errMissingMessageID
+	}
+
+	chat, err := server.ForumService.EditChatMessage(msg.MessageID, userID, msg.Message, server.EditWindow)
+	if err != nil {
+		return err
+	}
+	logger.Info("Message edited", "message_id", chat.MessageID)
+
+	server.notifyParticipants(chat, realtimeforum.Message{
+		Type:        "edit",
+		MessageID:   int64(chat.MessageID),
+		SenderID:    int64(chat.SenderID),
+		ReceiverID:  int64(chat.ReceiverID),
+		Message:     chat.MessageContent,
+		MessageHTML: chat.MessageHTML,
+		SentAt:      chat.SentAt,
+		EditedAt:    chat.EditedAt,
+	})
+	return nil
+}
+
+// deleteMessage applies a "delete" frame from userID and propagates the deletion
+// to every connection of both participants.
+func (server *WebSocketServer) deleteMessage(userID int64, msg realtimeforum.Message, logger *slog.Logger) error {
+	if msg.MessageID == 0 {
+		return errMissingMessageID
+	}
+
+	chat, err := server.ForumService.DeleteChatMessage(msg.MessageID, userID, server.EditWindow)
+	if err != nil {
+		return err
+	}
+	logger.Info("Message deleted", "message_id", chat.MessageID)
+
+	server.notifyParticipants(chat, realtimeforum.Message{
+		Type:       "delete",
+		MessageID:  int64(chat.MessageID),
+		SenderID:   int64(chat.SenderID),
+		ReceiverID: int64(chat.ReceiverID),
+		SentAt:     chat.SentAt,
+		Deleted:    true,
+	})
+	return nil
+}
+
+// notifyParticipants sends a frame about a private message to the receiver and to the
+// sender, so the sender's other devices stay in sync too.
+func (server *WebSocketServer) notifyParticipants(chat realtimeforum.Chats, message realtimeforum.Message) {
+	server.sendToUser(int64(chat.ReceiverID), message)
+	if chat.SenderID != chat.ReceiverID {
+		server.sendToUser(int64(chat.SenderID), message)
+	}
+}
@@ -0,0 +1,39 @@
+package websocket
+
+import (
+	"errors"
+
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage"
+)
+
+// clientErrors are the failures whose text is safe to send back to the client as is.
+var clientErrors = []error{
+	errMissingMessageID,
+	errInvalidCategory,
+	service.ErrNotMessageAuthor,
+	service.ErrEditWindowExpired,
+	service.ErrMessageDeleted,
+	service.ErrNotPrivateMessage,
+	service.ErrEmptyMessageEdited,
+	service.ErrMessageTooLong,
+	service.ErrInvalidEmoji,
+	service.ErrMessageNotVisible,
+	service.ErrBlocked,
+	service.ErrTooManyAttachments,
+	storage.ErrAttachmentUnavailable,
+}
+
+// clientErrorText turns a failed operation on a message into the text sent back to the client.
+// Database errors are not exposed; fallback is sent instead.
+func clientErrorText(err error, fallback string) string {
+	if errors.Is(err, storage.ErrNotFound) {
+		return "Message not found"
+	}
+	for _, known := range clientErrors {
+		if errors.Is(err, known) {
+			return err.Error()
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,206 @@
+package websocket
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	realtimeforum "livechat-system/backend/models"
+	service "livechat-system/backend/services"
+)
+
+// excerptLength is the number of characters of a post's content sent in "newPost" and
+// "postEdited" frames.
+const excerptLength = 200
+
+// errInvalidCategory is returned for "subscribe" and "unsubscribe" frames naming a category ID
+// that cannot exist.
+var errInvalidCategory = errors.New("invalid category")
+
+// feedSubscription is the set of categories whose new posts a user is sent.
+type feedSubscription struct {
+	all        bool         // Every category, whatever categories holds
+	categories map[int]bool // Categories subscribed to one by one
+}
+
+func (f feedSubscription) includes(categoryID int) bool {
+	return f.all || f.categories[categoryID]
+}
+
+// wants reports whether a frame about post is sent with this subscription.
+func (f feedSubscription) wants(post *realtimeforum.PostSummary) bool {
+	return f.includes(post.CategoryID) || (post.PreviousCategoryID != 0 && f.includes(post.PreviousCategoryID))
+}
+
+// frame describes the subscription to the client in a "subscriptions" frame.
+func (f feedSubscription) frame() realtimeforum.Message {
+	categories := make([]int, 0, len(f.categories))
+	for categoryID := range f.categories {
+		categories = append(categories, categoryID)
+	}
+	return realtimeforum.Message{Type: "subscriptions", Categories: categories, AllCategories: f.all}
+}
+
+// updateFeed applies a "subscribe" or "unsubscribe" frame from userID and answers with the
+// resulting subscriptions. A "subscribe" frame without categories subscribes to every category,
+// and an "unsubscribe" frame without categories ends every subscription. Subscriptions belong
+// to the user's session, so they are shared by all of their connections, whatever the transport,
+// and survive reconnects.
+func (server *WebSocketServer) updateFeed(conn connection, userID int64, msg realtimeforum.Message, subscribe bool) error {
+	for _, categoryID := range msg.Categories {
+		if categoryID <= 0 {
+			return errInvalidCategory
+		}
+	}
+
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+	s := server.session(userID)
+	switch {
+	case subscribe && len(msg.Categories) == 0:
+		s.feed.all = true
+	case subscribe:
+		if s.feed.categories == nil {
+			s.feed.categories = make(map[int]bool)
+		}
+		for _, categoryID := range msg.Categories {
+			s.feed.categories[categoryID] = true
+		}
+	case len(msg.Categories) == 0:
+		s.feed = feedSubscription{}
+	default:
+		for _, categoryID := range msg.Categories {
+			delete(s.feed.categories, categoryID)
+		}
+	}
+	if err := server.send(conn, s.feed.frame()); err != nil {
+		slog.Warn("Error sending subscriptions", "user_id", userID, "err", err)
+	}
+	return nil
+}
+
+// PublishPost sends a "newPost" frame about a post that was just created to every user
+// subscribed to its category, on any node, except the users who blocked its author. The
+// author's own connections get it too when subscribed, so their other devices stay current.
+func (server *WebSocketServer) PublishPost(post realtimeforum.Posts) {
+	summary := server.postSummary(post)
+	server.publishPostFrame(realtimeforum.Message{Type: "newPost", Post: &summary})
+}
+
+// PublishPostEdit sends a "postEdited" frame with the new version of a post to the same users
+// as PublishPost. When the edit moved the post from previousCategoryID, the subscribers of that
+// category get it too, so they can take the post out of their list.
+func (server *WebSocketServer) PublishPostEdit(post realtimeforum.Posts, previousCategoryID int) {
+	summary := server.postSummary(post)
+	summary.EditedAt = post.EditedAt
+	if previousCategoryID != post.CategoryID {
+		summary.PreviousCategoryID = previousCategoryID
+	}
+	server.publishPostFrame(realtimeforum.Message{Type: "postEdited", Post: &summary})
+}
+
+// PublishPostDelete sends a "postDeleted" frame, which only identifies the post, to the same
+// users as PublishPost.
+func (server *WebSocketServer) PublishPostDelete(post realtimeforum.Posts) {
+	summary := realtimeforum.PostSummary{
+		PostID:     post.PostID,
+		UserID:     post.UserID,
+		CategoryID: post.CategoryID,
+		CreatedAt:  post.CreatedAt,
+		Deleted:    true,
+	}
+	server.publishPostFrame(realtimeforum.Message{Type: "postDeleted", Post: &summary})
+}
+
+// PublishPollResults sends a "pollResults" frame with the votes counted in the poll of a post,
+// without who cast them, to the same users as PublishPost.
+func (server *WebSocketServer) PublishPollResults(post realtimeforum.Posts, poll realtimeforum.Poll) {
+	summary := realtimeforum.PostSummary{
+		PostID:     post.PostID,
+		UserID:     post.UserID,
+		CategoryID: post.CategoryID,
+		CreatedAt:  post.CreatedAt,
+	}
+	results := service.PollResults(poll)
+	server.publishPostFrame(realtimeforum.Message{Type: "pollResults", Post: &summary, Poll: &results})
+}
+
+// postSummary describes a post in feed frames.
+func (server *WebSocketServer) postSummary(post realtimeforum.Posts) realtimeforum.PostSummary {
+	summary := realtimeforum.PostSummary{
+		PostID:     post.PostID,
+		UserID:     post.UserID,
+		Title:      post.Title,
+		Excerpt:    excerpt(post.Content, excerptLength),
+		CategoryID: post.CategoryID,
+		CreatedAt:  post.CreatedAt,
+	}
+	username, err := server.ForumService.GetUsernameByID(int64(post.UserID))
+	if err != nil {
+		slog.Error("Error getting username", "user_id", post.UserID, "err", err)
+	}
+	summary.AuthorUsername = username
+	return summary
+}
+
+// publishPostFrame sends a feed frame to the subscribers of its post's categories on every
+// node, except the users who blocked the author of the post.
+func (server *WebSocketServer) publishPostFrame(frame realtimeforum.Message) {
+	authorID := int64(frame.Post.UserID)
+	blockers, err := server.ForumService.GetRelationOwners(authorID, realtimeforum.RelationBlock)
+	if err != nil {
+		slog.Error("Error getting users who blocked post author", "user_id", authorID, "err", err)
+	}
+
+	delivered := server.sendPostLocal(frame, blockers)
+	server.publish(clusterEvent{Kind: eventPost, Message: &frame, Exclude: keys(blockers)})
+	slog.Debug("Post sent to feed subscribers", "type", frame.Type, "post_id", frame.Post.PostID, "delivered", delivered)
+}
+
+// sendPostLocal records a feed frame in the session of every user of this node subscribed to
+// the post's category, or to the category it left, except the users in exclude, and writes it
+// to their connections. It returns the number of connections written to.
+func (server *WebSocketServer) sendPostLocal(frame realtimeforum.Message, exclude map[int64]bool) int {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+
+	recorded := make(map[int64]realtimeforum.Message)
+	for userID, s := range server.sessions {
+		if exclude[userID] || !s.feed.wants(frame.Post) {
+			continue
+		}
+		recorded[userID] = s.record(frame, server.EventLogSize)
+	}
+
+	delivered := 0
+	for conn, userID := range server.clients {
+		message, ok := recorded[userID]
+		if !ok {
+			continue
+		}
+		if err := server.send(conn, message); err != nil {
+			slog.Warn("Error sending new post to client", "user_id", userID, "err", err)
+			conn.Close()
+			delete(server.clients, conn)
+			continue
+		}
+		delivered++
+	}
+	return delivered
+}
+
+// excerpt returns the first limit characters of content, cut before the last word that does
+// not fit entirely and followed by an ellipsis when anything was left out.
+func excerpt(content string, limit int) string {
+	content = strings.TrimSpace(content)
+	if utf8.RuneCountInString(content) <= limit {
+		return content
+	}
+	runes := []rune(content)
+	cut := string(runes[:limit])
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \t\n.,;:") + "…"
+}
@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrHubStalled is returned by Check when the hub's connection lock is not released in time,
+// which means a handler is stuck while holding it and no frame can be routed to any client.
+var ErrHubStalled = errors.New("websocket hub is stalled")
+
+// hubProbe is a goroutine waiting to take the connection lock for Check. done is closed once it
+// has, with shuttingDown read under the lock.
+type hubProbe struct {
+	done         chan struct{}
+	shuttingDown bool
+}
+
+// Check reports whether the hub can take new connections and route frames: it fails once
+// Shutdown has started, and when the connection lock is not taken before ctx is done. The lock is
+// taken by a probe goroutine rather than by Check, so Check never blocks past ctx, and checks
+// made while a probe is still waiting share it instead of piling up behind the lock.
+func (server *WebSocketServer) Check(ctx context.Context) error {
+	probe := server.startProbe()
+	select {
+	case <-probe.done:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", ErrHubStalled, ctx.Err())
+	}
+	if probe.shuttingDown {
+		return errShuttingDown
+	}
+	return nil
+}
+
+// startProbe returns the probe that is waiting for the connection lock, starting one if there
+// is none.
+func (server *WebSocketServer) startProbe() *hubProbe {
+	server.probeMutex.Lock()
+	defer server.probeMutex.Unlock()
+	if server.probe != nil {
+		return server.probe
+	}
+	probe := &hubProbe{done: make(chan struct{})}
+	server.probe = probe
+	go func() {
+		server.clientsMutex.Lock()
+		probe.shuttingDown = server.shuttingDown
+		server.clientsMutex.Unlock()
+
+		server.probeMutex.Lock()
+		server.probe = nil
+		server.probeMutex.Unlock()
+		close(probe.done)
+	}()
+	return probe
+}
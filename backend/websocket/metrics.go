@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"errors"
+
+	"livechat-system/backend/metrics"
+	realtimeforum "livechat-system/backend/models"
+)
+
+// frameTypes are the frame types clients may send. Anything else is counted as "unknown", since
+// the type is chosen by the client and every distinct label value becomes a new series.
+var frameTypes = map[string]bool{
+	"private":        true,
+	"broadcast":      true,
+	"edit":           true,
+	"delete":         true,
+	"addReaction":    true,
+	"removeReaction": true,
+	"onlineUsers":    true,
+	"subscribe":      true,
+	"unsubscribe":    true,
+}
+
+// hubMetrics holds the counters the hub updates as frames come and go.
+type hubMetrics struct {
+	received    *metrics.CounterVec
+	drops       *metrics.CounterVec
+	writeErrors *metrics.CounterVec
+}
+
+// RegisterMetrics exposes the number of connections and online users, the frames received per
+// type, the frames dropped because a client fell too far behind and the writes of frames to
+// clients that failed. Without it the hub keeps no metrics.
+func (server *WebSocketServer) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewFunc("livechat_websocket_connections", "Open client connections, over WebSocket, Server-Sent Events or long-polling.",
+		metrics.TypeGauge, nil, func() []metrics.Sample {
+			server.clientsMutex.Lock()
+			defer server.clientsMutex.Unlock()
+			return []metrics.Sample{{Value: float64(len(server.clients))}}
+		})
+	registry.NewFunc("livechat_online_users", "Users with at least one open connection.",
+		metrics.TypeGauge, nil, func() []metrics.Sample {
+			server.userStatusMutex.Lock()
+			defer server.userStatusMutex.Unlock()
+			return []metrics.Sample{{Value: float64(len(server.onlineUsers))}}
+		})
+	server.metrics = &hubMetrics{
+		received: registry.NewCounterVec("livechat_websocket_messages_received_total",
+			"WebSocket frames received from clients by type.", "type"),
+		drops: registry.NewCounterVec("livechat_websocket_send_buffer_drops_total",
+			"Frames dropped because the send queue or long-polling buffer of the client was full, by frame type.", "type"),
+		writeErrors: registry.NewCounterVec("livechat_websocket_write_errors_total",
+			"Writes of frames to clients that failed, by frame type.", "type"),
+	}
+}
+
+func (server *WebSocketServer) countReceived(frameType string) {
+	if server.metrics == nil {
+		return
+	}
+	if !frameTypes[frameType] {
+		frameType = "unknown"
+	}
+	server.metrics.received.With(frameType).Inc()
+}
+
+// send sends one frame to a connection and counts it if it is dropped or fails. Senders close
+// the connection when it returns an error, so a client that fell behind reconnects and resumes.
+func (server *WebSocketServer) send(conn connection, v interface{}) error {
+	err := conn.WriteJSON(v)
+	switch {
+	case err == nil, server.metrics == nil, errors.Is(err, errConnectionClosed):
+	case errors.Is(err, errSendQueueFull), errors.Is(err, errPollBufferFull):
+		server.metrics.drops.With(outgoingType(v)).Inc()
+	default:
+		server.metrics.writeErrors.With(outgoingType(v)).Inc()
+	}
+	return err
+}
+
+// countWriteError counts a frame whose write to the client failed.
+func (server *WebSocketServer) countWriteError(v interface{}) {
+	if server.metrics != nil {
+		server.metrics.writeErrors.With(outgoingType(v)).Inc()
+	}
+}
+
+// outgoingType returns the type of a frame sent by the server. Replies built as maps carry
+// their type in the "type" key, or are error replies.
+func outgoingType(v interface{}) string {
+	switch frame := v.(type) {
+	case realtimeforum.Message:
+		return frame.Type
+	case map[string]string:
+		if frameType := frame["type"]; frameType != "" {
+			return frameType
+		}
+	case map[string]interface{}:
+		if frameType, ok := frame["type"].(string); ok {
+			return frameType
+		}
+	}
+	return "error"
+}
@@ -0,0 +1,16 @@
+package websocket
+
+import realtimeforum "livechat-system/backend/models"
+
+// SendNotifications sends each notification to its user in a "notification" frame, on every
+// connection of the user to any node. Users who are not connected read it from /notifications.
+func (server *WebSocketServer) SendNotifications(notifications []realtimeforum.Notification) {
+	for i := range notifications {
+		notification := notifications[i]
+		server.sendToUser(int64(notification.UserID), realtimeforum.Message{
+			Type:         "notification",
+			SentAt:       notification.CreatedAt,
+			Notification: &notification,
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"livechat-system/backend/logging"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// pollTimeout is how long a poll waits for frames before returning none.
+	pollTimeout = 25 * time.Second
+
+	// pollIdleTimeout is how long a long-polling connection is kept without a poll. Past it the
+	// client is considered gone, and offline once it has no other connection.
+	pollIdleTimeout = 2 * pollTimeout
+
+	// pollBufferSize is how many frames a long-polling connection holds until the client
+	// acknowledges them. A client that falls further behind is disconnected and resumes from its
+	// last sequence number.
+	pollBufferSize = 1000
+)
+
+// errPollBufferFull is returned when a long-polling client stopped collecting its frames.
+var errPollBufferFull = errors.New("long-polling buffer is full")
+
+// pollConnection is a long-polling connection: frames are held until a poll of the client
+// acknowledges them, so that none is lost with a response that does not reach it. It outlives
+// the requests, and is identified across them by its cursor. The client sends its frames with
+// HandleSend.
+type pollConnection struct {
+	cursor    string
+	userID    int64
+	wake      chan struct{} // Signalled when frames arrive
+	done      chan struct{} // Closed by Close
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	frames   []json.RawMessage // Not acknowledged yet, the first one at position acked+1
+	acked    int64             // Position of the last frame acknowledged, counting from 1
+	notice   *closeNotice      // Set by WriteClose
+	lastPoll time.Time         // When a poll last started or ended
+}
+
+// pollResponse is the body of a reply to a poll.
+type pollResponse struct {
+	Cursor string            `json:"cursor"`          // Identifies the connection in the next poll
+	Frames []json.RawMessage `json:"frames"`          // Frames not acknowledged yet, oldest first
+	Seq    int64             `json:"seq"`             // Position of the last of Frames, which the next poll acknowledges with lastSeq
+	Close  *closeNotice      `json:"close,omitempty"` // Set once the connection ended; poll again without a cursor to reconnect
+}
+
+func newPollConnection(userID int64) (*pollConnection, error) {
+	cursor := make([]byte, 16)
+	if _, err := rand.Read(cursor); err != nil {
+		return nil, err
+	}
+	return &pollConnection{
+		cursor:   hex.EncodeToString(cursor),
+		userID:   userID,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		lastPoll: time.Now(),
+	}, nil
+}
+
+func (c *pollConnection) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if len(c.frames) >= pollBufferSize {
+		c.mu.Unlock()
+		return errPollBufferFull
+	}
+	c.frames = append(c.frames, data)
+	c.mu.Unlock()
+	c.signal()
+	return nil
+}
+
+// WriteClose hands the reason to the pending or next poll and ends the connection.
+func (c *pollConnection) WriteClose(code int, reason string) error {
+	c.mu.Lock()
+	c.notice = &closeNotice{Code: code, Reason: reason}
+	c.mu.Unlock()
+	return c.Close()
+}
+
+func (c *pollConnection) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *pollConnection) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// acknowledge discards the frames up to position lastSeq, which the client received.
+func (c *pollConnection) acknowledge(lastSeq int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := min(max(lastSeq-c.acked, 0), int64(len(c.frames)))
+	c.frames = c.frames[n:]
+	c.acked += n
+}
+
+// pending returns the frames not acknowledged yet, with the position of the last one.
+// c.mu must be held.
+func (c *pollConnection) pending() ([]json.RawMessage, int64) {
+	frames := append([]json.RawMessage(nil), c.frames...)
+	return frames, c.acked + int64(len(frames))
+}
+
+// collect waits until frames are available, the connection ends, timeout elapses or ctx is
+// done, and returns the frames not acknowledged yet with the position of the last one, which
+// are kept until acknowledged. notice is set once the connection has ended.
+func (c *pollConnection) collect(ctx context.Context, timeout time.Duration) (frames []json.RawMessage, seq int64, notice *closeNotice) {
+	c.touch()
+	defer c.touch()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		frames, seq = c.pending()
+		notice = c.notice
+		c.mu.Unlock()
+		if len(frames) > 0 || notice != nil {
+			return frames, seq, notice
+		}
+
+		select {
+		case <-c.wake:
+		case <-c.done:
+			// Closed without a reason: the client was dropped, for example for being idle
+			c.mu.Lock()
+			frames, seq = c.pending()
+			if c.notice == nil {
+				c.notice = &closeNotice{Code: websocket.CloseAbnormalClosure, Reason: "connection dropped"}
+			}
+			notice = c.notice
+			c.mu.Unlock()
+			return frames, seq, notice
+		case <-timer.C:
+			return nil, seq, nil
+		case <-ctx.Done():
+			return nil, seq, nil
+		}
+	}
+}
+
+func (c *pollConnection) touch() {
+	c.mu.Lock()
+	c.lastPoll = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *pollConnection) idleSince() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastPoll
+}
+
+// HandlePoll serves long-polling, the last resort of clients that can use neither WebSocket
+// nor Server-Sent Events. A poll without a cursor opens a connection, authenticated and resumed
+// like HandleConnections, and returns its cursor with the presence snapshot. Each following poll
+// passes the cursor, and the seq of the previous response as lastSeq to acknowledge its frames,
+// and returns the frames not acknowledged yet, waiting up to 25 seconds for some. Frames are
+// only discarded once acknowledged, so a response lost on its way is sent again by the next
+// poll. A poll with an unknown or expired cursor is answered 410 Gone. A DELETE with the
+// cursor closes the connection, which otherwise lasts until the client stops polling.
+func (server *WebSocketServer) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context()).With("remote_addr", r.RemoteAddr, "transport", "poll")
+
+	userID, ok := server.authenticate(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With("user_id", userID)
+
+	var conn *pollConnection
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		server.clientsMutex.Lock()
+		conn = server.polls[cursor]
+		server.clientsMutex.Unlock()
+		if conn == nil || conn.userID != userID {
+			http.Error(w, "Unknown or expired cursor", http.StatusGone)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			conn.Close()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		lastSeq, ok := lastSeqParam(w, r)
+		if !ok {
+			return
+		}
+		conn.acknowledge(lastSeq)
+	} else {
+		lastSeq, ok := lastSeqParam(w, r)
+		if !ok {
+			return
+		}
+		if !server.acceptConnection() {
+			rejectDuringShutdown(w)
+			return
+		}
+		var err error
+		conn, err = newPollConnection(userID)
+		if err != nil {
+			server.handlers.Done()
+			logger.Error("Error creating long-polling connection", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		server.clientsMutex.Lock()
+		server.polls[conn.cursor] = conn
+		server.clientsMutex.Unlock()
+		server.connectClient(conn, userID, lastSeq, logger)
+		go server.servePoll(conn, logger)
+	}
+
+	frames, seq, notice := conn.collect(r.Context(), pollTimeout)
+	if frames == nil {
+		frames = []json.RawMessage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(pollResponse{Cursor: conn.cursor, Frames: frames, Seq: seq, Close: notice}); err != nil {
+		logger.Debug("Error writing poll response", "err", err)
+	}
+}
+
+// servePoll keeps a long-polling connection registered until it is closed or stops being
+// polled, which is what a connection handler does for the other transports.
+func (server *WebSocketServer) servePoll(conn *pollConnection, logger *slog.Logger) {
+	defer server.handlers.Done()
+
+	ticker := time.NewTicker(pollIdleTimeout / 5)
+	defer ticker.Stop()
+	for open := true; open; {
+		select {
+		case <-conn.done:
+			open = false
+		case <-ticker.C:
+			if time.Since(conn.idleSince()) > pollIdleTimeout {
+				logger.Info("Long-polling client stopped polling")
+				conn.Close()
+				open = false
+			}
+		}
+	}
+
+	server.clientsMutex.Lock()
+	delete(server.polls, conn.cursor)
+	server.clientsMutex.Unlock()
+	server.handleClientDisconnection(conn, conn.userID, logger)
+}
@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// sendQueueSize is how many frames may wait to be written to one WebSocket or event stream
+	// client. A client that falls further behind is disconnected and resumes from its last
+	// sequence number, since its session still holds the frames.
+	sendQueueSize = 256
+
+	// writeTimeout bounds how long writing one frame to a client may take. A client that reads
+	// nothing for that long is disconnected.
+	writeTimeout = 10 * time.Second
+)
+
+// Errors returned by sendQueue.WriteJSON when the frame is not queued.
+var (
+	errSendQueueFull    = errors.New("send queue is full")
+	errConnectionClosed = errors.New("connection is closed")
+)
+
+// frameWriter is a transport whose writes block until the client reads them. A sendQueue
+// calls it from a single goroutine.
+type frameWriter interface {
+	WriteJSON(v interface{}) error
+	WriteClose(code int, reason string) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// heartbeater is a frameWriter that must be written to every sseHeartbeatInterval while idle,
+// so proxies do not close it for inactivity.
+type heartbeater interface {
+	heartbeat() error
+}
+
+// queuedFrame is a frame waiting in a sendQueue: v, or a close frame when notice is set.
+type queuedFrame struct {
+	v      interface{}
+	notice *closeNotice
+}
+
+// sendQueue is the connection the hub registers for a WebSocket or event stream client. Frames
+// are queued without blocking and written by a goroutine of the queue, so the hub never writes to
+// a socket while holding clientsMutex, and a client that stops reading holds up nothing but its
+// own queue. When the queue is full the frame is dropped and the hub closes the connection.
+type sendQueue struct {
+	conn   frameWriter
+	server *WebSocketServer
+	userID int64
+	linger time.Duration // How long the connection stays open after a close frame, for the client to answer it
+
+	frames    chan queuedFrame
+	closing   chan struct{} // Closed by Close
+	stopped   chan struct{} // Closed once the writer has stopped and closed conn
+	closeOnce sync.Once
+}
+
+// newSendQueue starts writing to conn, a connection of userID.
+func (server *WebSocketServer) newSendQueue(conn frameWriter, userID int64, linger time.Duration) *sendQueue {
+	q := &sendQueue{
+		conn:    conn,
+		server:  server,
+		userID:  userID,
+		linger:  linger,
+		frames:  make(chan queuedFrame, sendQueueSize),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// WriteJSON queues a frame. It returns errSendQueueFull, dropping the frame, when the client has
+// fallen sendQueueSize frames behind.
+func (q *sendQueue) WriteJSON(v interface{}) error {
+	return q.enqueue(queuedFrame{v: v})
+}
+
+// WriteClose queues a close frame, written after the frames queued before it. Nothing is
+// written after it.
+func (q *sendQueue) WriteClose(code int, reason string) error {
+	return q.enqueue(queuedFrame{notice: &closeNotice{Code: code, Reason: reason}})
+}
+
+func (q *sendQueue) enqueue(frame queuedFrame) error {
+	select {
+	case <-q.closing:
+		return errConnectionClosed
+	default:
+	}
+	select {
+	case q.frames <- frame:
+		return nil
+	default:
+		return errSendQueueFull
+	}
+}
+
+// Close stops queueing frames. The writer writes those already queued, as long as the client
+// reads them within writeTimeout, and then closes the connection.
+func (q *sendQueue) Close() error {
+	q.closeOnce.Do(func() { close(q.closing) })
+	return nil
+}
+
+// run writes the queued frames until Close is called, a close frame is written or a write fails,
+// and then closes the connection.
+func (q *sendQueue) run() {
+	defer close(q.stopped)
+	defer q.conn.Close()
+
+	var heartbeat <-chan time.Time
+	if _, ok := q.conn.(heartbeater); ok {
+		ticker := time.NewTicker(sseHeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case frame := <-q.frames:
+			if !q.write(frame) {
+				return
+			}
+		case <-heartbeat:
+			q.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := q.conn.(heartbeater).heartbeat(); err != nil {
+				slog.Debug("Heartbeat failed", "user_id", q.userID, "err", err)
+				return
+			}
+		case <-q.closing:
+			for {
+				select {
+				case frame := <-q.frames:
+					if !q.write(frame) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes one frame and reports whether the writer should go on.
+func (q *sendQueue) write(frame queuedFrame) bool {
+	if err := q.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		slog.Warn("Error setting write deadline", "user_id", q.userID, "err", err)
+	}
+	if frame.notice != nil {
+		if err := q.conn.WriteClose(frame.notice.Code, frame.notice.Reason); err != nil {
+			slog.Warn("Error sending close frame", "user_id", q.userID, "err", err)
+			return false
+		}
+		if q.linger > 0 {
+			select {
+			case <-q.closing:
+			case <-time.After(q.linger):
+			}
+		}
+		return false
+	}
+	if err := q.conn.WriteJSON(frame.v); err != nil {
+		q.server.countWriteError(frame.v)
+		slog.Warn("Error writing to client", "user_id", q.userID, "err", err)
+		return false
+	}
+	return true
+}
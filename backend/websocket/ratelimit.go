@@ -0,0 +1,43 @@
+package websocket
+
+import (
+	"log/slog"
+	"strconv"
+
+	"livechat-system/backend/ratelimit"
+
+	"github.com/gorilla/websocket"
+)
+
+// allowFrame applies the rate limit of the frame's type to userID, shared by all their connections.
+// A rejected frame gets a "rateLimited" error frame. It returns false when the frame must be dropped,
+// and disconnect is true when the user keeps exceeding the limit and the connection must be closed.
+func (server *WebSocketServer) allowFrame(conn connection, userID int64, frameType, clientMessageID string, logger *slog.Logger) (allowed bool, disconnect bool) {
+	if server.RateLimits == nil {
+		return true, false
+	}
+
+	key := "user:" + strconv.FormatInt(userID, 10)
+	allowed, wait := server.RateLimits.Allow(frameType, key)
+	if allowed {
+		return true, false
+	}
+
+	logger.Info("Rate limited frame", "type", frameType)
+	if server.Offenders != nil && server.Offenders.Strike(key) {
+		logger.Warn("User keeps exceeding the rate limit, disconnecting")
+		if err := conn.WriteClose(websocket.ClosePolicyViolation, "rate limit exceeded"); err != nil {
+			logger.Warn("Error sending close frame", "err", err)
+		}
+		return false, true
+	}
+
+	server.writeJSON(conn, map[string]interface{}{
+		"type":            "rateLimited",
+		"error":           "Rate limit exceeded",
+		"frameType":       frameType,
+		"retryAfter":      ratelimit.RetryAfterSeconds(wait),
+		"clientMessageId": clientMessageID,
+	})
+	return false, false
+}
@@ -0,0 +1,38 @@
+package websocket
+
+import (
+	"log/slog"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+// setReaction applies an "addReaction" or "removeReaction" frame from userID and sends the
+// message's updated reactions to everyone who can see the message.
+func (server *WebSocketServer) setReaction(userID int64, msg realtimeforum.Message, add bool, logger *slog.Logger) error {
+	if msg.MessageID == 0 {
+		return errMissingMessageID
+	}
+
+	chat, reactions, err := server.ForumService.SetReaction(msg.MessageID, userID, msg.Emoji, add)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Reaction updated", "message_id", chat.MessageID, "emoji", msg.Emoji, "add", add)
+
+	// The frame carries the full aggregate so clients can simply replace what they show
+	frame := realtimeforum.Message{
+		Type:       "reaction",
+		MessageID:  int64(chat.MessageID),
+		ReceiverID: int64(chat.ReceiverID),
+		Emoji:      msg.Emoji,
+		Reactions:  reactions,
+	}
+	if chat.ReceiverID == realtimeforum.LobbyReceiverID {
+		// SenderID is left empty so the reacting user's own devices get the update too
+		server.broadcastMessageToAllClients(frame)
+		return nil
+	}
+	frame.SenderID = int64(chat.SenderID)
+	server.notifyParticipants(chat, frame)
+	return nil
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"livechat-system/backend/logging"
+	realtimeforum "livechat-system/backend/models"
+)
+
+// maxFrameSize bounds the size of a frame a client sends, over /ws or with HandleSend.
+const maxFrameSize = 64 << 10
+
+// replyConnection collects the replies to a frame sent with HandleSend, which returns them as
+// its response. It is never registered, so nothing but those replies is written to it.
+type replyConnection struct {
+	frames []interface{}
+}
+
+func (c *replyConnection) WriteJSON(v interface{}) error {
+	c.frames = append(c.frames, v)
+	return nil
+}
+
+// WriteClose does nothing: HandleSend answers 429 instead.
+func (c *replyConnection) WriteClose(code int, reason string) error { return nil }
+
+func (c *replyConnection) Close() error { return nil }
+
+// HandleSend takes one frame, as a client would send it over WebSocket, from a client that
+// receives its frames with HandleEvents or HandlePoll. The frame goes through the same rate limits
+// and routing, and the response is the JSON array of the replies a WebSocket client would have
+// received, such as the ack of a chat message. A user who keeps exceeding the rate limits is
+// answered 429 Too Many Requests.
+func (server *WebSocketServer) HandleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	logger := logging.FromContext(r.Context()).With("remote_addr", r.RemoteAddr, "transport", "post")
+
+	userID, ok := server.authenticate(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With("user_id", userID)
+
+	var msg realtimeforum.Message
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFrameSize)).Decode(&msg); err != nil {
+		http.Error(w, "Invalid frame", http.StatusBadRequest)
+		return
+	}
+	logger.Debug("Frame received", "type", msg.Type)
+
+	replies := &replyConnection{frames: []interface{}{}}
+	status := http.StatusOK
+	if disconnect := server.handleFrame(replies, userID, msg, logger); disconnect {
+		status = http.StatusTooManyRequests
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(replies.frames); err != nil {
+		logger.Debug("Error writing send response", "err", err)
+	}
+}
@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"log/slog"
+	"math/rand"
+	"time"
+
+	realtimeforum "livechat-system/backend/models"
+)
+
+const (
+	// sessionOriginRange bounds the sequence number a new session starts from. Sequence numbers
+	// stay below 2^53, so browsers parse them exactly.
+	sessionOriginRange = 1 << 52
+
+	// DefaultEventLogSize is how many recent events are kept per user so a reconnecting client can catch up.
+	DefaultEventLogSize = 500
+	// DefaultSessionTTL is how long a session is kept after its user's last connection closed.
+	DefaultSessionTTL = 30 * time.Minute
+)
+
+// userSession tracks the event sequence of a single user across all of their connections.
+// Every event sent to the user gets the next sequence number and is kept in a bounded log,
+// so a client that reconnects with the last sequence it saw can be sent what it missed.
+//
+// Sessions are kept by each node, not shared across a cluster. A session starts its sequence at a
+// random origin, so the sequence numbers of a client that reconnects to another node, or to this
+// one after its session was purged or the server restarted, are unknown to the session it gets:
+// the client is sent a "resync" frame and reloads its state instead of being replayed events of
+// another sequence.
+type userSession struct {
+	lastSeq  int64                   // Sequence number of the most recent event
+	events   []realtimeforum.Message // Most recent events, oldest first
+	lastSeen time.Time               // When the user last had a connection open
+	feed     feedSubscription        // Categories whose new posts the user is sent
+}
+
+// record assigns the next sequence number to the message and appends it to the log,
+// dropping the oldest event once the log holds limit events.
+func (s *userSession) record(msg realtimeforum.Message, limit int) realtimeforum.Message {
+	s.lastSeq++
+	msg.Seq = s.lastSeq
+	s.events = append(s.events, msg)
+	if len(s.events) > limit {
+		s.events = s.events[len(s.events)-limit:]
+	}
+	return msg
+}
+
+// since returns the events after lastSeq. It returns false if some of those events were
+// already dropped from the log, or if lastSeq is from a sequence the server no longer knows.
+func (s *userSession) since(lastSeq int64) ([]realtimeforum.Message, bool) {
+	if lastSeq > s.lastSeq {
+		return nil, false
+	}
+	if lastSeq == s.lastSeq {
+		return nil, true
+	}
+	if len(s.events) == 0 || s.events[0].Seq > lastSeq+1 {
+		return nil, false
+	}
+	first := len(s.events) - int(s.lastSeq-lastSeq)
+	return s.events[first:], true
+}
+
+// session returns the session of the given user, creating it if needed.
+// clientsMutex must be held.
+func (server *WebSocketServer) session(userID int64) *userSession {
+	s, ok := server.sessions[userID]
+	if !ok {
+		s = &userSession{lastSeq: rand.Int63n(sessionOriginRange)}
+		server.sessions[userID] = s
+	}
+	s.lastSeen = time.Now()
+	return s
+}
+
+// resumeSession sends a reconnecting client every event it missed since lastSeq,
+// or a "resync" frame if the gap can no longer be filled from the log.
+// clientsMutex must be held so no new event is recorded while replaying.
+func (server *WebSocketServer) resumeSession(conn connection, userID int64, lastSeq int64, logger *slog.Logger) {
+	s := server.session(userID)
+	missed, ok := s.since(lastSeq)
+	if !ok {
+		logger.Info("Cannot resume session, asking for a full resync", "last_seq", lastSeq, "current_seq", s.lastSeq)
+		if err := server.send(conn, realtimeforum.Message{Type: "resync", Seq: s.lastSeq}); err != nil {
+			logger.Warn("Error sending resync", "err", err)
+		}
+		return
+	}
+
+	logger.Info("Resuming session", "last_seq", lastSeq, "replayed", len(missed))
+	for _, event := range missed {
+		if err := server.send(conn, event); err != nil {
+			logger.Warn("Error replaying event", "seq", event.Seq, "err", err)
+			return
+		}
+	}
+}
+
+// PurgeIdleSessions forgets the sessions of users who have had no connection open for longer
+// than SessionTTL and returns how many were removed.
+func (server *WebSocketServer) PurgeIdleSessions() int {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+	return server.purgeIdleSessions(time.Now())
+}
+
+// purgeIdleSessions is PurgeIdleSessions for callers that already hold clientsMutex.
+func (server *WebSocketServer) purgeIdleSessions(now time.Time) int {
+	connected := make(map[int64]bool)
+	for _, userID := range server.clients {
+		connected[userID] = true
+	}
+	purged := 0
+	for userID, s := range server.sessions {
+		if !connected[userID] && now.Sub(s.lastSeen) > server.SessionTTL {
+			delete(server.sessions, userID)
+			purged++
+		}
+	}
+	return purged
+}
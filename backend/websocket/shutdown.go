@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shutdownReason is sent with the "service restart" close code, telling clients to reconnect shortly.
+const shutdownReason = "server restarting"
+
+// closeFrameTimeout bounds how long sending a close frame to one client may take.
+const closeFrameTimeout = time.Second
+
+// errShuttingDown is returned to upgrade requests that arrive once Shutdown has started.
+var errShuttingDown = errors.New("server is shutting down")
+
+// acceptConnection registers a connection handler that Shutdown must wait for.
+// It returns false once Shutdown has started.
+func (server *WebSocketServer) acceptConnection() bool {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+	if server.shuttingDown {
+		return false
+	}
+	server.handlers.Add(1)
+	return true
+}
+
+// CloseConnections stops accepting connections and sends every client a close frame telling it
+// to reconnect later. Event streams and long polls are HTTP requests, so it must run as soon as
+// the HTTP server starts shutting down, which waits for them: register it with
+// http.Server.RegisterOnShutdown. Calling it again does nothing.
+func (server *WebSocketServer) CloseConnections() {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+	if server.shuttingDown {
+		return
+	}
+	server.shuttingDown = true
+	for conn := range server.clients {
+		if err := conn.WriteClose(websocket.CloseServiceRestart, shutdownReason); err != nil {
+			slog.Warn("Error sending close frame", "user_id", server.clients[conn], "err", err)
+			conn.Close()
+		}
+	}
+	slog.Info("Sent close frames to clients", "count", len(server.clients))
+}
+
+// Shutdown closes the connections like CloseConnections, if that was not done yet, and waits
+// until each connection handler has finished the frame it was processing, so every chat message
+// that was received is stored before the database is closed. If ctx expires first, the remaining
+// connections are closed forcibly and ctx's error is returned. In a cluster, the other nodes
+// are then told that the users connected to this one went offline.
+func (server *WebSocketServer) Shutdown(ctx context.Context) error {
+	defer server.leaveCluster()
+
+	server.CloseConnections()
+
+	done := make(chan struct{})
+	go func() {
+		server.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// Clients that did not answer the close frame are dropped. Their handlers still
+		// finish the frame in progress before noticing the closed connection.
+		server.clientsMutex.Lock()
+		for conn := range server.clients {
+			conn.Close()
+		}
+		server.clientsMutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// rejectDuringShutdown answers an upgrade request that arrived after Shutdown started.
+func rejectDuringShutdown(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, errShuttingDown.Error(), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"livechat-system/backend/logging"
+	realtimeforum "livechat-system/backend/models"
+)
+
+const (
+	// sseHeartbeatInterval is how often an idle event stream gets a comment, so proxies do
+	// not close it for inactivity.
+	sseHeartbeatInterval = 20 * time.Second
+
+	// sseRetry is how long EventSource waits before reconnecting a dropped stream, in milliseconds.
+	sseRetry = 3000
+)
+
+// sseConnection is a connection over Server-Sent Events, written to by a sendQueue. The server
+// writes frames as events; the client sends its frames with HandleSend.
+type sseConnection struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newSSEConnection(w http.ResponseWriter) *sseConnection {
+	return &sseConnection{w: w, rc: http.NewResponseController(w)}
+}
+
+// WriteJSON sends the frame as a "message" event. Events with a sequence number carry it as
+// their ID, so EventSource sends it back in Last-Event-ID when it reconnects and the missed
+// events are replayed.
+func (c *sseConnection) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if message, ok := v.(realtimeforum.Message); ok && message.Seq > 0 {
+		if _, err := fmt.Fprintf(c.w, "id: %d\n", message.Seq); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(c.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+// WriteClose sends a "close" event. The stream ends once the sendQueue stops after it.
+func (c *sseConnection) WriteClose(code int, reason string) error {
+	data, err := json.Marshal(closeNotice{Code: code, Reason: reason})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.w, "event: close\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+// SetWriteDeadline bounds the next writes, where the ResponseWriter supports it.
+func (c *sseConnection) SetWriteDeadline(t time.Time) error {
+	if err := c.rc.SetWriteDeadline(t); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// Close does nothing: the stream ends when HandleEvents returns.
+func (c *sseConnection) Close() error {
+	return nil
+}
+
+// heartbeat writes a comment, which EventSource ignores.
+func (c *sseConnection) heartbeat() error {
+	if _, err := fmt.Fprint(c.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+// HandleEvents streams the hub's frames to an EventSource, for clients whose proxies do not
+// let WebSocket upgrades through. It authenticates and resumes sessions like HandleConnections;
+// EventSource's automatic reconnections resume from the Last-Event-ID header.
+func (server *WebSocketServer) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context()).With("remote_addr", r.RemoteAddr, "transport", "sse")
+
+	userID, ok := server.authenticate(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With("user_id", userID)
+	lastSeq, ok := lastSeqParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !server.acceptConnection() {
+		rejectDuringShutdown(w)
+		return
+	}
+	defer server.handlers.Done()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keeps nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	stream := newSSEConnection(w)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+	if err := stream.rc.Flush(); err != nil {
+		logger.Warn("Event stream cannot be flushed", "err", err)
+		return
+	}
+
+	// The queue writes the frames and the heartbeats until the stream fails or is closed
+	conn := server.newSendQueue(stream, userID, 0)
+	server.connectClient(conn, userID, lastSeq, logger)
+	select {
+	case <-conn.stopped:
+	case <-r.Context().Done():
+	}
+	server.handleClientDisconnection(conn, userID, logger)
+
+	// w must not be written to once the handler returns
+	<-conn.stopped
+}
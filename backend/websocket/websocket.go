@@ -1,15 +1,17 @@
 package websocket
 
 import (
-	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"runtime/debug"
 	"sync"
 	"time"
 
+	"livechat-system/backend/logging"
 	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/ratelimit"
 	service "livechat-system/backend/services"
 
 	"github.com/dgrijalva/jwt-go"
@@ -18,25 +20,44 @@ import (
 
 // WebSocketServer represents the WebSocket server.
 type WebSocketServer struct {
-	DB              *sql.DB
 	ForumService    *service.ForumService
 	SecretKey       string
-	clients         map[*websocket.Conn]int64 // Map to track all connected WebSocket clients
-	onlineUsers     map[int64]bool            // Map to track online users
+	EditWindow      time.Duration              // How long after sending a private message it may be edited or deleted
+	EventLogSize    int                        // Number of recent events kept per user for resuming sessions
+	SessionTTL      time.Duration              // How long a disconnected user's session is kept
+	RateLimits      *ratelimit.Group           // Per-user limits on incoming frames, by message type; nil disables them
+	Offenders       *ratelimit.Offenders       // Users who keep exceeding the limits get disconnected
+	CheckOrigin     func(r *http.Request) bool // Decides which browser origins may connect; nil allows any
+	clients         map[connection]int64       // Every client connection, over any transport, and its user
+	sessions        map[int64]*userSession     // Per-user event sequence and log, guarded by clientsMutex
+	polls           map[string]*pollConnection // Long-polling connections by cursor, guarded by clientsMutex
+	onlineUsers     map[int64]bool             // Map to track online users
+	shuttingDown    bool                       // Set by Shutdown, guarded by clientsMutex
+	metrics         *hubMetrics                // Set by RegisterMetrics; nil keeps no metrics
+	cluster         *cluster                   // Set by JoinCluster; nil when the hub runs on a single node
+	handlers        sync.WaitGroup             // Connection handlers still running
+	probe           *hubProbe                  // The probe of Check waiting for clientsMutex, guarded by probeMutex
+	probeMutex      sync.Mutex
 	clientsMutex    sync.Mutex
 	userStatusMutex sync.Mutex
 }
 
-// NewWebSocketServer creates a new instance of WebSocketServer with dependencies injected.
-func NewWebSocketServer(db *sql.DB, forumService *service.ForumService, secretKey string) *WebSocketServer {
+// NewWebSocketServer creates a new instance of WebSocketServer with dependencies injected. Frames
+// are not rate limited until RateLimits and Offenders are set, from the configured policies.
+func NewWebSocketServer(forumService *service.ForumService, secretKey string) *WebSocketServer {
 	if forumService == nil {
-		log.Fatalf("ForumService is nil")
+		slog.Error("ForumService is nil")
+		os.Exit(1)
 	}
 	return &WebSocketServer{
-		DB:              db,
 		ForumService:    forumService,
 		SecretKey:       secretKey,
-		clients:         make(map[*websocket.Conn]int64),
+		EditWindow:      DefaultEditWindow,
+		EventLogSize:    DefaultEventLogSize,
+		SessionTTL:      DefaultSessionTTL,
+		clients:         make(map[connection]int64),
+		polls:           make(map[string]*pollConnection),
+		sessions:        make(map[int64]*userSession),
 		onlineUsers:     make(map[int64]bool),
 		userStatusMutex: sync.Mutex{},
 	}
@@ -57,48 +78,51 @@ type CustomClaims struct {
 
 // HandleConnections manages incoming WebSocket connections, enforcing JWT token validation.
 func (server *WebSocketServer) HandleConnections(w http.ResponseWriter, r *http.Request) {
-	log.Printf("New WebSocket connection attempt from %s", r.RemoteAddr)
+	logger := logging.FromContext(r.Context()).With("remote_addr", r.RemoteAddr)
+	logger.Debug("New WebSocket connection attempt")
 
-	// Extract JWT token from query parameters.
-	tokenString := r.URL.Query().Get("token")
-	if tokenString == "" {
-		log.Println("JWT token is missing")
-		http.Error(w, "JWT token is missing", http.StatusUnauthorized)
+	userID, ok := server.authenticate(w, r, logger)
+	if !ok {
 		return
 	}
+	logger = logger.With("user_id", userID)
+	logger.Debug("WebSocket connection authenticated")
 
-	// Validate JWT token.
-	claims, err := server.validateToken(tokenString)
-	if err != nil {
-		log.Printf("Invalid token: %v\n", err)
-		http.Error(w, "Invalid JWT token", http.StatusUnauthorized)
+	// A reconnecting client passes the last sequence number it saw so missed events can be replayed.
+	lastSeq, ok := lastSeqParam(w, r)
+	if !ok {
 		return
 	}
 
-	// At this point, the token is valid.
-	userID := claims.UserID
-	log.Printf("Authenticated user ID: %d\n", userID)
+	// Once shutdown has started no new connections are accepted
+	if !server.acceptConnection() {
+		rejectDuringShutdown(w)
+		return
+	}
+	defer server.handlers.Done()
 
 	// Proceed with WebSocket upgrade.
+	upgrader := upgrader
+	if server.CheckOrigin != nil {
+		upgrader.CheckOrigin = server.CheckOrigin
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("WebSocket Upgrade error:", err)
-		http.Error(w, "Failed to upgrade WebSocket connection", http.StatusInternalServerError)
+		// The upgrader already replied to the client
+		logger.Warn("WebSocket upgrade failed", "err", err)
 		return
 	}
 
 	// Delegate the connection handling to another method
-	server.handleClientConnection(conn, int64(claims.UserID))
+	server.handleClientConnection(conn, userID, lastSeq, logger)
 
 }
 
 func (server *WebSocketServer) validateToken(tokenString string) (*CustomClaims, error) {
-	fmt.Println("token at Validation:", tokenString) // Log the token to inspect its format and completeness
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(server.SecretKey), nil
 	})
 	if err != nil {
-		fmt.Println("Token validation error:", err) // More detailed error logging
 		return nil, err
 	}
 	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
@@ -108,51 +132,95 @@ func (server *WebSocketServer) validateToken(tokenString string) (*CustomClaims,
 	}
 }
 
-func (server *WebSocketServer) handleClientConnection(conn *websocket.Conn, userID int64) {
-	// Ensure to handle client disconnection
-	defer server.handleClientDisconnection(conn, userID)
+// handleClientConnection registers the WebSocket connection and serves it until it closes.
+// A lastSeq of -1 means the client is not resuming a previous session. Everything logged about
+// the connection goes through logger, which carries the ID of the upgrade request.
+func (server *WebSocketServer) handleClientConnection(ws *websocket.Conn, userID int64, lastSeq int64, logger *slog.Logger) {
+	// Larger frames close the connection before they are read
+	ws.SetReadLimit(maxFrameSize)
+	conn := server.newSendQueue(wsConnection{ws}, userID, closeFrameTimeout)
+	server.connectClient(conn, userID, lastSeq, logger)
+
+	// Listen to messages from this connection
+	server.listenToMessages(conn, ws, userID, logger)
+
+	// Shutdown waits for the handler, so it returns once the frames queued before the
+	// connection ended are written
+	<-conn.stopped
+}
 
-	// Register new connection with the user's ID.
+// connectClient registers a connection of any transport: it replays what a resuming client
+// missed, marks the user online and sends the presence snapshot. The connection's handler
+// must call handleClientDisconnection once it ends.
+func (server *WebSocketServer) connectClient(conn connection, userID int64, lastSeq int64, logger *slog.Logger) {
+	// Register new connection with the user's ID. Missed events are replayed under the same
+	// lock so nothing new can be recorded for this user between the replay and the registration.
 	server.clientsMutex.Lock()
 	if server.clients == nil {
-		server.clients = make(map[*websocket.Conn]int64)
+		server.clients = make(map[connection]int64)
+	}
+	server.purgeIdleSessions(time.Now())
+	if lastSeq >= 0 {
+		server.resumeSession(conn, userID, lastSeq, logger)
+	} else {
+		server.session(userID)
 	}
 	server.clients[conn] = userID
 	server.clientsMutex.Unlock()
+	logger.Info("Client connected")
 
 	server.markUserOnline(userID)
+	server.publish(clusterEvent{Kind: eventPresence, UserID: userID, Online: true})
 
 	// Send the initial online users list to the new client
-	server.sendOnlineUsersToClient(conn)
+	server.sendOnlineUsersToClient(conn, userID)
 
 	// Broadcast to all other clients that a new user has connected
 	server.broadcastUserStatusChange(userID, true)
-
-	// Listen to messages from this connection
-	server.listenToMessages(conn, userID)
 }
 
-func (server *WebSocketServer) sendOnlineUsersToClient(conn *websocket.Conn) {
-	onlineUsers := server.getOnlineUsers()
+// sendOnlineUsersToClient sends the presence snapshot as seen by userID. Its Seq is the user's
+// current sequence number, so the client knows which events the snapshot already reflects.
+func (server *WebSocketServer) sendOnlineUsersToClient(conn connection, userID int64) {
+	onlineUsers := server.getOnlineUsers(userID)
 	message := realtimeforum.Message{
 		Type:        "onlineUsers",
 		OnlineUsers: onlineUsers,
 	}
-	err := conn.WriteJSON(message)
-	if err != nil {
-		log.Printf("Error sending online users to client: %v", err)
+
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+	if s, ok := server.sessions[userID]; ok {
+		message.Seq = s.lastSeq
+	}
+	if err := server.send(conn, message); err != nil {
+		slog.Warn("Error sending online users to client", "user_id", userID, "err", err)
 	}
 }
 
-func (server *WebSocketServer) getOnlineUsers() []realtimeforum.UserStatus {
+// getOnlineUsers lists the users online on any node as seen by viewerID. Users the viewer has
+// blocked are left out.
+func (server *WebSocketServer) getOnlineUsers(viewerID int64) []realtimeforum.UserStatus {
+	blocked, err := server.ForumService.GetRelationTargets(viewerID, realtimeforum.RelationBlock)
+	if err != nil {
+		slog.Error("Error getting blocked users", "user_id", viewerID, "err", err)
+	}
+
+	online := server.remoteOnlineUsers()
 	server.userStatusMutex.Lock()
-	defer server.userStatusMutex.Unlock()
+	for userID := range server.onlineUsers {
+		online[userID] = true
+	}
+	server.userStatusMutex.Unlock()
 
 	var onlineUsers []realtimeforum.UserStatus
-	for userID := range server.onlineUsers {
+	for userID := range online {
+		if blocked[userID] {
+			continue
+		}
 		username, err := server.ForumService.GetUsernameByID(userID)
 		if err != nil {
-			log.Printf("Error getting username for user %d: %v", userID, err)
+			slog.Error("Error getting username", "user_id", userID, "err", err)
 			continue
 		}
 		onlineUsers = append(onlineUsers, realtimeforum.UserStatus{
@@ -164,10 +232,12 @@ func (server *WebSocketServer) getOnlineUsers() []realtimeforum.UserStatus {
 	return onlineUsers
 }
 
+// broadcastUserStatusChange tells the clients of this node that the user came online or went
+// offline. It is not forwarded: every node announces the changes it learns from presence events.
 func (server *WebSocketServer) broadcastUserStatusChange(userID int64, isOnline bool) {
 	username, err := server.ForumService.GetUsernameByID(userID)
 	if err != nil {
-		log.Printf("Error getting username for user %d: %v", userID, err)
+		slog.Error("Error getting username", "user_id", userID, "err", err)
 		return
 	}
 
@@ -177,154 +247,384 @@ func (server *WebSocketServer) broadcastUserStatusChange(userID int64, isOnline
 			{UserID: userID, Username: username, IsOnline: isOnline},
 		},
 	}
-	server.broadcastMessageToAllClients(statusChangeMessage)
+
+	// Users who blocked this user do not see their presence
+	blockers, err := server.ForumService.GetRelationOwners(userID, realtimeforum.RelationBlock)
+	if err != nil {
+		slog.Error("Error getting users who blocked user", "user_id", userID, "err", err)
+	}
+	server.broadcastLocal(statusChangeMessage, blockers, nil)
 }
 
-func (server *WebSocketServer) listenToMessages(conn *websocket.Conn, userID int64) {
+func (server *WebSocketServer) listenToMessages(conn connection, ws *websocket.Conn, userID int64, logger *slog.Logger) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in listenToMessages: %v", r)
-			debug.PrintStack()
+			logger.Error("Recovered from panic in listenToMessages", "panic", r, "stack", string(debug.Stack()))
 		}
-		server.handleClientDisconnection(conn, userID)
+		server.handleClientDisconnection(conn, userID, logger)
 	}()
 
 	for {
 		var msg realtimeforum.Message
-		err := conn.ReadJSON(&msg)
+		err := ws.ReadJSON(&msg)
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("Error reading JSON: %v", err)
-				debug.PrintStack()
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure,
+				websocket.CloseServiceRestart, websocket.ClosePolicyViolation) {
+				logger.Warn("Error reading JSON", "err", err)
 			}
 			break
 		}
 
-		log.Printf("Message from user %d: Type: %s", userID, msg.Type)
+		logger.Debug("WebSocket frame received", "type", msg.Type)
+		if disconnect := server.handleFrame(conn, userID, msg, logger); disconnect {
+			break
+		}
+	}
+}
+
+// handleFrame processes one frame sent by userID, whatever transport carried it, and writes the
+// replies, such as acks and errors, to conn. It returns true when the user keeps exceeding the
+// rate limits and the connection must be closed.
+func (server *WebSocketServer) handleFrame(conn connection, userID int64, msg realtimeforum.Message, logger *slog.Logger) (disconnect bool) {
+	server.countReceived(msg.Type)
+
+	allowed, disconnect := server.allowFrame(conn, userID, msg.Type, msg.ClientMessageID, logger)
+	if disconnect || !allowed {
+		return disconnect
+	}
 
-		switch msg.Type {
-		case "private":
-			if msg.ReceiverID != 0 {
-				msg.SenderID = userID
-				server.sendPrivateMessage(msg.SenderID, msg.ReceiverID, msg)
-			} else {
-				log.Printf("Invalid user IDs: SenderID %d, ReceiverID %d", msg.SenderID, msg.ReceiverID)
-				conn.WriteJSON(map[string]string{"error": "Invalid user IDs provided"})
+	switch msg.Type {
+	case "private":
+		if msg.ReceiverID != 0 {
+			msg.SenderID = userID
+			ack, err := server.sendPrivateMessage(msg.SenderID, msg.ReceiverID, msg, logger)
+			if err != nil {
+				logger.Warn("Error sending private message", "receiver_id", msg.ReceiverID, "err", err)
+				server.writeJSON(conn, map[string]string{"error": clientErrorText(err, "Failed to store message"), "clientMessageId": msg.ClientMessageID})
+				return false
 			}
-		case "broadcast":
-			// msg.SenderID = userID // Set the sender ID
-			server.broadcastMessage(msg)
-		case "onlineUsers":
-			server.sendOnlineUsersToClient(conn)
-		default:
-			log.Printf("Unhandled message type: %s", msg.Type)
-			conn.WriteJSON(map[string]string{"error": "Unhandled message type"})
+			server.writeJSON(conn, ack)
+		} else {
+			logger.Info("Private message without receiver")
+			server.writeJSON(conn, map[string]string{"error": "Invalid user IDs provided"})
+		}
+	case "broadcast":
+		msg.SenderID = userID // Never trust the sender ID supplied by the client
+		ack, err := server.broadcastMessage(msg, logger)
+		if err != nil {
+			logger.Error("Error storing broadcast message", "err", err)
+			server.writeJSON(conn, map[string]string{"error": clientErrorText(err, "Failed to store message"), "clientMessageId": msg.ClientMessageID})
+			return false
+		}
+		server.writeJSON(conn, ack)
+	case "edit":
+		if err := server.editMessage(userID, msg, logger); err != nil {
+			logger.Info("Error editing message", "message_id", msg.MessageID, "err", err)
+			server.writeJSON(conn, map[string]string{"error": clientErrorText(err, "Failed to update message")})
 		}
+	case "delete":
+		if err := server.deleteMessage(userID, msg, logger); err != nil {
+			logger.Info("Error deleting message", "message_id", msg.MessageID, "err", err)
+			server.writeJSON(conn, map[string]string{"error": clientErrorText(err, "Failed to update message")})
+		}
+	case "addReaction", "removeReaction":
+		if err := server.setReaction(userID, msg, msg.Type == "addReaction", logger); err != nil {
+			logger.Info("Error setting reaction", "message_id", msg.MessageID, "err", err)
+			server.writeJSON(conn, map[string]string{"error": clientErrorText(err, "Failed to update reaction")})
+		}
+	case "onlineUsers":
+		server.sendOnlineUsersToClient(conn, userID)
+	case "subscribe", "unsubscribe":
+		if err := server.updateFeed(conn, userID, msg, msg.Type == "subscribe"); err != nil {
+			logger.Info("Error updating feed subscriptions", "categories", msg.Categories, "err", err)
+			server.writeJSON(conn, map[string]string{"error": clientErrorText(err, "Failed to update subscriptions")})
+		}
+	default:
+		logger.Info("Unhandled message type", "type", msg.Type)
+		server.writeJSON(conn, map[string]string{"error": "Unhandled message type"})
 	}
+	return false
 }
 
-func (server *WebSocketServer) handleClientDisconnection(conn *websocket.Conn, userID int64) {
+// handleClientDisconnection unregisters a connection of any transport and, when it was the
+// user's last one, tells everyone the user went offline.
+func (server *WebSocketServer) handleClientDisconnection(conn connection, userID int64, logger *slog.Logger) {
 	conn.Close()
 	server.clientsMutex.Lock()
 	delete(server.clients, conn)
+	if s, ok := server.sessions[userID]; ok {
+		s.lastSeen = time.Now()
+	}
+	stillConnected := false
+	for _, id := range server.clients {
+		if id == userID {
+			stillConnected = true
+			break
+		}
+	}
+	shuttingDown := server.shuttingDown
 	server.clientsMutex.Unlock()
 
+	// Everyone is being disconnected, so there is nobody left to tell
+	if shuttingDown {
+		server.unmarkUserOnline(userID)
+		logger.Info("Client disconnected for shutdown")
+		return
+	}
+
+	// The user stays online while any of their other devices is still connected
+	if stillConnected {
+		logger.Info("Client disconnected, other connections remain")
+		return
+	}
+
 	server.unmarkUserOnline(userID)
+	server.publish(clusterEvent{Kind: eventPresence, UserID: userID})
+
+	// The user stays online while they are connected to another node
+	if server.onlineElsewhere(userID) {
+		logger.Info("Client disconnected, connected to another node")
+		return
+	}
 
 	// Broadcast to all clients that this user has disconnected
 	server.broadcastUserStatusChange(userID, false)
 
-	log.Printf("Client with user ID %d has disconnected", userID)
+	logger.Info("Client disconnected")
 }
 
-func (server *WebSocketServer) broadcastMessageToAllClients(message realtimeforum.Message) {
-	log.Println("Broadcasting message to all connected clients...")
-	acknowledged := false
+// broadcastMessageToAllClients records the message in the session of every user except the sender,
+// writes it to every connected client and returns the number of clients of this node that received
+// it. Users who are disconnected but still have a session get it when they resume. The other nodes
+// of a cluster do the same for their own clients.
+func (server *WebSocketServer) broadcastMessageToAllClients(message realtimeforum.Message) int {
+	return server.broadcastFiltered(message, nil, nil)
+}
+
+// broadcastFiltered works like broadcastMessageToAllClients, but skips the users in exclude
+// and flags the copies sent to the users in muted.
+func (server *WebSocketServer) broadcastFiltered(message realtimeforum.Message, exclude, muted map[int64]bool) int {
+	delivered := server.broadcastLocal(message, exclude, muted)
+	server.publish(clusterEvent{Kind: eventBroadcast, Message: &message, Exclude: keys(exclude), Muted: keys(muted)})
+	return delivered
+}
+
+// broadcastLocal is broadcastFiltered for the clients of this node only.
+func (server *WebSocketServer) broadcastLocal(message realtimeforum.Message, exclude, muted map[int64]bool) int {
+	slog.Debug("Broadcasting message to all connected clients", "type", message.Type)
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+
+	// Each user gets their own copy with their own sequence number
+	recorded := make(map[int64]realtimeforum.Message, len(server.sessions))
+	for userID, s := range server.sessions {
+		if userID == message.SenderID || exclude[userID] {
+			continue
+		}
+		tailored := message
+		tailored.Muted = muted[userID]
+		recorded[userID] = s.record(tailored, server.EventLogSize)
+	}
+
+	delivered := 0
 	for client, userID := range server.clients {
 		// Skip sending the message back to the sender
-		if userID == message.SenderID {
+		if userID == message.SenderID || exclude[userID] {
 			continue
 		}
-		if err := client.WriteJSON(message); err != nil {
-			log.Printf("Error broadcasting to client: %v", err)
+		if err := server.send(client, recorded[userID]); err != nil {
+			slog.Warn("Error broadcasting to client", "user_id", userID, "err", err)
 			client.Close()
 			delete(server.clients, client)
 		} else {
-			acknowledged = true
+			delivered++
 		}
 	}
-	if acknowledged {
-		log.Println("Broadcast message successfully sent to at least one client.")
-	} else {
-		log.Println("Failed to send broadcast message to any client.")
-	}
+	slog.Debug("Broadcast message sent", "type", message.Type, "delivered", delivered)
+	return delivered
 }
 
-func (server *WebSocketServer) broadcastMessage(message realtimeforum.Message) {
+// broadcastMessage stores a lobby message and sends it to every other connected client.
+// It returns the ack frame for the sender.
+func (server *WebSocketServer) broadcastMessage(message realtimeforum.Message, logger *slog.Logger) (realtimeforum.Message, error) {
 	message.Type = "broadcast"
-	log.Printf("Initiating broadcast for message: %s", message.Message)
-	server.broadcastMessageToAllClients(message)
+	message.SentAt = time.Now().UTC()
+
+	if senderUsername, err := server.ForumService.GetUsernameByID(message.SenderID); err == nil {
+		message.SenderUsername = senderUsername
+	} else {
+		logger.Error("Failed to retrieve sender username", "err", err)
+	}
+
+	chat, duplicate, err := server.ForumService.SaveChatMessageOnce(realtimeforum.Chats{
+		SenderID:        int(message.SenderID),
+		ReceiverID:      realtimeforum.LobbyReceiverID,
+		MessageContent:  message.Message,
+		SentAt:          message.SentAt,
+		SenderUsername:  message.SenderUsername,
+		ClientMessageID: message.ClientMessageID,
+		AttachmentIDs:   message.AttachmentIDs,
+	})
+	if err != nil {
+		return realtimeforum.Message{}, err
+	}
+	if duplicate {
+		// The client is retrying a message we already have, so only acknowledge it again
+		logger.Info("Duplicate broadcast, not re-sending", "client_message_id", message.ClientMessageID)
+		return newAck(chat), nil
+	}
+
+	message.MessageID = int64(chat.MessageID)
+	message.MessageHTML = chat.MessageHTML
+	message.AttachmentIDs, message.Attachments = nil, chat.Attachments
+
+	// Users who muted the sender still get the message, flagged so the client does not notify them
+	muters, err := server.ForumService.GetRelationOwners(message.SenderID, realtimeforum.RelationMute)
+	if err != nil {
+		logger.Error("Error getting users who muted sender", "err", err)
+	}
+	// Someone connected to another node counts as a delivery, since that node sends it to them
+	if server.broadcastFiltered(message, nil, muters) > 0 || server.anyoneElsewhere(message.SenderID) {
+		server.markDelivered(&chat)
+	}
+	return newAck(chat), nil
 }
 
-func (server *WebSocketServer) sendPrivateMessage(senderID int64, receiverID int64, msg realtimeforum.Message) {
+// sendPrivateMessage stores a private message and delivers it to every connection of the receiver.
+// The message is stored even if the receiver is offline. It returns the ack frame for the sender.
+func (server *WebSocketServer) sendPrivateMessage(senderID int64, receiverID int64, msg realtimeforum.Message, logger *slog.Logger) (realtimeforum.Message, error) {
+	logger = logger.With("receiver_id", receiverID)
 
-	server.clientsMutex.Lock()
-	defer server.clientsMutex.Unlock()
+	// A receiver who blocked the sender never gets their messages, and nothing is stored
+	blocked, err := server.ForumService.HasUserRelation(receiverID, senderID, realtimeforum.RelationBlock)
+	if err != nil {
+		return realtimeforum.Message{}, err
+	}
+	if blocked {
+		logger.Info("Receiver has blocked sender, rejecting private message")
+		return realtimeforum.Message{}, service.ErrBlocked
+	}
+	muted, err := server.ForumService.HasUserRelation(receiverID, senderID, realtimeforum.RelationMute)
+	if err != nil {
+		logger.Error("Error checking whether receiver muted sender", "err", err)
+	}
 
-	log.Printf("Attempting to send private message from %d to %d", senderID, receiverID)
+	outgoingMsg := realtimeforum.Message{
+		Type:            "private",
+		SenderID:        senderID,
+		ReceiverID:      receiverID,
+		Message:         msg.Message,
+		SenderUsername:  msg.SenderUsername,
+		ClientMessageID: msg.ClientMessageID,
+		SentAt:          time.Now().UTC(), // Ensure the timestamp is set
+		Muted:           muted,
+	}
 
-	for conn, id := range server.clients {
-		if id == receiverID {
-			log.Printf("Matching client found for receiver ID %d", receiverID)
-
-			outgoingMsg := realtimeforum.Message{
-				Type:           "private",
-				SenderID:       senderID,
-				ReceiverID:     receiverID,
-				Message:        msg.Message,
-				SenderUsername: msg.SenderUsername,
-				SentAt:         time.Now().UTC(), // Ensure the timestamp is set
-			}
+	if senderUsername, err := server.ForumService.GetUsernameByID(senderID); err == nil {
+		outgoingMsg.SenderUsername = senderUsername
+	} else {
+		logger.Error("Failed to retrieve sender username", "err", err)
+	}
 
-			if senderUsername, err := server.ForumService.GetUsernameByID(senderID); err == nil {
-				outgoingMsg.SenderUsername = senderUsername
-				log.Printf("Sender username set: %s", senderUsername)
-			} else {
-				log.Printf("Failed to retrieve sender username: %v", err)
-			}
+	// Store the message before delivering it so a retry with the same client ID can be detected
+	chat, duplicate, err := server.ForumService.SaveChatMessageOnce(realtimeforum.Chats{
+		SenderID:        int(senderID),
+		ReceiverID:      int(receiverID),
+		MessageContent:  msg.Message,
+		SentAt:          outgoingMsg.SentAt,
+		SenderUsername:  outgoingMsg.SenderUsername,
+		ClientMessageID: msg.ClientMessageID,
+		AttachmentIDs:   msg.AttachmentIDs,
+	})
+	if err != nil {
+		return realtimeforum.Message{}, err
+	}
+	if duplicate {
+		logger.Info("Duplicate private message, not re-delivering", "client_message_id", msg.ClientMessageID)
+		return newAck(chat), nil
+	}
+	outgoingMsg.MessageID = int64(chat.MessageID)
+	outgoingMsg.MessageHTML = chat.MessageHTML
+	outgoingMsg.Attachments = chat.Attachments
 
-			// Send message to the receiver
-			if err := conn.WriteJSON(outgoingMsg); err != nil {
-				log.Printf("Error sending private message to user ID %d: %v", receiverID, err)
-				server.clientsMutex.Lock()
-				conn.Close()
-				delete(server.clients, conn)
-				server.clientsMutex.Unlock()
-				debug.PrintStack()
-				return
-			}
+	if server.sendToUser(receiverID, outgoingMsg) > 0 || server.onlineElsewhere(receiverID) {
+		logger.Debug("Private message delivered", "message_id", chat.MessageID)
+		server.markDelivered(&chat)
+	} else {
+		logger.Debug("Receiver not connected, private message stored only", "message_id", chat.MessageID)
+	}
 
-			log.Printf("Private message sent successfully to user ID %d", receiverID)
+	if err := server.ForumService.UpdateUserLastActivity(senderID); err != nil {
+		logger.Error("Failed to update last activity", "err", err)
+	}
+	return newAck(chat), nil
+}
 
-			chat := realtimeforum.Chats{
-				SenderID:       int(senderID),
-				ReceiverID:     int(receiverID),
-				MessageContent: msg.Message,
-				SentAt:         outgoingMsg.SentAt,
-				SenderUsername: outgoingMsg.SenderUsername,
-			}
+// sendToUser records the message in the user's session, writes it to every connection
+// of the user and returns the number of connections to this node that received it. The
+// other nodes of a cluster do the same for the user's connections to them.
+func (server *WebSocketServer) sendToUser(userID int64, message realtimeforum.Message) int {
+	delivered := server.sendToLocalUser(userID, message)
+	server.publish(clusterEvent{Kind: eventToUser, UserID: userID, Message: &message})
+	return delivered
+}
 
-			if err := server.ForumService.SaveChatMessage(chat); err != nil {
-				log.Printf("Error saving chat message: %v", err)
-			}
+// sendToLocalUser is sendToUser for the connections to this node only.
+func (server *WebSocketServer) sendToLocalUser(userID int64, message realtimeforum.Message) int {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
 
-			if err := server.ForumService.UpdateUserLastActivity(server.DB, senderID); err != nil {
-				log.Printf("Failed to update last activity for user %d: %v", senderID, err)
-			}
+	if s, ok := server.sessions[userID]; ok {
+		message = s.record(message, server.EventLogSize)
+	}
+
+	delivered := 0
+	for conn, id := range server.clients {
+		if id != userID {
+			continue
+		}
+		if err := server.send(conn, message); err != nil {
+			slog.Warn("Error sending message to user", "user_id", userID, "err", err)
+			conn.Close()
+			delete(server.clients, conn)
+			continue
 		}
+		delivered++
 	}
+	return delivered
+}
 
-	log.Printf("Finished processing private message from %d to %d", senderID, receiverID)
+// writeJSON sends a reply to a single connection, and closes it if the reply cannot be sent.
+func (server *WebSocketServer) writeJSON(conn connection, v interface{}) {
+	if err := server.send(conn, v); err != nil {
+		slog.Warn("Error writing to client", "err", err)
+		conn.Close()
+	}
+}
+
+// markDelivered records that a stored message reached at least one recipient.
+func (server *WebSocketServer) markDelivered(chat *realtimeforum.Chats) {
+	deliveredAt := time.Now().UTC()
+	if err := server.ForumService.MarkChatMessageDelivered(int64(chat.MessageID), deliveredAt); err != nil {
+		slog.Error("Failed to mark message as delivered", "message_id", chat.MessageID, "err", err)
+		return
+	}
+	chat.DeliveredAt = &deliveredAt
+}
+
+// newAck builds the "ack" frame telling the sender that a message was stored or delivered.
+func newAck(chat realtimeforum.Chats) realtimeforum.Message {
+	status := realtimeforum.MessageStatusStored
+	if chat.DeliveredAt != nil {
+		status = realtimeforum.MessageStatusDelivered
+	}
+	return realtimeforum.Message{
+		Type:            "ack",
+		MessageID:       int64(chat.MessageID),
+		ClientMessageID: chat.ClientMessageID,
+		Status:          status,
+		SentAt:          chat.SentAt,
+	}
 }
 
 // Helper function to determine if a user is currently marked online
@@ -0,0 +1,413 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"livechat-system/backend/metrics"
+	realtimeforum "livechat-system/backend/models"
+	"livechat-system/backend/ratelimit"
+	service "livechat-system/backend/services"
+	"livechat-system/backend/storage/memstore"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "test-secret"
+
+// testHub is a hub on an empty in-memory store, served over HTTP until the test ends.
+type testHub struct {
+	server *WebSocketServer
+	store  *memstore.Store
+	srv    *httptest.Server
+}
+
+// newTestHub starts a hub without rate limits; tests that need them set them before connecting.
+func newTestHub(t *testing.T) *testHub {
+	t.Helper()
+	store := memstore.New()
+	server := NewWebSocketServer(service.NewForumService(store), testSecret)
+	srv := httptest.NewServer(http.HandlerFunc(server.HandleConnections))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("shutting down the hub: %v", err)
+		}
+	})
+	return &testHub{server: server, store: store, srv: srv}
+}
+
+// createUser stores a user named name and returns their ID.
+func (h *testHub) createUser(t *testing.T, name string) int64 {
+	t.Helper()
+	userID, err := h.store.CreateUser(realtimeforum.User{Username: name, Email: name + "@example.com", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+// token returns a token of userID signed with the secret of the hub.
+func token(t *testing.T, userID int64) string {
+	t.Helper()
+	claims := CustomClaims{
+		UserID:         int(userID),
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// testClient is a WebSocket connection of a user to the hub.
+type testClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// connect opens a connection as userID, resuming from lastSeq unless it is negative.
+func (h *testHub) connect(t *testing.T, userID int64, lastSeq int64) *testClient {
+	t.Helper()
+	query := url.Values{"token": {token(t, userID)}}
+	if lastSeq >= 0 {
+		query.Set("lastSeq", strconv.FormatInt(lastSeq, 10))
+	}
+	wsURL := "ws" + strings.TrimPrefix(h.srv.URL, "http") + "/?" + query.Encode()
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("connecting user %d: %v", userID, err)
+	}
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn}
+}
+
+// join connects userID and reads the frames up to the announcement of their own presence,
+// which every connected user is sent, them included.
+func (h *testHub) join(t *testing.T, userID int64) *testClient {
+	t.Helper()
+	c := h.connect(t, userID, -1)
+	c.readUntil(statusChange(userID, true))
+	return c
+}
+
+// send writes a frame.
+func (c *testClient) send(msg realtimeforum.Message) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("sending a %s frame: %v", msg.Type, err)
+	}
+}
+
+// frame is a frame read from the hub: a realtimeforum.Message, or an error reply.
+type frame struct {
+	realtimeforum.Message
+	Error string `json:"error"`
+}
+
+// read returns the next frame, failing the test if none comes within a few seconds.
+func (c *testClient) read() frame {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var f frame
+	if err := c.conn.ReadJSON(&f); err != nil {
+		c.t.Fatalf("reading a frame: %v", err)
+	}
+	return f
+}
+
+// readUntil returns the frames read up to and including the first one that matches.
+func (c *testClient) readUntil(match func(frame) bool) []frame {
+	c.t.Helper()
+	var frames []frame
+	for {
+		f := c.read()
+		frames = append(frames, f)
+		if match(f) {
+			return frames
+		}
+	}
+}
+
+func ofType(frameType string) func(frame) bool {
+	return func(f frame) bool { return f.Type == frameType }
+}
+
+// statusChange matches the "userStatusChange" frame telling that userID came online or went offline.
+func statusChange(userID int64, online bool) func(frame) bool {
+	return func(f frame) bool {
+		return f.Type == "userStatusChange" && len(f.OnlineUsers) == 1 &&
+			f.OnlineUsers[0].UserID == userID && f.OnlineUsers[0].IsOnline == online
+	}
+}
+
+func onlineIDs(users []realtimeforum.UserStatus) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, user := range users {
+		ids[user.UserID] = user.IsOnline
+	}
+	return ids
+}
+
+func TestConnect(t *testing.T) {
+	h := newTestHub(t)
+	aliceID, bobID := h.createUser(t, "alice"), h.createUser(t, "bob")
+
+	alice := h.connect(t, aliceID, -1)
+	snapshot := alice.read()
+	if snapshot.Type != "onlineUsers" || len(snapshot.OnlineUsers) != 1 || !onlineIDs(snapshot.OnlineUsers)[aliceID] {
+		t.Fatalf("first frame of alice: got %+v, want the presence snapshot with only alice", snapshot)
+	}
+
+	bob := h.connect(t, bobID, -1)
+	snapshot = bob.read()
+	if online := onlineIDs(snapshot.OnlineUsers); snapshot.Type != "onlineUsers" || !online[aliceID] || !online[bobID] {
+		t.Fatalf("first frame of bob: got %+v, want the presence snapshot with alice and bob", snapshot)
+	}
+	alice.readUntil(statusChange(bobID, true))
+
+	bob.conn.Close()
+	alice.readUntil(statusChange(bobID, false))
+
+	// A connection without a valid token is refused before the upgrade
+	wsURL := "ws" + strings.TrimPrefix(h.srv.URL, "http") + "/?token=" + token(t, aliceID) + "x"
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("connecting with a forged token: got %v, %v, want %d", resp, err, http.StatusUnauthorized)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	h := newTestHub(t)
+	aliceID, bobID := h.createUser(t, "alice"), h.createUser(t, "bob")
+	alice, bob := h.join(t, aliceID), h.join(t, bobID)
+	alice.readUntil(statusChange(bobID, true))
+
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: "hello", ClientMessageID: "m1"})
+	ack := alice.read()
+	if ack.Type != "ack" || ack.ClientMessageID != "m1" || ack.MessageID == 0 || ack.Status != realtimeforum.MessageStatusDelivered {
+		t.Errorf("reply to the broadcast: got %+v, want a delivered ack of m1", ack)
+	}
+	received := bob.readUntil(ofType("broadcast"))
+	message := received[len(received)-1]
+	if message.Message.Message != "hello" || message.SenderID != aliceID || message.SenderUsername != "alice" || message.MessageID != ack.MessageID {
+		t.Errorf("broadcast received by bob: got %+v, want hello from alice", message)
+	}
+
+	// A retry with the same client message ID is acknowledged again but not re-sent
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: "hello", ClientMessageID: "m1"})
+	if retried := alice.read(); retried.Type != "ack" || retried.MessageID != ack.MessageID {
+		t.Errorf("reply to the retry: got %+v, want the ack of message %d", retried, ack.MessageID)
+	}
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: "again", ClientMessageID: "m2"})
+	alice.read()
+	if next := bob.read(); next.Type != "broadcast" || next.Message.Message != "again" {
+		t.Errorf("next frame of bob after the retry: got %+v, want the broadcast of m2", next)
+	}
+
+	// Messages over the length limit are refused before they are rendered, and larger frames
+	// close the connection before they are read
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: strings.Repeat("a", 4001), ClientMessageID: "m3"})
+	if reply := alice.read(); reply.Error != service.ErrMessageTooLong.Error() {
+		t.Errorf("reply to a too long message: got %+v, want %q", reply, service.ErrMessageTooLong)
+	}
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: strings.Repeat("a", maxFrameSize), ClientMessageID: "m4"})
+	alice.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := alice.conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("after a frame over the size limit: got %v, want a message too big close", err)
+	}
+}
+
+// TestSlowClient checks that a client that stops reading holds up nobody else: once its queue is
+// full its frames are dropped and counted, and it is disconnected.
+func TestSlowClient(t *testing.T) {
+	h := newTestHub(t)
+	registry := metrics.NewRegistry()
+	h.server.RegisterMetrics(registry)
+	aliceID, bobID, carolID := h.createUser(t, "alice"), h.createUser(t, "bob"), h.createUser(t, "carol")
+	alice, bob := h.join(t, aliceID), h.join(t, bobID)
+	h.connect(t, carolID, -1) // Never reads
+
+	connected := func(userID int64) bool {
+		h.server.clientsMutex.Lock()
+		defer h.server.clientsMutex.Unlock()
+		for _, id := range h.server.clients {
+			if id == userID {
+				return true
+			}
+		}
+		return false
+	}
+	content := strings.Repeat("a", 4000)
+	for i := 0; connected(carolID); i++ {
+		if i == 10000 {
+			t.Fatalf("carol is still connected after %d broadcasts she did not read", i)
+		}
+		alice.send(realtimeforum.Message{Type: "broadcast", Message: content, ClientMessageID: strconv.Itoa(i)})
+		alice.readUntil(ofType("ack"))
+		bob.readUntil(ofType("broadcast"))
+	}
+
+	exposition := httptest.NewRecorder()
+	registry.Handler()(exposition, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(exposition.Body.String(), `livechat_websocket_send_buffer_drops_total{type="broadcast"} `) {
+		t.Errorf("metrics after dropping frames for carol:\n%s", exposition.Body)
+	}
+}
+
+func TestResume(t *testing.T) {
+	h := newTestHub(t)
+	aliceID, bobID := h.createUser(t, "alice"), h.createUser(t, "bob")
+
+	alice := h.connect(t, aliceID, -1)
+	lastSeq := alice.read().Seq
+	alice.conn.Close()
+
+	// What happens while alice is away is kept in her session
+	bob := h.join(t, bobID)
+	bob.send(realtimeforum.Message{Type: "broadcast", Message: "while you were away", ClientMessageID: "m1"})
+	bob.readUntil(ofType("ack"))
+
+	alice = h.connect(t, aliceID, lastSeq)
+	replayed := alice.readUntil(ofType("onlineUsers"))
+	snapshot := replayed[len(replayed)-1]
+	var missed *frame
+	for i, f := range replayed[:len(replayed)-1] {
+		if f.Seq <= lastSeq {
+			t.Errorf("replayed frame %+v is not after seq %d", f, lastSeq)
+		}
+		if f.Type == "broadcast" {
+			missed = &replayed[i]
+		}
+	}
+	if missed == nil || missed.Message.Message != "while you were away" {
+		t.Fatalf("frames replayed to alice: got %+v, want the broadcast of bob", replayed)
+	}
+	if snapshot.Seq < missed.Seq {
+		t.Errorf("seq of the snapshot after the replay: got %d, want at least %d", snapshot.Seq, missed.Seq)
+	}
+	alice.conn.Close()
+
+	// A sequence number the hub never gave out cannot be resumed from
+	alice = h.connect(t, aliceID, snapshot.Seq+100)
+	if resync := alice.read(); resync.Type != "resync" || resync.Seq < snapshot.Seq {
+		t.Errorf("first frame resuming from an unknown seq: got %+v, want a resync at seq %d or later", resync, snapshot.Seq)
+	}
+}
+
+func TestResumeGap(t *testing.T) {
+	h := newTestHub(t)
+	h.server.EventLogSize = 2
+	aliceID, bobID := h.createUser(t, "alice"), h.createUser(t, "bob")
+
+	alice := h.connect(t, aliceID, -1)
+	lastSeq := alice.read().Seq
+	alice.conn.Close()
+
+	bob := h.join(t, bobID)
+	for i := 1; i <= 3; i++ {
+		bob.send(realtimeforum.Message{Type: "broadcast", Message: "message", ClientMessageID: strconv.Itoa(i)})
+		bob.readUntil(ofType("ack"))
+	}
+
+	// The log no longer holds the first events alice missed
+	alice = h.connect(t, aliceID, lastSeq)
+	if resync := alice.read(); resync.Type != "resync" || resync.Seq <= lastSeq {
+		t.Errorf("first frame resuming past the log: got %+v, want a resync after seq %d", resync, lastSeq)
+	}
+}
+
+// TestUnknownFrameIgnored checks that a frame of a type the hub does not handle gets an error
+// reply and is not relayed to the other users.
+func TestUnknownFrameIgnored(t *testing.T) {
+	h := newTestHub(t)
+	aliceID, bobID := h.createUser(t, "alice"), h.createUser(t, "bob")
+	alice, bob := h.join(t, aliceID), h.join(t, bobID)
+	alice.readUntil(statusChange(bobID, true))
+
+	alice.send(realtimeforum.Message{Type: "noSuchType", ReceiverID: bobID})
+	if reply := alice.read(); reply.Error != "Unhandled message type" {
+		t.Errorf("reply to a frame of an unknown type: got %+v, want an unhandled message type error", reply)
+	}
+
+	// The next frame bob gets is the private message sent after it
+	alice.send(realtimeforum.Message{Type: "private", ReceiverID: bobID, Message: "hi", ClientMessageID: "m1"})
+	alice.readUntil(ofType("ack"))
+	if next := bob.read(); next.Type != "private" || next.Message.Message != "hi" {
+		t.Errorf("next frame of bob: got %+v, want the private message", next)
+	}
+}
+
+func TestRateLimitClose(t *testing.T) {
+	h := newTestHub(t)
+	h.server.RateLimits = ratelimit.NewGroup(map[string]ratelimit.Policy{"broadcast": {Rate: 0.001, Burst: 1}})
+	h.server.Offenders = ratelimit.NewOffenders(2, time.Minute)
+	aliceID := h.createUser(t, "alice")
+	alice := h.join(t, aliceID)
+
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: "1", ClientMessageID: "m1"})
+	if ack := alice.read(); ack.Type != "ack" {
+		t.Fatalf("reply to the first broadcast: got %+v, want an ack", ack)
+	}
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: "2", ClientMessageID: "m2"})
+	if limited := alice.read(); limited.Type != "rateLimited" || limited.ClientMessageID != "m2" {
+		t.Fatalf("reply to the second broadcast: got %+v, want rateLimited for m2", limited)
+	}
+
+	// Frames of other types are not limited by the broadcast policy
+	alice.send(realtimeforum.Message{Type: "onlineUsers"})
+	if snapshot := alice.read(); snapshot.Type != "onlineUsers" {
+		t.Fatalf("reply to an onlineUsers frame: got %+v, want the presence snapshot", snapshot)
+	}
+
+	alice.send(realtimeforum.Message{Type: "broadcast", Message: "3", ClientMessageID: "m3"})
+	alice.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := alice.conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("after a second violation: got %v, want a policy violation close", err)
+	}
+}
+
+// TestCheck checks that the health check fails within its deadline while the connection lock is
+// held, recovers once it is released, and fails once shutdown has started.
+func TestCheck(t *testing.T) {
+	h := newTestHub(t)
+	if err := h.server.Check(context.Background()); err != nil {
+		t.Fatalf("checking an idle hub: %v", err)
+	}
+
+	h.server.clientsMutex.Lock()
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := h.server.Check(ctx)
+		cancel()
+		if !errors.Is(err, ErrHubStalled) {
+			t.Errorf("checking a stalled hub: got %v, want %v", err, ErrHubStalled)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("checking a stalled hub took %v", elapsed)
+		}
+	}
+	h.server.clientsMutex.Unlock()
+
+	if err := h.server.Check(context.Background()); err != nil {
+		t.Errorf("checking the hub once the lock is released: %v", err)
+	}
+
+	h.server.CloseConnections()
+	if err := h.server.Check(context.Background()); !errors.Is(err, errShuttingDown) {
+		t.Errorf("checking the hub during shutdown: got %v, want %v", err, errShuttingDown)
+	}
+}
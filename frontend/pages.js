@@ -6,8 +6,15 @@ const postContainer = document.createElement('div')
 postContainer.setAttribute('id', 'postcontainer')
 
 let ws; // Declare ws at a higher scope
+// Transport of the real-time connection. WebSocket is tried first; behind proxies that block the
+// upgrade we fall back to Server-Sent Events, then to long-polling, and send frames with POST.
+let transport = 'websocket'; // 'websocket', 'sse' or 'poll'
+let eventSource = null;
+let pollCursor = null; // Identifies our long-polling connection once the first poll answered
 let chatUIReady = false;
 let messageQueue = [];
+let pendingMessages = new Map(); // Outgoing messages waiting for an ack, keyed by clientMessageId
+let lastSeq = null; // Highest event sequence number received, sent back on reconnect to replay missed events
 let isConnecting = false;
 let reconnectAttempts = 0;
 const MAX_RECONNECT_ATTEMPTS = 5;
@@ -61,44 +68,7 @@ function displayPostData(postData) {
   postContainer.innerHTML = ''
     // Looping through each post in the postData array
     postData.forEach(post => {
-        // Creating a div for each post
-        const singlePost = document.createElement('div')
-        // Setting the class of the div to singlepost
-        singlePost.setAttribute('class', 'singlepost')
-
-        // Creating a new div for the title of the post
-        const titleElement = document.createElement("h2");
-        // Setting the text content of the title div to the post title
-        titleElement.textContent = `${post.post_title}`
-
-        // Creating a new div for the author of the post
-        const authorElement = document.createElement("p");
-        // Setting the text content of the author div to the post author
-        authorElement.textContent = `By ${post.user_id}`
-
-        // Creating a new div for the content of the post
-        const contentElement = document.createElement("p");
-        // Setting the text content of the content div to the post content
-        contentElement.textContent = `${post.post_content}`
-
-        // Creating a new div for the date of post creation
-        const createdAtElement = document.createElement("p");
-        // Setting the text content of the created at div to the post creation date
-        contentElement.textContent = `${formatDate(post.created_at)}`
-
-        // Creating a new div for the comments of the post
-        const commentsElement = document.createElement("p");
-        // Setting the content of the post comments div
-        commentsElement.textContent = 'post comments'
-
-        // Appending the elements to the single post div
-        singlePost.appendChild(titleElement)
-        singlePost.appendChild(authorElement)
-        singlePost.appendChild(contentElement)
-        singlePost.appendChild(createdAtElement)
-        singlePost.appendChild(commentsElement)
-
-        postContainer.appendChild(singlePost)
+        postContainer.appendChild(createPostElement(post))
     })
 
    
@@ -108,8 +78,214 @@ function displayPostData(postData) {
  
 }
 
+// Builds the element showing one post
+function createPostElement(post) {
+    // Creating a div for each post
+    const singlePost = document.createElement('div')
+    // Setting the class of the div to singlepost
+    singlePost.setAttribute('class', 'singlepost')
+    // Lets "postEdited" and "postDeleted" frames find the post
+    singlePost.dataset.postId = post.post_id
+
+    // Creating a new div for the title of the post
+    const titleElement = document.createElement("h2");
+    // Setting the text content of the title div to the post title
+    titleElement.textContent = `${post.post_title}`
+    if (post.edited_at) {
+        titleElement.textContent += ' (edited)'
+    }
+
+    // Creating a new div for the author of the post
+    const authorElement = document.createElement("p");
+    // Setting the text content of the author div to the post author
+    authorElement.textContent = `By ${post.author_username || post.user_id}`
+
+    // Creating a new div for the content of the post
+    const contentElement = document.createElement("div");
+    // Using the HTML the server rendered from the post's Markdown, which is safe to insert;
+    // summaries of feed frames only carry a plain excerpt
+    if (post.post_content_html) {
+        contentElement.innerHTML = post.post_content_html
+    } else {
+        contentElement.textContent = `${post.post_content}`
+    }
+
+    // Creating a new div for the date of post creation
+    const createdAtElement = document.createElement("p");
+    // Setting the text content of the created at div to the post creation date
+    contentElement.textContent = `${formatDate(post.created_at)}`
+
+    // Creating a new div for the comments of the post
+    const commentsElement = document.createElement("p");
+    // Setting the content of the post comments div
+    commentsElement.textContent = 'post comments'
+
+    // Appending the elements to the single post div
+    singlePost.appendChild(titleElement)
+    singlePost.appendChild(authorElement)
+    singlePost.appendChild(contentElement)
+    if (post.attachments) {
+        singlePost.appendChild(createAttachmentsElement(post.attachments))
+    }
+    if (post.poll) {
+        singlePost.appendChild(createPollElement(post.post_id, post.poll))
+    }
+    singlePost.appendChild(createFollowButton('Bookmark', '/bookmarks', {post_id: post.post_id}))
+    singlePost.appendChild(createFollowButton('Watch', '/watches', {kind: 'post', target_id: post.post_id}))
+    singlePost.appendChild(createdAtElement)
+    singlePost.appendChild(commentsElement)
+    return singlePost
+}
+
+// Lists the files attached to a post or chat message: thumbnails for images, links for other
+// files. Attachments are only served with the Authorization header, so they are fetched here and
+// shown through object URLs.
+function createAttachmentsElement(attachments) {
+    const list = document.createElement('div');
+    list.className = 'attachments';
+    for (const attachment of attachments) {
+        const url = `http://localhost:8080/attachment?attachmentId=${attachment.attachment_id}`;
+        const link = document.createElement('a');
+        link.textContent = attachment.filename;
+        link.download = attachment.filename;
+        fetchAttachment(url).then(objectURL => { link.href = objectURL; }).catch(console.error);
+        if (attachment.has_thumbnail) {
+            const img = document.createElement('img');
+            img.alt = attachment.filename;
+            img.width = Math.min(attachment.width, 256);
+            fetchAttachment(`${url}&size=thumbnail`).then(objectURL => { img.src = objectURL; }).catch(console.error);
+            link.textContent = '';
+            link.appendChild(img);
+        }
+        list.appendChild(link);
+    }
+    return list;
+}
+
+async function fetchAttachment(url) {
+    const response = await fetch(url, {
+        headers: {'Authorization': `Bearer ${localStorage.getItem('token')}`}
+    });
+    if (!response.ok) {
+        throw new Error(`Failed to fetch attachment: ${response.status}`);
+    }
+    return URL.createObjectURL(await response.blob());
+}
+
+// Shows a post pushed by the server in a "newPost" frame on top of the forum page, if it is open
+function displayNewPost(summary) {
+    if (!postContainer.isConnected) {
+        return; // The posts are fetched again when the forum page opens
+    }
+    const post = { ...summary, post_content: summary.excerpt };
+    postContainer.prepend(createPostElement(post));
+}
 
+// Replaces a post shown on the forum page with the new version of a "postEdited" frame
+function displayPostEdited(summary) {
+    const existing = postContainer.querySelector(`[data-post-id="${summary.post_id}"]`);
+    if (existing) {
+        existing.replaceWith(createPostElement({ ...summary, post_content: summary.excerpt }));
+    }
+}
 
+// Shows the poll of a post: its options with their votes, and a button to vote for each of them
+// until the user voted or the poll closed. Only single choice votes are cast from here.
+function createPollElement(postID, poll) {
+    const list = document.createElement('ul');
+    list.className = 'poll';
+    list.dataset.pollId = postID;
+    const canVote = !poll.closed && !(poll.my_votes && poll.my_votes.length);
+    for (const option of poll.options) {
+        const item = document.createElement('li');
+        item.dataset.optionId = option.option_id;
+        const label = document.createElement('span');
+        label.textContent = option.text;
+        const votes = document.createElement('span');
+        votes.className = 'poll-votes';
+        votes.textContent = ` ${option.votes}`;
+        item.appendChild(label);
+        item.appendChild(votes);
+        if (canVote) {
+            const button = document.createElement('button');
+            button.textContent = 'Vote';
+            button.addEventListener('click', () => vote(postID, option.option_id));
+            item.appendChild(button);
+        }
+        list.appendChild(item);
+    }
+    if (poll.closed) {
+        const closed = document.createElement('li');
+        closed.textContent = 'Closed';
+        list.appendChild(closed);
+    }
+    return list;
+}
+
+async function vote(postID, optionID) {
+    const response = await fetch(`http://localhost:8080/poll?postId=${postID}`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${localStorage.getItem('token')}`
+        },
+        body: JSON.stringify({option_ids: [optionID]})
+    });
+    if (!response.ok) {
+        console.error('Failed to vote:', await response.text());
+        return;
+    }
+    const poll = await response.json();
+    const existing = postContainer.querySelector(`[data-poll-id="${postID}"]`);
+    if (existing) {
+        existing.replaceWith(createPollElement(postID, poll));
+    }
+}
+
+// Creates a button that bookmarks or watches a post by posting body to path, and says so once done
+function createFollowButton(label, path, body) {
+    const button = document.createElement('button');
+    button.textContent = label;
+    button.addEventListener('click', async () => {
+        const response = await fetch(`http://localhost:8080${path}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${localStorage.getItem('token')}`
+            },
+            body: JSON.stringify(body)
+        });
+        if (!response.ok) {
+            console.error(`Failed to ${label.toLowerCase()} post:`, await response.text());
+            return;
+        }
+        button.textContent = `${label}ed`;
+        button.disabled = true;
+    });
+    return button;
+}
+
+// Updates the votes of a poll shown on the forum page with the results of a "pollResults" frame
+function displayPollResults(post, poll) {
+    const existing = postContainer.querySelector(`[data-poll-id="${post.post_id}"]`);
+    if (!existing) {
+        return;
+    }
+    for (const option of poll.options) {
+        const votes = existing.querySelector(`[data-option-id="${option.option_id}"] .poll-votes`);
+        if (votes) {
+            votes.textContent = ` ${option.votes}`;
+        }
+    }
+}
+
+// Removes a post of a "postDeleted" frame from the forum page
+function displayPostDeleted(summary) {
+    const existing = postContainer.querySelector(`[data-post-id="${summary.post_id}"]`);
+    if (existing) {
+        existing.remove();
+    }
+}
 
 async function createProfileContent() {
     try{
@@ -180,6 +356,21 @@ function closeWebSocket() {
         ws.close();
         ws = null;
     }
+    if (eventSource) {
+        eventSource.close();
+        eventSource = null;
+    }
+    if (pollCursor) {
+        // Tell the server now, instead of letting it notice we stopped polling
+        const token = localStorage.getItem('token');
+        fetch(`http://localhost:8080/events/poll?cursor=${pollCursor}`, {
+            method: 'DELETE',
+            headers: { 'Authorization': `Bearer ${token}` }
+        }).catch(error => console.error('Error closing long-polling connection:', error));
+        pollCursor = null;
+    }
+    transport = 'websocket';
+    lastSeq = null;
 }
 
 // Call this function when logging out or navigating away from chat
@@ -294,7 +485,8 @@ function sendMessage() {
         message: message,
         receiverId: currentChatUserId ? parseInt(currentChatUserId) : null, // Use user ID for directing the message
         senderUsername: localStorage.getItem('username'),
-        senderId: parseInt(senderId) // Ensure senderId is included and correctly formatted as an integer
+        senderId: parseInt(senderId), // Ensure senderId is included and correctly formatted as an integer
+        clientMessageId: crypto.randomUUID() // Lets the server de-duplicate the message if we resend it
     };
 
 
@@ -302,9 +494,14 @@ function sendMessage() {
     displayOutgoingMessage(payload);  // Display the message immediately in the UI
 
 
+  // Keep the message until the server acks it so it can be resent after a reconnect
+  pendingMessages.set(payload.clientMessageId, payload);
+
   // Try sending the message and catch any errors
   try {
-    ws.send(JSON.stringify(payload));
+    if (isConnected()) {
+        sendFrame(payload);
+    }
 } catch (error) {
     console.error('Error sending message:', error);
 }
@@ -346,6 +543,10 @@ function initializeWebSocket() {
         console.log("WebSocket connection already exists");
         return;
     }
+    if (eventSource || pollCursor) {
+        console.log("Fallback connection already exists");
+        return;
+    }
 
     if (isConnecting) {
         console.log("WebSocket connection is already being established");
@@ -362,57 +563,41 @@ function initializeWebSocket() {
         return;
     }
 
-    ws = new WebSocket(`ws://localhost:8080/ws?token=${token}`);
+    // When reconnecting, ask the server to replay everything after the last event we saw
+    const resumeParam = lastSeq !== null ? `&lastSeq=${lastSeq}` : '';
+    if (transport !== 'websocket') {
+        initializeFallback(token, resumeParam);
+        return;
+    }
+    ws = new WebSocket(`ws://localhost:8080/ws?token=${token}${resumeParam}`);
+    let opened = false;
 
     ws.onopen = () => {
         console.log('WebSocket connection established');
-        isConnecting = false;
-        reconnectAttempts = 0;
-        requestOnlineUsersList();
-
-        // Set a flag to indicate this is the initial login
-        initialLoginComplete = true;
-
-        // Schedule a delayed request for online users
-        setTimeout(() => {
-            if (chatUIReady) {
-                console.log("Sending delayed request for online users");
-                requestOnlineUsersList();
-            }
-        }, 6000); // Delay of 3 seconds
+        opened = true;
+        handleConnectionOpen();
     };
 
     ws.onmessage = (event) => {
         console.log("WebSocket message received:", event.data);
         try {
-            const message = JSON.parse(event.data);
-            if (chatUIReady) {
-                displayIncomingMessage(message);
-            } else {
-                console.log("Chat UI not ready, queueing message:", message);
-                queueMessage(message);
-            }
+            handleServerFrame(JSON.parse(event.data));
         } catch (error) {
             console.error('Error parsing message JSON:', error);
         }
     };
 
     ws.onclose = (event) => {
-        if (event.code === 1001) {
-            console.log('WebSocket closed due to page navigation');
-        } else {
-            console.error('WebSocket closed unexpectedly:', event.code, event.reason);
-            if (reconnectAttempts < MAX_RECONNECT_ATTEMPTS) {
-                setTimeout(() => {
-                    reconnectAttempts++;
-                    console.log(`Attempting to reconnect (${reconnectAttempts}/${MAX_RECONNECT_ATTEMPTS})`);
-                    initializeWebSocket();
-                }, 5000 * reconnectAttempts); // Exponential backoff
-            } else {
-                console.error('Max reconnection attempts reached. Please refresh the page.');
-            }
+        if (!opened && event.code === 1006) {
+            // The upgrade never went through, which is what proxies blocking WebSocket do
+            console.warn('WebSocket unavailable, falling back to Server-Sent Events');
+            ws = null;
+            transport = 'sse';
+            isConnecting = false;
+            initializeWebSocket();
+            return;
         }
-        isConnecting = false;
+        handleConnectionClose(event.code, event.reason);
     };
 
     ws.onerror = (error) => {
@@ -421,7 +606,245 @@ function initializeWebSocket() {
     };
 }
 
+// Opens the connection over Server-Sent Events or, when those fail too, long-polling.
+function initializeFallback(token, resumeParam) {
+    if (transport === 'sse') {
+        let opened = false;
+        eventSource = new EventSource(`http://localhost:8080/events?token=${token}${resumeParam}`);
+        eventSource.onopen = () => {
+            console.log('Event stream established');
+            opened = true;
+            handleConnectionOpen();
+        };
+        eventSource.onmessage = (event) => {
+            try {
+                handleServerFrame(JSON.parse(event.data));
+            } catch (error) {
+                console.error('Error parsing message JSON:', error);
+            }
+        };
+        eventSource.addEventListener('close', (event) => {
+            const notice = JSON.parse(event.data);
+            eventSource.close();
+            eventSource = null;
+            handleConnectionClose(notice.code, notice.reason);
+        });
+        eventSource.onerror = () => {
+            // EventSource reconnects by itself, resuming with Last-Event-ID, once it has been open
+            if (!opened) {
+                console.warn('Event stream unavailable, falling back to long-polling');
+                eventSource.close();
+                eventSource = null;
+                transport = 'poll';
+                isConnecting = false;
+                initializeWebSocket();
+            }
+        };
+        return;
+    }
+    pollEvents(token, resumeParam);
+}
+
+// Polls for frames until the connection closes. Each poll waits on the server until frames arrive,
+// and acknowledges those of the previous one: the server sends them again until it does.
+async function pollEvents(token, resumeParam) {
+    let lastSeq = 0;
+    while (transport === 'poll' && localStorage.getItem('token') === token) {
+        const query = pollCursor ? `token=${token}&cursor=${pollCursor}&lastSeq=${lastSeq}` : `token=${token}${resumeParam}`;
+        let body;
+        try {
+            const response = await fetch(`http://localhost:8080/events/poll?${query}`);
+            if (!response.ok) {
+                throw new Error(`poll answered ${response.status}`);
+            }
+            body = await response.json();
+        } catch (error) {
+            console.error('Long-polling failed:', error);
+            pollCursor = null;
+            handleConnectionClose(1006, error.message);
+            return;
+        }
+        if (transport !== 'poll') {
+            return; // Logged out while the poll was waiting
+        }
+        if (pollCursor === null) {
+            console.log('Long-polling connection established');
+            pollCursor = body.cursor;
+            handleConnectionOpen();
+        }
+        body.frames.forEach(handleServerFrame);
+        lastSeq = body.seq;
+        if (body.close) {
+            pollCursor = null;
+            handleConnectionClose(body.close.code, body.close.reason);
+            return;
+        }
+    }
+}
+
+function isConnected() {
+    if (transport === 'websocket') {
+        return ws && ws.readyState === WebSocket.OPEN;
+    }
+    if (transport === 'sse') {
+        return eventSource !== null && eventSource.readyState === EventSource.OPEN;
+    }
+    return pollCursor !== null;
+}
+
+// Sends a frame over the WebSocket, or with POST when on a fallback transport. The replies to a
+// POST, such as acks, are handled like the frames received from the connection.
+function sendFrame(payload) {
+    if (transport === 'websocket') {
+        ws.send(JSON.stringify(payload));
+        return;
+    }
+    fetch('http://localhost:8080/events/send', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${localStorage.getItem('token')}`
+        },
+        body: JSON.stringify(payload)
+    })
+        .then(response => response.json())
+        .then(replies => replies.forEach(handleServerFrame))
+        .catch(error => console.error('Error sending frame:', error));
+}
+
+function handleConnectionOpen() {
+    isConnecting = false;
+    reconnectAttempts = 0;
+    requestOnlineUsersList();
+    resendPendingMessages();
+    sendFrame({ type: 'subscribe' }); // New posts of every category, shown live on the forum page
 
+    // Set a flag to indicate this is the initial login
+    initialLoginComplete = true;
+
+    // Schedule a delayed request for online users
+    setTimeout(() => {
+        if (chatUIReady) {
+            console.log("Sending delayed request for online users");
+            requestOnlineUsersList();
+        }
+    }, 6000); // Delay of 3 seconds
+}
+
+function handleServerFrame(message) {
+    if (message.seq && (lastSeq === null || message.seq > lastSeq)) {
+        lastSeq = message.seq;
+    } else if (message.type === 'onlineUsers' && lastSeq === null) {
+        lastSeq = 0; // The snapshot is our starting point even before any event arrives
+    }
+    if (message.type === 'ack') {
+        handleAck(message);
+        return;
+    }
+    if (message.type === 'resync') {
+        handleResync();
+        return;
+    }
+    if (message.type === 'rateLimited') {
+        handleRateLimited(message);
+        return;
+    }
+    if (message.type === 'newPost') {
+        displayNewPost(message.post);
+        return;
+    }
+    if (message.type === 'postEdited') {
+        displayPostEdited(message.post);
+        return;
+    }
+    if (message.type === 'postDeleted') {
+        displayPostDeleted(message.post);
+        return;
+    }
+    if (message.type === 'pollResults') {
+        displayPollResults(message.post, message.poll);
+        return;
+    }
+    if (message.type === 'subscriptions') {
+        return; // Confirms our subscribe frame, nothing to show
+    }
+    if (message.type === 'notification') {
+        displayNotification(message); // Also kept by the server, for GET /notifications
+        return;
+    }
+    if (chatUIReady) {
+        displayIncomingMessage(message);
+    } else {
+        console.log("Chat UI not ready, queueing message:", message);
+        queueMessage(message);
+    }
+}
+
+// Handles the end of the connection, with a WebSocket close code whatever the transport.
+function handleConnectionClose(code, reason) {
+    if (code === 1001) {
+        console.log('Connection closed due to page navigation');
+    } else if (code === 1012) {
+        // The server is restarting. Wait a moment, spread out so every client does not
+        // reconnect at once, and resume from the last event we saw.
+        console.log('Server restarting, reconnecting shortly');
+        reconnectAttempts = 0;
+        setTimeout(initializeWebSocket, 1000 + Math.random() * 4000);
+    } else {
+        console.error('Connection closed unexpectedly:', code, reason);
+        if (reconnectAttempts < MAX_RECONNECT_ATTEMPTS) {
+            setTimeout(() => {
+                reconnectAttempts++;
+                console.log(`Attempting to reconnect (${reconnectAttempts}/${MAX_RECONNECT_ATTEMPTS})`);
+                initializeWebSocket();
+            }, 5000 * reconnectAttempts); // Exponential backoff
+        } else {
+            console.error('Max reconnection attempts reached. Please refresh the page.');
+        }
+    }
+    isConnecting = false;
+}
+
+
+
+// Resends every message the server has not acked yet. The server ignores
+// duplicates with the same clientMessageId, so resending is always safe.
+function resendPendingMessages() {
+    pendingMessages.forEach(payload => {
+        console.log("Resending unacknowledged message:", payload.clientMessageId);
+        sendFrame(payload);
+    });
+}
+
+// The server could not replay everything we missed, so reload the state from scratch
+function handleResync() {
+    console.log("Server requested a full resync");
+    requestOnlineUsersList();
+    const currentChatUserId = sessionStorage.getItem('currentChatUserId');
+    if (currentChatUserId) {
+        loadAndDisplayChatHistory(currentChatUserId);
+    }
+}
+
+// The server dropped a frame because we sent too many. A message we are still waiting
+// an ack for is sent again once the server says we may.
+function handleRateLimited(message) {
+    console.warn(`Rate limited on ${message.frameType}, retry in ${message.retryAfter}s`);
+    const payload = pendingMessages.get(message.clientMessageId);
+    if (!payload) {
+        return;
+    }
+    setTimeout(() => {
+        if (pendingMessages.has(payload.clientMessageId) && isConnected()) {
+            sendFrame(payload);
+        }
+    }, message.retryAfter * 1000);
+}
+
+function handleAck(message) {
+    console.log(`Message ${message.clientMessageId} ${message.status} as ${message.messageId}`);
+    pendingMessages.delete(message.clientMessageId);
+}
 
 function queueMessage(message) {
     messageQueue.push(message);
@@ -502,11 +925,17 @@ function displayIncomingMessage(message) {
             case 'userStatusChange':
                 updateUserStatus(message.onlineUsers[0]);
                 break;
+            case 'edit':
+            case 'delete':
+            case 'reaction':
+                refreshChatIfOpen(message);
+                break;
             default:
                 console.warn('Unknown message type:', message.type);
                 return;
         }
-        if (message.type === 'broadcast' || message.type === 'private') {
+        // Messages from muted users are shown but never notify
+        if ((message.type === 'broadcast' || message.type === 'private') && !message.muted) {
             displayNotification(message);
         }
     } catch (error) {
@@ -538,10 +967,10 @@ function updateUserStatus(user) {
 }
 
 function requestOnlineUsersList() {
-    if (ws && ws.readyState === WebSocket.OPEN) {
-        ws.send(JSON.stringify({ type: "onlineUsers" }));
+    if (isConnected()) {
+        sendFrame({ type: "onlineUsers" });
     } else {
-        console.error("WebSocket is not open. Unable to request online users list.");
+        console.error("Connection is not open. Unable to request online users list.");
     }
 }
 // Function to initiate private chat and load chat history
@@ -561,6 +990,21 @@ function initiatePrivateChat(username, userId) {
     }
 }
 
+// Fills the content span of a chat message with the sender's name and the message. The HTML the
+// server rendered from the message's Markdown is safe to insert; messages without one, such as
+// the sender's own before the server has seen them, are shown as plain text.
+function fillMessageContent(span, username, text, html) {
+    span.textContent = `${username}: `;
+    if (html) {
+        const body = document.createElement('span');
+        body.className = 'message-body';
+        body.innerHTML = html;
+        span.appendChild(body);
+    } else {
+        span.appendChild(document.createTextNode(text));
+    }
+}
+
 function displayBroadcastMessage(message) {
     console.log(`Displaying broadcast message: ${message.senderUsername}: ${message.message}`);
     const messagesContainer = document.getElementById('messages-container');
@@ -569,8 +1013,11 @@ function displayBroadcastMessage(message) {
     
     const contentSpan = document.createElement('span');
     contentSpan.className = 'message-content';
-    contentSpan.textContent = `${message.senderUsername}: ${message.message}`;
+    fillMessageContent(contentSpan, message.senderUsername, message.message, message.messageHtml);
     messageElement.appendChild(contentSpan);
+    if (message.attachments) {
+        messageElement.appendChild(createAttachmentsElement(message.attachments));
+    }
 
     const timeSpan = document.createElement('span');
     timeSpan.className = 'message-time';
@@ -595,8 +1042,11 @@ function displayPrivateMessage(message) {
         
         const contentSpan = document.createElement('span');
         contentSpan.className = 'message-content';
-        contentSpan.textContent = `${message.senderUsername}: ${message.message}`;
+        fillMessageContent(contentSpan, message.senderUsername, message.message, message.messageHtml);
         messageDiv.appendChild(contentSpan);
+        if (message.attachments) {
+            messageDiv.appendChild(createAttachmentsElement(message.attachments));
+        }
 
         const timeSpan = document.createElement('span');
         timeSpan.className = 'message-time';
@@ -636,6 +1086,10 @@ function displayNotification(message) {
         notificationText = `New message from ${message.senderUsername}`;
     } else if (message.type === 'broadcast') {
         notificationText = `Broadcast message from ${message.senderUsername}`;
+    } else if (message.type === 'notification' && message.notification.kind === 'comment') {
+        notificationText = `${message.notification.actor_username} commented on "${message.notification.post_title}"`;
+    } else if (message.type === 'notification') {
+        notificationText = `${message.notification.actor_username} posted "${message.notification.post_title}"`;
     } else {
         // Default notification text for other types of messages
         notificationText = "You've received a new notification.";
@@ -709,7 +1163,10 @@ function loadAndDisplayChatHistory(userId) {
     const url = `http://localhost:8080/chat-history?senderId=${currentUserId}&receiverId=${userId}`;
 
     // Make an HTTP GET request to the server to fetch the chat history between the current user and the specified user.
-    fetch(url)
+    // The server only answers the current user, identified by their token.
+    fetch(url, {
+        headers: {'Authorization': `Bearer ${localStorage.getItem('token')}`}
+    })
         .then(response => {
             // Check if the HTTP response is successful (status code in the range 200-299).
             if (!response.ok) {
@@ -739,6 +1196,14 @@ function loadAndDisplayChatHistory(userId) {
 
 
 
+// Reloads the open conversation when one of its messages was edited or deleted.
+function refreshChatIfOpen(message) {
+    const currentChatUserId = parseInt(sessionStorage.getItem('currentChatUserId'));
+    if (currentChatUserId === message.senderId || currentChatUserId === message.receiverId) {
+        loadAndDisplayChatHistory(currentChatUserId);
+    }
+}
+
 // Helper function to update the UI with chat messages.
 function displayChatHistory(messages) {
     // Get a reference to the messages container in the DOM where chat messages are displayed.
@@ -757,9 +1222,22 @@ function displayChatHistory(messages) {
         const formattedDate = !isNaN(sentAt.getTime()) ? sentAt.toLocaleString() : 'Invalid Date';
 
         const senderUsername = message.senderUsername || 'Unknown';
-        const messageContent = message.message_content || 'No message content';
+        let messageContent = message.message_content || 'No message content';
+        let messageHtml = message.message_html;
+        let details = '';
+        if (message.deleted) {
+            messageContent = 'This message was deleted';
+            messageHtml = '';
+            messageDiv.classList.add('deleted');
+        } else if (message.edited_at) {
+            details += ' (edited)';
+        }
+        if (message.reactions) {
+            details += ' ' + message.reactions.map(r => `${r.emoji} ${r.count}`).join(' ');
+        }
 
-        messageDiv.textContent = `${senderUsername}: ${messageContent} (${formattedDate})`;
+        fillMessageContent(messageDiv, senderUsername, messageContent, messageHtml);
+        messageDiv.appendChild(document.createTextNode(`${details} (${formattedDate})`));
         messagesContainer.appendChild(messageDiv);
     });
 